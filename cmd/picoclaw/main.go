@@ -10,14 +10,18 @@ import (
 	"bufio"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,13 +35,19 @@ import (
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/devices"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/health"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/mcp"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/migrate"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/skills"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/state"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/voice"
+	"golang.org/x/term"
 )
 
 //go:generate cp -r ../../workspace .
@@ -142,6 +152,12 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "usage":
+		usageCmd()
+	case "jobs":
+		jobsCmd()
+	case "mcp":
+		mcpCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -156,6 +172,13 @@ func main() {
 			os.Exit(1)
 		}
 
+		egress, err := tools.NewEgressPolicy(cfg.Tools.Egress.AllowHosts, cfg.Tools.Egress.DenyHosts)
+		if err != nil {
+			fmt.Printf("Error in tools.egress config: %v\n", err)
+			os.Exit(1)
+		}
+		tools.SetDefaultEgressPolicy(egress)
+
 		workspace := cfg.WorkspacePath()
 		installer := skills.NewSkillInstaller(workspace)
 		// 获取全局配置目录和内置 skills 目录
@@ -211,6 +234,9 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  usage       Show token usage and spend per route and channel")
+	fmt.Println("  jobs        List, inspect and cancel agent jobs")
+	fmt.Println("  mcp         Serve picoclaw's tools and agent over MCP")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
@@ -665,6 +691,34 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	jobsHandler := agentLoop.JobsHandler()
+	healthServer.Handle("/jobs", jobsHandler)
+	healthServer.Handle("/jobs/", jobsHandler)
+	healthServer.Handle("/agents", agentLoop.AgentsHandler())
+	if ch, ok := channelManager.GetChannel("api"); ok {
+		if apiChannel, ok := ch.(*channels.APIChannel); ok {
+			healthServer.Handle("/api/", apiChannel.Handler())
+			fmt.Printf("✓ API channel available at http://%s:%d/api/\n", cfg.Gateway.Host, cfg.Gateway.Port)
+			if cfg.Channels.API.UI {
+				uiHandler := apiChannel.UIHandler(agentLoop.Sessions())
+				healthServer.Handle("/ui", uiHandler)
+				healthServer.Handle("/ui/", uiHandler)
+				fmt.Printf("✓ Web UI available at http://%s:%d/ui/\n", cfg.Gateway.Host, cfg.Gateway.Port)
+			}
+		}
+	}
+	for _, p := range []struct{ name, method string }{
+		{"openai", cfg.Providers.OpenAI.AuthMethod},
+		{"anthropic", cfg.Providers.Anthropic.AuthMethod},
+	} {
+		if p.method == "oauth" || p.method == "token" {
+			healthServer.RunPeriodicCheck(ctx, "auth_"+p.name, time.Minute, auth.RefresherFor(p.name).Check)
+		}
+	}
+	if cfg.Architecture.UseNewArchitecture && cfg.Architecture.EnableHeartbeat {
+		healthServer.RunPeriodicCheck(ctx, "agents", 15*time.Second, agentLoop.CheckAgents)
+		fmt.Println("✓ Agent heartbeat check registered (every 15s)")
+	}
 
 	if ollamaBase := cfg.Providers.Ollama.APIBase; ollamaBase != "" {
 		checkURL := strings.TrimSuffix(ollamaBase, "/v1")
@@ -713,6 +767,9 @@ func gatewayCmd() {
 
 	go agentLoop.Run(ctx)
 
+	// Resume or fail jobs left unfinished by the previous run.
+	agentLoop.RecoverJobs()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	<-sigChan
@@ -816,6 +873,8 @@ func authCmd() {
 		authLogoutCmd()
 	case "status":
 		authStatusCmd()
+	case "secrets":
+		authSecretsCmd()
 	default:
 		fmt.Printf("Unknown auth command: %s\n", os.Args[2])
 		authHelp()
@@ -827,6 +886,7 @@ func authHelp() {
 	fmt.Println("  login       Login via OAuth or paste token")
 	fmt.Println("  logout      Remove stored credentials")
 	fmt.Println("  status      Show current auth status")
+	fmt.Println("  secrets     Manage encrypted secrets (set, list, rm)")
 	fmt.Println()
 	fmt.Println("Login options:")
 	fmt.Println("  --provider <name>    Provider to login with (openai, anthropic)")
@@ -838,6 +898,143 @@ func authHelp() {
 	fmt.Println("  picoclaw auth login --provider anthropic")
 	fmt.Println("  picoclaw auth logout --provider openai")
 	fmt.Println("  picoclaw auth status")
+	fmt.Println("  picoclaw auth secrets set anthropic")
+}
+
+func authSecretsCmd() {
+	if len(os.Args) < 4 {
+		authSecretsHelp()
+		return
+	}
+
+	store, err := secrets.LoadDefault()
+	if err != nil {
+		fmt.Printf("Error loading secrets: %v\n", err)
+		os.Exit(1)
+	}
+
+	args := os.Args[4:]
+	switch os.Args[3] {
+	case "set":
+		if len(args) < 1 {
+			fmt.Println("Usage: picoclaw auth secrets set <name> [value]")
+			return
+		}
+		name := args[0]
+		if err := secrets.ValidateName(name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		value := ""
+		if len(args) > 1 {
+			value = args[1]
+			fmt.Println("Note: a value given on the command line stays in the shell history; omit it to be prompted.")
+		} else if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+			// Prompt without echo so the value stays off the screen and out
+			// of the shell history.
+			fmt.Printf("Enter the value for %s: ", name)
+			raw, err := term.ReadPassword(fd)
+			fmt.Println()
+			if err != nil {
+				fmt.Printf("Error reading value: %v\n", err)
+				os.Exit(1)
+			}
+			value = strings.TrimSpace(string(raw))
+		} else {
+			scanner := bufio.NewScanner(os.Stdin)
+			if scanner.Scan() {
+				value = strings.TrimSpace(scanner.Text())
+			}
+		}
+		if value == "" {
+			fmt.Println("Error: value cannot be empty")
+			os.Exit(1)
+		}
+		if err := store.Set(name, value); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := store.Save(); err != nil {
+			fmt.Printf("Error saving secrets: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Secret %s saved. Use it in config.json as \"%s%s\"\n", name, secrets.RefPrefix, name)
+	case "migrate":
+		cfg, err := loadConfig()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		names, err := cfg.MoveSecretsToStore(store)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(names) == 0 {
+			fmt.Println("No plaintext credentials in config.json.")
+			return
+		}
+		// Save the store first: a config pointing at missing secrets would
+		// not load.
+		if err := store.Save(); err != nil {
+			fmt.Printf("Error saving secrets: %v\n", err)
+			os.Exit(1)
+		}
+		if err := config.SaveConfig(getConfigPath(), cfg); err != nil {
+			fmt.Printf("Error saving config: %v\n", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			fmt.Printf("✓ Moved to secret %s\n", name)
+		}
+	case "list":
+		names := store.Names()
+		if len(names) == 0 {
+			fmt.Println("No secrets stored.")
+			return
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "rm":
+		if len(args) < 1 {
+			fmt.Println("Usage: picoclaw auth secrets rm <name>")
+			return
+		}
+		if !store.Delete(args[0]) {
+			fmt.Printf("Secret %s not found\n", args[0])
+			return
+		}
+		if err := store.Save(); err != nil {
+			fmt.Printf("Error saving secrets: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Secret %s removed\n", args[0])
+	default:
+		fmt.Printf("Unknown secrets command: %s\n", os.Args[3])
+		authSecretsHelp()
+	}
+}
+
+func authSecretsHelp() {
+	fmt.Println("\nSecrets commands:")
+	fmt.Println("  set <name> [value]   Store a secret (prompts without echo if omitted)")
+	fmt.Println("  list                 List secret names")
+	fmt.Println("  rm <name>            Remove a secret")
+	fmt.Println("  migrate              Move plaintext credentials in config.json to secrets")
+	fmt.Println()
+	fmt.Println("Secrets and auth.json are encrypted with ChaCha20-Poly1305. The key comes from:")
+	fmt.Printf("  %s          base64-encoded 32-byte key\n", secrets.KeyEnv)
+	fmt.Printf("  %s   passphrase\n", secrets.PassphraseEnv)
+	fmt.Printf("  %s     key file (default ~/.picoclaw/secrets.key, created on first use)\n", secrets.KeyFileEnv)
+	fmt.Println()
+	fmt.Println("The default key file sits next to the encrypted files in ~/.picoclaw: it keeps")
+	fmt.Println("secrets out of config.json, backups and shared configs, but anyone who can read")
+	fmt.Println("~/.picoclaw can decrypt them. Set a passphrase, or keep the key file elsewhere,")
+	fmt.Println("to protect against that.")
+	fmt.Println()
+	fmt.Println("Reference a secret from config.json:")
+	fmt.Println("  \"api_key\": \"secret:anthropic\"")
 }
 
 func authLoginCmd() {
@@ -1047,7 +1244,15 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 }
 
 func loadConfig() (*config.Config, error) {
-	return config.LoadConfig(getConfigPath())
+	cfg, err := config.LoadConfig(getConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	if paths := cfg.PlaintextSecrets(); len(paths) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: config.json holds %d plaintext credential(s) (%s); move them to encrypted secrets with: picoclaw auth secrets migrate\n",
+			len(paths), strings.Join(paths, ", "))
+	}
+	return cfg, nil
 }
 
 func cronCmd() {
@@ -1088,6 +1293,434 @@ func cronCmd() {
 	}
 }
 
+func usageCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	at := time.Now()
+	asJSON := false
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-d", "--date":
+			if i+1 >= len(args) {
+				usageHelp()
+				return
+			}
+			parsed, err := time.ParseInLocation("2006-01-02", args[i+1], time.Local)
+			if err != nil {
+				fmt.Printf("Invalid date %q (want YYYY-MM-DD)\n", args[i+1])
+				return
+			}
+			at = parsed
+			i++
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			usageHelp()
+			return
+		default:
+			fmt.Printf("Unknown usage option: %s\n", args[i])
+			usageHelp()
+			return
+		}
+	}
+
+	// Reports are read even when recording is disabled, so past data stays visible.
+	ledger := usage.NewLedger(filepath.Join(cfg.WorkspacePath(), usage.DirName), usage.NewPriceTable(cfg.Usage.Prices))
+	if !asJSON {
+		report, err := ledger.Report(at)
+		if err != nil {
+			fmt.Printf("Error reading usage: %v\n", err)
+			return
+		}
+		fmt.Print(report)
+		return
+	}
+
+	day, err := ledger.DaySummary(at)
+	if err != nil {
+		fmt.Printf("Error reading usage: %v\n", err)
+		return
+	}
+	month, err := ledger.MonthSummary(at)
+	if err != nil {
+		fmt.Printf("Error reading usage: %v\n", err)
+		return
+	}
+	data, _ := json.MarshalIndent(map[string]usage.Summary{"day": day, "month": month}, "", "  ")
+	fmt.Println(string(data))
+}
+
+func usageHelp() {
+	fmt.Println("\nUsage:")
+	fmt.Println("  picoclaw usage                 Today's and this month's usage")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -d, --date YYYY-MM-DD  Report that day and its month")
+	fmt.Println("  --json                 Print summaries as JSON")
+}
+
+func jobsCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	asJSON := false
+	var args []string
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			jobsHelp()
+			return
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	sub := "list"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch sub {
+	case "list":
+		jobsListCmd(cfg, asJSON)
+	case "status", "cancel":
+		if len(args) < 2 {
+			fmt.Printf("Usage: picoclaw jobs %s <job_id>\n", sub)
+			return
+		}
+		if sub == "status" {
+			jobsStatusCmd(cfg, args[1], asJSON)
+		} else {
+			jobsCancelCmd(cfg, args[1])
+		}
+	default:
+		fmt.Printf("Unknown jobs command: %s\n", sub)
+		jobsHelp()
+	}
+}
+
+func jobsHelp() {
+	fmt.Println("\nJobs commands:")
+	fmt.Println("  list               Running and recent jobs (default)")
+	fmt.Println("  status <job_id>    Show one job")
+	fmt.Println("  cancel <job_id>    Stop a running job or withdraw a pending proposal")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --json             Print JSON")
+	fmt.Println()
+	fmt.Println("The commands talk to the running gateway; list and status fall back to")
+	fmt.Println("the job journal in the workspace when the gateway is not running.")
+}
+
+// gatewayURL is the base URL for reaching the local gateway's HTTP server.
+func gatewayURL(cfg *config.Config) string {
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port))
+}
+
+// gatewayJobsRequest calls the gateway's jobs API and decodes the reply into out.
+// A non-2xx reply is returned as an error with the API's message.
+func gatewayJobsRequest(cfg *config.Config, method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, gatewayURL(cfg)+path, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s", apiErr.Error)
+		}
+		return fmt.Errorf("gateway returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// journalJobs reads jobs straight from the journal, newest first.
+func journalJobs(cfg *config.Config) ([]agent.JobStatus, error) {
+	journal, err := jobs.Open(filepath.Join(cfg.WorkspacePath(), "state", jobs.JournalFile))
+	if err != nil {
+		return nil, err
+	}
+	list := journal.List()
+	out := make([]agent.JobStatus, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		out = append(out, agent.JobStatus{Job: list[i]})
+	}
+	return out, nil
+}
+
+func jobsListCmd(cfg *config.Config, asJSON bool) {
+	var reply struct {
+		Jobs []agent.JobStatus `json:"jobs"`
+	}
+	if err := gatewayJobsRequest(cfg, http.MethodGet, "/jobs", &reply); err != nil {
+		list, jerr := journalJobs(cfg)
+		if jerr != nil {
+			fmt.Printf("Error reading jobs: %v\n", jerr)
+			return
+		}
+		if !asJSON {
+			fmt.Printf("Gateway not reachable (%v); showing the job journal.\n", err)
+		}
+		if len(list) > 20 {
+			list = list[:20]
+		}
+		reply.Jobs = list
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(reply.Jobs, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(reply.Jobs) == 0 {
+		fmt.Println("No jobs.")
+		return
+	}
+	fmt.Printf("%-18s %-10s %-9s %-22s %-8s %s\n", "JOB ID", "STATE", "ROUTE", "CHAT", "AGE", "MESSAGE")
+	for _, j := range reply.Jobs {
+		state := string(j.State)
+		if j.Running {
+			state += "*"
+		}
+		message := strings.ReplaceAll(strings.TrimSpace(j.Content), "\n", " ")
+		fmt.Printf("%-18s %-10s %-9s %-22s %-8s %s\n", j.ID, state, j.Route,
+			j.Channel+":"+j.ChatID, time.Since(j.CreatedAt).Round(time.Second), utils.Truncate(message, 40))
+	}
+	fmt.Println("\n* running in the gateway")
+}
+
+func jobsStatusCmd(cfg *config.Config, jobID string, asJSON bool) {
+	var status agent.JobStatus
+	if err := gatewayJobsRequest(cfg, http.MethodGet, "/jobs/"+url.PathEscape(jobID), &status); err != nil {
+		list, jerr := journalJobs(cfg)
+		if jerr != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		found := false
+		for _, j := range list {
+			if j.ID == jobID {
+				status, found = j, true
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("Job:      %s\n", status.ID)
+	fmt.Printf("State:    %s (running: %v)\n", status.State, status.Running)
+	if status.Route != "" {
+		fmt.Printf("Route:    %s\n", status.Route)
+	}
+	fmt.Printf("Chat:     %s:%s\n", status.Channel, status.ChatID)
+	fmt.Printf("Started:  %s\n", status.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Updated:  %s\n", status.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if status.Attempts > 1 {
+		fmt.Printf("Attempts: %d\n", status.Attempts)
+	}
+	if status.Detail != "" {
+		fmt.Printf("Detail:   %s\n", status.Detail)
+	}
+	fmt.Printf("Message:  %s\n", utils.Truncate(strings.TrimSpace(status.Content), 200))
+	for _, a := range status.Agents {
+		fmt.Printf("Agent:    %s %s (last seen %s)\n", a.AgentID, a.Status, a.LastSeen.Format("15:04:05"))
+	}
+}
+
+func jobsCancelCmd(cfg *config.Config, jobID string) {
+	var status agent.JobStatus
+	if err := gatewayJobsRequest(cfg, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/cancel", &status); err != nil {
+		fmt.Printf("Error cancelling job: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Cancelled %s\n", status.ID)
+}
+
+func mcpCmd() {
+	if len(os.Args) < 3 {
+		mcpHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "serve":
+		mcpServeCmd(os.Args[3:])
+	case "-h", "--help", "help":
+		mcpHelp()
+	default:
+		fmt.Printf("Unknown mcp command: %s\n", os.Args[2])
+		mcpHelp()
+	}
+}
+
+func mcpServeCmd(args []string) {
+	httpAddr := ""
+	useStdio := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--http":
+			if i+1 >= len(args) {
+				mcpHelp()
+				return
+			}
+			httpAddr = args[i+1]
+			i++
+		case "--stdio":
+			useStdio = true
+		case "--debug", "-d":
+			logger.SetLevel(logger.DEBUG)
+		case "-h", "--help", "help":
+			mcpHelp()
+			return
+		default:
+			fmt.Printf("Unknown mcp serve option: %s\n", args[i])
+			mcpHelp()
+			return
+		}
+	}
+	if httpAddr == "" {
+		useStdio = true
+	}
+
+	// In stdio mode stdout carries the protocol, so anything else that prints
+	// (provider setup, tools) is redirected to stderr.
+	protocolOut := os.Stdout
+	if useStdio {
+		os.Stdout = os.Stderr
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	msgBus := bus.NewMessageBus()
+	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	defer agentLoop.Stop()
+
+	// Same tool set as the gateway. The cron service is not started here; jobs
+	// added over MCP are stored and run by the gateway.
+	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
+	setupCronTool(agentLoop, msgBus, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, execTimeout)
+
+	// ask_agent lives only in the MCP server's registry so the agent cannot
+	// call itself through it.
+	serveCfg := cfg.MCP.Serve
+	exported := mcp.ExportRegistry(agentLoop.Tools(), serveCfg.Tools, tools.NewAskAgentTool(agentLoop, mcp.ServerChannel))
+	server := mcp.NewServer(exported, mcp.Implementation{Name: "picoclaw", Version: version})
+	server.SetHTTPOptions(mcp.HTTPOptions{
+		Token:          serveCfg.Token,
+		AllowedOrigins: serveCfg.AllowedOrigins,
+		AllowedHosts:   serveCfg.AllowedHosts,
+	})
+	if httpAddr != "" && serveCfg.Token == "" && !isLoopbackAddr(httpAddr) {
+		fmt.Fprintf(os.Stderr, "Refusing to serve MCP on %s without mcp.serve.token\n", httpAddr)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	errCh := make(chan error, 2)
+	if httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", server)
+		httpServer := &http.Server{Addr: httpAddr, Handler: mux}
+		go func() {
+			<-ctx.Done()
+			httpServer.Close()
+		}()
+		go func() {
+			fmt.Fprintf(os.Stderr, "%s MCP server listening on http://%s/mcp\n", logo, httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- err
+				return
+			}
+			errCh <- nil
+		}()
+	}
+	if useStdio {
+		go func() {
+			errCh <- server.ServeStdio(ctx, os.Stdin, protocolOut)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errCh:
+		if err != nil && err != context.Canceled {
+			fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// isLoopbackAddr reports whether a host:port listen address only accepts
+// local connections.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func mcpHelp() {
+	fmt.Println("\nMCP commands:")
+	fmt.Println("  serve             Expose picoclaw's tools and agent as an MCP server")
+	fmt.Println()
+	fmt.Println("Serve options:")
+	fmt.Println("  --stdio             Speak MCP over stdin/stdout (default)")
+	fmt.Println("  --http <host:port>  Serve streamable HTTP at http://<host:port>/mcp")
+	fmt.Println("                      (non-loopback addresses require mcp.serve.token)")
+	fmt.Println("  -d, --debug         Enable debug logging")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw mcp serve")
+	fmt.Println("  picoclaw mcp serve --http 127.0.0.1:18795")
+}
+
 func cronHelp() {
 	fmt.Println("\nCron commands:")
 	fmt.Println("  list              List all scheduled jobs")
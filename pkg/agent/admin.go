@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+)
+
+// isAdmin reports whether msg comes from a sender listed in
+// agents.defaults.admins. Admins may act on other chats' approvals and jobs.
+func (al *AgentLoop) isAdmin(msg bus.InboundMessage) bool {
+	for _, entry := range al.cfg.Agents.Defaults.Admins {
+		channel, sender, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if channel != msg.Channel {
+			continue
+		}
+		if !ok || (sender != "" && sender == msg.SenderID) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameChat reports whether msg was sent from channel/chatID.
+func sameChat(msg bus.InboundMessage, channel, chatID string) bool {
+	return msg.Channel == channel && msg.ChatID == chatID
+}
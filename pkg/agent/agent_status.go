@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// Agent statuses published on the heartbeat bus.
+const (
+	agentIdle       = "idle"
+	agentProcessing = "processing"
+	agentWaiting    = "waiting" // waiting for another agent (e.g. Worker for its Orders)
+)
+
+// heartbeatAgents are the agents of the new architecture.
+var heartbeatAgents = []string{"chat", "worker", "order1", "order2", "order3"}
+
+// defaultProgressTimeout is how long a processing agent may go without
+// progress before it stops beating, when not configured.
+const defaultProgressTimeout = 5 * time.Minute
+
+// agentActivity is what an agent is doing right now.
+type agentActivity struct {
+	status string
+	jobID  string
+	// progress is touched by the agent's LLM and tool calls; nil when idle.
+	progress *agentProgress
+	// deadline is the deadline of the agent's work; zero when it has none.
+	deadline time.Time
+}
+
+// beating reports whether the agent should still publish heartbeats at now. A
+// busy agent stops once its deadline has passed; a processing agent also stops
+// when it has made no progress for timeout, so a call that hangs without
+// honouring its context still goes stale.
+func (a agentActivity) beating(now time.Time, timeout time.Duration) bool {
+	if a.progress == nil {
+		return true
+	}
+	if !a.deadline.IsZero() && now.After(a.deadline) {
+		return false
+	}
+	return a.status != agentProcessing || now.Sub(a.progress.last()) < timeout
+}
+
+// agentProgress records when an agent last made progress: an LLM or tool call
+// starting or finishing, or a streamed delta. It travels in the agent's work
+// context.
+type agentProgress struct{ at atomic.Int64 }
+
+func (p *agentProgress) touch() { p.at.Store(time.Now().UnixNano()) }
+
+func (p *agentProgress) last() time.Time { return time.Unix(0, p.at.Load()) }
+
+type agentProgressKey struct{}
+
+// noteProgress marks progress for the agent whose work ctx belongs to.
+func noteProgress(ctx context.Context) {
+	if p, ok := ctx.Value(agentProgressKey{}).(*agentProgress); ok {
+		p.touch()
+	}
+}
+
+// setAgentBusy marks agentID as processing or waiting on jobID and publishes a
+// heartbeat. The returned context carries the agent's progress so that LLM and
+// tool calls made with it keep the agent beating.
+func (al *AgentLoop) setAgentBusy(ctx context.Context, agentID, status, jobID string) context.Context {
+	if al.heartbeats == nil {
+		return ctx
+	}
+	progress := &agentProgress{}
+	progress.touch()
+	deadline, _ := ctx.Deadline()
+	al.agentActivity.Store(agentID, agentActivity{status: status, jobID: jobID, progress: progress, deadline: deadline})
+	al.publishHeartbeat(agentID, status, jobID)
+	return context.WithValue(ctx, agentProgressKey{}, progress)
+}
+
+// progressTimeout is how long a processing agent may go without progress
+// before it stops beating.
+func (al *AgentLoop) progressTimeout() time.Duration {
+	if sec := al.cfg.Architecture.HeartbeatProgressTimeoutSec; sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return defaultProgressTimeout
+}
+
+// setAgentIdle marks agentID idle once it is done with jobID. It leaves the
+// agent alone if another job has taken it over meanwhile.
+func (al *AgentLoop) setAgentIdle(agentID, jobID string) {
+	if al.heartbeats == nil {
+		return
+	}
+	if v, ok := al.agentActivity.Load(agentID); ok && v.(agentActivity).jobID != jobID {
+		return
+	}
+	al.agentActivity.Store(agentID, agentActivity{status: agentIdle})
+	al.publishHeartbeat(agentID, agentIdle, "")
+}
+
+func (al *AgentLoop) publishHeartbeat(agentID, status, jobID string) {
+	al.heartbeats.Report(heartbeat.AgentHeartbeat{
+		AgentID:   agentID,
+		JobID:     jobID,
+		Status:    status,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"alias": resolveAlias(agentID, al.cfg)},
+	})
+}
+
+// runHeartbeats feeds the heartbeat collector and re-publishes every agent's
+// status four times per collector timeout until ctx is done. Busy agents past
+// their deadline or without progress are skipped (see agentActivity.beating).
+func (al *AgentLoop) runHeartbeats(ctx context.Context) {
+	if al.heartbeats == nil || al.workerHeartbeatModule == nil {
+		return
+	}
+	go al.workerHeartbeatModule.Collect(ctx, al.heartbeats)
+
+	for _, id := range heartbeatAgents {
+		al.agentActivity.LoadOrStore(id, agentActivity{status: agentIdle})
+	}
+	ticker := time.NewTicker(al.workerHeartbeatModule.Timeout() / 4)
+	defer ticker.Stop()
+	timeout := al.progressTimeout()
+	for {
+		now := time.Now()
+		al.agentActivity.Range(func(k, v interface{}) bool {
+			a := v.(agentActivity)
+			if a.beating(now, timeout) {
+				al.publishHeartbeat(k.(string), a.status, a.jobID)
+			}
+			return true
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// agentReport returns the collector's view of every agent, sorted by ID.
+func (al *AgentLoop) agentReport() worker.HeartbeatReport {
+	if al.workerHeartbeatModule == nil {
+		return worker.HeartbeatReport{Timestamp: time.Now(), Agents: []worker.AgentStatus{}}
+	}
+	report := al.workerHeartbeatModule.GetReport()
+	sort.Slice(report.Agents, func(i, j int) bool { return report.Agents[i].AgentID < report.Agents[j].AgentID })
+	return report
+}
+
+// AgentsHandler serves GET /agents: the live status of every agent.
+func (al *AgentLoop) AgentsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJobsJSON(w, http.StatusOK, al.agentReport())
+	})
+}
+
+// CheckAgents is a readiness check that fails while any agent has stopped
+// sending heartbeats, naming the agents and the jobs they were on.
+func (al *AgentLoop) CheckAgents() (bool, string) {
+	if al.workerHeartbeatModule == nil {
+		return true, "heartbeat disabled"
+	}
+	report := al.agentReport()
+	var stale []string
+	for _, a := range report.Agents {
+		if a.Status != "timeout" {
+			continue
+		}
+		desc := fmt.Sprintf("%s silent for %s", a.AgentID, time.Since(a.LastSeen).Round(time.Second))
+		if a.JobID != "" {
+			desc += " on " + a.JobID
+		}
+		stale = append(stale, desc)
+	}
+	if len(stale) > 0 {
+		logger.WarnCF("agent", "heartbeat.stale", map[string]interface{}{"agents": stale})
+		return false, "stale agents: " + strings.Join(stale, ", ")
+	}
+	return true, fmt.Sprintf("%d agents reporting", len(report.Agents))
+}
+
+// trackProgress wraps provider so that its calls count as progress for the
+// agent making them.
+func trackProgress(provider providers.LLMProvider) providers.LLMProvider {
+	if provider == nil {
+		return nil
+	}
+	pp := &progressProvider{inner: provider}
+	if sp, ok := provider.(providers.StreamingProvider); ok {
+		return &progressStreamingProvider{progressProvider: pp, stream: sp}
+	}
+	return pp
+}
+
+type progressProvider struct {
+	inner providers.LLMProvider
+}
+
+func (p *progressProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	noteProgress(ctx)
+	defer noteProgress(ctx)
+	return p.inner.Chat(ctx, messages, tools, model, options)
+}
+
+func (p *progressProvider) GetDefaultModel() string {
+	return p.inner.GetDefaultModel()
+}
+
+type progressStreamingProvider struct {
+	*progressProvider
+	stream providers.StreamingProvider
+}
+
+func (p *progressStreamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}, onDelta providers.StreamHandler) (*providers.LLMResponse, error) {
+	noteProgress(ctx)
+	defer noteProgress(ctx)
+	return p.stream.ChatStream(ctx, messages, tools, model, options, func(delta providers.StreamDelta) {
+		noteProgress(ctx)
+		if onDelta != nil {
+			onDelta(delta)
+		}
+	})
+}
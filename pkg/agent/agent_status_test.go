@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/chat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// stuckProvider ignores cancellation and only returns once released.
+type stuckProvider struct{ release chan struct{} }
+
+func (p *stuckProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	<-p.release
+	return nil, ctx.Err()
+}
+
+func (p *stuckProvider) GetDefaultModel() string { return "stuck" }
+
+func TestAgentHeartbeats_ReportStuckOrder(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				CoderProvider:  "ollama",
+				CoderModel:     "coder-a",
+				Coder2Provider: "ollama",
+				Coder2Model:    "coder-b",
+				Coder3Provider: "ollama",
+				Coder3Model:    "coder-c",
+			},
+		},
+		Loop: config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Architecture: config.ArchitectureConfig{
+			UseNewArchitecture:     true,
+			EnableHeartbeat:        true,
+			EnableDeliberation:     true,
+			DeliberationTimeoutSec: 1,
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	if al.workerHeartbeatModule == nil {
+		t.Fatal("heartbeat collector should be attached")
+	}
+	stuck := &stuckProvider{release: make(chan struct{})}
+	defer close(stuck.release)
+	al.providerPool.Put("ollama", "coder-a", &proposalProvider{risk: "低"})
+	al.providerPool.Put("ollama", "coder-b", &proposalProvider{risk: "低"})
+	al.providerPool.Put("ollama", "coder-c", stuck)
+
+	al.workerHeartbeatModule.SetTimeout(400 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.runHeartbeats(ctx)
+
+	// order3 ignores its deadline and keeps running after deliberation gives up on it.
+	const jobID = "job_20261016_007"
+	al.deliberateNewArch(ctx, chat.Task{JobID: jobID, UserText: "設定を直して"}, false)
+
+	var ok bool
+	var msg string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if ok, msg = al.CheckAgents(); !ok {
+			break
+		}
+	}
+	if ok {
+		t.Fatalf("stuck order3 should fail the agents check, got %q", msg)
+	}
+	if !strings.Contains(msg, "order3") || !strings.Contains(msg, jobID) {
+		t.Errorf("check should name the stuck agent and job, got %q", msg)
+	}
+	for _, id := range []string{"chat", "worker", "order1", "order2"} {
+		if strings.Contains(msg, id) {
+			t.Errorf("%s keeps beating and should not be stale: %q", id, msg)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	al.AgentsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents", nil))
+	var report worker.HeartbeatReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("GET /agents: %v", err)
+	}
+	got := map[string]worker.AgentStatus{}
+	for _, a := range report.Agents {
+		got[a.AgentID] = a
+	}
+	if len(got) != 5 {
+		t.Errorf("expected all 5 agents, got %+v", report.Agents)
+	}
+	if a := got["order3"]; a.Status != "timeout" || a.JobID != jobID || a.Alias != "Gin" {
+		t.Errorf("unexpected order3 status: %+v", a)
+	}
+	if a := got["order1"]; a.Status != agentIdle || a.JobID != "" {
+		t.Errorf("order1 should be idle after proposing, got %+v", a)
+	}
+}
+
+func TestAgentActivity_StaleWithoutProgress(t *testing.T) {
+	now := time.Unix(1000, 0)
+	progress := &agentProgress{}
+	progress.at.Store(now.UnixNano())
+	busy := agentActivity{status: agentProcessing, jobID: "job_1", progress: progress}
+
+	if !busy.beating(now.Add(time.Minute), 2*time.Minute) {
+		t.Error("an agent with recent progress should keep beating")
+	}
+	// A call that hangs on a live context without a deadline makes no progress.
+	if busy.beating(now.Add(3*time.Minute), 2*time.Minute) {
+		t.Error("an agent without progress for the timeout should stop beating")
+	}
+	waiting := busy
+	waiting.status = agentWaiting
+	if !waiting.beating(now.Add(3*time.Minute), 2*time.Minute) {
+		t.Error("a waiting agent is not judged by its own progress")
+	}
+	waiting.deadline = now.Add(time.Minute)
+	if waiting.beating(now.Add(2*time.Minute), 2*time.Minute) {
+		t.Error("a busy agent past its deadline should stop beating")
+	}
+	if !(agentActivity{status: agentIdle}).beating(now.Add(time.Hour), time.Minute) {
+		t.Error("idle agents always beat")
+	}
+}
+
+func TestTrackProgress_TouchesAgentProgress(t *testing.T) {
+	al := &AgentLoop{cfg: &config.Config{}, heartbeats: heartbeat.NewHeartbeatBus()}
+	ctx := al.setAgentBusy(context.Background(), "order1", agentProcessing, "job_1")
+	v, _ := al.agentActivity.Load("order1")
+	progress := v.(agentActivity).progress
+	progress.at.Store(0)
+
+	provider := trackProgress(&mockProvider{})
+	if _, err := provider.Chat(ctx, nil, nil, "m", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if time.Since(progress.last()) > time.Minute {
+		t.Errorf("an LLM call should count as progress, last = %v", progress.last())
+	}
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/chat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/order"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// analysisCodeBlock matches a fenced code block in the user's message.
+var analysisCodeBlock = regexp.MustCompile("```[\\w+-]*\\n([\\s\\S]*?)```")
+
+// findAnalysisTarget returns the code an ANALYZE request points at: a fenced
+// code block, or the first file or directory mentioned that exists inside the
+// workspace.
+func (al *AgentLoop) findAnalysisTarget(text string) (string, bool) {
+	if m := analysisCodeBlock.FindStringSubmatch(text); m != nil && strings.TrimSpace(m[1]) != "" {
+		return m[1], true
+	}
+
+	tokens := strings.FieldsFunc(text, func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\n', '\r', '　', '「', '」', '『', '』', '(', ')', '（', '）',
+			'"', '\'', '`', '、', '。', ',', '：', ':', '？', '?':
+			return true
+		}
+		return false
+	})
+	for _, token := range tokens {
+		if !strings.ContainsAny(token, "/.") || token == "." || token == ".." {
+			continue
+		}
+		path, err := tools.ResolvePath(token, al.workspace, al.cfg.Agents.Defaults.RestrictToWorkspace)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// analyzeCodeNewArch runs an ANALYZE request that names code through an Order's
+// CodeAnalysisModule instead of the Worker's free-form answer.
+func (al *AgentLoop) analyzeCodeNewArch(ctx context.Context, task chat.Task, target string, localOnly bool) (string, error) {
+	const orderID = "order1"
+	ctx = al.setAgentBusy(ctx, orderID, agentProcessing, task.JobID)
+	defer al.setAgentIdle(orderID, task.JobID)
+
+	logger.InfoCF("agent", "new_arch.analyze_code", map[string]interface{}{
+		"job_id":   task.JobID,
+		"order_id": orderID,
+	})
+
+	orderAgent, err := NewAgentWithModules(ctx, orderID, al.cfg, al.bus, al.sessions, al.router)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Order agent: %w", err)
+	}
+	if orderAgent.Provider == nil {
+		binding, err := al.bindRouteWithTask(orderIDToRoute(orderID), task.UserText, localOnly)
+		if err != nil {
+			return "", fmt.Errorf("failed to bind LLM for %s: %w", orderID, err)
+		}
+		orderAgent.Provider = binding.Provider
+		orderAgent.Model = binding.Model
+	}
+
+	var analysisModule *order.CodeAnalysisModule
+	for _, module := range orderAgent.Modules {
+		if am, ok := module.(*order.CodeAnalysisModule); ok {
+			analysisModule = am
+			break
+		}
+	}
+	if analysisModule == nil {
+		return "", fmt.Errorf("CodeAnalysisModule not found in Order agent")
+	}
+
+	result, err := analysisModule.AnalyzeCode(ctx, order.AnalysisRequest{
+		JobID:   task.JobID,
+		Route:   RouteAnalyze,
+		Target:  target,
+		Context: map[string]interface{}{"user_text": task.UserText},
+	})
+	if err != nil {
+		return "", err
+	}
+	return order.FormatAnalysis(result), nil
+}
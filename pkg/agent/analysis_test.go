@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// reviewJSONProvider answers code analysis prompts with one finding.
+type reviewJSONProvider struct{ calls int }
+
+func (p *reviewJSONProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return &providers.LLMResponse{
+		Content: `{"summary":"エラー処理に漏れがあります","issues":[{"severity":"warning","file":"calc.py","line":2,"message":"ゼロ除算を考慮していない","suggestion":"b が 0 のときを扱う"}]}`,
+	}, nil
+}
+
+func (p *reviewJSONProvider) GetDefaultModel() string { return "review" }
+
+func TestProcessMessageNewArch_AnalyzeRoutesCodeToAnalysisModule(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "calc.py"), []byte("def div(a, b):\n    return a / b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	al, _ := newApprovalTestLoop(t, workspace)
+	reviewer := &reviewJSONProvider{}
+	al.providerPool.Put("ollama", "coder-a", reviewer)
+
+	resp, err := al.processMessage(context.Background(), approvalMsg("telegram", "1", "/analyze calc.py をレビューして"))
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	if reviewer.calls != 1 {
+		t.Fatalf("expected the Order's provider to analyze the file once, got %d calls", reviewer.calls)
+	}
+	for _, want := range []string{"## 解析結果", "[warning] calc.py:2: ゼロ除算を考慮していない"} {
+		if !strings.Contains(resp, want) {
+			t.Errorf("response missing %q:\n%s", want, resp)
+		}
+	}
+
+	// Without code the Worker answers directly.
+	resp, err = al.processMessage(context.Background(), approvalMsg("telegram", "1", "/analyze 売上の傾向を教えて"))
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	if reviewer.calls != 1 || resp != "Mock response" {
+		t.Errorf("plain ANALYZE should stay on the Worker, got %q (%d analysis calls)", resp, reviewer.calls)
+	}
+}
+
+func TestFindAnalysisTarget(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, "pkg", "calc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	al, _ := newApprovalTestLoop(t, workspace)
+	al.cfg.Agents.Defaults.RestrictToWorkspace = true
+
+	tests := []struct {
+		text   string
+		target string
+		ok     bool
+	}{
+		{"「pkg/calc」を解析して", "pkg/calc", true},
+		{"この関数を見て\n```go\nfunc f() {}\n```", "func f() {}\n", true},
+		{"pkg/missing.go を解析して", "", false},
+		{"/etc/passwd を解析して", "", false},
+		{"売上を集計して", "", false},
+	}
+	for _, tt := range tests {
+		target, ok := al.findAnalysisTarget(tt.text)
+		if ok != tt.ok || target != tt.target {
+			t.Errorf("findAnalysisTarget(%q) = %q, %v; want %q, %v", tt.text, target, ok, tt.target, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/constants"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/order"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
+)
+
+// newApprovalFlow opens the pending proposal store under workspace/state.
+// A store that cannot be read is left untouched and an in-memory one is used.
+func newApprovalFlow(workspace string) *order.ApprovalFlowModule {
+	path := filepath.Join(workspace, "state", order.PendingProposalsFile)
+	m, err := order.NewPersistentApprovalFlowModule(path)
+	if err != nil {
+		logger.WarnCF("agent", "approval.load_failed", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return order.NewApprovalFlowModule()
+	}
+	if n := len(m.ListPending()); n > 0 {
+		logger.InfoCF("agent", "approval.loaded", map[string]interface{}{"pending": n})
+	}
+	return m
+}
+
+// storePendingProposal keeps an Order result with a patch for /approve and
+// returns the notice appended to the reply. Results without a patch are not stored.
+func (al *AgentLoop) storePendingProposal(msg bus.InboundMessage, result worker.OrderResult) string {
+	if al.orderApprovalModule == nil || !result.Success || strings.TrimSpace(result.Patch) == "" {
+		return ""
+	}
+	al.orderApprovalModule.StorePending(order.PendingProposal{
+		Proposal: order.Proposal{
+			JobID:    result.JobID,
+			OrderID:  result.OrderID,
+			Plan:     result.Plan,
+			Patch:    result.Patch,
+			Risk:     result.Risk,
+			Metadata: result.Metadata,
+		},
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SessionKey: msg.SessionKey,
+	})
+	al.recordJob(result.JobID, jobs.StateProposal, "", result.OrderID)
+	return fmt.Sprintf("この提案は承認待ちだよ（%s）。実行するなら /approve %s 、見送るなら /deny %s って送ってね。",
+		result.JobID, result.JobID, result.JobID)
+}
+
+// handleApprovalCommand handles /approve, /deny and /pending. Senders see
+// and act on the proposals of their own chat only, unless they are admins.
+func (al *AgentLoop) handleApprovalCommand(ctx context.Context, msg bus.InboundMessage, cmd string, args []string) string {
+	if al.orderApprovalModule == nil {
+		return "承認フローは新アーキテクチャ（architecture.use_new_architecture）でのみ使えるよ。"
+	}
+
+	admin := al.isAdmin(msg)
+	if cmd == "/pending" {
+		var list []order.PendingProposal
+		for _, p := range al.orderApprovalModule.ListPending() {
+			if admin || sameChat(msg, p.Channel, p.ChatID) {
+				list = append(list, p)
+			}
+		}
+		return formatPendingProposals(list)
+	}
+
+	if len(args) < 1 {
+		return fmt.Sprintf("使い方: %s <job_id>", cmd)
+	}
+	jobID := args[0]
+
+	// Proposals of other chats are reported as missing, so that job IDs
+	// cannot be probed.
+	if p, ok := al.orderApprovalModule.GetPending(jobID); !ok || !(admin || sameChat(msg, p.Channel, p.ChatID)) {
+		return fmt.Sprintf("承認待ちの提案 %s は見つからなかったよ。/pending で確認してね。", jobID)
+	}
+
+	if cmd == "/deny" {
+		if _, ok := al.orderApprovalModule.Deny(jobID); !ok {
+			return fmt.Sprintf("承認待ちの提案 %s は見つからなかったよ。/pending で確認してね。", jobID)
+		}
+		al.recordJob(jobID, jobs.StateDone, "", "denied")
+		return fmt.Sprintf("了解、%s の提案は見送ったよ。", jobID)
+	}
+
+	pending, ok := al.orderApprovalModule.Approve(jobID)
+	if !ok {
+		return fmt.Sprintf("承認待ちの提案 %s は見つからなかったよ。/pending で確認してね。", jobID)
+	}
+	report := al.executeApprovedProposal(ctx, pending)
+
+	// Report to the chat the proposal came from when it was approved elsewhere.
+	if pending.Channel != "" && !constants.IsInternalChannel(pending.Channel) &&
+		(pending.Channel != msg.Channel || pending.ChatID != msg.ChatID) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: pending.Channel,
+			ChatID:  pending.ChatID,
+			Content: report,
+		})
+		return fmt.Sprintf("%s を承認して実行したよ。結果は元のチャット（%s:%s）に報告したよ。", jobID, pending.Channel, pending.ChatID)
+	}
+	return report
+}
+
+// executeApprovedProposal runs an approved patch through the Worker patch
+// executor and formats the result for the user.
+func (al *AgentLoop) executeApprovedProposal(ctx context.Context, pending order.PendingProposal) string {
+	p := pending.Proposal
+	logger.InfoCF("worker", "worker.patch_execution_start", map[string]interface{}{
+		"job_id":      p.JobID,
+		"order_id":    p.OrderID,
+		"patch_type":  detectPatchType(p.Patch),
+		"session_key": pending.SessionKey,
+	})
+
+	al.recordJob(p.JobID, jobs.StateExecuting, "", p.OrderID)
+	result, err := al.executeWorkerPatch(ctx, p.Patch, pending.SessionKey)
+	if err != nil {
+		al.recordJob(p.JobID, jobs.StateFailed, "", err.Error())
+		logger.ErrorCF("worker", "worker.patch_execution_error", map[string]interface{}{
+			"job_id": p.JobID,
+			"error":  err.Error(),
+		})
+		return fmt.Sprintf("%s の patch の実行に失敗したよ😢\n\nエラー: %v", p.JobID, err)
+	}
+
+	if result.Success {
+		al.recordJob(p.JobID, jobs.StateDone, "", result.Summary)
+	} else {
+		al.recordJob(p.JobID, jobs.StateFailed, "", result.Summary)
+	}
+
+	logger.InfoCF("worker", "worker.patch_execution_complete", map[string]interface{}{
+		"job_id":        p.JobID,
+		"success":       result.Success,
+		"executed_cmds": result.ExecutedCmds,
+		"failed_cmds":   result.FailedCmds,
+	})
+
+	head := fmt.Sprintf("%s の実行完了！✨", p.JobID)
+	if result.DryRun {
+		head = fmt.Sprintf("%s は dry-run だよ。ファイルはまだ変更していないよ。", p.JobID)
+	}
+	if !result.Success {
+		head = fmt.Sprintf("%s を実行したけど、失敗したコマンドがあるよ😢", p.JobID)
+	}
+	report := fmt.Sprintf("%s\n\n%s\n\n詳細:\n%s", head, result.Summary, formatExecutionResults(result.Results))
+	if result.DryRun && len(result.Files) > 0 {
+		report += "\n\n変更予定のファイル:\n" + formatFileChanges(result.Files)
+	}
+	return report
+}
+
+// formatPendingProposals lists pending proposals for /pending.
+func formatPendingProposals(list []order.PendingProposal) string {
+	if len(list) == 0 {
+		return "承認待ちの提案はないよ。"
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("承認待ちの提案は %d 件だよ。\n", len(list)))
+	for _, p := range list {
+		plan := strings.TrimSpace(p.Proposal.Plan)
+		if i := strings.Index(plan, "\n"); i >= 0 {
+			plan = plan[:i]
+		}
+		sb.WriteString(fmt.Sprintf("- %s（%s, %s:%s, %s）: %s\n",
+			p.Proposal.JobID, p.Proposal.OrderID, p.Channel, p.ChatID,
+			p.CreatedAt.Format("01/02 15:04"), utils.Truncate(plan, 60)))
+	}
+	sb.WriteString("/approve <job_id> で実行、/deny <job_id> で見送りだよ。")
+	return sb.String()
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// patchProposalProvider proposes writing a file at target.
+type patchProposalProvider struct{ target string }
+
+func (p *patchProposalProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content: "## Plan\nhello.go を追加する\n\n## Patch\n```go:" + p.target + "\npackage hello\n```\n\n## Risk\n低",
+	}, nil
+}
+
+func (p *patchProposalProvider) GetDefaultModel() string { return "proposal" }
+
+func newApprovalTestLoop(t *testing.T, workspace string) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Admins:            config.FlexibleStringSlice{"slack:admin"},
+			},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				CoderProvider: "ollama",
+				CoderModel:    "coder-a",
+			},
+		},
+		Loop:         config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Architecture: config.ArchitectureConfig{UseNewArchitecture: true},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &mockProvider{})
+	al.providerPool.Put("ollama", "coder-a", &patchProposalProvider{target: filepath.Join(workspace, "hello.go")})
+	return al, msgBus
+}
+
+func approvalMsg(channel, chatID, content string) bus.InboundMessage {
+	return bus.InboundMessage{
+		Channel:    channel,
+		ChatID:     chatID,
+		SenderID:   "u1",
+		SessionKey: channel + ":" + chatID,
+		Content:    content,
+	}
+}
+
+func TestApprovalFlow_ApproveExecutesAndReportsToOrigin(t *testing.T) {
+	workspace := t.TempDir()
+	al, msgBus := newApprovalTestLoop(t, workspace)
+	ctx := context.Background()
+
+	resp, err := al.processMessage(ctx, approvalMsg("telegram", "1", "/code1 hello.go を作って"))
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	m := regexp.MustCompile(`/approve (\S+)`).FindStringSubmatch(resp)
+	if m == nil {
+		t.Fatalf("expected an approval prompt, got:\n%s", resp)
+	}
+	jobID := m[1]
+	target := filepath.Join(workspace, "hello.go")
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatal("patch must not run before approval")
+	}
+	drainOutbound(msgBus)
+
+	// The pending proposal survives a restart.
+	al, msgBus = newApprovalTestLoop(t, workspace)
+	pending, _ := al.processMessage(ctx, approvalMsg("telegram", "1", "/pending"))
+	if !strings.Contains(pending, jobID) || !strings.Contains(pending, "telegram:1") {
+		t.Fatalf("/pending should list %s, got:\n%s", jobID, pending)
+	}
+
+	admin := approvalMsg("slack", "C1", "/approve "+jobID)
+	admin.SenderID = "admin"
+	resp, err = al.processMessage(ctx, admin)
+	if err != nil {
+		t.Fatalf("/approve failed: %v", err)
+	}
+	if !strings.Contains(resp, "telegram:1") {
+		t.Errorf("approver should be told where the result went, got %q", resp)
+	}
+	if data, err := os.ReadFile(target); err != nil || !strings.Contains(string(data), "package hello") {
+		t.Fatalf("approved patch was not applied: %v", err)
+	}
+
+	var report *bus.OutboundMessage
+	for _, out := range drainOutbound(msgBus) {
+		if out.Channel == "telegram" && out.ChatID == "1" {
+			out := out
+			report = &out
+		}
+	}
+	if report == nil || !strings.Contains(report.Content, "実行完了") {
+		t.Fatalf("expected the execution report on telegram:1, got %+v", report)
+	}
+
+	resp, _ = al.processMessage(ctx, approvalMsg("telegram", "1", "/approve "+jobID))
+	if !strings.Contains(resp, "見つからなかった") {
+		t.Errorf("a proposal can only be approved once, got %q", resp)
+	}
+}
+
+func TestApprovalFlow_Deny(t *testing.T) {
+	workspace := t.TempDir()
+	al, _ := newApprovalTestLoop(t, workspace)
+	ctx := context.Background()
+
+	resp, _ := al.processMessage(ctx, approvalMsg("telegram", "1", "/code1 hello.go を作って"))
+	m := regexp.MustCompile(`/deny (\S+)`).FindStringSubmatch(resp)
+	if m == nil {
+		t.Fatalf("expected an approval prompt, got:\n%s", resp)
+	}
+
+	resp, _ = al.processMessage(ctx, approvalMsg("telegram", "1", "/deny "+m[1]))
+	if !strings.Contains(resp, "見送った") {
+		t.Errorf("unexpected /deny reply %q", resp)
+	}
+	if resp, _ = al.processMessage(ctx, approvalMsg("telegram", "1", "/pending")); resp != "承認待ちの提案はないよ。" {
+		t.Errorf("expected no pending proposals, got %q", resp)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "hello.go")); !os.IsNotExist(err) {
+		t.Error("denied patch must not run")
+	}
+}
+
+func TestApprovalFlow_ScopedToOriginChat(t *testing.T) {
+	workspace := t.TempDir()
+	al, _ := newApprovalTestLoop(t, workspace)
+	ctx := context.Background()
+
+	resp, _ := al.processMessage(ctx, approvalMsg("telegram", "1", "/code1 hello.go を作って"))
+	m := regexp.MustCompile(`/approve (\S+)`).FindStringSubmatch(resp)
+	if m == nil {
+		t.Fatalf("expected an approval prompt, got:\n%s", resp)
+	}
+	jobID := m[1]
+
+	if resp, _ := al.processMessage(ctx, approvalMsg("telegram", "2", "/pending")); strings.Contains(resp, jobID) {
+		t.Errorf("another chat must not see the proposal, got:\n%s", resp)
+	}
+	for _, cmd := range []string{"/approve ", "/deny "} {
+		resp, _ := al.processMessage(ctx, approvalMsg("slack", "C1", cmd+jobID))
+		if !strings.Contains(resp, "見つからなかった") {
+			t.Errorf("%s from another chat should be rejected, got %q", cmd, resp)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "hello.go")); !os.IsNotExist(err) {
+		t.Fatal("a proposal must not run when approved from another chat")
+	}
+
+	admin := approvalMsg("slack", "C1", "/pending")
+	admin.SenderID = "admin"
+	if resp, _ := al.processMessage(ctx, admin); !strings.Contains(resp, jobID) {
+		t.Errorf("admins should see every chat's proposals, got:\n%s", resp)
+	}
+	if resp, _ := al.processMessage(ctx, approvalMsg("telegram", "1", "/pending")); !strings.Contains(resp, jobID) {
+		t.Errorf("the origin chat should see its proposal, got:\n%s", resp)
+	}
+}
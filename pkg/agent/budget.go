@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/constants"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/state"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+)
+
+// budgetVerdict is the outcome of checking a turn against the budgets.
+type budgetVerdict struct {
+	Refuse  bool   // hard limit reached: the turn must not run
+	Demote  bool   // soft limit reached: run the turn on local models only
+	Limit   string // which limit was hit, e.g. "sender_daily_tokens"
+	Key     string // sender, channel or session the limit applies to
+	Message string // user-facing notice in the chat persona's voice
+}
+
+// budgetGuard enforces config.BudgetConfig. Counters live in state.Manager so
+// they survive restarts; token and spend counters are fed from the usage ledger.
+type budgetGuard struct {
+	cfg   config.BudgetConfig
+	state *state.Manager
+	now   func() time.Time
+}
+
+// newBudgetGuard returns nil when budgets are disabled.
+func newBudgetGuard(cfg config.BudgetConfig, st *state.Manager) *budgetGuard {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &budgetGuard{cfg: cfg, state: st, now: time.Now}
+}
+
+func (g *budgetGuard) today() string {
+	return g.now().Format("2006-01-02")
+}
+
+// rollover resets b when it belongs to a previous day.
+func rolloverBudget(b *state.BudgetUsage, day string) {
+	if b.Day == day {
+		return
+	}
+	*b = state.BudgetUsage{Day: day}
+}
+
+// usage returns today's counters.
+func (g *budgetGuard) usage() state.BudgetUsage {
+	b := g.state.GetBudgetUsage()
+	rolloverBudget(&b, g.today())
+	return b
+}
+
+// record is registered on the usage ledger and adds a call to the counters.
+// A CODE3 turn is counted when it first reaches a cloud provider on the CODE3
+// binding, whichever way it got there (an explicit /code3, CODE resolved by
+// selectCoderRoute, or order3 in deliberation); the ledger record carries the
+// route the provider was bound for.
+func (g *budgetGuard) record(rec usage.Record) {
+	cloud := !providers.IsLocalProvider(rec.Provider)
+	cloudUSD := 0.0
+	if rec.Channel != "" && cloud {
+		cloudUSD = rec.CostUSD
+	}
+	code3Session := ""
+	if cloud && strings.EqualFold(strings.TrimSpace(rec.Route), RouteCode3) {
+		code3Session = parentSessionKey(rec.SessionKey)
+	}
+	if (rec.SenderID == "" || rec.TotalTokens == 0) && cloudUSD == 0 && code3Session == "" {
+		return
+	}
+	day := g.today()
+	err := g.state.UpdateBudgetUsage(func(b *state.BudgetUsage) {
+		rolloverBudget(b, day)
+		if code3Session != "" {
+			countCode3(b, code3Session, rec.JobID)
+		}
+		if rec.SenderID != "" && rec.TotalTokens > 0 {
+			if b.SenderTokens == nil {
+				b.SenderTokens = make(map[string]int)
+			}
+			b.SenderTokens[rec.SenderID] += rec.TotalTokens
+		}
+		if cloudUSD > 0 {
+			if b.ChannelCloudUSD == nil {
+				b.ChannelCloudUSD = make(map[string]float64)
+			}
+			b.ChannelCloudUSD[rec.Channel] += cloudUSD
+		}
+	})
+	if err != nil {
+		logger.WarnCF("agent", "budget.save_failed", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// check evaluates a turn on route. Hard limits win over soft limits.
+func (g *budgetGuard) check(senderID, channel, sessionKey, route string) budgetVerdict {
+	b := g.usage()
+	code3 := strings.EqualFold(strings.TrimSpace(route), RouteCode3)
+	tokens := b.SenderTokens[senderID]
+	spend := b.ChannelCloudUSD[channel]
+	code3Calls := b.SessionCode3Calls[sessionKey]
+
+	switch {
+	case senderID != "" && g.cfg.SenderDailyTokensHard > 0 && tokens >= g.cfg.SenderDailyTokensHard:
+		return budgetVerdict{Refuse: true, Limit: "sender_daily_tokens", Key: senderID,
+			Message: "ごめんね、今日の利用上限に達しちゃったから、この依頼は受けられないよ。また明日声をかけてね。"}
+	case channel != "" && g.cfg.ChannelDailyCloudUSDHard > 0 && spend >= g.cfg.ChannelDailyCloudUSDHard:
+		return budgetVerdict{Refuse: true, Limit: "channel_daily_cloud_usd", Key: channel,
+			Message: "ごめんね、今日のクラウド利用上限に達しちゃったから、この依頼は受けられないよ。また明日声をかけてね。"}
+	case code3 && g.cfg.SessionCode3CallsHard > 0 && code3Calls >= g.cfg.SessionCode3CallsHard:
+		return budgetVerdict{Refuse: true, Limit: "session_code3_calls", Key: sessionKey,
+			Message: fmt.Sprintf("ごめんね、今日このセッションで使える高品質コーディング（CODE3）の上限（%d回）に達しちゃったよ。また明日お願いね。", g.cfg.SessionCode3CallsHard)}
+	case senderID != "" && g.cfg.SenderDailyTokensSoft > 0 && tokens >= g.cfg.SenderDailyTokensSoft:
+		return budgetVerdict{Demote: true, Limit: "sender_daily_tokens", Key: senderID,
+			Message: "今日はたくさんお話ししたから、ここからはローカルモデルで対応するね。"}
+	case channel != "" && g.cfg.ChannelDailyCloudUSDSoft > 0 && spend >= g.cfg.ChannelDailyCloudUSDSoft:
+		return budgetVerdict{Demote: true, Limit: "channel_daily_cloud_usd", Key: channel,
+			Message: "今日のクラウド利用が目安を超えたから、ここからはローカルモデルで対応するね。"}
+	case code3 && g.cfg.SessionCode3CallsSoft > 0 && code3Calls >= g.cfg.SessionCode3CallsSoft:
+		return budgetVerdict{Demote: true, Limit: "session_code3_calls", Key: sessionKey,
+			Message: "このセッションの高品質コーディング（CODE3）が目安の回数に達したから、ここからはローカルモデルで進めるね。"}
+	}
+	return budgetVerdict{}
+}
+
+// countCode3 records one CODE3 turn for sessionKey. Calls of a job already
+// counted are not counted again; calls without a job count one each.
+func countCode3(b *state.BudgetUsage, sessionKey, jobID string) {
+	if jobID != "" {
+		if b.Code3Jobs[jobID] {
+			return
+		}
+		if b.Code3Jobs == nil {
+			b.Code3Jobs = make(map[string]bool)
+		}
+		b.Code3Jobs[jobID] = true
+	}
+	if b.SessionCode3Calls == nil {
+		b.SessionCode3Calls = make(map[string]int)
+	}
+	b.SessionCode3Calls[sessionKey]++
+}
+
+// delegateSessionKey is the throwaway session a DELEGATE directive runs in.
+func delegateSessionKey(parent string) string {
+	return fmt.Sprintf("%s:delegate:%d", parent, time.Now().UnixNano())
+}
+
+// parentSessionKey maps a delegate session back to the chat session it was
+// made for; other keys are returned unchanged.
+func parentSessionKey(key string) string {
+	parent, _, _ := strings.Cut(key, ":delegate:")
+	return parent
+}
+
+// budgetRoute is the route a turn is checked against: the one its provider
+// will be bound for. A CODE turn goes where selectCoderRoute sends its task,
+// as in bindRouteWithTask.
+func budgetRoute(route, taskText string) string {
+	if strings.EqualFold(strings.TrimSpace(route), RouteCode) {
+		return selectCoderRoute(taskText)
+	}
+	return route
+}
+
+// firstNotice reports whether the soft-limit notice for key has not been sent
+// today, and marks it as sent.
+func (g *budgetGuard) firstNotice(key string) bool {
+	day := g.today()
+	first := false
+	err := g.state.UpdateBudgetUsage(func(b *state.BudgetUsage) {
+		rolloverBudget(b, day)
+		if b.Notified[key] {
+			return
+		}
+		if b.Notified == nil {
+			b.Notified = make(map[string]bool)
+		}
+		b.Notified[key] = true
+		first = true
+	})
+	if err != nil {
+		logger.WarnCF("agent", "budget.save_failed", map[string]interface{}{"error": err.Error()})
+	}
+	return first
+}
+
+// applyBudget checks a turn on route for msg. route must be the route the
+// turn's provider is bound for (see budgetRoute). A refused turn returns the
+// persona's refusal; a soft limit forces localOnly and tells the user once a
+// day. CODE3 turns are counted from the usage ledger as they run.
+func (al *AgentLoop) applyBudget(msg bus.InboundMessage, route string, localOnly bool) (bool, bool, string) {
+	if al.budget == nil {
+		return localOnly, false, ""
+	}
+	verdict := al.budget.check(msg.SenderID, msg.Channel, msg.SessionKey, route)
+	if verdict.Refuse || verdict.Demote {
+		logger.InfoCF("agent", "budget.limit", map[string]interface{}{
+			"limit":       verdict.Limit,
+			"key":         verdict.Key,
+			"hard":        verdict.Refuse,
+			"route":       route,
+			"session_key": msg.SessionKey,
+		})
+	}
+	if verdict.Refuse {
+		return localOnly, true, verdict.Message
+	}
+	if verdict.Demote {
+		localOnly = true
+		if !constants.IsInternalChannel(msg.Channel) && al.budget.firstNotice(verdict.Limit+":"+verdict.Key) {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: verdict.Message,
+			})
+		}
+	}
+	return localOnly, false, ""
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/state"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+)
+
+func newBudgetTestLoop(t *testing.T, budget config.BudgetConfig) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	budget.Enabled = true
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Providers: config.ProvidersConfig{
+			DeepSeek: config.ProviderConfig{APIKey: "k"},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				ChatProvider: "deepseek",
+				ChatModel:    "deepseek-chat",
+			},
+		},
+		Loop:   config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Budget: budget,
+	}
+	msgBus := bus.NewMessageBus()
+	return NewAgentLoop(cfg, msgBus, &mockProvider{}), msgBus
+}
+
+func TestBudgetGuard_CheckAndRollover(t *testing.T) {
+	g := newBudgetGuard(config.BudgetConfig{
+		Enabled:                  true,
+		SenderDailyTokensSoft:    100,
+		SenderDailyTokensHard:    200,
+		ChannelDailyCloudUSDHard: 1.0,
+		SessionCode3CallsHard:    1,
+	}, state.NewManager(t.TempDir()))
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.Local)
+	g.now = func() time.Time { return now }
+
+	if v := g.check("u1", "telegram", "telegram:1", RouteChat); v.Refuse || v.Demote {
+		t.Fatalf("fresh budget should allow the turn, got %+v", v)
+	}
+
+	g.record(usage.Record{SenderID: "u1", Channel: "telegram", Provider: "ollama", TotalTokens: 150})
+	if v := g.check("u1", "telegram", "telegram:1", RouteChat); !v.Demote || v.Limit != "sender_daily_tokens" {
+		t.Errorf("expected soft token limit, got %+v", v)
+	}
+	if v := g.check("u2", "telegram", "telegram:1", RouteChat); v.Demote || v.Refuse {
+		t.Errorf("limits are per sender, got %+v", v)
+	}
+
+	g.record(usage.Record{SenderID: "u1", Channel: "telegram", Provider: "ollama", TotalTokens: 60, CostUSD: 5})
+	if v := g.check("u1", "telegram", "telegram:1", RouteChat); !v.Refuse || v.Limit != "sender_daily_tokens" {
+		t.Errorf("expected hard token limit, got %+v", v)
+	}
+	if v := g.check("u2", "telegram", "telegram:1", RouteChat); v.Refuse {
+		t.Errorf("local provider cost must not count as cloud spend, got %+v", v)
+	}
+
+	g.record(usage.Record{Channel: "slack", Provider: "anthropic", CostUSD: 1.5})
+	if v := g.check("u3", "slack", "slack:1", RouteChat); !v.Refuse || v.Limit != "channel_daily_cloud_usd" {
+		t.Errorf("expected hard cloud spend limit, got %+v", v)
+	}
+
+	g.record(usage.Record{SessionKey: "discord:1", Route: RouteCode3, Provider: "anthropic", JobID: "j1"})
+	if v := g.check("u3", "discord", "discord:1", RouteCode3); !v.Refuse || v.Limit != "session_code3_calls" {
+		t.Errorf("expected CODE3 cap, got %+v", v)
+	}
+	if v := g.check("u3", "discord", "discord:1", RouteChat); v.Refuse {
+		t.Errorf("CODE3 cap must only apply to CODE3 turns, got %+v", v)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if v := g.check("u1", "slack", "discord:1", RouteCode3); v.Refuse || v.Demote {
+		t.Errorf("counters should reset on a new day, got %+v", v)
+	}
+}
+
+func TestProcessMessage_HardBudgetRefusesTurn(t *testing.T) {
+	al, _ := newBudgetTestLoop(t, config.BudgetConfig{SenderDailyTokensHard: 10})
+	al.budget.record(usage.Record{SenderID: "u1", TotalTokens: 10})
+
+	resp, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", ChatID: "1", SenderID: "u1", SessionKey: "telegram:1", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	if !strings.Contains(resp, "上限") {
+		t.Errorf("expected refusal, got %q", resp)
+	}
+	if len(al.sessions.GetHistory("telegram:1")) != 0 {
+		t.Error("refused turns must not reach the LLM or history")
+	}
+}
+
+func TestApplyBudget_SoftLimitDemotesToLocalOnce(t *testing.T) {
+	al, msgBus := newBudgetTestLoop(t, config.BudgetConfig{ChannelDailyCloudUSDSoft: 1})
+	al.budget.record(usage.Record{Channel: "telegram", Provider: "deepseek", CostUSD: 2})
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", SessionKey: "telegram:1"}
+
+	localOnly, refused, _ := al.applyBudget(msg, RouteChat, false)
+	if refused || !localOnly {
+		t.Fatalf("expected demotion, got localOnly=%v refused=%v", localOnly, refused)
+	}
+	al.applyBudget(msg, RouteChat, false)
+	notices := drainOutbound(msgBus)
+	if len(notices) != 1 || !strings.Contains(notices[0].Content, "ローカル") {
+		t.Fatalf("expected one persona notice, got %+v", notices)
+	}
+
+	b, err := al.bindRoute(RouteChat, localOnly)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if b.ProviderName != "ollama" {
+		t.Errorf("demoted CHAT turn should bind a local provider, got %s/%s", b.ProviderName, b.Model)
+	}
+}
+
+func TestApplyBudget_CountsCloudCode3Turns(t *testing.T) {
+	al, _ := newBudgetTestLoop(t, config.BudgetConfig{SessionCode3CallsHard: 2})
+	msg := bus.InboundMessage{Channel: "cli", ChatID: "direct", SessionKey: "cli:direct"}
+
+	// Local CODE3 calls and other routes do not count.
+	al.budget.record(usage.Record{SessionKey: "cli:direct", Route: RouteCode3, Provider: "ollama", JobID: "j0"})
+	al.budget.record(usage.Record{SessionKey: "cli:direct", Route: RouteCode2, Provider: "anthropic", JobID: "j0"})
+	// A turn's calls count once, also from its delegate session.
+	al.budget.record(usage.Record{SessionKey: "cli:direct", Route: RouteCode3, Provider: "anthropic", JobID: "j1"})
+	al.budget.record(usage.Record{SessionKey: delegateSessionKey("cli:direct"), Route: RouteCode3, Provider: "anthropic", JobID: "j1"})
+	if _, refused, _ := al.applyBudget(msg, RouteCode3, false); refused {
+		t.Fatal("second CODE3 turn refused too early")
+	}
+	al.budget.record(usage.Record{SessionKey: delegateSessionKey("cli:direct"), Route: RouteCode3, Provider: "anthropic", JobID: "j2"})
+	if _, refused, _ := al.applyBudget(msg, RouteCode3, false); !refused {
+		t.Error("third CODE3 turn should be refused")
+	}
+	if _, refused, _ := al.applyBudget(msg, budgetRoute(RouteCode, "production outage fix"), false); !refused {
+		t.Error("a CODE turn that selectCoderRoute sends to CODE3 should be refused too")
+	}
+	if _, refused, _ := al.applyBudget(msg, budgetRoute(RouteCode, "rename a variable"), false); refused {
+		t.Error("a CODE turn on CODE2 is not capped")
+	}
+
+	// Counters survive a restart through state.Manager.
+	if got := state.NewManager(al.workspace).GetBudgetUsage().SessionCode3Calls["cli:direct"]; got != 2 {
+		t.Errorf("persisted CODE3 calls = %d, want 2", got)
+	}
+}
+
+func TestBindRouteWithTask_RecordsTargetRoute(t *testing.T) {
+	al, _ := newBudgetTestLoop(t, config.BudgetConfig{})
+	for task, want := range map[string]string{
+		"":                      RouteCode2,
+		"production outage fix": RouteCode3,
+		"write the design spec": RouteCode1,
+	} {
+		b, err := al.bindRouteWithTask(RouteCode, task, false)
+		if err != nil {
+			t.Fatalf("bindRouteWithTask(%q) failed: %v", task, err)
+		}
+		if b.Target != want {
+			t.Errorf("Target for %q = %s, want %s", task, b.Target, want)
+		}
+	}
+}
+
+func TestProcessMessageNewArch_DemotedChatTurnStaysLocal(t *testing.T) {
+	al, _ := newBudgetTestLoop(t, config.BudgetConfig{ChannelDailyCloudUSDSoft: 1})
+	al.cfg.Architecture.UseNewArchitecture = true
+	al.cfg.Routing.LLM.WorkerProvider = "deepseek"
+	al.cfg.Routing.LLM.WorkerModel = "deepseek-chat"
+	cloud := &recordingProvider{}
+	al.providerPool.Put("deepseek", "deepseek-chat", cloud)
+	if err := al.initializeNewArchitecture(context.Background()); err != nil {
+		t.Fatalf("initializeNewArchitecture failed: %v", err)
+	}
+	al.budget.record(usage.Record{Channel: "telegram", Provider: "deepseek", CostUSD: 2})
+
+	_, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", ChatID: "1", SenderID: "u1", SessionKey: "telegram:1", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	if route := al.sessions.GetRoutes("telegram:1"); len(route) != 1 || route[0].Route != RouteChat {
+		t.Fatalf("expected a CHAT turn, got %+v", route)
+	}
+	if cloud.got != nil {
+		t.Error("a demoted CHAT turn reached the cloud provider")
+	}
+}
@@ -16,19 +16,27 @@ type Classification struct {
 }
 
 type Classifier struct {
-	provider providers.LLMProvider
-	model    string
+	binding func() RouteBinding
 }
 
+// NewClassifier creates a classifier bound to a fixed provider and model.
 func NewClassifier(provider providers.LLMProvider, model string) *Classifier {
-	return &Classifier{
-		provider: provider,
-		model:    model,
-	}
+	fixed := RouteBinding{Provider: provider, Model: model}
+	return NewBindingClassifier(func() RouteBinding { return fixed })
+}
+
+// NewBindingClassifier creates a classifier that resolves its binding on every call,
+// so it follows model switches without sharing mutable state with in-flight turns.
+func NewBindingClassifier(binding func() RouteBinding) *Classifier {
+	return &Classifier{binding: binding}
 }
 
 func (c *Classifier) Classify(ctx context.Context, userText string) (Classification, bool) {
-	if c == nil || c.provider == nil {
+	if c == nil || c.binding == nil {
+		return Classification{}, false
+	}
+	binding := c.binding()
+	if binding.Provider == nil {
 		return Classification{}, false
 	}
 
@@ -36,10 +44,10 @@ func (c *Classifier) Classify(ctx context.Context, userText string) (Classificat
 		"route must be one of CHAT, PLAN, ANALYZE, OPS, RESEARCH, CODE. confidence must be 0..1."
 	userPrompt := "Classify this message:\n" + userText
 
-	resp, err := c.provider.Chat(ctx, []providers.Message{
+	resp, err := binding.Provider.Chat(ctx, []providers.Message{
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
-	}, nil, c.model, map[string]interface{}{
+	}, nil, binding.Model, map[string]interface{}{
 		"temperature": 0.0,
 		"max_tokens":  300,
 	})
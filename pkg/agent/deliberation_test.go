@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/chat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// blockingProvider never answers until ctx is done.
+type blockingProvider struct{}
+
+func (p *blockingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *blockingProvider) GetDefaultModel() string { return "blocking" }
+
+// proposalProvider returns a fixed proposal in the format Orders expect.
+type proposalProvider struct{ risk string }
+
+func (p *proposalProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content: "## Plan\n設定を直して TestLoad を追加する\n\n## Patch\n```go:/tmp/none.go\npackage none\n```\n\n## Risk\n" + p.risk,
+	}, nil
+}
+
+func (p *proposalProvider) GetDefaultModel() string { return "proposal" }
+
+// promptLogProvider records the last message of every call.
+type promptLogProvider struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (p *promptLogProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(messages) > 0 {
+		p.prompts = append(p.prompts, messages[len(messages)-1].Content)
+	}
+	return &providers.LLMResponse{Content: "Mock response"}, nil
+}
+
+func (p *promptLogProvider) GetDefaultModel() string { return "prompt-log" }
+
+func TestDeliberateNewArch_CollectsPartialResults(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				CoderProvider:  "ollama",
+				CoderModel:     "coder-a",
+				Coder2Provider: "ollama",
+				Coder2Model:    "coder-b",
+				Coder3Provider: "ollama",
+				Coder3Model:    "coder-c",
+			},
+		},
+		Loop:         config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Architecture: config.ArchitectureConfig{EnableDeliberation: true, DeliberationTimeoutSec: 1},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	al.providerPool.Put("ollama", "coder-a", &proposalProvider{risk: "高"})
+	al.providerPool.Put("ollama", "coder-b", &proposalProvider{risk: "低"})
+	al.providerPool.Put("ollama", "coder-c", &blockingProvider{})
+
+	start := time.Now()
+	results := al.deliberateNewArch(context.Background(), chat.Task{JobID: "job_20261016_001", UserText: "設定を直して"}, false)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("deliberation should stop at the per-Order timeout, took %s", elapsed)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, r := range results[:2] {
+		if !r.Success {
+			t.Errorf("%s should succeed, got %v", r.OrderID, r.Error)
+		}
+	}
+	if results[2].OrderID != "order3" || results[2].Success || results[2].Error == nil ||
+		!strings.Contains(results[2].Error.Error(), "timed out") {
+		t.Errorf("order3 should time out, got %+v", results[2])
+	}
+}
+
+func TestProcessMessageNewArch_LocalJudgeStaysLocal(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Providers: config.ProvidersConfig{
+			DeepSeek: config.ProviderConfig{APIKey: "k"},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				WorkerProvider: "deepseek",
+				WorkerModel:    "deepseek-chat",
+				CoderProvider:  "ollama",
+				CoderModel:     "coder-a",
+				Coder2Provider: "ollama",
+				Coder2Model:    "coder-b",
+				Coder3Provider: "ollama",
+				Coder3Model:    "coder-c",
+			},
+		},
+		Loop: config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Architecture: config.ArchitectureConfig{
+			UseNewArchitecture:     true,
+			EnableDeliberation:     true,
+			DeliberationTimeoutSec: 5,
+		},
+	}
+	local := &promptLogProvider{}
+	cloud := &promptLogProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), local)
+	al.providerPool.Put("deepseek", "deepseek-chat", cloud)
+	al.providerPool.Put("ollama", "coder-a", &proposalProvider{risk: "高"})
+	al.providerPool.Put("ollama", "coder-b", &proposalProvider{risk: "低"})
+	al.providerPool.Put("ollama", "coder-c", &proposalProvider{risk: "中"})
+
+	flags := al.sessions.GetFlags("cli:direct")
+	flags.LocalOnly = true
+	al.sessions.SetFlags("cli:direct", flags)
+
+	if _, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "cli", ChatID: "direct", SenderID: "u1", SessionKey: "cli:direct", Content: "config.go の設定を直して",
+	}); err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	if len(cloud.prompts) != 0 {
+		t.Errorf("the /local deliberation judge reached the cloud Worker provider: %q", cloud.prompts)
+	}
+	judged := false
+	for _, p := range local.prompts {
+		judged = judged || strings.Contains(p, "採点")
+	}
+	if !judged {
+		t.Errorf("the judge should run on the local provider, got %q", local.prompts)
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+// DefaultMaxConcurrentSessions is used when LoopConfig.MaxConcurrentSessions is unset.
+const DefaultMaxConcurrentSessions = 4
+
+// controlLane is the queue key of job-control commands (/jobs, /status,
+// /cancel). It cannot collide with a session key or a channel:chat pair.
+const controlLane = "\x00control"
+
+// sessionDispatcher fans inbound messages out to per-session workers.
+// Messages that share a SessionKey are handled strictly in arrival order,
+// while different sessions run in parallel up to a global concurrency cap.
+// Job-control commands go through a control lane instead: a single worker
+// outside the cap, so they never wait behind the jobs they are about.
+type sessionDispatcher struct {
+	handle func(ctx context.Context, msg bus.InboundMessage)
+	sem    chan struct{}
+
+	mu     sync.Mutex
+	queues map[string][]bus.InboundMessage
+	wg     sync.WaitGroup
+}
+
+func newSessionDispatcher(maxConcurrent int, handle func(ctx context.Context, msg bus.InboundMessage)) *sessionDispatcher {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrentSessions
+	}
+	return &sessionDispatcher{
+		handle: handle,
+		sem:    make(chan struct{}, maxConcurrent),
+		queues: make(map[string][]bus.InboundMessage),
+	}
+}
+
+// Dispatch enqueues msg on its session queue, starting a worker for the
+// session if none is active.
+func (d *sessionDispatcher) Dispatch(ctx context.Context, msg bus.InboundMessage) {
+	d.enqueue(ctx, dispatchKey(msg), msg)
+}
+
+// DispatchControl enqueues a job-control command on the control lane.
+func (d *sessionDispatcher) DispatchControl(ctx context.Context, msg bus.InboundMessage) {
+	d.enqueue(ctx, controlLane, msg)
+}
+
+func (d *sessionDispatcher) enqueue(ctx context.Context, key string, msg bus.InboundMessage) {
+	d.mu.Lock()
+	pending, active := d.queues[key]
+	d.queues[key] = append(pending, msg)
+	d.mu.Unlock()
+
+	if active {
+		logger.DebugCF("agent", "dispatch.queued", map[string]interface{}{
+			"session_key": key,
+			"queued":      len(pending) + 1,
+		})
+		return
+	}
+
+	d.wg.Add(1)
+	go d.work(ctx, key)
+}
+
+// Wait blocks until every session worker and the control lane have drained
+// their queues.
+func (d *sessionDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *sessionDispatcher) work(ctx context.Context, key string) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		pending := d.queues[key]
+		if len(pending) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		msg := pending[0]
+		d.queues[key] = pending[1:]
+		d.mu.Unlock()
+
+		if key == controlLane {
+			if ctx.Err() != nil {
+				d.drop(key)
+				return
+			}
+			d.handle(ctx, msg)
+			continue
+		}
+
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			d.drop(key)
+			return
+		}
+		d.handle(ctx, msg)
+		<-d.sem
+	}
+}
+
+// drop discards the rest of key's queue once the dispatcher is shutting down.
+func (d *sessionDispatcher) drop(key string) {
+	d.mu.Lock()
+	delete(d.queues, key)
+	d.mu.Unlock()
+}
+
+// dispatchKey returns the ordering key for msg. Messages without a session
+// key fall back to their channel/chat pair so they are still serialized.
+func dispatchKey(msg bus.InboundMessage) string {
+	if msg.SessionKey != "" {
+		return msg.SessionKey
+	}
+	return msg.Channel + ":" + msg.ChatID
+}
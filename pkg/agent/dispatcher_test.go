@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+)
+
+func TestSessionDispatcher_PreservesOrderWithinSession(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		got = append(got, msg.Content)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	for _, c := range []string{"1", "2", "3", "4", "5"} {
+		d.Dispatch(ctx, bus.InboundMessage{SessionKey: "line:u1", Content: c})
+	}
+	d.Wait()
+
+	want := []string{"1", "2", "3", "4", "5"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d messages, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order mismatch at %d: got %v", i, got)
+		}
+	}
+}
+
+func TestSessionDispatcher_RunsSessionsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		started <- msg.SessionKey
+		<-release
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "line:slow"})
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "telegram:fast"})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("second session was blocked behind the first")
+		}
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestSessionDispatcher_RespectsConcurrencyCap(t *testing.T) {
+	var inFlight, peak int32
+
+	d := newSessionDispatcher(2, func(ctx context.Context, msg bus.InboundMessage) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	})
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		d.Dispatch(ctx, bus.InboundMessage{SessionKey: key})
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent sessions, got %d", peak)
+	}
+}
+
+func TestSessionDispatcher_ControlLaneBypassesCapAndIsWaited(t *testing.T) {
+	release := make(chan struct{})
+	var inFlight, peak, handled int32
+
+	d := newSessionDispatcher(1, func(ctx context.Context, msg bus.InboundMessage) {
+		if msg.Content != "/status" {
+			<-release
+			return
+		}
+		n := atomic.AddInt32(&inFlight, 1)
+		if n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&handled, 1)
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "line:busy", Content: "long job"})
+	for i := 0; i < 5; i++ {
+		d.DispatchControl(ctx, bus.InboundMessage{SessionKey: "line:busy", Content: "/status"})
+	}
+
+	deadline := time.After(time.Second)
+	for atomic.LoadInt32(&handled) < 5 {
+		select {
+		case <-deadline:
+			t.Fatal("control commands were blocked behind the running job")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if peak != 1 {
+		t.Fatalf("expected control commands to run one at a time, peak=%d", peak)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Wait returned while a session worker was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+}
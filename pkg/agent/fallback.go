@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/health"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+const ollamaRestartTimeout = 2 * time.Minute
+
+func newCircuitBreakers(cfg config.CircuitBreakerConfig) *providers.CircuitBreakers {
+	return providers.NewCircuitBreakers(providers.BreakerConfig{
+		FailureThreshold:  cfg.FailureThreshold,
+		OpenDuration:      time.Duration(cfg.OpenSeconds) * time.Second,
+		SlowCallThreshold: time.Duration(cfg.SlowCallMS) * time.Millisecond,
+	})
+}
+
+// resolveRouteFallbacks returns the configured fallback chain for route,
+// following the same role inheritance as resolveRouteLLMWithTask.
+func (al *AgentLoop) resolveRouteFallbacks(route, taskText string) []string {
+	llmCfg := al.cfg.Routing.LLM
+	first := func(lists ...[]string) []string {
+		for _, l := range lists {
+			if len(l) > 0 {
+				return l
+			}
+		}
+		return nil
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(route)) {
+	case RouteCode1:
+		return llmCfg.CoderFallbacks
+	case RouteCode2:
+		return first(llmCfg.Coder2Fallbacks, llmCfg.CoderFallbacks)
+	case RouteCode3:
+		return first(llmCfg.Coder3Fallbacks, llmCfg.Coder2Fallbacks, llmCfg.CoderFallbacks)
+	case RouteCode:
+		return al.resolveRouteFallbacks(selectCoderRoute(taskText), "")
+	case RouteChat:
+		return llmCfg.ChatFallbacks
+	default:
+		if strings.TrimSpace(llmCfg.WorkerProvider) == "" {
+			return first(llmCfg.WorkerFallbacks, llmCfg.ChatFallbacks)
+		}
+		return llmCfg.WorkerFallbacks
+	}
+}
+
+// parseFallbackEntry splits "provider/model" at the first slash.
+// "ollama/chat-v1:latest" → ("ollama", "chat-v1:latest"),
+// "openrouter/openai/gpt-4o" → ("openrouter", "openai/gpt-4o").
+func parseFallbackEntry(entry string) (string, string) {
+	entry = strings.TrimSpace(entry)
+	if idx := strings.Index(entry, "/"); idx != -1 {
+		return strings.ToLower(strings.TrimSpace(entry[:idx])), strings.TrimSpace(entry[idx+1:])
+	}
+	return strings.ToLower(entry), ""
+}
+
+// withFallbacks wraps primary in a FallbackProvider over the route's fallback
+// chain. Routes without fallbacks are wrapped too, as a chain of one, so that
+// every call is recorded by the circuit breakers (an open Ollama circuit is
+// what triggers OllamaRestartCommand). In /local mode (or after a soft budget demotion) only local
+// providers are used: a cloud primary is dropped and, when the chain has no
+// local entry either, the turn is demoted to a local role provider.
+func (al *AgentLoop) withFallbacks(primary RouteBinding, route, taskText string, localOnly bool) (RouteBinding, error) {
+	entries := al.resolveRouteFallbacks(route, taskText)
+
+	var candidates []providers.FallbackCandidate
+	if !localOnly || providers.IsLocalProvider(primary.ProviderName) {
+		candidates = append(candidates, providers.FallbackCandidate{
+			Name:     primary.ProviderName,
+			Model:    primary.Model,
+			Provider: primary.Provider,
+		})
+	} else {
+		logger.InfoCF("agent", "route.fallback.skipped", map[string]interface{}{
+			"route":    route,
+			"provider": primary.ProviderName,
+			"model":    primary.Model,
+			"reason":   "local_only",
+		})
+	}
+	for _, entry := range entries {
+		name, model := parseFallbackEntry(entry)
+		if name == "" {
+			continue
+		}
+		if localOnly && !providers.IsLocalProvider(name) {
+			logger.InfoCF("agent", "route.fallback.skipped", map[string]interface{}{
+				"route":    route,
+				"provider": name,
+				"model":    model,
+				"reason":   "local_only",
+			})
+			continue
+		}
+		p, err := al.providerPool.Get(name, model)
+		if err != nil {
+			logger.WarnCF("agent", "route.fallback.skipped", map[string]interface{}{
+				"route":    route,
+				"provider": name,
+				"model":    model,
+				"reason":   err.Error(),
+			})
+			continue
+		}
+		candidates = append(candidates, providers.FallbackCandidate{Name: name, Model: model, Provider: p})
+	}
+	if len(candidates) == 0 {
+		local, ok := al.localDemotionCandidate()
+		if !ok {
+			return RouteBinding{}, fmt.Errorf("no local provider available for route %s in local-only mode", route)
+		}
+		logger.InfoCF("agent", "route.local_only.demoted", map[string]interface{}{
+			"route":    route,
+			"from":     primary.ProviderName + "/" + primary.Model,
+			"provider": local.Name,
+			"model":    local.Model,
+		})
+		candidates = append(candidates, local)
+	}
+
+	primary.ProviderName = candidates[0].Name
+	primary.Model = candidates[0].Model
+	primary.Provider = providers.NewFallbackProvider(route, candidates, al.breakers)
+	return primary, nil
+}
+
+// localDemotionCandidate returns the first local provider among the Chat role,
+// the Worker role and the default binding.
+func (al *AgentLoop) localDemotionCandidate() (providers.FallbackCandidate, bool) {
+	for _, route := range []string{RouteChat, RoutePlan} {
+		name, model := al.resolveRouteLLM(route)
+		if !providers.IsLocalProvider(name) {
+			continue
+		}
+		if model == "" {
+			model = al.defaultRouteBinding().Model
+		}
+		if p, err := al.providerPool.Get(name, model); err == nil {
+			return providers.FallbackCandidate{Name: name, Model: model, Provider: p}, true
+		}
+	}
+	def := al.defaultRouteBinding()
+	if providers.IsLocalProvider(def.ProviderName) {
+		return providers.FallbackCandidate{Name: def.ProviderName, Model: def.Model, Provider: def.Provider}, true
+	}
+	return providers.FallbackCandidate{}, false
+}
+
+// onProviderCircuitOpen is called when a provider's circuit opens. For Ollama
+// it checks health and runs OllamaRestartCommand in the background while the
+// fallback chain keeps serving requests.
+func (al *AgentLoop) onProviderCircuitOpen(provider, reason string) {
+	logger.WarnCF("agent", "provider.circuit_open", map[string]interface{}{
+		"provider": provider,
+		"reason":   reason,
+	})
+	if provider != "ollama" || al.cfg.Providers.Ollama.APIBase == "" {
+		return
+	}
+
+	checkURL := strings.TrimSuffix(al.cfg.Providers.Ollama.APIBase, "/v1")
+	ollamaOK, ollamaMsg := health.OllamaCheck(checkURL, 5*time.Second)()
+	modelsOK, modelsMsg := true, ""
+	if required := al.buildOllamaRequiredModels(); len(required) > 0 {
+		modelsOK, modelsMsg = health.OllamaModelsCheck(checkURL, 5*time.Second, required)()
+	}
+	logger.InfoCF("agent", "ollama health check",
+		map[string]interface{}{
+			"ollama_ok": ollamaOK, "ollama_msg": ollamaMsg,
+			"models_ok": modelsOK, "models_msg": modelsMsg,
+		})
+
+	restartCmd := strings.TrimSpace(al.cfg.Providers.OllamaRestartCommand)
+	if (ollamaOK && modelsOK) || restartCmd == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaRestartTimeout)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "sh", "-c", restartCmd).Run(); err != nil {
+		logger.WarnCF("agent", "ollama restart failed", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	logger.InfoCF("agent", "ollama restarted", map[string]interface{}{"reason": reason})
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+func newFallbackTestLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Providers: config.ProvidersConfig{
+			VLLM:     config.ProviderConfig{APIKey: "k", APIBase: "http://127.0.0.1:8000/v1"},
+			DeepSeek: config.ProviderConfig{APIKey: "k"},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				ChatProvider:  "ollama",
+				ChatModel:     "chat-v1",
+				ChatFallbacks: []string{"vllm/chat-local", "deepseek/deepseek-chat"},
+			},
+		},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+}
+
+func fallbackChain(t *testing.T, b RouteBinding) []string {
+	t.Helper()
+	fp, ok := b.Provider.(*providers.FallbackProvider)
+	if !ok {
+		t.Fatalf("expected a FallbackProvider, got %T", b.Provider)
+	}
+	var names []string
+	for _, c := range fp.Candidates() {
+		names = append(names, c.Name+"/"+c.Model)
+	}
+	return names
+}
+
+func TestBindRoute_BuildsFallbackChain(t *testing.T) {
+	al := newFallbackTestLoop(t)
+
+	b, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	got := fallbackChain(t, b)
+	want := []string{"ollama/chat-v1", "vllm/chat-local", "deepseek/deepseek-chat"}
+	if len(got) != len(want) {
+		t.Fatalf("chain = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("chain = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBindRoute_LocalOnlyNeverFallsBackToCloud(t *testing.T) {
+	al := newFallbackTestLoop(t)
+
+	b, err := al.bindRoute(RouteChat, true)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	for _, name := range fallbackChain(t, b) {
+		if name == "deepseek/deepseek-chat" {
+			t.Fatalf("cloud provider in /local chain: %v", fallbackChain(t, b))
+		}
+	}
+}
+
+// boundProvider is the primary provider behind b's chain.
+func boundProvider(t *testing.T, b RouteBinding) providers.LLMProvider {
+	t.Helper()
+	fp, ok := b.Provider.(*providers.FallbackProvider)
+	if !ok {
+		t.Fatalf("expected a FallbackProvider, got %T", b.Provider)
+	}
+	return fp.Candidates()[0].Provider
+}
+
+func TestBindRoute_NoFallbacksWrapsPrimaryOnly(t *testing.T) {
+	al := newBindingTestLoop(t)
+
+	b, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if got := fallbackChain(t, b); len(got) != 1 || got[0] != "ollama/chat-v1" {
+		t.Fatalf("chain = %v, want [ollama/chat-v1]", got)
+	}
+}
+
+func TestBindRoute_SingleOllamaFailureRestartsOllama(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	marker := filepath.Join(t.TempDir(), "restarted")
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Providers: config.ProvidersConfig{
+			Ollama:               config.ProviderConfig{APIBase: down.URL + "/v1"},
+			OllamaRestartCommand: "touch " + marker,
+		},
+		Routing: config.RoutingConfig{
+			LLM:            config.RouteLLMConfig{ChatProvider: "ollama", ChatModel: "chat-v1"},
+			CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 1, OpenSeconds: 60},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &failFirstMockProvider{failures: 1, failError: errors.New("connection refused")})
+
+	b, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if _, err := b.Provider.Chat(context.Background(), nil, nil, b.Model, nil); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(marker); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("OllamaRestartCommand did not run after the circuit opened")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestParseFallbackEntry(t *testing.T) {
+	tests := []struct {
+		in, provider, model string
+	}{
+		{"ollama/chat-v1:latest", "ollama", "chat-v1:latest"},
+		{"openrouter/openai/gpt-4o", "openrouter", "openai/gpt-4o"},
+		{" Anthropic ", "anthropic", ""},
+	}
+	for _, tt := range tests {
+		p, m := parseFallbackEntry(tt.in)
+		if p != tt.provider || m != tt.model {
+			t.Errorf("parseFallbackEntry(%q) = (%q, %q), want (%q, %q)", tt.in, p, m, tt.provider, tt.model)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
+)
+
+var (
+	// ErrJobNotFound is returned for a JobID that is neither running nor journaled.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotRunning is returned when cancelling a job that already finished.
+	ErrJobNotRunning = errors.New("job is not running")
+)
+
+// errJobCancelled is the context cause of a job stopped by CancelJob.
+var errJobCancelled = errors.New("job cancelled")
+
+// defaultJobListLimit caps the finished jobs shown by /jobs and the jobs API.
+const defaultJobListLimit = 10
+
+// activeJob is a job being processed by this process.
+type activeJob struct {
+	job    jobs.Job
+	cancel context.CancelCauseFunc
+}
+
+// JobStatus is a job as reported by /jobs, /status and `picoclaw jobs`.
+type JobStatus struct {
+	jobs.Job
+	Running bool                 `json:"running"`
+	Agents  []worker.AgentStatus `json:"agents,omitempty"`
+}
+
+// jobCancelled reports whether ctx belongs to a job stopped by CancelJob.
+func jobCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errJobCancelled)
+}
+
+// isJobControlCommand reports whether content is /jobs, /status or /cancel.
+// These bypass the per-session queue so they are not stuck behind the job
+// they are about.
+func isJobControlCommand(content string) bool {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "/jobs", "/status", "/cancel":
+		return true
+	}
+	return false
+}
+
+// Jobs returns the running jobs followed by up to limit other journaled jobs,
+// newest first. limit <= 0 uses the default.
+func (al *AgentLoop) Jobs(limit int) []JobStatus {
+	return al.jobsMatching(limit, nil)
+}
+
+// jobsMatching is Jobs restricted to the jobs keep accepts (all when nil).
+func (al *AgentLoop) jobsMatching(limit int, keep func(jobs.Job) bool) []JobStatus {
+	if limit <= 0 {
+		limit = defaultJobListLimit
+	}
+
+	var running, others []JobStatus
+	seen := make(map[string]bool)
+	al.activeJobs.Range(func(_, v interface{}) bool {
+		status := al.jobStatus(v.(*activeJob).job.ID)
+		seen[status.ID] = true
+		if keep == nil || keep(status.Job) {
+			running = append(running, status)
+		}
+		return true
+	})
+	if al.journal != nil {
+		for _, job := range al.journal.List() {
+			if !seen[job.ID] && (keep == nil || keep(job)) {
+				others = append(others, JobStatus{Job: job})
+			}
+		}
+	}
+
+	newestFirst := func(list []JobStatus) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+				return list[i].ID > list[j].ID
+			}
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		})
+	}
+	newestFirst(running)
+	newestFirst(others)
+	if len(others) > limit {
+		others = others[:limit]
+	}
+	return append(running, others...)
+}
+
+// JobStatus returns the current status of a job, including the agents
+// reporting work on it to the heartbeat collector.
+func (al *AgentLoop) JobStatus(jobID string) (JobStatus, bool) {
+	status := al.jobStatus(jobID)
+	return status, status.ID != ""
+}
+
+func (al *AgentLoop) jobStatus(jobID string) JobStatus {
+	var status JobStatus
+	if v, ok := al.activeJobs.Load(jobID); ok {
+		status.Job = v.(*activeJob).job
+		status.Running = true
+	}
+	if al.journal != nil {
+		if job, ok := al.journal.Get(jobID); ok {
+			status.Job = job
+		}
+	}
+	if status.ID == "" {
+		return status
+	}
+	if al.workerHeartbeatModule != nil {
+		for _, agent := range al.workerHeartbeatModule.GetReport().Agents {
+			if agent.JobID == jobID {
+				status.Agents = append(status.Agents, agent)
+			}
+		}
+		sort.Slice(status.Agents, func(i, j int) bool { return status.Agents[i].AgentID < status.Agents[j].AgentID })
+	}
+	return status
+}
+
+// CancelJob stops a job: a running job's context is cancelled (killing any
+// commands it started) and a pending proposal is withdrawn. by names who
+// cancelled it ("telegram:123", "cli", ...); when that is not the origin chat,
+// the origin chat is told.
+func (al *AgentLoop) CancelJob(jobID, by string) (JobStatus, error) {
+	v, running := al.activeJobs.Load(jobID)
+	status := al.jobStatus(jobID)
+	switch {
+	case running:
+		v.(*activeJob).cancel(errJobCancelled)
+	case status.ID == "":
+		return status, ErrJobNotFound
+	case status.State == jobs.StateProposal && al.orderApprovalModule != nil:
+		if _, ok := al.orderApprovalModule.Deny(jobID); !ok {
+			return status, ErrJobNotRunning
+		}
+	default:
+		return status, ErrJobNotRunning
+	}
+
+	al.recordJob(jobID, jobs.StateCancelled, "", "cancelled by "+by)
+	logger.InfoCF("agent", "jobs.cancelled", map[string]interface{}{
+		"job_id": jobID,
+		"by":     by,
+		"state":  string(status.State),
+	})
+
+	if by != status.Channel+":"+status.ChatID && al.canNotifyChannel(status.Channel) {
+		al.notifyJobOrigin(status.Job, fmt.Sprintf("%s はキャンセルされたよ。", jobID))
+	}
+	status, _ = al.JobStatus(jobID)
+	status.Running = false
+	return status, nil
+}
+
+// handleJobCommand handles /jobs, /status and /cancel. Senders only see and
+// cancel jobs started from their own chat unless they are admins; other jobs
+// are reported as not found.
+func (al *AgentLoop) handleJobCommand(msg bus.InboundMessage, cmd string, args []string) string {
+	admin := al.isAdmin(msg)
+	visible := func(job jobs.Job) bool {
+		return admin || sameChat(msg, job.Channel, job.ChatID)
+	}
+	if cmd == "/jobs" {
+		return formatJobList(al.jobsMatching(0, visible))
+	}
+	if len(args) < 1 {
+		return fmt.Sprintf("使い方: %s <job_id>（ジョブ一覧は /jobs）", cmd)
+	}
+	jobID := args[0]
+
+	status, ok := al.JobStatus(jobID)
+	if !ok || !visible(status.Job) {
+		return fmt.Sprintf("ジョブ %s は見つからなかったよ。/jobs で確認してね。", jobID)
+	}
+	if cmd == "/status" {
+		return formatJobStatus(status)
+	}
+
+	_, err := al.CancelJob(jobID, msg.Channel+":"+msg.ChatID)
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		return fmt.Sprintf("ジョブ %s は見つからなかったよ。/jobs で確認してね。", jobID)
+	case errors.Is(err, ErrJobNotRunning):
+		return fmt.Sprintf("ジョブ %s はもう実行中じゃないよ。", jobID)
+	}
+	return fmt.Sprintf("了解、%s を止めたよ。", jobID)
+}
+
+// formatJobList lists jobs for /jobs.
+func formatJobList(list []JobStatus) string {
+	if len(list) == 0 {
+		return "ジョブはまだないよ。"
+	}
+	var sb strings.Builder
+	sb.WriteString("最近のジョブだよ。\n")
+	for _, s := range list {
+		sb.WriteString(fmt.Sprintf("- %s [%s] %s:%s: %s\n",
+			s.ID, jobStateLabel(s), s.Channel, s.ChatID, utils.Truncate(firstLine(s.Content), 40)))
+	}
+	sb.WriteString("/status <job_id> で詳細、/cancel <job_id> で停止だよ。")
+	return sb.String()
+}
+
+// formatJobStatus describes one job for /status.
+func formatJobStatus(s JobStatus) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s: %s\n", s.ID, jobStateLabel(s)))
+	if s.Content != "" {
+		sb.WriteString(fmt.Sprintf("依頼: %s\n", utils.Truncate(firstLine(s.Content), 80)))
+	}
+	sb.WriteString(fmt.Sprintf("チャット: %s:%s\n", s.Channel, s.ChatID))
+	sb.WriteString(fmt.Sprintf("開始: %s\n", s.CreatedAt.Format("01/02 15:04:05")))
+	if s.Attempts > 1 {
+		sb.WriteString(fmt.Sprintf("試行: %d 回目\n", s.Attempts))
+	}
+	if s.Detail != "" {
+		sb.WriteString(fmt.Sprintf("詳細: %s\n", utils.Truncate(s.Detail, 200)))
+	}
+	for _, a := range s.Agents {
+		name := a.AgentID
+		if a.Alias != "" {
+			name = fmt.Sprintf("%s（%s）", a.AgentID, a.Alias)
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s（%s前）\n", name, a.Status, time.Since(a.LastSeen).Round(time.Second)))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// jobStateLabel is the state with the route, plus the elapsed time while running.
+func jobStateLabel(s JobStatus) string {
+	label := string(s.State)
+	if s.Route != "" {
+		label += ", " + s.Route
+	}
+	if s.Running {
+		label = fmt.Sprintf("実行中 %s, %s", time.Since(s.CreatedAt).Round(time.Second), label)
+	}
+	return label
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// JobsHandler serves the jobs API used by `picoclaw jobs`:
+//
+//	GET  /jobs                  running and recent jobs (?limit=N)
+//	GET  /jobs/{id}             one job
+//	POST /jobs/{id}/cancel      cancel a job
+//
+// Only loopback clients are served since jobs carry message contents.
+func (al *AgentLoop) JobsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		writeJobsJSON(w, http.StatusOK, map[string]interface{}{"jobs": al.Jobs(limit)})
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		status, ok := al.JobStatus(r.PathValue("id"))
+		if !ok {
+			writeJobsJSON(w, http.StatusNotFound, map[string]string{"error": ErrJobNotFound.Error()})
+			return
+		}
+		writeJobsJSON(w, http.StatusOK, status)
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		status, err := al.CancelJob(r.PathValue("id"), "cli")
+		switch {
+		case errors.Is(err, ErrJobNotFound):
+			writeJobsJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, ErrJobNotRunning):
+			writeJobsJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			writeJobsJSON(w, http.StatusOK, status)
+		}
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJobsJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WarnCF("agent", "jobs.api_write_failed", map[string]interface{}{"error": err.Error()})
+	}
+}
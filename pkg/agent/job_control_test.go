@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// startedProvider signals when it is first called and then blocks until its
+// context is done.
+type startedProvider struct {
+	once    sync.Once
+	started chan struct{}
+}
+
+func (p *startedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.once.Do(func() { close(p.started) })
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *startedProvider) GetDefaultModel() string { return "blocking" }
+
+func newJobControlTestLoop(t *testing.T, provider providers.LLMProvider) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Routing: config.RoutingConfig{
+			Classifier:    config.RoutingClassifierConfig{Enabled: false},
+			FallbackRoute: RouteChat,
+		},
+		Loop: config.LoopConfig{MaxLoops: 3, MaxMillis: 60000},
+	}
+	msgBus := bus.NewMessageBus()
+	return NewAgentLoop(cfg, msgBus, provider), msgBus
+}
+
+func TestCancelJob_StopsRunningJobAndTellsOrigin(t *testing.T) {
+	provider := &startedProvider{started: make(chan struct{})}
+	al, msgBus := newJobControlTestLoop(t, provider)
+
+	type result struct {
+		resp string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := al.processMessage(context.Background(), approvalMsg("telegram", "1", "長い調べもの"))
+		done <- result{resp, err}
+	}()
+	select {
+	case <-provider.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+
+	list := al.Jobs(0)
+	if len(list) != 1 || !list[0].Running {
+		t.Fatalf("expected one running job, got %+v", list)
+	}
+	jobID := list[0].ID
+	if out := formatJobList(list); !strings.Contains(out, jobID) || !strings.Contains(out, "実行中") {
+		t.Errorf("/jobs should show the running job, got:\n%s", out)
+	}
+
+	// Other chats neither see nor cancel the job.
+	if resp, _ := al.processMessage(context.Background(), approvalMsg("discord", "D1", "/jobs")); strings.Contains(resp, jobID) {
+		t.Errorf("/jobs from another chat must not list the job, got:\n%s", resp)
+	}
+	for _, cmd := range []string{"/status ", "/cancel "} {
+		resp, _ := al.processMessage(context.Background(), approvalMsg("discord", "D1", cmd+jobID))
+		if !strings.Contains(resp, "見つからなかった") {
+			t.Errorf("%s from another chat should report not found, got %q", cmd, resp)
+		}
+	}
+	if list := al.Jobs(0); len(list) != 1 || !list[0].Running {
+		t.Fatalf("job should still be running, got %+v", list)
+	}
+
+	// An admin cancels from another chat; the origin chat is told.
+	al.cfg.Agents.Defaults.Admins = config.FlexibleStringSlice{"slack"}
+	resp, _ := al.processMessage(context.Background(), approvalMsg("slack", "C1", "/cancel "+jobID))
+	if !strings.Contains(resp, "止めた") {
+		t.Errorf("unexpected /cancel reply %q", resp)
+	}
+
+	select {
+	case r := <-done:
+		if r.resp != "" || r.err != nil {
+			t.Errorf("cancelled job should end silently, got resp=%q err=%v", r.resp, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled job did not stop")
+	}
+
+	status, ok := al.JobStatus(jobID)
+	if !ok || status.Running || status.State != jobs.StateCancelled {
+		t.Errorf("expected a cancelled job, got %+v", status)
+	}
+	var notified bool
+	for _, out := range drainOutbound(msgBus) {
+		if out.Channel == "telegram" && strings.Contains(out.Content, "キャンセル") {
+			notified = true
+		}
+	}
+	if !notified {
+		t.Error("origin chat should be told about the cancellation")
+	}
+
+	resp, _ = al.processMessage(context.Background(), approvalMsg("slack", "C1", "/cancel "+jobID))
+	if !strings.Contains(resp, "実行中じゃない") {
+		t.Errorf("cancelling a finished job should be refused, got %q", resp)
+	}
+	resp, _ = al.processMessage(context.Background(), approvalMsg("slack", "C1", "/status "+jobID))
+	if !strings.Contains(resp, "cancelled") || !strings.Contains(resp, "長い調べもの") {
+		t.Errorf("unexpected /status reply:\n%s", resp)
+	}
+}
+
+func TestJobsHandler(t *testing.T) {
+	al, _ := newJobControlTestLoop(t, &mockProvider{})
+	if _, err := al.processMessage(context.Background(), approvalMsg("telegram", "1", "こんにちは")); err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	jobID := al.Jobs(0)[0].ID
+
+	ts := httptest.NewServer(al.JobsHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Jobs []JobStatus `json:"jobs"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != jobID || list.Jobs[0].State != jobs.StateDone {
+		t.Errorf("GET /jobs = %+v", list.Jobs)
+	}
+
+	for path, want := range map[string]int{
+		"/jobs/" + jobID:         http.StatusOK,
+		"/jobs/job_19990101_001": http.StatusNotFound,
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	resp, err = http.Post(ts.URL+"/jobs/"+jobID+"/cancel", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("cancelling a finished job = %d, want 409", resp.StatusCode)
+	}
+
+	// Non-loopback clients are refused.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	req.RemoteAddr = "192.0.2.10:4000"
+	al.JobsHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("remote client got %d, want 403", rec.Code)
+	}
+}
+
+func TestRunWorkerPatch_StopsWhenCancelled(t *testing.T) {
+	al, _ := newJobControlTestLoop(t, &mockProvider{})
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errJobCancelled)
+
+	patch := `[{"type":"shell_command","action":"run","target":"touch","content":"should-not-exist"}]`
+	if _, err := al.executeWorkerPatch(ctx, patch, "telegram:1"); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+}
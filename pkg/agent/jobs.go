@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/constants"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobid"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+)
+
+// resumeJobMetadataKey marks an inbound message re-queued by RecoverJobs so
+// that it keeps its JobID.
+const resumeJobMetadataKey = "resume_job_id"
+
+// openJobJournal opens the job journal under workspace/state and drops
+// finished jobs older than the retention period. A journal that cannot be
+// opened disables journaling (nil) rather than blocking startup.
+func openJobJournal(workspace string, cfg config.JobsConfig) *jobs.Journal {
+	path := filepath.Join(workspace, "state", jobs.JournalFile)
+	journal, err := jobs.Open(path)
+	if err != nil {
+		logger.WarnCF("agent", "jobs.load_failed", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return nil
+	}
+	if cfg.RetentionDays > 0 {
+		if err := journal.Compact(time.Now().AddDate(0, 0, -cfg.RetentionDays)); err != nil {
+			logger.WarnCF("agent", "jobs.compact_failed", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	return journal
+}
+
+// newJobIDGenerator returns a generator that continues after the IDs already
+// in the journal, so a restart never reuses today's JobIDs.
+func newJobIDGenerator(journal *jobs.Journal) *jobid.Generator {
+	gen := jobid.NewGenerator()
+	if journal != nil {
+		for _, job := range journal.List() {
+			gen.Observe(job.ID)
+		}
+	}
+	return gen
+}
+
+// jobIDFromContext returns the JobID assigned by startJob.
+func jobIDFromContext(ctx context.Context) string {
+	return usage.CallInfoFromContext(ctx).JobID
+}
+
+// startJob assigns a JobID to msg, records it as received and returns a
+// cancellable context carrying the ID. A message re-queued by RecoverJobs
+// keeps its ID. Every startJob must be paired with finishJob.
+func (al *AgentLoop) startJob(ctx context.Context, msg bus.InboundMessage) (context.Context, string) {
+	job := jobs.Job{
+		State:      jobs.StateReceived,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SessionKey: msg.SessionKey,
+		SenderID:   msg.SenderID,
+		Content:    msg.Content,
+		Attempts:   1,
+		CreatedAt:  time.Now(),
+	}
+
+	resumed := false
+	if id := msg.Metadata[resumeJobMetadataKey]; id != "" && al.journal != nil {
+		if prev, ok := al.journal.Get(id); ok {
+			job.ID, job.Attempts, resumed = id, prev.Attempts, true
+		}
+	}
+	if !resumed {
+		job.ID = al.jobIDGen.Next()
+		if al.journal != nil {
+			if err := al.journal.Record(jobs.Event{
+				Time:       job.CreatedAt,
+				JobID:      job.ID,
+				State:      jobs.StateReceived,
+				Channel:    msg.Channel,
+				ChatID:     msg.ChatID,
+				SessionKey: msg.SessionKey,
+				SenderID:   msg.SenderID,
+				Content:    msg.Content,
+				Media:      msg.Media,
+				Metadata:   msg.Metadata,
+				Attempt:    1,
+			}); err != nil {
+				logger.WarnCF("agent", "jobs.record_failed", map[string]interface{}{
+					"job_id": job.ID,
+					"error":  err.Error(),
+				})
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	al.activeJobs.Store(job.ID, &activeJob{job: job, cancel: cancel})
+	return usage.WithJobID(ctx, job.ID), job.ID
+}
+
+// recordJob appends a state transition to the journal. It is a no-op when
+// journaling is off or the job has no ID.
+func (al *AgentLoop) recordJob(jobID string, state jobs.State, route, detail string) {
+	if al.journal == nil || jobID == "" {
+		return
+	}
+	if err := al.journal.Record(jobs.Event{JobID: jobID, State: state, Route: route, Detail: detail}); err != nil {
+		logger.WarnCF("agent", "jobs.record_failed", map[string]interface{}{
+			"job_id": jobID,
+			"state":  string(state),
+			"error":  err.Error(),
+		})
+	}
+}
+
+// finishJob records the outcome of processMessage. Jobs already finished
+// (e.g. by patch execution) or parked as proposals are left as they are, and
+// so are jobs cut short by shutdown, so that RecoverJobs picks them up.
+func (al *AgentLoop) finishJob(ctx context.Context, jobID string, err error) {
+	if v, ok := al.activeJobs.LoadAndDelete(jobID); ok {
+		defer v.(*activeJob).cancel(nil)
+	}
+	if al.journal == nil || jobID == "" {
+		return
+	}
+	if jobCancelled(ctx) {
+		return // CancelJob has recorded it
+	}
+	if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+	if job, ok := al.journal.Get(jobID); ok && (job.State.Finished() || job.State == jobs.StateProposal) {
+		return
+	}
+	if err != nil {
+		al.recordJob(jobID, jobs.StateFailed, "", err.Error())
+		return
+	}
+	al.recordJob(jobID, jobs.StateDone, "", "")
+}
+
+// RecoverJobs resumes or fails the jobs that were in flight when the gateway
+// last stopped, and tells the origin chat what happened. Call it once the
+// agent loop is consuming inbound messages.
+func (al *AgentLoop) RecoverJobs() {
+	if al.journal == nil {
+		return
+	}
+	unfinished := al.journal.Unfinished()
+	if len(unfinished) == 0 {
+		return
+	}
+	logger.InfoCF("agent", "jobs.recover", map[string]interface{}{"unfinished": len(unfinished)})
+	for _, job := range unfinished {
+		al.recoverJob(job)
+	}
+}
+
+func (al *AgentLoop) recoverJob(job jobs.Job) {
+	cfg := al.cfg.Jobs
+	fields := map[string]interface{}{
+		"job_id":   job.ID,
+		"state":    string(job.State),
+		"channel":  job.Channel,
+		"chat_id":  job.ChatID,
+		"attempts": job.Attempts,
+	}
+
+	switch {
+	case !al.canNotifyChannel(job.Channel) || job.Content == "":
+		// Nobody is waiting for the reply (CLI, MCP caller, ...).
+		al.recordJob(job.ID, jobs.StateFailed, "", "interrupted by restart")
+		al.takeOriginReply(job.SessionKey)
+		logger.InfoCF("agent", "jobs.recover_dropped", fields)
+
+	case job.State == jobs.StateExecuting:
+		// A half-applied patch must not be applied again.
+		al.recordJob(job.ID, jobs.StateFailed, "", "interrupted by restart while executing")
+		al.notifyJobOrigin(job, fmt.Sprintf("再起動で %s の patch 実行が途中で止まったよ😢 ファイルが一部だけ変更されているかもしれないから確認してね。", job.ID))
+		logger.WarnCF("agent", "jobs.recover_failed", fields)
+
+	case !cfg.ResumeOnRestart || job.Attempts > cfg.MaxResumes:
+		al.recordJob(job.ID, jobs.StateFailed, "", "interrupted by restart")
+		al.notifyJobOrigin(job, fmt.Sprintf("再起動で依頼（%s）が中断されちゃった。ごめんね、もう一度送ってもらえる？", job.ID))
+		logger.WarnCF("agent", "jobs.recover_failed", fields)
+
+	default:
+		if err := al.journal.Record(jobs.Event{
+			JobID:   job.ID,
+			State:   jobs.StateReceived,
+			Detail:  "resumed after restart",
+			Attempt: job.Attempts + 1,
+		}); err != nil {
+			logger.WarnCF("agent", "jobs.record_failed", map[string]interface{}{
+				"job_id": job.ID,
+				"error":  err.Error(),
+			})
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: job.Channel,
+			ChatID:  job.ChatID,
+			Content: fmt.Sprintf("再起動で止まっていた依頼（%s）を再開するね。", job.ID),
+		})
+
+		metadata := make(map[string]string, len(job.Metadata)+1)
+		for k, v := range job.Metadata {
+			metadata[k] = v
+		}
+		metadata[resumeJobMetadataKey] = job.ID
+		al.bus.PublishInbound(bus.InboundMessage{
+			Channel:    job.Channel,
+			SenderID:   job.SenderID,
+			ChatID:     job.ChatID,
+			Content:    job.Content,
+			Media:      job.Media,
+			SessionKey: job.SessionKey,
+			Metadata:   metadata,
+		})
+		logger.InfoCF("agent", "jobs.recover_resumed", fields)
+	}
+}
+
+// canNotifyChannel reports whether a reply on channel reaches a user.
+func (al *AgentLoop) canNotifyChannel(channel string) bool {
+	if channel == "" || constants.IsInternalChannel(channel) {
+		return false
+	}
+	if al.channelManager == nil {
+		return true
+	}
+	_, ok := al.channelManager.GetChannel(channel)
+	return ok
+}
+
+// notifyJobOrigin sends content to the chat a job came from, as a reply to
+// the remembered origin message when one is pending.
+func (al *AgentLoop) notifyJobOrigin(job jobs.Job, content string) {
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  job.Channel,
+		ChatID:   job.ChatID,
+		Content:  content,
+		Metadata: al.takeOriginReply(job.SessionKey),
+	})
+}
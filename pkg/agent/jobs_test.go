@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
+)
+
+func TestJobJournal_TracksProposalThroughApproval(t *testing.T) {
+	workspace := t.TempDir()
+	al, _ := newApprovalTestLoop(t, workspace)
+	ctx := context.Background()
+
+	resp, err := al.processMessage(ctx, approvalMsg("telegram", "1", "/code1 hello.go を作って"))
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+	m := regexp.MustCompile(`/approve (\S+)`).FindStringSubmatch(resp)
+	if m == nil {
+		t.Fatalf("expected an approval prompt, got:\n%s", resp)
+	}
+	job, ok := al.journal.Get(m[1])
+	if !ok || job.State != jobs.StateProposal || job.Channel != "telegram" || job.Route != RouteCode1 {
+		t.Fatalf("expected a journaled proposal, got %+v (ok=%v)", job, ok)
+	}
+
+	if _, err := al.processMessage(ctx, approvalMsg("telegram", "1", "/approve "+m[1])); err != nil {
+		t.Fatalf("/approve failed: %v", err)
+	}
+	if job, _ := al.journal.Get(m[1]); job.State != jobs.StateDone {
+		t.Errorf("approved job state = %s, want done", job.State)
+	}
+
+	// A restarted loop continues after the journaled IDs.
+	al, _ = newApprovalTestLoop(t, workspace)
+	if next := al.jobIDGen.Next(); next <= m[1] {
+		t.Errorf("JobID %s reused or went backwards after restart (last was %s)", next, m[1])
+	}
+}
+
+func TestRecoverJobs_ResumesOrFailsUnfinishedJobs(t *testing.T) {
+	workspace := t.TempDir()
+	journal, err := jobs.Open(filepath.Join(workspace, "state", jobs.JournalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []jobs.Event{
+		{JobID: "job_resume", State: jobs.StateReceived, Channel: "telegram", ChatID: "1", SessionKey: "telegram:1",
+			Content: "調べて", Metadata: map[string]string{"message_id": "m1"}, Attempt: 1},
+		{JobID: "job_resume", State: jobs.StateDelegated, Route: RouteResearch},
+		{JobID: "job_exec", State: jobs.StateReceived, Channel: "line", ChatID: "u1", SessionKey: "line:u1", Content: "/code3 直して", Attempt: 1},
+		{JobID: "job_exec", State: jobs.StateExecuting},
+		{JobID: "job_retried", State: jobs.StateReceived, Channel: "slack", ChatID: "C1", SessionKey: "slack:C1", Content: "again", Attempt: 2},
+		{JobID: "job_cli", State: jobs.StateReceived, Channel: "cli", ChatID: "direct", SessionKey: "cli:default", Content: "hi", Attempt: 1},
+		{JobID: "job_done", State: jobs.StateReceived, Channel: "telegram", ChatID: "1", Content: "ok", Attempt: 1},
+		{JobID: "job_done", State: jobs.StateDone},
+	} {
+		if err := journal.Record(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	al, msgBus := newApprovalTestLoop(t, workspace)
+	al.cfg.Jobs = config.JobsConfig{ResumeOnRestart: true, MaxResumes: 1}
+
+	// The interrupted LINE job left an origin reply pending.
+	flags := al.sessions.GetFlags("line:u1")
+	flags.PendingOriginReply = true
+	flags.OriginMessageID = "origin-1"
+	flags.OriginRoute = RouteCode3
+	al.sessions.SetFlags("line:u1", flags)
+
+	al.RecoverJobs()
+
+	want := map[string]jobs.State{
+		"job_resume":  jobs.StateReceived,
+		"job_exec":    jobs.StateFailed,
+		"job_retried": jobs.StateFailed,
+		"job_cli":     jobs.StateFailed,
+		"job_done":    jobs.StateDone,
+	}
+	for id, state := range want {
+		if job, _ := al.journal.Get(id); job.State != state {
+			t.Errorf("%s state = %s, want %s", id, job.State, state)
+		}
+	}
+	if job, _ := al.journal.Get("job_resume"); job.Attempts != 2 {
+		t.Errorf("resumed job attempts = %d, want 2", job.Attempts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resumed, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected the resumed job to be re-queued")
+	}
+	if resumed.Content != "調べて" || resumed.Metadata[resumeJobMetadataKey] != "job_resume" || resumed.Metadata["message_id"] != "m1" {
+		t.Errorf("unexpected re-queued message: %+v", resumed)
+	}
+
+	notices := map[string]bus.OutboundMessage{}
+	for _, out := range drainOutbound(msgBus) {
+		notices[out.Channel] = out
+	}
+	if len(notices) != 3 {
+		t.Errorf("expected notices on telegram, line and slack only, got %+v", notices)
+	}
+	if !strings.Contains(notices["telegram"].Content, "再開") {
+		t.Errorf("unexpected resume notice: %+v", notices["telegram"])
+	}
+	if n := notices["line"]; !strings.Contains(n.Content, "patch") || n.Metadata["origin_message_id"] != "origin-1" {
+		t.Errorf("executing job should be failed with an origin reply: %+v", n)
+	}
+	if al.sessions.GetFlags("line:u1").PendingOriginReply {
+		t.Error("PendingOriginReply should be cleared once the failure is reported")
+	}
+	if !strings.Contains(notices["slack"].Content, "もう一度") {
+		t.Errorf("job over max_resumes should ask to resend: %+v", notices["slack"])
+	}
+
+	// Processing the re-queued message keeps its JobID and finishes the job.
+	if _, err := al.processMessage(context.Background(), resumed); err != nil {
+		t.Fatalf("processMessage(resumed) failed: %v", err)
+	}
+	if job, _ := al.journal.Get("job_resume"); !job.State.Finished() {
+		t.Errorf("resumed job should be finished, got %s", job.State)
+	}
+}
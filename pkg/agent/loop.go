@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"hash/fnv"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -27,25 +26,35 @@ import (
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/constants"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/health"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobid"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/mcp"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/chat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/order"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/session"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/state"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
 )
 
 type AgentLoop struct {
 	bus            *bus.MessageBus
 	cfg            *config.Config
-	provider       providers.LLMProvider
-	providerName   string
+	providerPool   *providers.ProviderPool
+	breakers       *providers.CircuitBreakers
+	usageLedger    *usage.Ledger // nil when usage tracking is disabled
+	budget         *budgetGuard  // nil when budgets are disabled
+	journal        *jobs.Journal // nil when the job journal cannot be opened
+	activeJobs     sync.Map      // JobID → *activeJob for jobs being processed now
+	defaultBinding RouteBinding
+	bindingMu      sync.RWMutex
 	workspace      string
-	model          string
 	contextWindow  int // Maximum context window size in tokens
 	maxIterations  int
 	loopMaxLoops   int
@@ -59,34 +68,39 @@ type AgentLoop struct {
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
 	channelManager *channels.Manager
 	mcpClient      *mcp.Client
+	mcpManager     *mcp.Manager // tools from cfg.MCP.Servers; nil when none are configured
 
 	// New architecture components (Phase 3)
-	jobIDGen                 *jobid.Generator
-	chatReceptionModule      *chat.LightweightReceptionModule
-	chatDecisionModule       *chat.FinalDecisionModule
-	workerRoutingModule      *worker.RoutingModule
-	workerExecutionModule    *worker.ExecutionModule
-	workerAggregationModule  *worker.AggregationModule
-	workerHeartbeatModule    *worker.HeartbeatCollectorModule
+	jobIDGen                *jobid.Generator
+	chatReceptionModule     *chat.LightweightReceptionModule
+	chatDecisionModule      *chat.FinalDecisionModule
+	workerRoutingModule     *worker.RoutingModule
+	workerExecutionModule   *worker.ExecutionModule
+	workerAggregationModule *worker.AggregationModule
+	workerHeartbeatModule   *worker.HeartbeatCollectorModule
+	heartbeats              *heartbeat.HeartbeatBus // nil unless the heartbeat collector is enabled
+	agentActivity           sync.Map                // agent ID → agentActivity
+	orderApprovalModule     *order.ApprovalFlowModule
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey         string // Session identifier for history/context
-	Channel            string // Target channel for tool execution
-	ChatID             string // Target chat ID for tool execution
-	UserMessage        string // User message content (may include prefix)
-	Media              []string
-	DefaultResponse    string // Response when LLM returns empty
-	EnableSummary      bool   // Whether to trigger summarization
-	SendResponse       bool   // Whether to send response via bus
-	NoHistory          bool   // If true, don't load session history (for heartbeat)
-	Route              string // Routed category for logging
-	LocalOnly          bool   // /local mode for this session
-	Declaration        string // Route declaration prefix
-	MaxLoops           int    // Max loop iterations for this turn
-	MaxMillis          int    // Max processing time for this turn
-	SkipAddUserMessage bool   // When true, don't add user message (used on Ollama recovery retry)
+	SessionKey      string // Session identifier for history/context
+	Channel         string // Target channel for tool execution
+	ChatID          string // Target chat ID for tool execution
+	UserMessage     string // User message content (may include prefix)
+	Media           []string
+	DefaultResponse string       // Response when LLM returns empty
+	EnableSummary   bool         // Whether to trigger summarization
+	SendResponse    bool         // Whether to send response via bus
+	NoHistory       bool         // If true, don't load session history (for heartbeat)
+	Route           string       // Routed category for logging
+	LocalOnly       bool         // /local mode for this session
+	Declaration     string       // Route declaration prefix
+	MaxLoops        int          // Max loop iterations for this turn
+	MaxMillis       int          // Max processing time for this turn
+	Binding         RouteBinding // LLM bound to this turn; zero value uses the default binding
+	Stream          bool         // Show the reply progressively on channels that support edits
 }
 
 const DefaultWorkOverlayTurns = 8
@@ -136,6 +150,38 @@ type chatDelegateDirective struct {
 	Task  string
 }
 
+// mcpConnectTimeout bounds the initialize handshake and first tools/list of
+// the configured MCP servers at startup.
+const mcpConnectTimeout = 30 * time.Second
+
+// newShellExecutor returns the executor selected by tools.exec. An
+// unavailable sandbox is kept, so commands fail rather than run unconfined.
+func newShellExecutor(execCfg config.ExecToolsConfig, workspace string) tools.Executor {
+	switch execCfg.Backend {
+	case "", "direct":
+		return tools.DirectExecutor{}
+	case "sandbox":
+		sandbox := tools.NewSandboxExecutor(tools.SandboxOptions{
+			Workspace:      workspace,
+			Network:        execCfg.AllowNetwork,
+			CPUTime:        time.Duration(execCfg.CPUSeconds) * time.Second,
+			MemoryBytes:    uint64(execCfg.MemoryMB) << 20,
+			MaxOutputBytes: int64(execCfg.MaxOutputMB) << 20,
+		})
+		if err := sandbox.Check(); err != nil {
+			logger.ErrorCF("agent", "exec.sandbox_unavailable", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return sandbox
+	default:
+		logger.ErrorCF("agent", "exec.unknown_backend", map[string]interface{}{
+			"backend": execCfg.Backend,
+		})
+		return tools.DirectExecutor{}
+	}
+}
+
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
 func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
@@ -172,11 +218,13 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Message tool - available to both agent and subagent
 	// Subagent uses it to communicate directly with user
 	messageTool := tools.NewMessageTool()
-	messageTool.SetSendCallback(func(channel, chatID, content string) error {
+	messageTool.SetWorkspace(workspace)
+	messageTool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: content,
+			Channel:     channel,
+			ChatID:      chatID,
+			Content:     content,
+			Attachments: attachments,
 		})
 		return nil
 	})
@@ -191,6 +239,17 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// web_fetch and media downloads follow tools.egress
+	if egress, err := tools.NewEgressPolicy(cfg.Tools.Egress.AllowHosts, cfg.Tools.Egress.DenyHosts); err != nil {
+		logger.ErrorCF("agent", "egress.config_invalid", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		tools.SetDefaultEgressPolicy(egress)
+	}
+	// exec tool and Worker shell commands run through tools.exec.backend
+	tools.SetDefaultExecutor(newShellExecutor(cfg.Tools.Exec, workspace))
+
 	// Create tool registry for main agent
 	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
 
@@ -214,13 +273,70 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		mcpClient = mcp.NewClient(cfg.MCP.Chrome.BaseURL)
 	}
 
+	// Connect configured MCP servers; each listed tool is registered as mcp_<server>_<tool>.
+	var mcpManager *mcp.Manager
+	if len(cfg.MCP.Servers) > 0 {
+		mcpManager = mcp.NewManager(toolsRegistry)
+		connectCtx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+		mcpManager.ConnectAll(connectCtx, cfg.MCP.Servers)
+		cancel()
+	}
+
+	// Every provider call is metered into the usage ledger, including the
+	// default provider and providers created later by the pool.
+	usageLedger := usage.Open(workspace, cfg.Usage)
+	budget := newBudgetGuard(cfg.Budget, stateManager)
+	if budget != nil {
+		if usageLedger == nil {
+			// Budgets are fed from the ledger, so it is required even if usage reporting is off.
+			usageLedger = usage.NewLedger(filepath.Join(workspace, usage.DirName), usage.NewPriceTable(cfg.Usage.Prices))
+			logger.InfoCF("agent", "usage.enabled_for_budget", nil)
+		}
+		usageLedger.OnRecord(budget.record)
+	}
+	// Logs and session files are redacted; LLM payloads too if configured.
+	redactor, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		logger.ErrorCF("agent", "redaction.config_invalid", map[string]interface{}{
+			"error": err.Error(),
+		})
+		redactor = redact.Default()
+	} else {
+		redact.SetDefault(redactor)
+	}
+	var payloadRedactor *redact.Redactor
+	if cfg.Redaction.LLMPayloads {
+		payloadRedactor = redactor
+	}
+	wrapProvider := func(name string, p providers.LLMProvider) providers.LLMProvider {
+		return usage.Meter(usageLedger, name, trackProgress(redactPayloads(payloadRedactor, p)))
+	}
+
+	defaultProviderName := strings.ToLower(strings.TrimSpace(cfg.Agents.Defaults.Provider))
+	defaultBinding := RouteBinding{
+		ProviderName: defaultProviderName,
+		Model:        strings.TrimSpace(cfg.Agents.Defaults.Model),
+		Provider:     wrapProvider(defaultProviderName, provider),
+	}
+	providerPool := providers.NewProviderPool(cfg)
+	providerPool.SetWrapper(wrapProvider)
+	providerPool.Put(defaultBinding.ProviderName, defaultBinding.Model, defaultBinding.Provider)
+
+	// Job state transitions are journaled so the gateway can resume or fail
+	// jobs interrupted by a restart.
+	journal := openJobJournal(workspace, cfg.Jobs)
+
 	al := &AgentLoop{
 		bus:            msgBus,
 		cfg:            cfg,
-		provider:       provider,
-		providerName:   strings.ToLower(strings.TrimSpace(cfg.Agents.Defaults.Provider)),
+		providerPool:   providerPool,
+		breakers:       newCircuitBreakers(cfg.Routing.CircuitBreaker),
+		usageLedger:    usageLedger,
+		budget:         budget,
+		journal:        journal,
+		jobIDGen:       newJobIDGenerator(journal),
+		defaultBinding: defaultBinding,
 		workspace:      workspace,
-		model:          cfg.Agents.Defaults.Model,
 		contextWindow:  cfg.Agents.Defaults.MaxTokens, // Restore context window for summarization
 		maxIterations:  cfg.Agents.Defaults.MaxToolIterations,
 		loopMaxLoops:   cfg.Loop.MaxLoops,
@@ -229,10 +345,12 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		state:          stateManager,
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
-		router:         NewRouter(cfg.Routing, NewClassifier(provider, cfg.Agents.Defaults.Model)),
 		summarizing:    sync.Map{},
 		mcpClient:      mcpClient,
+		mcpManager:     mcpManager,
 	}
+	al.router = NewRouter(cfg.Routing, NewBindingClassifier(al.defaultRouteBinding))
+	al.breakers.SetOnOpen(al.onProviderCircuitOpen)
 
 	// Initialize new architecture if enabled
 	if cfg.Architecture.UseNewArchitecture {
@@ -250,6 +368,10 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	go al.runHeartbeats(ctx)
+
+	dispatcher := newSessionDispatcher(al.cfg.Loop.MaxConcurrentSessions, al.handleInbound)
+	defer dispatcher.Wait()
 
 	for al.running.Load() {
 		select {
@@ -261,56 +383,99 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			// /jobs, /status and /cancel must not wait behind the job they are about.
+			if isJobControlCommand(msg.Content) {
+				dispatcher.DispatchControl(ctx, msg)
+				continue
 			}
+			dispatcher.Dispatch(ctx, msg)
+		}
+	}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
+	return nil
+}
 
-				if !alreadySent {
-					outbound := bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					}
-					// Special handling: when Worker/Coder finishes, reply to the remembered origin message ID.
-					flags := al.sessions.GetFlags(msg.SessionKey)
-					if flags.PendingOriginReply && flags.OriginMessageID != "" {
-						outbound.Metadata = map[string]string{
-							"origin_message_id": flags.OriginMessageID,
-							"origin_route":      flags.OriginRoute,
-							"reply_mode":        "origin",
-						}
-						flags.PendingOriginReply = false
-						al.sessions.SetFlags(msg.SessionKey, flags)
-						_ = al.sessions.Save(msg.SessionKey)
-					}
-					al.bus.PublishOutbound(outbound)
-				}
-			}
+// handleInbound processes a single inbound message and publishes the reply.
+// It is invoked by the session dispatcher, so calls for different sessions may
+// run concurrently while calls for the same session are serialized.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	ctx, stream := withReplyStream(ctx)
+	response, err := al.processMessage(ctx, msg)
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+	}
+
+	if response == "" {
+		stream.finish(al.bus, msg.Channel, msg.ChatID, nil)
+		return
+	}
+
+	// Check if the message tool already sent a response during this round.
+	// If so, skip publishing to avoid duplicate messages to the user.
+	alreadySent := false
+	if tool, ok := al.tools.Get("message"); ok {
+		if mt, ok := tool.(*tools.MessageTool); ok {
+			alreadySent = mt.HasSentTo(msg.Channel, msg.ChatID)
 		}
 	}
+	if alreadySent {
+		stream.finish(al.bus, msg.Channel, msg.ChatID, nil)
+		return
+	}
 
-	return nil
+	outbound := bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: response,
+	}
+	// Special handling: when Worker/Coder finishes, reply to the remembered origin message ID.
+	outbound.Metadata = al.takeOriginReply(msg.SessionKey)
+	stream.finish(al.bus, msg.Channel, msg.ChatID, &outbound)
+}
+
+// takeOriginReply returns the outbound metadata that replies to the
+// remembered origin message and clears the pending flag. It returns nil when
+// no origin reply is pending for the session.
+func (al *AgentLoop) takeOriginReply(sessionKey string) map[string]string {
+	if sessionKey == "" {
+		return nil
+	}
+	flags := al.sessions.GetFlags(sessionKey)
+	if !flags.PendingOriginReply || flags.OriginMessageID == "" {
+		return nil
+	}
+	metadata := map[string]string{
+		"origin_message_id": flags.OriginMessageID,
+		"origin_route":      flags.OriginRoute,
+		"reply_mode":        "origin",
+	}
+	flags.PendingOriginReply = false
+	al.sessions.SetFlags(sessionKey, flags)
+	_ = al.sessions.Save(sessionKey)
+	return metadata
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if al.mcpManager != nil {
+		al.mcpManager.Close()
+	}
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	al.tools.Register(tool)
 }
 
+// Tools returns the agent's tool registry.
+func (al *AgentLoop) Tools() *tools.ToolRegistry {
+	return al.tools
+}
+
+// Sessions returns the agent's session store.
+func (al *AgentLoop) Sessions() *session.SessionManager {
+	return al.sessions
+}
+
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
 }
@@ -358,17 +523,13 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 		Route:           RouteChat,
 		MaxLoops:        al.maxIterations,
 		MaxMillis:       al.loopMaxMillis,
+		Binding:         al.defaultRouteBinding(),
 	})
 }
 
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
-	// Add message preview to log (show full content for error messages)
-	var logContent string
-	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
-		logContent = msg.Content // Full content for errors
-	} else {
-		logContent = utils.Truncate(msg.Content, 80)
-	}
+	// Only a preview of the message is logged; the logger redacts it.
+	logContent := utils.Truncate(msg.Content, 80)
 	logger.InfoCF("agent", fmt.Sprintf("Processing message from %s:%s: %s", msg.Channel, msg.SenderID, logContent),
 		map[string]interface{}{
 			"channel":     msg.Channel,
@@ -377,34 +538,55 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			"session_key": msg.SessionKey,
 		})
 
+	// Attribute every LLM call made for this message in the usage ledger.
+	ctx = usage.WithCallInfo(ctx, usage.CallInfo{
+		SessionKey: msg.SessionKey,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+	})
+
 	// Route system messages to processSystemMessage
 	if msg.Channel == "system" {
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Daily session cutover: archive yesterday's session to daily note and reset.
+	if !al.cfg.Architecture.UseNewArchitecture {
+		al.maybeDailyCutover(msg.SessionKey)
+	}
+
+	// Commands (/approve, /pending, /usage, ...) are handled before any routing
+	// and are not journaled as jobs.
+	if response, handled := al.handleCommand(ctx, msg); handled {
+		return response, nil
+	}
+
+	ctx, jobID := al.startJob(ctx, msg)
+
 	// Branch between new and legacy architecture
+	var response string
+	var err error
 	if al.cfg.Architecture.UseNewArchitecture {
-		return al.processMessageNewArch(ctx, msg)
+		response, err = al.processMessageNewArch(ctx, msg)
+	} else {
+		response, err = al.processMessageLegacy(ctx, msg)
 	}
-
-	// Continue with legacy architecture below
-	return al.processMessageLegacy(ctx, msg)
+	al.finishJob(ctx, jobID, err)
+	if jobCancelled(ctx) {
+		// The user was told by /cancel; drop the partial reply.
+		return "", nil
+	}
+	return response, err
 }
 
 // processMessageLegacy is the original processMessage implementation.
 // This preserves backward compatibility while the new architecture is being developed.
 func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMessage) (string, error) {
-
-	// Daily session cutover: archive yesterday's session to daily note and reset.
-	al.maybeDailyCutover(msg.SessionKey)
-
-	// Check for commands
-	if response, handled := al.handleCommand(ctx, msg); handled {
-		return response, nil
-	}
+	jobID := jobIDFromContext(ctx)
 
 	flags := al.sessions.GetFlags(msg.SessionKey)
-	decision := al.router.Decide(ctx, msg.Content, flags)
+	decision := al.router.Decide(usage.WithRoute(ctx, "CLASSIFY"), msg.Content, flags)
 	// LINE channel is chat-only by product rule.
 	// Force CHAT route regardless of classifier/rules output.
 	if msg.Channel == "line" && strings.ToUpper(strings.TrimSpace(decision.Route)) != RouteChat {
@@ -424,7 +606,17 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 			"classifier_confidence": decision.ClassifierConfidence,
 			"error_reason":          decision.ErrorReason,
 		})
+	al.recordJob(jobID, jobs.StateRouted, decision.Route, decision.Source)
 	flags.LocalOnly = decision.LocalOnly
+	// Budgets are evaluated per turn; a soft-limit demotion is not persisted like /local.
+	if decision.DirectResponse == "" {
+		// bindRoute below resolves the route without the task text.
+		localOnly, refused, notice := al.applyBudget(msg, budgetRoute(decision.Route, ""), decision.LocalOnly)
+		if refused {
+			return notice, nil
+		}
+		decision.LocalOnly = localOnly
+	}
 	// Special handling: remember origin message ID for Worker/Coder completion reply.
 	if msg.Channel == "line" {
 		originMessageID := strings.TrimSpace(msg.Metadata["message_id"])
@@ -435,6 +627,10 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 		}
 	}
 
+	if strings.ToUpper(strings.TrimSpace(decision.Route)) != RouteChat && decision.DirectResponse == "" {
+		al.recordJob(jobID, jobs.StateDelegated, decision.Route, "")
+	}
+
 	// Notify user when Chat agent delegates work to Worker/Coder (or other non-chat routes).
 	if strings.ToUpper(strings.TrimSpace(decision.Route)) != RouteChat && !constants.IsInternalChannel(msg.Channel) {
 		role, alias := al.resolveRouteRoleAlias(decision.Route)
@@ -452,6 +648,18 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 			Content: fmt.Sprintf("%sから%sに作業依頼して進めるね。完了したら報告するよ。", chatAlias, display),
 		})
 	}
+	userMessage := decision.CleanUserText
+	if userMessage == "" {
+		userMessage = msg.Content
+	}
+	al.sessions.AddRoute(msg.SessionKey, session.RouteRecord{
+		Text:        userMessage,
+		Route:       decision.Route,
+		Source:      decision.Source,
+		Confidence:  decision.Confidence,
+		Declaration: decision.Declaration,
+		LocalOnly:   decision.LocalOnly,
+	})
 	if decision.DirectResponse != "" {
 		al.sessions.SetFlags(msg.SessionKey, flags)
 		al.sessions.Save(msg.SessionKey)
@@ -459,15 +667,10 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 	}
 
 	// Process as user message
-	userMessage := decision.CleanUserText
-	if userMessage == "" {
-		userMessage = msg.Content
-	}
-	restoreRouteLLM, err := al.applyRouteLLM(decision.Route)
+	binding, err := al.bindRoute(decision.Route, decision.LocalOnly)
 	if err != nil {
 		return "", fmt.Errorf("failed to switch LLM for route %s: %w", decision.Route, err)
 	}
-	defer restoreRouteLLM()
 
 	// Keep chat conversations naturally continuous.
 	// CHAT route should prefer full per-user history over aggressive auto-summarization.
@@ -490,37 +693,12 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 		Declaration:     decision.Declaration,
 		MaxLoops:        al.loopMaxLoops,
 		MaxMillis:       al.loopMaxMillis,
+		Binding:         binding,
+		// CODE3 output is a plan/patch payload that is rewritten before it reaches the user.
+		Stream: !strings.EqualFold(strings.TrimSpace(decision.Route), RouteCode3),
 	}
 	response, err := al.runAgentLoop(ctx, opts)
 
-	// LINE指示ごと: ヘルスチェック（失敗してなくても実行）→Ollama落ち/モデル未ロードなら再起動→リトライ
-	if al.routeUsesOllama(decision.Route) && al.cfg.Providers.Ollama.APIBase != "" {
-		checkURL := strings.TrimSuffix(al.cfg.Providers.Ollama.APIBase, "/v1")
-		ollamaOK, ollamaMsg := health.OllamaCheck(checkURL, 5*time.Second)()
-		required := al.buildOllamaRequiredModels()
-		modelsOK, modelsMsg := true, ""
-		if len(required) > 0 {
-			modelsOK, modelsMsg = health.OllamaModelsCheck(checkURL, 5*time.Second, required)()
-		}
-		logger.InfoCF("agent", "ollama health check",
-			map[string]interface{}{
-				"ollama_ok": ollamaOK, "ollama_msg": ollamaMsg,
-				"models_ok": modelsOK, "models_msg": modelsMsg,
-				"llm_err": err != nil,
-			})
-		needsRestart := !ollamaOK || !modelsOK
-		if needsRestart && strings.TrimSpace(al.cfg.Providers.OllamaRestartCommand) != "" {
-			cmd := exec.CommandContext(ctx, "sh", "-c", al.cfg.Providers.OllamaRestartCommand)
-			if runErr := cmd.Run(); runErr != nil {
-				logger.WarnCF("agent", "ollama restart failed", map[string]interface{}{"error": runErr.Error()})
-			} else if err != nil {
-				time.Sleep(10 * time.Second)
-				opts.SkipAddUserMessage = true
-				response, err = al.runAgentLoop(ctx, opts)
-			}
-		}
-	}
-
 	// CODE3 の出力処理：plan/patch を解析して承認要求を生成
 	if err == nil && strings.EqualFold(strings.TrimSpace(decision.Route), RouteCode3) {
 		coderOutput, parseErr := parseCoder3Output(response)
@@ -537,23 +715,39 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 				"session_key": msg.SessionKey,
 			})
 
+			al.recordJob(jobID, jobs.StateExecuting, decision.Route, "")
 			result, execErr := al.executeWorkerPatch(ctx, coderOutput.Patch, msg.SessionKey)
 			if execErr != nil {
+				al.recordJob(jobID, jobs.StateFailed, "", execErr.Error())
 				response = fmt.Sprintf("patch の実行に失敗したよ😢\n\nエラー: %v\n\nPlan:\n%s", execErr, coderOutput.Plan)
 				logger.ErrorCF("worker", "worker.patch_execution_error", map[string]interface{}{
 					"job_id": coderOutput.JobID,
 					"error":  execErr.Error(),
 				})
 			} else {
-				response = fmt.Sprintf("実行完了！✨\n\n%s\n\n詳細:\n%s\n\nPlan:\n%s",
+				head := "実行完了！✨"
+				if result.DryRun {
+					head = "dry-run だよ。ファイルはまだ変更していないよ。"
+				}
+				response = fmt.Sprintf("%s\n\n%s\n\n詳細:\n%s\n\nPlan:\n%s",
+					head,
 					result.Summary,
 					formatExecutionResults(result.Results),
 					coderOutput.Plan)
 
+				if result.DryRun && len(result.Files) > 0 {
+					response += "\n\n変更予定のファイル:\n" + formatFileChanges(result.Files)
+				}
 				if result.GitCommit != "" {
 					response += fmt.Sprintf("\n\nGit コミット: %s", result.GitCommit)
 				}
 
+				if result.Success {
+					al.recordJob(jobID, jobs.StateDone, "", result.Summary)
+				} else {
+					al.recordJob(jobID, jobs.StateFailed, "", result.Summary)
+				}
+
 				logger.InfoCF("worker", "worker.patch_execution_complete", map[string]interface{}{
 					"job_id":        coderOutput.JobID,
 					"success":       result.Success,
@@ -566,6 +760,7 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 
 	if err == nil && strings.EqualFold(strings.TrimSpace(decision.Route), RouteChat) {
 		if directive, ok := parseChatDelegateDirective(response); ok {
+			al.recordJob(jobID, jobs.StateDelegated, directive.Route, "")
 			if !constants.IsInternalChannel(msg.Channel) {
 				role, alias := al.resolveRouteRoleAlias(directive.Route)
 				display := role
@@ -584,7 +779,7 @@ func (al *AgentLoop) processMessageLegacy(ctx context.Context, msg bus.InboundMe
 			if delegateErr != nil {
 				err = delegateErr
 			} else {
-				finalResponse, finalizeErr := al.finalizeDelegationWithChat(ctx, msg, directive, delegateResult)
+				finalResponse, finalizeErr := al.finalizeDelegationWithChat(ctx, msg, directive, delegateResult, decision.LocalOnly)
 				if finalizeErr != nil {
 					err = finalizeErr
 				} else {
@@ -744,15 +939,17 @@ func chooseDelegationTemplate(seed string, templates []string, args ...interface
 }
 
 func (al *AgentLoop) executeChatDelegation(ctx context.Context, msg bus.InboundMessage, directive chatDelegateDirective, localOnly bool) (string, error) {
-	restoreRouteLLM, err := al.applyRouteLLMWithTask(directive.Route, directive.Task)
+	localOnly, refused, notice := al.applyBudget(msg, budgetRoute(directive.Route, directive.Task), localOnly)
+	if refused {
+		return notice, nil
+	}
+	binding, err := al.bindRouteWithTask(directive.Route, directive.Task, localOnly)
 	if err != nil {
 		return "", fmt.Errorf("failed to switch LLM for delegated route %s: %w", directive.Route, err)
 	}
-	defer restoreRouteLLM()
 
-	delegateSessionKey := fmt.Sprintf("%s:delegate:%d", msg.SessionKey, time.Now().UnixNano())
 	return al.runAgentLoop(ctx, processOptions{
-		SessionKey:      delegateSessionKey,
+		SessionKey:      delegateSessionKey(msg.SessionKey),
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
 		UserMessage:     directive.Task,
@@ -764,15 +961,15 @@ func (al *AgentLoop) executeChatDelegation(ctx context.Context, msg bus.InboundM
 		LocalOnly:       localOnly,
 		MaxLoops:        al.loopMaxLoops,
 		MaxMillis:       al.loopMaxMillis,
+		Binding:         binding,
 	})
 }
 
-func (al *AgentLoop) finalizeDelegationWithChat(ctx context.Context, msg bus.InboundMessage, directive chatDelegateDirective, delegateResult string) (string, error) {
-	restoreRouteLLM, err := al.applyRouteLLM(RouteChat)
+func (al *AgentLoop) finalizeDelegationWithChat(ctx context.Context, msg bus.InboundMessage, directive chatDelegateDirective, delegateResult string, localOnly bool) (string, error) {
+	binding, err := al.bindRoute(RouteChat, localOnly)
 	if err != nil {
 		return "", fmt.Errorf("failed to switch back to chat LLM: %w", err)
 	}
-	defer restoreRouteLLM()
 
 	finalPrompt := fmt.Sprintf(
 		"[DELEGATION_RESULT]\nRoute: %s\nTask:\n%s\n\nResult:\n%s\n\nこの結果を踏まえてユーザー向け最終回答を返して。ここでは DELEGATE 形式を絶対に出力せず、最終回答のみ返すこと。",
@@ -792,6 +989,8 @@ func (al *AgentLoop) finalizeDelegationWithChat(ctx context.Context, msg bus.Inb
 		Route:           RouteChat,
 		MaxLoops:        al.loopMaxLoops,
 		MaxMillis:       al.loopMaxMillis,
+		Binding:         binding,
+		Stream:          true,
 	})
 	if err != nil {
 		return "", err
@@ -802,59 +1001,6 @@ func (al *AgentLoop) finalizeDelegationWithChat(ctx context.Context, msg bus.Inb
 	return finalResponse, nil
 }
 
-func (al *AgentLoop) applyRouteLLM(route string) (func(), error) {
-	return al.applyRouteLLMWithTask(route, "")
-}
-
-func (al *AgentLoop) applyRouteLLMWithTask(route, taskText string) (func(), error) {
-	actualRoute := route
-	if route == RouteCode && taskText != "" {
-		actualRoute = selectCoderRoute(taskText)
-	}
-	role, alias := al.resolveRouteRoleAlias(actualRoute)
-	targetProvider, targetModel := al.resolveRouteLLMWithTask(actualRoute, taskText)
-	if targetModel == "" {
-		targetModel = al.model
-	}
-	if targetProvider == al.providerName && targetModel == al.model {
-		return func() {}, nil
-	}
-
-	cfg := config.DefaultConfig()
-	cfg.Providers = al.cfg.Providers
-	cfg.Agents.Defaults.Workspace = al.cfg.Agents.Defaults.Workspace
-	cfg.Agents.Defaults.RestrictToWorkspace = al.cfg.Agents.Defaults.RestrictToWorkspace
-	cfg.Agents.Defaults.Provider = targetProvider
-	cfg.Agents.Defaults.Model = targetModel
-
-	routeProvider, err := providers.CreateProvider(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	prevProvider := al.provider
-	prevProviderName := al.providerName
-	prevModel := al.model
-
-	al.provider = routeProvider
-	al.providerName = targetProvider
-	al.model = targetModel
-
-	logger.InfoCF("agent", "route.llm.selected", map[string]interface{}{
-		"route":    route,
-		"role":     role,
-		"alias":    alias,
-		"provider": targetProvider,
-		"model":    targetModel,
-	})
-
-	return func() {
-		al.provider = prevProvider
-		al.providerName = prevProviderName
-		al.model = prevModel
-	}, nil
-}
-
 func (al *AgentLoop) resolveRouteLLM(route string) (string, string) {
 	return al.resolveRouteLLMWithTask(route, "")
 }
@@ -969,11 +1115,6 @@ func selectCoderRoute(taskText string) string {
 	return RouteCode2
 }
 
-func (al *AgentLoop) routeUsesOllama(route string) bool {
-	provider, _ := al.resolveRouteLLM(route)
-	return strings.EqualFold(strings.TrimSpace(provider), "ollama")
-}
-
 func (al *AgentLoop) buildOllamaRequiredModels() []health.ModelRequirement {
 	var required []health.ModelRequirement
 	type pair struct {
@@ -1092,6 +1233,18 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 // runAgentLoop is the core message processing logic.
 // It handles context building, LLM calls, tool execution, and response handling.
 func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (string, error) {
+	callInfo := usage.CallInfoFromContext(ctx)
+	callInfo.SessionKey = opts.SessionKey
+	callInfo.Channel = opts.Channel
+	callInfo.ChatID = opts.ChatID
+	callInfo.Route = opts.Route
+	if opts.Binding.Target != "" {
+		callInfo.Route = opts.Binding.Target
+	} else if callInfo.Route == "" {
+		callInfo.Route = opts.Binding.Route
+	}
+	ctx = usage.WithCallInfo(ctx, callInfo)
+
 	loopCtx := ctx
 	cancel := func() {}
 	if opts.MaxMillis > 0 {
@@ -1138,10 +1291,8 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		workOverlay,
 	)
 
-	// 3. Save user message to session (skip on retry - already added)
-	if !opts.SkipAddUserMessage {
-		al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
-	}
+	// 3. Save user message to session
+	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(loopCtx, messages, opts)
@@ -1179,7 +1330,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 7. Optional: summarization
 	if opts.EnableSummary {
-		al.maybeSummarize(opts.SessionKey, opts.Channel, opts.ChatID)
+		al.maybeSummarize(opts.SessionKey, opts.Channel, opts.ChatID, al.bindingOrDefault(opts.Binding))
 	}
 
 	// 8. Optional: send response via bus
@@ -1212,6 +1363,8 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	if opts.MaxLoops > 0 {
 		limit = opts.MaxLoops
 	}
+	binding := al.bindingOrDefault(opts.Binding)
+	streamer := al.newReplyStreamer(ctx, opts)
 
 	for iteration < limit {
 		iteration++
@@ -1232,7 +1385,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             binding.Model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
 				"max_tokens":        8192,
@@ -1254,10 +1407,10 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		// Retry loop for context/token errors
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
-			response, err = al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
+			response, err = chatLLM(ctx, binding, messages, providerToolDefs, map[string]interface{}{
 				"max_tokens":  8192,
 				"temperature": 0.7,
-			})
+			}, streamer)
 
 			if err == nil {
 				break // Success
@@ -1463,7 +1616,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
+			noteProgress(ctx)
 			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			noteProgress(ctx)
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -1500,7 +1655,8 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
+// updateToolContexts starts a new round for the message tool's send
+// tracking. Other tools read the origin chat from the tool context.
 func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
 	if tool, ok := al.tools.Get("message"); ok {
@@ -1508,16 +1664,6 @@ func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 			mt.SetContext(channel, chatID)
 		}
 	}
-	if tool, ok := al.tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
-	}
-	if tool, ok := al.tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
-	}
 }
 
 // maybeDailyCutover checks whether the session has crossed a daily boundary
@@ -1577,7 +1723,8 @@ func (al *AgentLoop) maybeDailyCutover(sessionKey string) {
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
-func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string) {
+// The summary is generated with the turn's binding.
+func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string, binding RouteBinding) {
 	newHistory := al.sessions.GetHistory(sessionKey)
 	tokenEstimate := al.estimateTokens(newHistory)
 	threshold := al.contextWindow * 75 / 100
@@ -1594,7 +1741,7 @@ func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string) {
 						Content: "⚠️ Memory threshold reached. Optimizing conversation history...",
 					})
 				}
-				al.summarizeSession(sessionKey)
+				al.summarizeSession(sessionKey, binding)
 			}()
 		}
 	}
@@ -1728,9 +1875,10 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 	return result
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(sessionKey string) {
+// summarizeSession summarizes the conversation history for a session using binding.
+func (al *AgentLoop) summarizeSession(sessionKey string, binding RouteBinding) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	ctx = usage.WithCallInfo(ctx, usage.CallInfo{SessionKey: sessionKey, Route: "SUMMARY"})
 	defer cancel()
 
 	history := al.sessions.GetHistory(sessionKey)
@@ -1774,12 +1922,12 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 		part1 := validMessages[:mid]
 		part2 := validMessages[mid:]
 
-		s1, _ := al.summarizeBatch(ctx, part1, "")
-		s2, _ := al.summarizeBatch(ctx, part2, "")
+		s1, _ := al.summarizeBatch(ctx, binding, part1, "")
+		s2, _ := al.summarizeBatch(ctx, binding, part2, "")
 
 		// Merge them
 		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
+		resp, err := binding.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, binding.Model, map[string]interface{}{
 			"max_tokens":  1024,
 			"temperature": 0.3,
 		})
@@ -1789,7 +1937,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 			finalSummary = s1 + " " + s2
 		}
 	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, validMessages, summary)
+		finalSummary, _ = al.summarizeBatch(ctx, binding, validMessages, summary)
 	}
 
 	if omitted && finalSummary != "" {
@@ -1804,7 +1952,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 }
 
 // summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Message, existingSummary string) (string, error) {
+func (al *AgentLoop) summarizeBatch(ctx context.Context, binding RouteBinding, batch []providers.Message, existingSummary string) (string, error) {
 	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
 	if existingSummary != "" {
 		prompt += "Existing context: " + existingSummary + "\n"
@@ -1814,7 +1962,7 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
 	}
 
-	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
+	response, err := binding.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, binding.Model, map[string]interface{}{
 		"max_tokens":  1024,
 		"temperature": 0.3,
 	})
@@ -1857,7 +2005,7 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		}
 		switch args[0] {
 		case "model":
-			return fmt.Sprintf("Current model: %s", al.model), true
+			return fmt.Sprintf("Current model: %s", al.defaultRouteBinding().Model), true
 		case "channel":
 			return fmt.Sprintf("Current channel: %s", msg.Channel), true
 		default:
@@ -1894,8 +2042,7 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 
 		switch target {
 		case "model":
-			oldModel := al.model
-			al.model = value
+			oldModel := al.setDefaultModel(value)
 			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
 		case "channel":
 			// This changes the 'default' channel for some operations, or effectively redirects output?
@@ -1941,6 +2088,22 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 			return "現在は会話モードです。仕事モードは /work で有効にできます。", true
 		}
 
+	case "/usage":
+		if al.usageLedger == nil {
+			return "Usage tracking is disabled (usage.enabled=false).", true
+		}
+		report, err := al.usageLedger.Report(time.Now())
+		if err != nil {
+			return fmt.Sprintf("Failed to read usage ledger: %v", err), true
+		}
+		return strings.TrimRight(report, "\n"), true
+
+	case "/approve", "/deny", "/pending":
+		return al.handleApprovalCommand(ctx, msg, cmd, args), true
+
+	case "/jobs", "/status", "/cancel":
+		return al.handleJobCommand(msg, cmd, args), true
+
 	case "/normal":
 		flags := al.sessions.GetFlags(msg.SessionKey)
 		flags.WorkOverlayTurnsLeft = 0
@@ -1987,6 +2150,9 @@ func detectPatchType(patch string) string {
 	if strings.HasPrefix(trimmed, "[") {
 		return "json"
 	}
+	if isUnifiedDiff(trimmed) {
+		return "unified_diff"
+	}
 	if strings.Contains(patch, "```") {
 		return "markdown"
 	}
@@ -2010,3 +2176,26 @@ func formatExecutionResults(results []CommandResult) string {
 	}
 	return strings.Join(lines, "\n")
 }
+
+// formatFileChanges は Worker が変更した（dry-run では変更予定の）ファイルを整形して返す
+func formatFileChanges(files []FileChange) string {
+	var lines []string
+	for _, f := range files {
+		line := fmt.Sprintf("- %s %s %s → %s", f.Action, f.Path, shortHash(f.BeforeHash), shortHash(f.AfterHash))
+		if f.Added > 0 || f.Removed > 0 {
+			line += fmt.Sprintf(" (+%d -%d)", f.Added, f.Removed)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func shortHash(h string) string {
+	if h == "" {
+		return "(none)"
+	}
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
@@ -2,22 +2,28 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
-	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobid"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/jobs"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/chat"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/order"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules/worker"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/session"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
 )
 
 // processMessageNewArch implements the new architecture message flow.
 // Flow: Chat (reception) → Worker (routing) → Order (if needed) → Worker (aggregation) → Chat (decision)
 func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundMessage) (string, error) {
-	// Generate JobID for this work unit
-	jobID := al.jobIDGen.Next()
+	// The JobID for this work unit was assigned (and journaled) by processMessage.
+	jobID := jobIDFromContext(ctx)
 
 	logger.InfoCF("agent", "new_arch.start", map[string]interface{}{
 		"job_id":      jobID,
@@ -25,8 +31,15 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 		"session_key": msg.SessionKey,
 	})
 
+	// Each agent reports what it is doing on the heartbeat bus.
+	al.setAgentBusy(ctx, "chat", agentProcessing, jobID)
+	defer al.setAgentIdle("chat", jobID)
+	defer al.setAgentIdle("worker", jobID)
+
 	// Step 1: Chat agent receives task (lightweight reception)
 	task := al.chatReceptionModule.ReceiveTask(msg, jobID)
+	al.setAgentBusy(ctx, "chat", agentWaiting, jobID)
+	ctx = al.setAgentBusy(ctx, "worker", agentProcessing, jobID)
 
 	logger.InfoCF("agent", "new_arch.task_received", map[string]interface{}{
 		"job_id":    jobID,
@@ -46,9 +59,34 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 		return "", fmt.Errorf("routing decision failed: %w", err)
 	}
 
+	al.recordJob(jobID, jobs.StateRouted, decision.Route, "")
+
 	// Update session flags with routing decision
 	flags.LocalOnly = decision.LocalOnly
 	al.sessions.SetFlags(msg.SessionKey, flags)
+	al.sessions.AddRoute(msg.SessionKey, session.RouteRecord{
+		Text:        task.UserText,
+		Route:       decision.Route,
+		Source:      decision.Source,
+		Confidence:  decision.Confidence,
+		Declaration: decision.Declaration,
+		LocalOnly:   decision.LocalOnly,
+	})
+
+	// Order routes run on the Order's own route; in deliberation order3 always
+	// takes part, so the turn is checked as CODE3.
+	checkRoute := decision.Route
+	if isOrderRoute(decision.Route) {
+		checkRoute = orderIDToRoute(routeToOrderID(decision.Route))
+		if al.cfg.Architecture.EnableDeliberation {
+			checkRoute = RouteCode3
+		}
+	}
+	localOnly, refused, notice := al.applyBudget(msg, checkRoute, decision.LocalOnly)
+	if refused {
+		return notice, nil
+	}
+	decision.LocalOnly = localOnly
 
 	// Step 3: Notify user if delegating to Order agent
 	if isOrderRoute(decision.Route) && msg.Channel != "system" {
@@ -71,10 +109,34 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 
 	// Step 4: Execute based on routing decision
 	var result chat.TaskResult
+	var approvalNotice string
 
 	if isOrderRoute(decision.Route) {
-		// Delegate to Order agent
-		orderResult, err := al.delegateToOrderNewArch(ctx, decision.Route, task)
+		al.recordJob(jobID, jobs.StateDelegated, decision.Route, "")
+		al.setAgentBusy(ctx, "worker", agentWaiting, jobID)
+
+		// Delegate to Order agent(s). In deliberation mode every Order gets the
+		// task and the Worker ranks their proposals.
+		var orderResults []worker.OrderResult
+		if al.cfg.Architecture.EnableDeliberation {
+			orderResults = al.deliberateNewArch(ctx, task, decision.LocalOnly)
+		} else {
+			orderResult, err := al.delegateToOrderNewArch(ctx, decision.Route, task, decision.LocalOnly)
+			if err != nil {
+				orderResult = worker.OrderResult{JobID: jobID, Success: false, Error: err}
+			}
+			orderResults = []worker.OrderResult{orderResult}
+		}
+
+		// Worker aggregates Order results
+		ctx = al.setAgentBusy(ctx, "worker", agentProcessing, jobID)
+		var judge worker.LLM
+		if len(orderResults) > 1 {
+			judge = al.bindJudge(decision.LocalOnly)
+		}
+		aggregateCtx, cancel := context.WithTimeout(ctx, al.deliberationTimeout())
+		aggregated, err := al.workerAggregationModule.Aggregate(aggregateCtx, orderResults, judge)
+		cancel()
 		if err != nil {
 			result = chat.TaskResult{
 				JobID:   jobID,
@@ -82,27 +144,37 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 				Error:   err,
 			}
 		} else {
-			// Worker aggregates Order result
-			aggregated, err := al.workerAggregationModule.Aggregate(ctx, []worker.OrderResult{orderResult})
-			if err != nil {
-				result = chat.TaskResult{
-					JobID:   jobID,
-					Success: false,
-					Error:   err,
-				}
-			} else {
-				result = chat.TaskResult{
-					JobID:    jobID,
-					Success:  aggregated.Success,
-					Output:   aggregated.Output,
-					Error:    aggregated.Error,
-					Metadata: aggregated.Metadata,
-				}
+			result = chat.TaskResult{
+				JobID:    jobID,
+				Success:  aggregated.Success,
+				Output:   aggregated.Output,
+				Error:    aggregated.Error,
+				Metadata: aggregated.Metadata,
 			}
+			// Patches are never applied without /approve.
+			approvalNotice = al.storePendingProposal(msg, aggregated)
 		}
 	} else {
-		// Worker executes directly
-		output, err := al.workerExecutionModule.ExecuteTask(ctx, jobID, decision.Route, task.UserText)
+		// Worker executes directly; ANALYZE requests that name code go to an
+		// Order's CodeAnalysisModule.
+		target, hasCode := "", false
+		if decision.Route == RouteAnalyze {
+			target, hasCode = al.findAnalysisTarget(task.UserText)
+		}
+		var output string
+		var err error
+		if hasCode {
+			output, err = al.analyzeCodeNewArch(ctx, task, target, decision.LocalOnly)
+		} else {
+			// The Worker is bound per turn so that /local and a budget
+			// demotion keep it off cloud providers.
+			var binding RouteBinding
+			binding, err = al.bindRouteWithTask(decision.Route, task.UserText, decision.LocalOnly)
+			if err == nil {
+				output, err = al.workerExecutionModule.ExecuteTask(ctx, jobID, decision.Route, task.UserText,
+					worker.LLM{Provider: binding.Provider, Model: binding.Model})
+			}
+		}
 		if err != nil {
 			result = chat.TaskResult{
 				JobID:   jobID,
@@ -119,7 +191,12 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 	}
 
 	// Step 5: Chat agent makes final decision
+	al.setAgentIdle("worker", jobID)
+	ctx = al.setAgentBusy(ctx, "chat", agentProcessing, jobID)
 	response := al.chatDecisionModule.MakeFinalDecision(ctx, result)
+	if approvalNotice != "" {
+		response += "\n\n" + approvalNotice
+	}
 
 	logger.InfoCF("agent", "new_arch.complete", map[string]interface{}{
 		"job_id":  jobID,
@@ -129,9 +206,97 @@ func (al *AgentLoop) processMessageNewArch(ctx context.Context, msg bus.InboundM
 	return response, nil
 }
 
+// bindJudge binds the Worker role's LLM that ranks deliberation proposals.
+// It is bound per turn like the Orders, so /local and a budget demotion keep
+// the judge local; without a binding the proposals are ranked by heuristics.
+func (al *AgentLoop) bindJudge(localOnly bool) worker.LLM {
+	binding, err := al.bindRoute(RoutePlan, localOnly)
+	if err != nil {
+		logger.WarnCF("agent", "new_arch.judge_unavailable", map[string]interface{}{
+			"local_only": localOnly,
+			"error":      err.Error(),
+		})
+		return worker.LLM{}
+	}
+	return worker.LLM{Provider: binding.Provider, Model: binding.Model}
+}
+
+// deliberationTimeout is the per-Order (and judge) limit in deliberation mode.
+func (al *AgentLoop) deliberationTimeout() time.Duration {
+	if sec := al.cfg.Architecture.DeliberationTimeoutSec; sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return 180 * time.Second
+}
+
+// deliberateNewArch fans the task out to order1/order2/order3 concurrently.
+// Each Order has its own timeout; an Order that fails or times out is returned
+// as a failed result so the others can still be compared.
+func (al *AgentLoop) deliberateNewArch(ctx context.Context, task chat.Task, localOnly bool) []worker.OrderResult {
+	routes := []string{RouteCode1, RouteCode2, RouteCode3}
+	timeout := al.deliberationTimeout()
+
+	logger.InfoCF("agent", "new_arch.deliberation.start", map[string]interface{}{
+		"job_id":  task.JobID,
+		"orders":  len(routes),
+		"timeout": timeout.String(),
+	})
+
+	results := make([]worker.OrderResult, len(routes))
+	var wg sync.WaitGroup
+	for i, route := range routes {
+		wg.Add(1)
+		go func(i int, route string) {
+			defer wg.Done()
+			orderCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			done := make(chan worker.OrderResult, 1)
+			go func() {
+				r, err := al.delegateToOrderNewArch(orderCtx, route, task, localOnly)
+				if err != nil {
+					r = worker.OrderResult{JobID: task.JobID, OrderID: routeToOrderID(route), Success: false, Error: err}
+				}
+				done <- r
+			}()
+
+			select {
+			case r := <-done:
+				results[i] = r
+			case <-orderCtx.Done():
+				err := orderCtx.Err()
+				if errors.Is(err, context.DeadlineExceeded) {
+					err = fmt.Errorf("timed out after %s", timeout)
+				}
+				results[i] = worker.OrderResult{JobID: task.JobID, OrderID: routeToOrderID(route), Success: false, Error: err}
+			}
+		}(i, route)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		}
+	}
+	logger.InfoCF("agent", "new_arch.deliberation.collected", map[string]interface{}{
+		"job_id":    task.JobID,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+	return results
+}
+
 // delegateToOrderNewArch delegates a task to an Order agent in the new architecture.
-func (al *AgentLoop) delegateToOrderNewArch(ctx context.Context, route string, task chat.Task) (worker.OrderResult, error) {
+func (al *AgentLoop) delegateToOrderNewArch(ctx context.Context, route string, task chat.Task, localOnly bool) (worker.OrderResult, error) {
 	orderID := routeToOrderID(route)
+	ctx = al.setAgentBusy(ctx, orderID, agentProcessing, task.JobID)
+	defer al.setAgentIdle(orderID, task.JobID)
+
+	// Usage is recorded under the Order's own route, so that the CODE3 budget
+	// sees order3 calls.
+	ctx = usage.WithRoute(ctx, orderIDToRoute(orderID))
 
 	logger.InfoCF("agent", "new_arch.delegate_order", map[string]interface{}{
 		"job_id":   task.JobID,
@@ -150,6 +315,22 @@ func (al *AgentLoop) delegateToOrderNewArch(ctx context.Context, route string, t
 		}, nil
 	}
 
+	// Bind the Order's LLM the same way the legacy path binds its route,
+	// including fallbacks and /local.
+	if orderAgent.Provider == nil {
+		binding, err := al.bindRouteWithTask(orderIDToRoute(orderID), task.UserText, localOnly)
+		if err != nil {
+			return worker.OrderResult{
+				JobID:   task.JobID,
+				OrderID: orderID,
+				Success: false,
+				Error:   fmt.Errorf("failed to bind LLM for %s: %w", orderID, err),
+			}, nil
+		}
+		orderAgent.Provider = binding.Provider
+		orderAgent.Model = binding.Model
+	}
+
 	// Find ProposalGenerationModule
 	var proposalModule *order.ProposalGenerationModule
 	for _, module := range orderAgent.Modules {
@@ -225,6 +406,18 @@ func routeToOrderID(route string) string {
 	}
 }
 
+// orderIDToRoute is the inverse of routeToOrderID.
+func orderIDToRoute(orderID string) string {
+	switch orderID {
+	case "order2":
+		return RouteCode2
+	case "order3":
+		return RouteCode3
+	default:
+		return RouteCode1
+	}
+}
+
 // initializeNewArchitecture sets up the new architecture components.
 // This is called during AgentLoop initialization when UseNewArchitecture is true.
 func (al *AgentLoop) initializeNewArchitecture(ctx context.Context) error {
@@ -233,8 +426,8 @@ func (al *AgentLoop) initializeNewArchitecture(ctx context.Context) error {
 		"enable_deliberation": al.cfg.Architecture.EnableDeliberation,
 	})
 
-	// Initialize JobID generator
-	al.jobIDGen = jobid.NewGenerator()
+	// Pending proposals survive restarts so /approve works after a reboot.
+	al.orderApprovalModule = newApprovalFlow(al.workspace)
 
 	// Create Chat agent with modules
 	chatAgent, err := NewAgentWithModules(ctx, "chat", al.cfg, al.bus, al.sessions, al.router)
@@ -258,6 +451,9 @@ func (al *AgentLoop) initializeNewArchitecture(ctx context.Context) error {
 		return fmt.Errorf("failed to create Worker agent: %w", err)
 	}
 
+	// The Worker's LLM is bound per turn (see processMessageNewArch), not
+	// here, so that /local and budget demotion apply to it.
+
 	// Extract modules from Worker agent
 	for _, module := range workerAgent.Modules {
 		switch m := module.(type) {
@@ -266,9 +462,11 @@ func (al *AgentLoop) initializeNewArchitecture(ctx context.Context) error {
 		case *worker.ExecutionModule:
 			al.workerExecutionModule = m
 		case *worker.AggregationModule:
+			m.SetPatchChecker(al.checkPatchApplies)
 			al.workerAggregationModule = m
 		case *worker.HeartbeatCollectorModule:
 			al.workerHeartbeatModule = m
+			al.heartbeats = heartbeat.NewHeartbeatBus()
 		}
 	}
 
@@ -0,0 +1,416 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPatchFuzz is how many context lines may be dropped from each end of a
+// hunk when it does not match exactly (like GNU patch's default fuzz factor).
+const maxPatchFuzz = 2
+
+// diffFile is one file section of a unified diff.
+type diffFile struct {
+	OldPath string // "" for /dev/null (new file)
+	NewPath string // "" for /dev/null (deleted file)
+	Hunks   []diffHunk
+}
+
+// diffHunk is one "@@ -a,b +c,d @@" block.
+type diffHunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []diffLine
+	NoNewlineOld       bool // "\ No newline at end of file" after the old side
+	NoNewlineNew       bool // "\ No newline at end of file" after the new side
+}
+
+type diffLine struct {
+	Kind byte // ' ', '-' or '+'
+	Text string
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// isUnifiedDiff reports whether patch looks like a unified diff.
+func isUnifiedDiff(patch string) bool {
+	trimmed := strings.TrimSpace(patch)
+	if strings.HasPrefix(trimmed, "diff --git ") {
+		return true
+	}
+	return strings.HasPrefix(trimmed, "--- ") && strings.Contains(trimmed, "\n+++ ") && strings.Contains(trimmed, "\n@@ ")
+}
+
+// parseUnifiedDiffCommands turns a unified diff into one file_edit command per
+// file. The command keeps that file's diff section so it can be re-parsed and
+// applied by the executor.
+func parseUnifiedDiffCommands(patch string) ([]PatchCommand, error) {
+	files, sections, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]PatchCommand, 0, len(files))
+	for i, f := range files {
+		target := f.NewPath
+		if target == "" {
+			target = f.OldPath
+		}
+		cmd := PatchCommand{
+			Type:    "file_edit",
+			Action:  "patch",
+			Target:  target,
+			Content: sections[i],
+		}
+		if f.OldPath != "" && f.NewPath != "" && f.OldPath != f.NewPath {
+			cmd.Metadata = map[string]string{"rename_from": f.OldPath}
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+// parseUnifiedDiff parses every file in a unified diff. sections[i] is the raw
+// text of files[i].
+func parseUnifiedDiff(patch string) ([]diffFile, []string, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var files []diffFile
+	var sections []string
+	var cur *diffFile
+	sectionStart := 0
+	pendingGit := false // a "diff --git" header was seen and the file has no ---/+++ yet
+
+	flush := func(end int) {
+		if cur != nil {
+			files = append(files, *cur)
+			sections = append(sections, strings.Join(lines[sectionStart:end], "\n")+"\n")
+			cur = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush(i)
+			cur = &diffFile{}
+			sectionStart = i
+			pendingGit = true
+			if a, b, ok := splitGitDiffHeader(line); ok {
+				cur.OldPath, cur.NewPath = a, b
+			}
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || !pendingGit || len(cur.Hunks) > 0 {
+				flush(i)
+				cur = &diffFile{}
+				sectionStart = i
+			}
+			pendingGit = false
+			cur.OldPath = diffPath(line[4:])
+			cur.NewPath = diffPath(lines[i+1][4:])
+			i++
+
+		case cur != nil && strings.HasPrefix(line, "new file mode"):
+			cur.OldPath = ""
+		case cur != nil && strings.HasPrefix(line, "deleted file mode"):
+			cur.NewPath = ""
+		case cur != nil && strings.HasPrefix(line, "rename from "):
+			cur.OldPath = strings.TrimSpace(strings.TrimPrefix(line, "rename from "))
+		case cur != nil && strings.HasPrefix(line, "rename to "):
+			cur.NewPath = strings.TrimSpace(strings.TrimPrefix(line, "rename to "))
+
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				return nil, nil, fmt.Errorf("hunk without file header at line %d", i+1)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", displayDiffPath(*cur), err)
+			}
+			cur.Hunks = append(cur.Hunks, hunk)
+			i = next - 1
+		}
+	}
+	flush(len(lines))
+
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no files found in unified diff")
+	}
+	for _, f := range files {
+		if f.OldPath == "" && f.NewPath == "" {
+			return nil, nil, fmt.Errorf("diff section without file paths")
+		}
+		if len(f.Hunks) == 0 && f.OldPath == f.NewPath {
+			return nil, nil, fmt.Errorf("%s: no hunks in diff", displayDiffPath(f))
+		}
+	}
+	return files, sections, nil
+}
+
+// parseHunk reads the hunk starting at lines[start] and returns the index of
+// the first line after it.
+func parseHunk(lines []string, start int) (diffHunk, int, error) {
+	m := hunkHeaderRe.FindStringSubmatch(lines[start])
+	if m == nil {
+		return diffHunk{}, 0, fmt.Errorf("malformed hunk header %q", lines[start])
+	}
+	h := diffHunk{
+		OldStart: atoiDefault(m[1], 0),
+		OldLines: atoiDefault(m[2], 1),
+		NewStart: atoiDefault(m[3], 0),
+		NewLines: atoiDefault(m[4], 1),
+	}
+
+	oldSeen, newSeen := 0, 0
+	i := start + 1
+	var last byte
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, `\`) {
+			switch last {
+			case '-':
+				h.NoNewlineOld = true
+			case '+':
+				h.NoNewlineNew = true
+			case ' ':
+				h.NoNewlineOld = true
+				h.NoNewlineNew = true
+			}
+			continue
+		}
+		if oldSeen >= h.OldLines && newSeen >= h.NewLines {
+			break
+		}
+		kind, text := byte(' '), ""
+		if line != "" {
+			// Blank context lines often lose their leading space in LLM output.
+			kind, text = line[0], line[1:]
+		}
+		switch kind {
+		case ' ':
+			oldSeen++
+			newSeen++
+		case '-':
+			oldSeen++
+		case '+':
+			newSeen++
+		default:
+			return diffHunk{}, 0, fmt.Errorf("unexpected line in hunk %q", line)
+		}
+		last = kind
+		h.Lines = append(h.Lines, diffLine{Kind: kind, Text: text})
+	}
+	if oldSeen != h.OldLines || newSeen != h.NewLines {
+		return diffHunk{}, 0, fmt.Errorf("hunk %q expects -%d +%d lines, found -%d +%d",
+			lines[start], h.OldLines, h.NewLines, oldSeen, newSeen)
+	}
+	return h, i, nil
+}
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// splitGitDiffHeader extracts the paths from "diff --git a/x b/y".
+func splitGitDiffHeader(line string) (string, string, bool) {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	idx := strings.Index(rest, " b/")
+	if !strings.HasPrefix(rest, "a/") || idx < 0 {
+		return "", "", false
+	}
+	return rest[2:idx], rest[idx+3:], true
+}
+
+// diffPath normalizes a ---/+++ path: strips a timestamp, the a/ or b/ prefix,
+// and maps /dev/null to "".
+func diffPath(raw string) string {
+	p := raw
+	if i := strings.Index(p, "\t"); i >= 0 {
+		p = p[:i]
+	}
+	p = strings.TrimSpace(p)
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		p = p[2:]
+	}
+	return p
+}
+
+func displayDiffPath(f diffFile) string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// hunkApplication reports how a file's hunks were applied.
+type hunkApplication struct {
+	Hunks   int
+	MaxFuzz int
+	Added   int
+	Removed int
+}
+
+// applyDiff applies f's hunks to original. Each hunk must match its context
+// exactly, at the expected line or nearby; if not, up to maxPatchFuzz context
+// lines are dropped from each end. A hunk that still does not match is rejected
+// and nothing is applied.
+func applyDiff(original string, f diffFile) (string, hunkApplication, error) {
+	var lines []string
+	eol := true
+	if original != "" {
+		lines = strings.Split(original, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		} else {
+			eol = false
+		}
+	}
+
+	app := hunkApplication{Hunks: len(f.Hunks)}
+	delta, drift, minPos := 0, 0, 0
+	for n, h := range f.Hunks {
+		var oldLines, newLines []string
+		for _, l := range h.Lines {
+			if l.Kind != '+' {
+				oldLines = append(oldLines, l.Text)
+			}
+			if l.Kind != '-' {
+				newLines = append(newLines, l.Text)
+			}
+			switch l.Kind {
+			case '+':
+				app.Added++
+			case '-':
+				app.Removed++
+			}
+		}
+
+		want := h.OldStart - 1
+		if h.OldLines == 0 {
+			want = h.OldStart
+		}
+		want += delta + drift
+
+		pos, lead, trail, fuzz, ok := locateHunk(lines, h, oldLines, want, minPos)
+		if !ok {
+			return "", app, fmt.Errorf("hunk %d (@@ -%d,%d +%d,%d @@) does not match %s",
+				n+1, h.OldStart, h.OldLines, h.NewStart, h.NewLines, displayDiffPath(f))
+		}
+		if fuzz > app.MaxFuzz {
+			app.MaxFuzz = fuzz
+		}
+
+		oldT := oldLines[lead : len(oldLines)-trail]
+		newT := newLines[lead : len(newLines)-trail]
+		updated := make([]string, 0, len(lines)-len(oldT)+len(newT))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, newT...)
+		updated = append(updated, lines[pos+len(oldT):]...)
+		lines = updated
+
+		drift += pos - lead - want
+		delta += len(newT) - len(oldT)
+		minPos = pos + len(newT)
+
+		if minPos+trail >= len(lines) {
+			if h.NoNewlineNew {
+				eol = false
+			} else if h.NoNewlineOld {
+				eol = true
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return "", app, nil
+	}
+	out := strings.Join(lines, "\n")
+	if eol {
+		out += "\n"
+	}
+	return out, app, nil
+}
+
+// locateHunk finds where the hunk's old lines occur, preferring the position
+// closest to want. lead and trail are the context lines dropped by fuzz.
+func locateHunk(lines []string, h diffHunk, oldLines []string, want, minPos int) (pos, lead, trail, fuzz int, ok bool) {
+	leadCtx, trailCtx := 0, 0
+	for _, l := range h.Lines {
+		if l.Kind != ' ' {
+			break
+		}
+		leadCtx++
+	}
+	for i := len(h.Lines) - 1; i >= 0 && h.Lines[i].Kind == ' '; i-- {
+		trailCtx++
+	}
+
+	prevLead, prevTrail := -1, -1
+	for fuzz = 0; fuzz <= maxPatchFuzz; fuzz++ {
+		lead, trail = minInt(fuzz, leadCtx), minInt(fuzz, trailCtx)
+		if lead == prevLead && trail == prevTrail {
+			break // no more context to drop
+		}
+		prevLead, prevTrail = lead, trail
+		if lead+trail >= len(oldLines) && len(oldLines) > 0 {
+			break
+		}
+		needle := oldLines[lead : len(oldLines)-trail]
+		if p, found := findLines(lines, needle, want+lead, minPos); found {
+			return p, lead, trail, fuzz, true
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// findLines searches for needle starting at want and moving outward, never
+// before minPos.
+func findLines(lines, needle []string, want, minPos int) (int, bool) {
+	maxPos := len(lines) - len(needle)
+	if maxPos < minPos {
+		return 0, false
+	}
+	if want < minPos {
+		want = minPos
+	}
+	if want > maxPos {
+		want = maxPos
+	}
+	for d := 0; want-d >= minPos || want+d <= maxPos; d++ {
+		if p := want - d; p >= minPos && matchLines(lines[p:], needle) {
+			return p, true
+		}
+		if p := want + d; d > 0 && p <= maxPos && matchLines(lines[p:], needle) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+func matchLines(lines, needle []string) bool {
+	for i, l := range needle {
+		if lines[i] != l {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
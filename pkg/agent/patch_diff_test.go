@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleGoFile = `package demo
+
+import "fmt"
+
+func Hello() {
+	fmt.Println("hello")
+}
+
+func Bye() {
+	fmt.Println("bye")
+}
+`
+
+func TestParsePatch_UnifiedDiff(t *testing.T) {
+	patch := `diff --git a/demo.go b/demo.go
+index 1111111..2222222 100644
+--- a/demo.go
++++ b/demo.go
+@@ -5,3 +5,3 @@ import "fmt"
+ func Hello() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
+ }
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++first
++second
+`
+	commands, err := parsePatch(patch)
+	if err != nil {
+		t.Fatalf("parsePatch() error: %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(commands))
+	}
+	for i, want := range []string{"demo.go", "new.txt"} {
+		if commands[i].Type != "file_edit" || commands[i].Action != "patch" || commands[i].Target != want {
+			t.Errorf("command %d = %+v, want file_edit patch %s", i, commands[i], want)
+		}
+	}
+	if got := detectPatchType(patch); got != "unified_diff" {
+		t.Errorf("detectPatchType() = %q, want unified_diff", got)
+	}
+}
+
+func TestParsePatch_MarkdownDiffFenceAndAnyLanguage(t *testing.T) {
+	patch := "```diff\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-old\n+new\n```\n\n" +
+		"```yaml:config/app.yaml\nkey: value\n```"
+	commands, err := parsePatch(patch)
+	if err != nil {
+		t.Fatalf("parsePatch() error: %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d: %+v", len(commands), commands)
+	}
+	if commands[0].Target != "config/app.yaml" || commands[0].Action != "update" {
+		t.Errorf("unexpected yaml command: %+v", commands[0])
+	}
+	if commands[1].Target != "a.txt" || commands[1].Action != "patch" {
+		t.Errorf("unexpected diff command: %+v", commands[1])
+	}
+}
+
+func TestParseUnifiedDiff_CountMismatch(t *testing.T) {
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n-old\n+new\n"
+	if _, _, err := parseUnifiedDiff(patch); err == nil {
+		t.Fatal("expected error for hunk with missing lines")
+	}
+}
+
+func TestApplyDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  string
+		patch     string
+		want      string
+		wantFuzz  int
+		wantError bool
+	}{
+		{
+			name:     "exact match",
+			original: sampleGoFile,
+			patch: `--- a/demo.go
++++ b/demo.go
+@@ -9,3 +9,4 @@
+ func Bye() {
+ 	fmt.Println("bye")
++	fmt.Println("see you")
+ }
+`,
+			want: strings.Replace(sampleGoFile, "\"bye\")\n", "\"bye\")\n\tfmt.Println(\"see you\")\n", 1),
+		},
+		{
+			name:     "offset line numbers",
+			original: "// header\n// header\n" + sampleGoFile,
+			patch: `--- a/demo.go
++++ b/demo.go
+@@ -5,3 +5,3 @@
+ func Hello() {
+-	fmt.Println("hello")
++	fmt.Println("hi")
+ }
+`,
+			want: "// header\n// header\n" + strings.Replace(sampleGoFile, `"hello"`, `"hi"`, 1),
+		},
+		{
+			name:     "fuzz drops stale context",
+			original: sampleGoFile,
+			patch: `--- a/demo.go
++++ b/demo.go
+@@ -4,5 +4,5 @@
+ // stale comment
+ func Hello() {
+-	fmt.Println("hello")
++	fmt.Println("hi")
+ }
+ // also stale
+`,
+			want:     strings.Replace(sampleGoFile, `"hello"`, `"hi"`, 1),
+			wantFuzz: 1,
+		},
+		{
+			name:     "mismatched hunk is rejected",
+			original: sampleGoFile,
+			patch: `--- a/demo.go
++++ b/demo.go
+@@ -5,3 +5,3 @@
+ func Hello() {
+-	fmt.Println("goodbye")
++	fmt.Println("hi")
+ }
+`,
+			wantError: true,
+		},
+		{
+			name:     "no newline at end of file",
+			original: "a\nb",
+			patch:    "--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+			want:     "a\nc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _, err := parseUnifiedDiff(tt.patch)
+			if err != nil {
+				t.Fatalf("parseUnifiedDiff() error: %v", err)
+			}
+			got, app, err := applyDiff(tt.original, files[0])
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got result %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyDiff() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("applyDiff() =\n%s\nwant:\n%s", got, tt.want)
+			}
+			if app.MaxFuzz != tt.wantFuzz {
+				t.Errorf("MaxFuzz = %d, want %d", app.MaxFuzz, tt.wantFuzz)
+			}
+		})
+	}
+}
+
+func TestRunWorkerPatch_UnifiedDiff(t *testing.T) {
+	patch := `diff --git a/demo.go b/demo.go
+--- a/demo.go
++++ b/demo.go
+@@ -5,3 +5,3 @@
+ func Hello() {
+-	fmt.Println("hello")
++	fmt.Println("hi")
+ }
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+	want := strings.Replace(sampleGoFile, `"hello"`, `"hi"`, 1)
+
+	setup := func(t *testing.T) (*AgentLoop, string) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "demo.go"), []byte(sampleGoFile), 0644)
+		os.WriteFile(filepath.Join(dir, "old.txt"), []byte("gone\n"), 0644)
+		return &AgentLoop{workspace: dir}, dir
+	}
+
+	t.Run("dry run leaves files untouched", func(t *testing.T) {
+		al, dir := setup(t)
+		result, err := al.dryRunWorkerPatch(context.Background(), patch)
+		if err != nil {
+			t.Fatalf("dryRunWorkerPatch() error: %v", err)
+		}
+		if !result.Success || !result.DryRun {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+		if len(result.Files) != 2 {
+			t.Fatalf("expected 2 file changes, got %d", len(result.Files))
+		}
+		if result.Files[0].AfterHash != hashContent([]byte(want), true) {
+			t.Errorf("after hash does not match the patched content")
+		}
+		if result.Files[1].AfterHash != "" {
+			t.Errorf("deleted file should have no after hash, got %q", result.Files[1].AfterHash)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "demo.go"))
+		if string(data) != sampleGoFile {
+			t.Errorf("dry run modified demo.go")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old.txt")); err != nil {
+			t.Errorf("dry run deleted old.txt")
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		al, dir := setup(t)
+		result, err := al.executeWorkerPatch(context.Background(), patch, "test-session")
+		if err != nil {
+			t.Fatalf("executeWorkerPatch() error: %v", err)
+		}
+		if !result.Success {
+			t.Fatalf("unexpected failure: %+v", result.Results)
+		}
+		if result.Files[0].BeforeHash != hashContent([]byte(sampleGoFile), true) {
+			t.Errorf("before hash does not match the original content")
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "demo.go"))
+		if string(data) != want {
+			t.Errorf("demo.go =\n%s\nwant:\n%s", data, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+			t.Errorf("old.txt should be deleted")
+		}
+	})
+
+	t.Run("rejected hunk fails the whole patch", func(t *testing.T) {
+		al, dir := setup(t)
+		bad := strings.Replace(patch, `-	fmt.Println("hello")`, `-	fmt.Println("nope")`, 1)
+		result, err := al.executeWorkerPatch(context.Background(), bad, "test-session")
+		if err != nil {
+			t.Fatalf("executeWorkerPatch() error: %v", err)
+		}
+		if result.Success || result.FailedCmds != 2 || len(result.Files) != 0 {
+			t.Fatalf("expected both file edits to fail, got %+v", result)
+		}
+		if !strings.Contains(result.Results[1].Error, "not applied") {
+			t.Errorf("the valid file edit should be reported as not applied, got %q", result.Results[1].Error)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "demo.go"))
+		if string(data) != sampleGoFile {
+			t.Errorf("rejected hunk modified demo.go")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old.txt")); err != nil {
+			t.Errorf("old.txt must not be deleted when another file fails validation: %v", err)
+		}
+	})
+
+	t.Run("symlink escaping workspace is rejected", func(t *testing.T) {
+		al, dir := setup(t)
+		outside := t.TempDir()
+		if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		escape := "--- /dev/null\n+++ b/link/evil.txt\n@@ -0,0 +1 @@\n+x\n"
+		result, err := al.executeWorkerPatch(context.Background(), escape, "test-session")
+		if err != nil {
+			t.Fatalf("executeWorkerPatch() error: %v", err)
+		}
+		if result.Success || !strings.Contains(result.Results[0].Error, "outside workspace") {
+			t.Fatalf("expected the symlinked path to be rejected, got %+v", result.Results)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+			t.Error("nothing may be written through a symlink leaving the workspace")
+		}
+	})
+
+	t.Run("path escaping workspace is rejected", func(t *testing.T) {
+		al, _ := setup(t)
+		escape := "--- a/../outside.txt\n+++ b/../outside.txt\n@@ -0,0 +1 @@\n+x\n"
+		if err := al.checkPatchApplies(escape); err == nil || !strings.Contains(err.Error(), "outside workspace") {
+			t.Errorf("expected outside workspace error, got %v", err)
+		}
+	})
+}
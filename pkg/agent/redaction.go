@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/session"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+)
+
+// newRedactor builds the redactor described by cfg; nil when redaction is
+// disabled.
+func newRedactor(cfg config.RedactionConfig) (*redact.Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	rules, err := redact.Builtin(cfg.Detectors...)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redaction.patterns[%d]: %w", i, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = "custom"
+		}
+		rules = append(rules, redact.Rule{Name: name, Pattern: re})
+	}
+	return redact.New(rules), nil
+}
+
+// redactPayloads wraps provider so that the messages it sends are redacted
+// first. Masked values are counted under the session of the call.
+func redactPayloads(r *redact.Redactor, provider providers.LLMProvider) providers.LLMProvider {
+	if r == nil || provider == nil {
+		return provider
+	}
+	rp := &redactingProvider{redactor: r, inner: provider}
+	if sp, ok := provider.(providers.StreamingProvider); ok {
+		return &redactingStreamingProvider{redactingProvider: rp, stream: sp}
+	}
+	return rp
+}
+
+type redactingProvider struct {
+	redactor *redact.Redactor
+	inner    providers.LLMProvider
+}
+
+func (p *redactingProvider) redact(ctx context.Context, messages []providers.Message) []providers.Message {
+	return session.RedactMessages(p.redactor, usage.CallInfoFromContext(ctx).SessionKey, messages)
+}
+
+func (p *redactingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	return p.inner.Chat(ctx, p.redact(ctx, messages), tools, model, options)
+}
+
+func (p *redactingProvider) GetDefaultModel() string {
+	return p.inner.GetDefaultModel()
+}
+
+type redactingStreamingProvider struct {
+	*redactingProvider
+	stream providers.StreamingProvider
+}
+
+func (p *redactingStreamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}, onDelta providers.StreamHandler) (*providers.LLMResponse, error) {
+	return p.stream.ChatStream(ctx, p.redact(ctx, messages), tools, model, options, onDelta)
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/usage"
+)
+
+type recordingProvider struct {
+	mockProvider
+	got []providers.Message
+}
+
+func (p *recordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.got = messages
+	return p.mockProvider.Chat(ctx, messages, tools, model, opts)
+}
+
+func TestRedactPayloads(t *testing.T) {
+	r, err := newRedactor(config.RedactionConfig{
+		Enabled:   true,
+		Detectors: []string{"email"},
+		Patterns:  []config.RedactionPattern{{Name: "ticket", Regex: `TICKET-\d+`}},
+	})
+	if err != nil {
+		t.Fatalf("newRedactor failed: %v", err)
+	}
+	inner := &recordingProvider{}
+	p := redactPayloads(r, inner)
+
+	messages := []providers.Message{{Role: "user", Content: "TICKET-7 from carol@example.com"}}
+	ctx := usage.WithCallInfo(context.Background(), usage.CallInfo{SessionKey: "slack:C1"})
+	if _, err := p.Chat(ctx, messages, nil, "m", nil); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if got := inner.got[0].Content; got != "[REDACTED:ticket] from [REDACTED:email]" {
+		t.Errorf("provider received %q", got)
+	}
+	if !strings.Contains(messages[0].Content, "carol@example.com") {
+		t.Error("caller's messages were modified")
+	}
+	counts := r.Counts("slack:C1")
+	if counts["email"] != 1 || counts["ticket"] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+}
+
+func TestNewRedactor_Config(t *testing.T) {
+	if r, err := newRedactor(config.RedactionConfig{}); r != nil || err != nil {
+		t.Errorf("disabled config: got %v, %v", r, err)
+	}
+	if _, err := newRedactor(config.RedactionConfig{Enabled: true, Detectors: []string{"ssn"}}); err == nil {
+		t.Error("expected an error for an unknown detector")
+	}
+	if _, err := newRedactor(config.RedactionConfig{Enabled: true, Patterns: []config.RedactionPattern{{Regex: "("}}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
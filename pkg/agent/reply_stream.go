@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/constants"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+const defaultStreamEditInterval = time.Second
+
+var replyStreamSeq atomic.Uint64
+
+// replyStream identifies the streamed reply of one turn. Edits and the final
+// message carry its ID so that channels never continue an unfinished stream
+// from an earlier turn; Edited tells whether anything was shown yet.
+type replyStream struct {
+	id     string
+	edited atomic.Bool
+}
+
+type replyStreamKey struct{}
+
+// withReplyStream gives the turn processed under ctx a streamed reply.
+// Turns without one (cron, heartbeat, CLI) are not streamed.
+func withReplyStream(ctx context.Context) (context.Context, *replyStream) {
+	rs := &replyStream{id: fmt.Sprintf("r%d", replyStreamSeq.Add(1))}
+	return context.WithValue(ctx, replyStreamKey{}, rs), rs
+}
+
+func replyStreamFrom(ctx context.Context) *replyStream {
+	rs, _ := ctx.Value(replyStreamKey{}).(*replyStream)
+	return rs
+}
+
+// finish publishes how the turn's reply ends: msg (when non-nil) with the
+// stream ID, or an abort so that channels drop the partial message.
+func (rs *replyStream) finish(b *bus.MessageBus, channel, chatID string, msg *bus.OutboundMessage) {
+	if msg != nil {
+		msg.StreamID = rs.id
+		b.PublishOutbound(*msg)
+		return
+	}
+	if rs.edited.Load() {
+		b.PublishOutbound(bus.OutboundMessage{
+			Channel:  channel,
+			ChatID:   chatID,
+			Kind:     bus.OutboundStreamAbort,
+			StreamID: rs.id,
+		})
+	}
+}
+
+// replyStreamer turns provider deltas into throttled bus.OutboundEdit messages
+// carrying the reply text so far. The final reply is still published as a
+// regular outbound message by the caller.
+type replyStreamer struct {
+	bus      *bus.MessageBus
+	stream   *replyStream
+	channel  string
+	chatID   string
+	prefix   string
+	interval time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	text        strings.Builder
+	lastSent    time.Time
+	lastContent string
+}
+
+// newReplyStreamer returns nil when streaming is not wanted for this turn,
+// so callers can treat a nil streamer as "use plain Chat".
+func (al *AgentLoop) newReplyStreamer(ctx context.Context, opts processOptions) *replyStreamer {
+	if !opts.Stream || !al.cfg.Loop.StreamReplies {
+		return nil
+	}
+	stream := replyStreamFrom(ctx)
+	if stream == nil {
+		return nil
+	}
+	if opts.Channel == "" || opts.ChatID == "" || constants.IsInternalChannel(opts.Channel) {
+		return nil
+	}
+	interval := defaultStreamEditInterval
+	if al.cfg.Loop.StreamEditIntervalMS > 0 {
+		interval = time.Duration(al.cfg.Loop.StreamEditIntervalMS) * time.Millisecond
+	}
+	prefix := ""
+	if opts.Declaration != "" {
+		prefix = opts.Declaration + "\n"
+	}
+	return &replyStreamer{
+		bus:      al.bus,
+		stream:   stream,
+		channel:  opts.Channel,
+		chatID:   opts.ChatID,
+		prefix:   prefix,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// reset starts a new LLM call; text from a previous tool iteration is dropped.
+func (s *replyStreamer) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.Reset()
+}
+
+func (s *replyStreamer) onDelta(d providers.StreamDelta) {
+	if d.Restart {
+		s.reset()
+		return
+	}
+	if d.Content == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text.WriteString(d.Content)
+	if s.now().Sub(s.lastSent) < s.interval {
+		return
+	}
+
+	content := s.text.String()
+	if strings.TrimSpace(content) == "" || mayBeChatDelegateDirective(content) {
+		return
+	}
+	content = s.prefix + content
+	if content == s.lastContent {
+		return
+	}
+
+	s.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  s.channel,
+		ChatID:   s.chatID,
+		Content:  content,
+		Kind:     bus.OutboundEdit,
+		StreamID: s.stream.id,
+	})
+	s.stream.edited.Store(true)
+	s.lastSent = s.now()
+	s.lastContent = content
+}
+
+// mayBeChatDelegateDirective reports whether partial output is, or could still
+// become, a DELEGATE directive. Such output is internal and never shown.
+func mayBeChatDelegateDirective(partial string) bool {
+	const marker = "DELEGATE:"
+	head := strings.ToUpper(strings.TrimLeft(partial, " \t\r\n"))
+	if len(head) < len(marker) {
+		return strings.HasPrefix(marker, head)
+	}
+	return strings.HasPrefix(head, marker)
+}
+
+// chatLLM calls the bound provider, streaming through streamer when both the
+// turn and the provider support it.
+func chatLLM(ctx context.Context, binding RouteBinding, messages []providers.Message, toolDefs []providers.ToolDefinition, options map[string]interface{}, streamer *replyStreamer) (*providers.LLMResponse, error) {
+	if streamer != nil {
+		if sp, ok := binding.Provider.(providers.StreamingProvider); ok {
+			streamer.reset()
+			return sp.ChatStream(ctx, messages, toolDefs, binding.Model, options, streamer.onDelta)
+		}
+	}
+	return binding.Provider.Chat(ctx, messages, toolDefs, binding.Model, options)
+}
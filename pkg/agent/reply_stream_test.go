@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+type streamingMockProvider struct {
+	deltas []string
+}
+
+func (m *streamingMockProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return m.ChatStream(ctx, messages, tools, model, opts, nil)
+}
+
+func (m *streamingMockProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}, onDelta providers.StreamHandler) (*providers.LLMResponse, error) {
+	content := ""
+	for _, d := range m.deltas {
+		content += d
+		if onDelta != nil {
+			onDelta(providers.StreamDelta{Content: d})
+		}
+	}
+	return &providers.LLMResponse{Content: content, FinishReason: "stop"}, nil
+}
+
+func (m *streamingMockProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func newStreamTestLoop(t *testing.T, provider providers.LLMProvider) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Loop: config.LoopConfig{
+			MaxLoops:      1,
+			MaxMillis:     5000,
+			StreamReplies: true,
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	return NewAgentLoop(cfg, msgBus, provider), msgBus
+}
+
+func drainOutbound(msgBus *bus.MessageBus) []bus.OutboundMessage {
+	var out []bus.OutboundMessage
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		cancel()
+		if !ok {
+			return out
+		}
+		out = append(out, msg)
+	}
+}
+
+func TestRunAgentLoop_StreamsEditsToChannel(t *testing.T) {
+	al, msgBus := newStreamTestLoop(t, &streamingMockProvider{deltas: []string{"こん", "にち", "は"}})
+	ctx, stream := withReplyStream(context.Background())
+
+	resp, err := al.runAgentLoop(ctx, processOptions{
+		SessionKey:  "telegram:1",
+		Channel:     "telegram",
+		ChatID:      "1",
+		UserMessage: "hi",
+		Route:       RouteChat,
+		MaxLoops:    1,
+		Stream:      true,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+	if resp != "こんにちは" {
+		t.Fatalf("unexpected final response %q", resp)
+	}
+
+	edits := drainOutbound(msgBus)
+	if len(edits) == 0 {
+		t.Fatal("expected progressive edits")
+	}
+	for _, e := range edits {
+		if e.Kind != bus.OutboundEdit || e.Channel != "telegram" || e.ChatID != "1" || e.StreamID != stream.id {
+			t.Fatalf("unexpected outbound message: %+v", e)
+		}
+	}
+	if first := edits[0].Content; first != "こん" {
+		t.Errorf("first edit should carry the text so far, got %q", first)
+	}
+}
+
+func TestRunAgentLoop_NoStreamOnInternalChannel(t *testing.T) {
+	al, msgBus := newStreamTestLoop(t, &streamingMockProvider{deltas: []string{"a", "b"}})
+	ctx, _ := withReplyStream(context.Background())
+
+	if _, err := al.runAgentLoop(ctx, processOptions{
+		SessionKey:  "cli:direct",
+		Channel:     "cli",
+		ChatID:      "direct",
+		UserMessage: "hi",
+		Route:       RouteChat,
+		MaxLoops:    1,
+		Stream:      true,
+	}); err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+	if edits := drainOutbound(msgBus); len(edits) != 0 {
+		t.Fatalf("internal channels must not receive edits, got %d", len(edits))
+	}
+}
+
+func TestReplyStreamer_HoldsBackDelegateDirective(t *testing.T) {
+	al, msgBus := newStreamTestLoop(t, &streamingMockProvider{deltas: []string{"DELE", "GATE: CODE\n", "TASK: fix it"}})
+	ctx, _ := withReplyStream(context.Background())
+
+	if _, err := al.runAgentLoop(ctx, processOptions{
+		SessionKey:  "telegram:1",
+		Channel:     "telegram",
+		ChatID:      "1",
+		UserMessage: "fix",
+		Route:       RouteChat,
+		MaxLoops:    1,
+		Stream:      true,
+	}); err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+	if edits := drainOutbound(msgBus); len(edits) != 0 {
+		t.Fatalf("DELEGATE directives must not be streamed, got %+v", edits)
+	}
+}
+
+func TestReplyStreamer_Throttles(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	now := time.Unix(0, 0)
+	s := &replyStreamer{
+		bus:      msgBus,
+		stream:   &replyStream{id: "r1"},
+		channel:  "slack",
+		chatID:   "C1",
+		interval: time.Second,
+		now:      func() time.Time { return now },
+	}
+
+	s.onDelta(providers.StreamDelta{Content: "a"})
+	s.onDelta(providers.StreamDelta{Content: "b"})
+	now = now.Add(2 * time.Second)
+	s.onDelta(providers.StreamDelta{Content: "c"})
+
+	edits := drainOutbound(msgBus)
+	if len(edits) != 2 {
+		t.Fatalf("expected 2 throttled edits, got %d", len(edits))
+	}
+	if edits[0].Content != "a" || edits[1].Content != "abc" {
+		t.Errorf("unexpected edit contents: %q, %q", edits[0].Content, edits[1].Content)
+	}
+}
+
+func TestRunAgentLoop_NoStreamWithoutTurn(t *testing.T) {
+	al, msgBus := newStreamTestLoop(t, &streamingMockProvider{deltas: []string{"a", "b"}})
+
+	if _, err := al.runAgentLoop(context.Background(), processOptions{
+		SessionKey:  "telegram:1",
+		Channel:     "telegram",
+		ChatID:      "1",
+		UserMessage: "hi",
+		Route:       RouteChat,
+		MaxLoops:    1,
+		Stream:      true,
+	}); err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+	if edits := drainOutbound(msgBus); len(edits) != 0 {
+		t.Fatalf("turns without a reply stream must not be streamed, got %d", len(edits))
+	}
+}
+
+func TestReplyStream_Finish(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+
+	_, quiet := withReplyStream(context.Background())
+	quiet.finish(msgBus, "slack", "C1", nil)
+	if out := drainOutbound(msgBus); len(out) != 0 {
+		t.Fatalf("a turn without edits must not abort anything, got %+v", out)
+	}
+
+	_, aborted := withReplyStream(context.Background())
+	aborted.edited.Store(true)
+	aborted.finish(msgBus, "slack", "C1", nil)
+	out := drainOutbound(msgBus)
+	if len(out) != 1 || out[0].Kind != bus.OutboundStreamAbort || out[0].StreamID != aborted.id {
+		t.Fatalf("expected one abort for %s, got %+v", aborted.id, out)
+	}
+
+	_, done := withReplyStream(context.Background())
+	done.finish(msgBus, "slack", "C1", &bus.OutboundMessage{Channel: "slack", ChatID: "C1", Content: "ok"})
+	out = drainOutbound(msgBus)
+	if len(out) != 1 || out[0].Kind != "" || out[0].StreamID != done.id {
+		t.Fatalf("final reply must carry the stream ID, got %+v", out)
+	}
+	if aborted.id == done.id {
+		t.Fatal("each turn needs its own stream ID")
+	}
+}
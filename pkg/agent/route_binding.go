@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// RouteBinding is the LLM selected for a single turn.
+// It is resolved once per turn and carried through processOptions so that the
+// LLM loop, summarization and classification never read shared mutable state.
+type RouteBinding struct {
+	Route string
+	// Target is the route the provider was resolved for, e.g. CODE2 or CODE3
+	// for a CODE turn. Usage is recorded under it.
+	Target       string
+	ProviderName string
+	Model        string
+	Provider     providers.LLMProvider
+}
+
+// IsZero reports whether no provider has been bound.
+func (b RouteBinding) IsZero() bool {
+	return b.Provider == nil
+}
+
+// defaultRouteBinding returns a snapshot of the loop's default provider/model.
+func (al *AgentLoop) defaultRouteBinding() RouteBinding {
+	al.bindingMu.RLock()
+	defer al.bindingMu.RUnlock()
+	return al.defaultBinding
+}
+
+// setDefaultModel changes the model used by the default binding (/switch model).
+// Turns that already resolved their binding are unaffected.
+func (al *AgentLoop) setDefaultModel(model string) string {
+	al.bindingMu.Lock()
+	defer al.bindingMu.Unlock()
+	old := al.defaultBinding.Model
+	al.defaultBinding.Model = model
+	return old
+}
+
+// bindingOrDefault returns b, or the default binding when b is unset.
+func (al *AgentLoop) bindingOrDefault(b RouteBinding) RouteBinding {
+	if b.IsZero() {
+		return al.defaultRouteBinding()
+	}
+	return b
+}
+
+func (al *AgentLoop) bindRoute(route string, localOnly bool) (RouteBinding, error) {
+	return al.bindRouteWithTask(route, "", localOnly)
+}
+
+// bindRouteWithTask resolves the provider and model for a turn on route.
+// Providers come from the shared ProviderPool, so clients are built once per
+// (provider, model) and reused across turns. The bound provider is a
+// FallbackProvider over the route's chain (just the primary when it declares
+// no fallbacks). With localOnly set,
+// cloud providers are never bound.
+func (al *AgentLoop) bindRouteWithTask(route, taskText string, localOnly bool) (RouteBinding, error) {
+	actualRoute := route
+	if route == RouteCode && taskText != "" {
+		actualRoute = selectCoderRoute(taskText)
+	}
+	target := budgetRoute(actualRoute, taskText)
+	role, alias := al.resolveRouteRoleAlias(actualRoute)
+	targetProvider, targetModel := al.resolveRouteLLMWithTask(actualRoute, taskText)
+
+	def := al.defaultRouteBinding()
+	if targetModel == "" {
+		targetModel = def.Model
+	}
+	// Routes that resolve to the configured default follow the default binding,
+	// which reflects /switch model.
+	if targetProvider == def.ProviderName && targetModel == strings.TrimSpace(al.cfg.Agents.Defaults.Model) {
+		def.Route = route
+		def.Target = target
+		return al.withFallbacks(def, actualRoute, taskText, localOnly)
+	}
+
+	// A cloud primary is dropped by withFallbacks in local-only mode, so it is
+	// not built at all.
+	var provider providers.LLMProvider
+	if !localOnly || providers.IsLocalProvider(targetProvider) {
+		p, err := al.providerPool.Get(targetProvider, targetModel)
+		if err != nil {
+			return RouteBinding{}, err
+		}
+		provider = p
+	}
+
+	logger.InfoCF("agent", "route.llm.selected", map[string]interface{}{
+		"route":    route,
+		"role":     role,
+		"alias":    alias,
+		"provider": targetProvider,
+		"model":    targetModel,
+	})
+
+	return al.withFallbacks(RouteBinding{
+		Route:        route,
+		Target:       target,
+		ProviderName: targetProvider,
+		Model:        targetModel,
+		Provider:     provider,
+	}, actualRoute, taskText, localOnly)
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+func newBindingTestLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Providers: config.ProvidersConfig{
+			VLLM: config.ProviderConfig{APIKey: "k", APIBase: "http://127.0.0.1:8000/v1"},
+		},
+		Routing: config.RoutingConfig{
+			LLM: config.RouteLLMConfig{
+				ChatProvider:  "ollama",
+				ChatModel:     "chat-v1",
+				CoderProvider: "vllm",
+				CoderModel:    "coder-v1",
+			},
+		},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+}
+
+func TestBindRoute_DefaultRouteUsesDefaultProvider(t *testing.T) {
+	al := newBindingTestLoop(t)
+
+	b, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if boundProvider(t, b) != al.defaultRouteBinding().Provider {
+		t.Error("CHAT route should reuse the default provider")
+	}
+	if b.Model != "chat-v1" || b.Route != RouteChat {
+		t.Errorf("unexpected binding: %+v", b)
+	}
+}
+
+func TestBindRoute_CachesRouteProviders(t *testing.T) {
+	al := newBindingTestLoop(t)
+
+	first, err := al.bindRoute(RouteCode1, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	second, err := al.bindRoute(RouteCode1, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if boundProvider(t, first) != boundProvider(t, second) {
+		t.Error("expected routed provider to be reused from the pool")
+	}
+	if first.ProviderName != "vllm" || first.Model != "coder-v1" {
+		t.Errorf("unexpected binding: %+v", first)
+	}
+	if al.defaultRouteBinding().Model != "chat-v1" {
+		t.Error("binding a route must not change the default binding")
+	}
+}
+
+func TestSwitchModel_DoesNotAffectResolvedBinding(t *testing.T) {
+	al := newBindingTestLoop(t)
+
+	inFlight, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+
+	resp, handled := al.handleCommand(context.Background(), bus.InboundMessage{
+		Content:    "/switch model to chat-v2",
+		SessionKey: "cli:direct",
+	})
+	if !handled {
+		t.Fatal("expected /switch to be handled")
+	}
+	if resp == "" {
+		t.Fatal("expected /switch response")
+	}
+
+	if inFlight.Model != "chat-v1" {
+		t.Errorf("in-flight binding changed to %s", inFlight.Model)
+	}
+	next, err := al.bindRoute(RouteChat, false)
+	if err != nil {
+		t.Fatalf("bindRoute failed: %v", err)
+	}
+	if next.Model != "chat-v2" {
+		t.Errorf("expected new turns to use switched model, got %s", next.Model)
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+func TestRunAgentLoop_RecordsUsage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "ollama",
+				Model:             "chat-v1",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Loop:  config.LoopConfig{MaxLoops: 1, MaxMillis: 5000},
+		Usage: config.UsageConfig{Enabled: true},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	if _, err := al.runAgentLoop(context.Background(), processOptions{
+		SessionKey:  "telegram:1",
+		Channel:     "telegram",
+		ChatID:      "1",
+		UserMessage: "hi",
+		Route:       RouteChat,
+		MaxLoops:    1,
+	}); err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+
+	now := time.Now()
+	recs, err := al.usageLedger.Load(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 usage record, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.Route != RouteChat || r.Channel != "telegram" || r.SessionKey != "telegram:1" || r.Provider != "ollama" || r.Model != "chat-v1" {
+		t.Errorf("unexpected usage record: %+v", r)
+	}
+
+	resp, handled := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/usage", SessionKey: "telegram:1"})
+	if !handled {
+		t.Fatal("expected /usage to be handled")
+	}
+	if !strings.Contains(resp, "by route") || !strings.Contains(resp, RouteChat) {
+		t.Errorf("unexpected /usage response:\n%s", resp)
+	}
+}
+
+func TestUsageCommand_Disabled(t *testing.T) {
+	al := newBindingTestLoop(t)
+	resp, handled := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/usage"})
+	if !handled || !strings.Contains(resp, "disabled") {
+		t.Errorf("unexpected /usage response when disabled: %q (handled=%v)", resp, handled)
+	}
+}
@@ -1,14 +1,19 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
 )
 
 // PatchCommand は patch 内の1つのコマンドを表現
@@ -21,6 +26,7 @@ type PatchCommand struct {
 }
 
 // parsePatch は patch 文字列を解析して PatchCommand のスライスを返す
+// JSON コマンド列・unified diff・Markdown の3形式に対応する
 func parsePatch(patch string) ([]PatchCommand, error) {
 	if patch == "" {
 		return nil, fmt.Errorf("empty patch")
@@ -36,17 +42,29 @@ func parsePatch(patch string) ([]PatchCommand, error) {
 		return commands, nil
 	}
 
+	// unified diff（diff --git / ---,+++ / @@ hunk）
+	if isUnifiedDiff(trimmed) {
+		return parseUnifiedDiffCommands(trimmed)
+	}
+
 	// Markdown パース
 	return parseMarkdownPatch(patch)
 }
 
+var (
+	// ```<lang>:<filepath> パターン（言語名は任意）
+	markdownFileEditRe = regexp.MustCompile("```[A-Za-z0-9_+#.-]*:([^\n]+)\n([\\s\\S]*?)```")
+	// ```diff または ```patch パターン（unified diff）
+	markdownDiffRe = regexp.MustCompile("```(?:diff|patch)\n([\\s\\S]*?)```")
+	// ```bash または ```sh パターン（シェルコマンド）
+	markdownShellRe = regexp.MustCompile("```(?:bash|sh)\n([\\s\\S]*?)```")
+)
+
 // parseMarkdownPatch は Markdown 形式の patch を解析する
 func parseMarkdownPatch(patch string) ([]PatchCommand, error) {
 	var commands []PatchCommand
 
-	// ```go:<filepath> または ```<lang>:<filepath> パターン
-	fileEditRe := regexp.MustCompile("```(?:go|python|js|java|rust|cpp|c):([^\n]+)\n([\\s\\S]*?)```")
-	for _, match := range fileEditRe.FindAllStringSubmatch(patch, -1) {
+	for _, match := range markdownFileEditRe.FindAllStringSubmatch(patch, -1) {
 		commands = append(commands, PatchCommand{
 			Type:    "file_edit",
 			Action:  "update",
@@ -55,9 +73,15 @@ func parseMarkdownPatch(patch string) ([]PatchCommand, error) {
 		})
 	}
 
-	// ```bash または ```sh パターン（シェルコマンド）
-	shellRe := regexp.MustCompile("```(?:bash|sh)\n([\\s\\S]*?)```")
-	for _, match := range shellRe.FindAllStringSubmatch(patch, -1) {
+	for _, match := range markdownDiffRe.FindAllStringSubmatch(patch, -1) {
+		diffCmds, err := parseUnifiedDiffCommands(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid diff block: %w", err)
+		}
+		commands = append(commands, diffCmds...)
+	}
+
+	for _, match := range markdownShellRe.FindAllStringSubmatch(patch, -1) {
 		commands = append(commands, PatchCommand{
 			Type:   "shell_command",
 			Action: "run",
@@ -72,48 +96,235 @@ func parseMarkdownPatch(patch string) ([]PatchCommand, error) {
 	return commands, nil
 }
 
-// executeFileEdit はファイル編集コマンドを実行する
-func (a *AgentLoop) executeFileEdit(ctx context.Context, cmd PatchCommand) (string, error) {
-	target := cmd.Target
+// FileChange は file_edit による1ファイルの変更を表現（ハッシュは SHA-256、存在しない場合は空）
+type FileChange struct {
+	Path       string `json:"path"`
+	Action     string `json:"action"`
+	BeforeHash string `json:"before_hash,omitempty"`
+	AfterHash  string `json:"after_hash,omitempty"`
+	Added      int    `json:"added,omitempty"`
+	Removed    int    `json:"removed,omitempty"`
+	Fuzz       int    `json:"fuzz,omitempty"`
+	RenameFrom string `json:"rename_from,omitempty"`
+}
+
+// fileEditPlan は書き込み前に計算した file_edit の結果
+type fileEditPlan struct {
+	Path       string
+	RenameFrom string // rename 元の絶対パス
+	Before     []byte // nil ならファイルは存在しない
+	After      []byte // nil ならファイルを削除する
+	Change     FileChange
+}
+
+// fileReader は path の内容を返す。存在しない場合は ok=false
+type fileReader func(path string) (data []byte, ok bool, err error)
+
+func readFileFromDisk(path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
 
-	// Security check: workspace 外への書き込みを禁止
-	if !strings.HasPrefix(target, a.workspace) {
+// resolveWorkspacePath は target を絶対パスにし、workspace 外なら拒否する
+// 相対パスは workspace 基準で解決する（unified diff のパスは相対）
+// シンボリックリンクは最も深い既存の親まで解決してから判定するので、
+// workspace 内のリンクを経由して外へ書き込むことはできない
+func (a *AgentLoop) resolveWorkspacePath(target string) (string, error) {
+	p := strings.TrimSpace(target)
+	if p == "" {
+		return "", fmt.Errorf("empty file path")
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(a.workspace, p)
+	}
+	p = filepath.Clean(p)
+	rel, err := filepath.Rel(filepath.Clean(a.workspace), p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
 		return "", fmt.Errorf("file path outside workspace: %s", target)
 	}
+	if _, err := tools.ResolvePath(p, a.workspace, true); err != nil {
+		return "", fmt.Errorf("file path outside workspace: %s: %w", target, err)
+	}
+	return p, nil
+}
+
+func hashContent(data []byte, exists bool) string {
+	if !exists {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// planFileEdit はファイル編集コマンドの結果を書き込まずに計算する
+func (a *AgentLoop) planFileEdit(cmd PatchCommand, read fileReader) (*fileEditPlan, error) {
+	target, err := a.resolveWorkspacePath(cmd.Target)
+	if err != nil {
+		return nil, err
+	}
+	before, exists, err := read(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", target, err)
+	}
+
+	plan := &fileEditPlan{Path: target, Change: FileChange{Path: target, Action: cmd.Action}}
+	if exists {
+		plan.Before = before
+	}
 
 	switch cmd.Action {
 	case "create", "update":
-		err := os.WriteFile(target, []byte(cmd.Content), 0644)
-		if err != nil {
-			return "", fmt.Errorf("failed to write file %s: %w", target, err)
-		}
-		return fmt.Sprintf("File %s written successfully (%d bytes)", target, len(cmd.Content)), nil
+		plan.After = []byte(cmd.Content)
 
 	case "delete":
-		err := os.Remove(target)
-		if err != nil {
-			return "", fmt.Errorf("failed to delete file %s: %w", target, err)
+		if !exists {
+			return nil, fmt.Errorf("failed to delete file %s: file not found", target)
 		}
-		return fmt.Sprintf("File %s deleted", target), nil
 
 	case "append":
-		f, err := os.OpenFile(target, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			return "", fmt.Errorf("failed to open file %s: %w", target, err)
+		plan.After = append(append([]byte{}, before...), cmd.Content...)
+
+	case "patch":
+		if err := a.planDiffEdit(plan, cmd, read); err != nil {
+			return nil, err
 		}
-		defer f.Close()
 
-		_, err = f.WriteString(cmd.Content)
+	default:
+		return nil, fmt.Errorf("unknown action: %s", cmd.Action)
+	}
+
+	plan.Change.BeforeHash = hashContent(plan.Before, plan.Before != nil)
+	plan.Change.AfterHash = hashContent(plan.After, plan.After != nil)
+	return plan, nil
+}
+
+// planDiffEdit は patch アクション（unified diff 1ファイル分）を plan に適用する
+// hunk が文脈と一致しない場合はファイル全体を拒否する
+func (a *AgentLoop) planDiffEdit(plan *fileEditPlan, cmd PatchCommand, read fileReader) error {
+	files, _, err := parseUnifiedDiff(cmd.Content)
+	if err != nil {
+		return fmt.Errorf("invalid diff for %s: %w", cmd.Target, err)
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("patch action for %s must contain exactly one file, got %d", cmd.Target, len(files))
+	}
+	f := files[0]
+
+	original, exists := plan.Before, plan.Before != nil
+	if from := cmd.Metadata["rename_from"]; from != "" {
+		src, err := a.resolveWorkspacePath(from)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("rename target already exists: %s", plan.Path)
+		}
+		original, exists, err = read(src)
 		if err != nil {
-			return "", fmt.Errorf("failed to append to file %s: %w", target, err)
+			return fmt.Errorf("failed to read file %s: %w", src, err)
+		}
+		if !exists {
+			return fmt.Errorf("rename source not found: %s", src)
+		}
+		plan.RenameFrom = src
+		plan.Before = original
+		plan.Change.RenameFrom = src
+	}
+
+	switch {
+	case f.OldPath == "" && exists:
+		return fmt.Errorf("diff creates %s but the file already exists", plan.Path)
+	case f.OldPath != "" && !exists:
+		return fmt.Errorf("diff modifies %s but the file does not exist", plan.Path)
+	}
+
+	updated, app, err := applyDiff(string(original), f)
+	if err != nil {
+		return err
+	}
+	plan.Change.Added, plan.Change.Removed, plan.Change.Fuzz = app.Added, app.Removed, app.MaxFuzz
+
+	if f.NewPath == "" {
+		if updated != "" {
+			return fmt.Errorf("diff deletes %s but content remains after applying hunks", plan.Path)
 		}
-		return fmt.Sprintf("Appended %d bytes to %s", len(cmd.Content), target), nil
+		return nil
+	}
+	plan.After = []byte(updated)
+	return nil
+}
 
+// applyFileEditPlan は plan をディスクに書き込む
+func applyFileEditPlan(plan *fileEditPlan) error {
+	if plan.After == nil {
+		if err := os.Remove(plan.Path); err != nil {
+			return fmt.Errorf("failed to delete file %s: %w", plan.Path, err)
+		}
+		return nil
+	}
+	if plan.RenameFrom != "" || plan.Before == nil {
+		if err := os.MkdirAll(filepath.Dir(plan.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", plan.Path, err)
+		}
+	}
+	if err := os.WriteFile(plan.Path, plan.After, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", plan.Path, err)
+	}
+	if plan.RenameFrom != "" {
+		if err := os.Remove(plan.RenameFrom); err != nil {
+			return fmt.Errorf("failed to remove renamed file %s: %w", plan.RenameFrom, err)
+		}
+	}
+	return nil
+}
+
+// describeFileEdit は plan の結果を1行で表す
+func describeFileEdit(plan *fileEditPlan, dryRun bool) string {
+	verb := func(done, would string) string {
+		if dryRun {
+			return would
+		}
+		return done
+	}
+	c := plan.Change
+	switch {
+	case c.Action == "delete" || (c.Action == "patch" && plan.After == nil):
+		return fmt.Sprintf("File %s %s", plan.Path, verb("deleted", "would be deleted"))
+	case c.Action == "append":
+		return fmt.Sprintf("%s %d bytes to %s", verb("Appended", "Would append"), len(plan.After)-len(plan.Before), plan.Path)
+	case c.Action == "patch":
+		msg := fmt.Sprintf("File %s %s (+%d -%d", plan.Path, verb("patched", "would be patched"), c.Added, c.Removed)
+		if c.Fuzz > 0 {
+			msg += fmt.Sprintf(", fuzz %d", c.Fuzz)
+		}
+		msg += ")"
+		if plan.RenameFrom != "" {
+			msg += fmt.Sprintf(", renamed from %s", plan.RenameFrom)
+		}
+		return msg
 	default:
-		return "", fmt.Errorf("unknown action: %s", cmd.Action)
+		return fmt.Sprintf("File %s %s (%d bytes)", plan.Path, verb("written successfully", "would be written"), len(plan.After))
 	}
 }
 
+// executeFileEdit はファイル編集コマンドを実行する
+func (a *AgentLoop) executeFileEdit(ctx context.Context, cmd PatchCommand) (string, error) {
+	plan, err := a.planFileEdit(cmd, readFileFromDisk)
+	if err != nil {
+		return "", err
+	}
+	if err := applyFileEditPlan(plan); err != nil {
+		return "", err
+	}
+	return describeFileEdit(plan, false), nil
+}
+
 // executeShellCommand はシェルコマンドを実行する
 func (a *AgentLoop) executeShellCommand(ctx context.Context, cmd PatchCommand) (string, error) {
 	command := cmd.Target
@@ -124,15 +335,20 @@ func (a *AgentLoop) executeShellCommand(ctx context.Context, cmd PatchCommand) (
 	execCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	cmdExec := exec.CommandContext(execCtx, "bash", "-c", command)
-	cmdExec.Dir = a.workspace
-
-	output, err := cmdExec.CombinedOutput()
+	// 実行は exec ツールと同じ Executor（直接実行またはサンドボックス）に任せる。
+	// ジョブのキャンセル時はコマンドの子プロセスもまとめて終了する
+	var output bytes.Buffer
+	err := tools.DefaultExecutor().Run(execCtx, tools.Command{
+		Args:   []string{"bash", "-c", command},
+		Dir:    a.workspace,
+		Stdout: &output,
+		Stderr: &output,
+	})
 	if err != nil {
-		return string(output), fmt.Errorf("command failed: %w", err)
+		return output.String(), fmt.Errorf("command failed: %w", err)
 	}
 
-	return string(output), nil
+	return output.String(), nil
 }
 
 // executeCommand は PatchCommand の Type に応じて適切な実行関数を呼び出す
@@ -157,9 +373,11 @@ func (a *AgentLoop) executeGitOperation(ctx context.Context, cmd PatchCommand) (
 // PatchExecutionResult は patch 実行の結果を表現
 type PatchExecutionResult struct {
 	Success      bool            `json:"success"`
+	DryRun       bool            `json:"dry_run,omitempty"`
 	ExecutedCmds int             `json:"executed_cmds"`
 	FailedCmds   int             `json:"failed_cmds"`
 	Results      []CommandResult `json:"results"`
+	Files        []FileChange    `json:"files,omitempty"`
 	Summary      string          `json:"summary"`
 	GitCommit    string          `json:"git_commit,omitempty"`
 }
@@ -174,7 +392,38 @@ type CommandResult struct {
 }
 
 // executeWorkerPatch は patch を解析して順次実行する
+// worker.dry_run が有効な場合は書き込まずに変更内容だけを報告する
 func (a *AgentLoop) executeWorkerPatch(ctx context.Context, patch string, sessionKey string) (*PatchExecutionResult, error) {
+	dryRun := a.cfg != nil && a.cfg.Worker.DryRun
+	return a.runWorkerPatch(ctx, patch, dryRun)
+}
+
+// dryRunWorkerPatch は patch を適用した場合の変更内容を、ファイルに触れずに返す
+func (a *AgentLoop) dryRunWorkerPatch(ctx context.Context, patch string) (*PatchExecutionResult, error) {
+	return a.runWorkerPatch(ctx, patch, true)
+}
+
+// dryRunOverlay は dry-run 中の仮想的なファイル内容を保持し、同じファイルへの
+// 後続コマンドが前のコマンドの結果を読めるようにする
+type dryRunOverlay map[string][]byte
+
+func (o dryRunOverlay) read(path string) ([]byte, bool, error) {
+	if data, ok := o[path]; ok {
+		return data, data != nil, nil
+	}
+	return readFileFromDisk(path)
+}
+
+func (o dryRunOverlay) apply(plan *fileEditPlan) {
+	o[plan.Path] = plan.After
+	if plan.RenameFrom != "" {
+		o[plan.RenameFrom] = nil
+	}
+}
+
+// runWorkerPatch は patch を実行する。dryRun ならシェルコマンドは実行せず、
+// ファイル編集は hunk の適用可否と前後のハッシュだけを計算する
+func (a *AgentLoop) runWorkerPatch(ctx context.Context, patch string, dryRun bool) (*PatchExecutionResult, error) {
 	commands, err := parsePatch(patch)
 	if err != nil {
 		return nil, fmt.Errorf("patch parse error: %w", err)
@@ -182,16 +431,50 @@ func (a *AgentLoop) executeWorkerPatch(ctx context.Context, patch string, sessio
 
 	result := &PatchExecutionResult{
 		Success:      true,
+		DryRun:       dryRun,
 		ExecutedCmds: 0,
 		FailedCmds:   0,
 		Results:      make([]CommandResult, 0, len(commands)),
 	}
-
-	for _, cmd := range commands {
+	overlay := dryRunOverlay{}
+	staged := map[int]*fileEditPlan{}
+	stageErrs := map[int]error{}
+
+	for i, cmd := range commands {
+		// キャンセルされたら残りのコマンドは実行しない
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("patch execution cancelled after %d of %d commands: %w",
+				len(result.Results), len(commands), context.Cause(ctx))
+		}
 		startTime := time.Now()
 		cmdResult := CommandResult{Command: cmd}
 
-		output, err := a.executeCommand(ctx, cmd)
+		var output string
+		var err error
+		switch {
+		case cmd.Type == "file_edit":
+			plan, ok := staged[i]
+			if !ok {
+				// 連続するファイル編集は全件を検証してからまとめて書き込む。
+				// 1件でも失敗すればその連続分は何も書き込まない
+				var errs map[int]error
+				staged, errs = a.stageFileEdits(commands, i, overlay, dryRun)
+				for j, e := range errs {
+					stageErrs[j] = e
+				}
+				plan = staged[i]
+			}
+			if e, failed := stageErrs[i]; failed {
+				err = e
+			} else {
+				output = describeFileEdit(plan, dryRun)
+				result.Files = append(result.Files, plan.Change)
+			}
+		case dryRun && (cmd.Type == "shell_command" || cmd.Type == "git_operation"):
+			output = fmt.Sprintf("Would run %s: %s", cmd.Type, strings.TrimSpace(cmd.Target+" "+cmd.Content))
+		default:
+			output, err = a.executeCommand(ctx, cmd)
+		}
 		duration := time.Since(startTime).Milliseconds()
 
 		if err != nil {
@@ -212,6 +495,69 @@ func (a *AgentLoop) executeWorkerPatch(ctx context.Context, patch string, sessio
 
 	result.Summary = fmt.Sprintf("実行: %d 件, 成功: %d 件, 失敗: %d 件",
 		len(commands), result.ExecutedCmds, result.FailedCmds)
+	if dryRun {
+		result.Summary = "[dry-run] " + result.Summary
+	}
 
 	return result, nil
 }
+
+// stageFileEdits は commands[start] から続くファイル編集をすべて計画し、
+// 全件が検証を通った場合だけ（dryRun でなければ）ディスクに書き込む。
+// 戻り値は各コマンドの計画と、失敗したコマンドのエラー。検証に失敗した連続分は
+// 失敗しなかったコマンドも未適用としてエラーになる
+func (a *AgentLoop) stageFileEdits(commands []PatchCommand, start int, overlay dryRunOverlay, dryRun bool) (map[int]*fileEditPlan, map[int]error) {
+	plans := map[int]*fileEditPlan{}
+	errs := map[int]error{}
+	// 書き込み前の計画は仮想的な内容の上で行い、同じファイルへの後続編集に引き継ぐ
+	stage := overlay
+	if !dryRun {
+		stage = dryRunOverlay{}
+	}
+	end := start
+	for ; end < len(commands) && commands[end].Type == "file_edit"; end++ {
+		plan, err := a.planFileEdit(commands[end], stage.read)
+		if err != nil {
+			errs[end] = err
+			continue
+		}
+		stage.apply(plan)
+		plans[end] = plan
+	}
+
+	if len(errs) > 0 {
+		for j := start; j < end; j++ {
+			if _, failed := errs[j]; !failed {
+				errs[j] = fmt.Errorf("not applied: %d file edit(s) in this patch failed validation", len(errs))
+			}
+		}
+		return plans, errs
+	}
+	if dryRun {
+		return plans, errs
+	}
+	for j := start; j < end; j++ {
+		if err := applyFileEditPlan(plans[j]); err != nil {
+			errs[j] = err
+			for k := j + 1; k < end; k++ {
+				errs[k] = fmt.Errorf("not applied: an earlier file edit could not be written")
+			}
+			break
+		}
+	}
+	return plans, errs
+}
+
+// checkPatchApplies は patch を実行せずに適用可能かを検査する（熟議モードの採点用）
+func (a *AgentLoop) checkPatchApplies(patch string) error {
+	result, err := a.dryRunWorkerPatch(context.Background(), patch)
+	if err != nil {
+		return err
+	}
+	for _, r := range result.Results {
+		if !r.Success {
+			return fmt.Errorf("%s", r.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package auth
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f, waiting until it is free.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
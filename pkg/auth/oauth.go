@@ -258,6 +258,9 @@ func pollDeviceCode(cfg OAuthProviderConfig, deviceAuthID, userCode string) (*Au
 	return exchangeCodeForTokens(cfg, tokenResp.AuthorizationCode, tokenResp.CodeVerifier, redirectURI)
 }
 
+// refreshHTTPClient bounds token refreshes, which run while requests wait.
+var refreshHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
 func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCredential, error) {
 	if cred.RefreshToken == "" {
 		return nil, fmt.Errorf("no refresh token available")
@@ -270,7 +273,7 @@ func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCre
 		"scope":         {"openid profile email"},
 	}
 
-	resp, err := http.PostForm(cfg.Issuer+"/oauth/token", data)
+	resp, err := refreshHTTPClient.PostForm(cfg.Issuer+"/oauth/token", data)
 	if err != nil {
 		return nil, fmt.Errorf("refreshing token: %w", err)
 	}
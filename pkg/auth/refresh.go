@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+const (
+	// maxRefreshFailures consecutive failures make the health check fail.
+	maxRefreshFailures = 3
+	// refreshRetryInterval is the minimum wait between failed refreshes, so a
+	// broken refresh token does not hit the issuer on every request.
+	refreshRetryInterval = time.Minute
+)
+
+// TokenRefresher returns a provider's stored credential, refreshing OAuth
+// tokens ahead of expiry and saving the rotated credential back to the store.
+// Refreshes are single-flight: concurrent callers wait for one refresh and
+// then share its result, and a file lock keeps other picoclaw processes from
+// refreshing the same token at the same time.
+//
+// The decrypted credential is kept in memory until it needs a refresh or
+// auth.json changes, so that requests do not decrypt the store (and stretch
+// a passphrase) every time.
+type TokenRefresher struct {
+	provider string
+	oauth    *OAuthProviderConfig // nil when the provider has no refresh endpoint
+	refresh  func(*AuthCredential, OAuthProviderConfig) (*AuthCredential, error)
+
+	mu          sync.Mutex
+	failures    int
+	lastErr     error
+	lastAttempt time.Time
+	cached      *AuthCredential
+	cachedStamp fileStamp // auth.json when cached was read
+}
+
+// fileStamp identifies a version of auth.json.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func authFileStamp() fileStamp {
+	info, err := os.Stat(authFilePath())
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+var refreshers sync.Map // provider → *TokenRefresher
+
+// RefresherFor returns the refresher shared by everything using provider's
+// credential.
+func RefresherFor(provider string) *TokenRefresher {
+	if r, ok := refreshers.Load(provider); ok {
+		return r.(*TokenRefresher)
+	}
+	r, _ := refreshers.LoadOrStore(provider, newTokenRefresher(provider, oauthConfigFor(provider)))
+	return r.(*TokenRefresher)
+}
+
+func newTokenRefresher(provider string, oauth *OAuthProviderConfig) *TokenRefresher {
+	return &TokenRefresher{provider: provider, oauth: oauth, refresh: RefreshAccessToken}
+}
+
+// oauthConfigFor returns the OAuth endpoint used to refresh provider's tokens.
+func oauthConfigFor(provider string) *OAuthProviderConfig {
+	switch provider {
+	case "openai":
+		cfg := OpenAIOAuthConfig()
+		return &cfg
+	}
+	return nil
+}
+
+// Token returns a usable credential, refreshing it first when it is about to
+// expire. If a refresh fails while the current token is still valid, the
+// current token is returned and the refresh is retried later.
+func (r *TokenRefresher) Token() (*AuthCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Read under the lock: a caller that waited sees the refreshed token.
+	cred, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	if !cred.NeedsRefresh() || !r.canRefresh(cred) {
+		return cred, nil
+	}
+	if r.failures > 0 && time.Since(r.lastAttempt) < refreshRetryInterval {
+		return r.fallback(cred)
+	}
+
+	r.lastAttempt = time.Now()
+	var refreshed *AuthCredential
+	err = withAuthFileLock(func() error {
+		// Another process may have refreshed while we waited for the lock;
+		// refreshing again would spend its rotated refresh token.
+		latest, err := GetCredential(r.provider)
+		if err != nil {
+			return fmt.Errorf("loading auth credentials: %w", err)
+		}
+		if latest != nil && !latest.NeedsRefresh() {
+			refreshed = latest
+			return nil
+		}
+		if latest != nil && latest.RefreshToken != "" {
+			cred = latest
+		}
+		if refreshed, err = r.refresh(cred, *r.oauth); err != nil {
+			return err
+		}
+		if refreshed.AccountID == "" {
+			refreshed.AccountID = cred.AccountID
+		}
+		if err := SetCredential(r.provider, refreshed); err != nil {
+			return fmt.Errorf("saving refreshed token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		r.failures++
+		r.lastErr = err
+		logger.WarnCF("auth", "token.refresh_failed", map[string]interface{}{
+			"provider": r.provider,
+			"failures": r.failures,
+			"error":    err.Error(),
+		})
+		if refreshed != nil {
+			// Refreshed but not saved: use it, the next refresh saves it.
+			return refreshed, nil
+		}
+		return r.fallback(cred)
+	}
+
+	if r.failures > 0 {
+		logger.InfoCF("auth", "token.refresh_recovered", map[string]interface{}{
+			"provider": r.provider,
+			"failures": r.failures,
+		})
+	}
+	r.failures = 0
+	r.lastErr = nil
+	r.cached, r.cachedStamp = refreshed, authFileStamp()
+	logger.InfoCF("auth", "token.refreshed", map[string]interface{}{
+		"provider":   r.provider,
+		"expires_at": refreshed.ExpiresAt.Format(time.RFC3339),
+	})
+	return refreshed, nil
+}
+
+// current returns the credential, from memory while auth.json is unchanged
+// and otherwise decrypted from the store. Must be called with r.mu held.
+func (r *TokenRefresher) current() (*AuthCredential, error) {
+	stamp := authFileStamp()
+	if r.cached != nil && stamp == r.cachedStamp {
+		return r.cached, nil
+	}
+	cred, err := GetCredential(r.provider)
+	if err != nil {
+		return nil, fmt.Errorf("loading auth credentials: %w", err)
+	}
+	if cred == nil {
+		r.cached = nil
+		return nil, fmt.Errorf("no credentials for %s. Run: picoclaw auth login --provider %s", r.provider, r.provider)
+	}
+	r.cached, r.cachedStamp = cred, stamp
+	return cred, nil
+}
+
+// withAuthFileLock runs fn holding an exclusive lock on auth.json.lock, which
+// every picoclaw process takes before refreshing a token.
+func withAuthFileLock(fn func() error) error {
+	path := authFilePath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("locking %s: %w", path, err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+func (r *TokenRefresher) canRefresh(cred *AuthCredential) bool {
+	return r.oauth != nil && cred.AuthMethod == "oauth" && cred.RefreshToken != ""
+}
+
+// fallback returns cred while it is still valid after a failed refresh.
+func (r *TokenRefresher) fallback(cred *AuthCredential) (*AuthCredential, error) {
+	if !cred.IsExpired() {
+		return cred, nil
+	}
+	return nil, fmt.Errorf("%s token expired and refresh failed: %w", r.provider, r.lastErr)
+}
+
+// Check is a health check for the credential: it fails after repeated
+// refresh failures, or when the token has expired and cannot be refreshed.
+func (r *TokenRefresher) Check() (bool, string) {
+	r.mu.Lock()
+	failures, lastErr := r.failures, r.lastErr
+	r.mu.Unlock()
+
+	if failures >= maxRefreshFailures {
+		return false, fmt.Sprintf("%s token refresh failed %d times: %v", r.provider, failures, lastErr)
+	}
+	r.mu.Lock()
+	cred, err := r.current()
+	r.mu.Unlock()
+	if err != nil {
+		return false, err.Error()
+	}
+	if cred.IsExpired() && !r.canRefresh(cred) {
+		return false, fmt.Sprintf("%s token expired at %s; run: picoclaw auth login --provider %s",
+			r.provider, cred.ExpiresAt.Format(time.RFC3339), r.provider)
+	}
+	if cred.ExpiresAt.IsZero() {
+		return true, "no expiry"
+	}
+	return true, fmt.Sprintf("expires %s", cred.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
+)
+
+func TestTokenRefresher_SingleFlight(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new-access",
+			"refresh_token": "new-refresh",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	SetCredential("openai", &AuthCredential{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		AccountID:    "acct-1",
+		ExpiresAt:    time.Now().Add(time.Minute), // inside the refresh window
+		Provider:     "openai",
+		AuthMethod:   "oauth",
+	})
+	r := newTokenRefresher("openai", &OAuthProviderConfig{Issuer: server.URL, ClientID: "test"})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 8)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cred, err := r.Token()
+			if err != nil {
+				t.Errorf("Token() error: %v", err)
+				return
+			}
+			tokens[i] = cred.AccessToken
+		}(i)
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("refresh endpoint called %d times, want 1", n)
+	}
+	for i, tok := range tokens {
+		if tok != "new-access" {
+			t.Errorf("caller %d got %q", i, tok)
+		}
+	}
+	stored, _ := GetCredential("openai")
+	if stored.AccessToken != "new-access" || stored.RefreshToken != "new-refresh" || stored.AccountID != "acct-1" {
+		t.Errorf("rotated credential not saved: %+v", stored)
+	}
+	if ok, msg := r.Check(); !ok {
+		t.Errorf("Check() = false, %q", msg)
+	}
+}
+
+func TestTokenRefresher_Failures(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	SetCredential("openai", &AuthCredential{
+		AccessToken:  "still-valid",
+		RefreshToken: "revoked",
+		ExpiresAt:    time.Now().Add(2 * time.Minute),
+		Provider:     "openai",
+		AuthMethod:   "oauth",
+	})
+	r := newTokenRefresher("openai", &OAuthProviderConfig{})
+	var calls int
+	r.refresh = func(*AuthCredential, OAuthProviderConfig) (*AuthCredential, error) {
+		calls++
+		return nil, errors.New("invalid_grant")
+	}
+
+	for attempt := 1; attempt <= maxRefreshFailures; attempt++ {
+		cred, err := r.Token()
+		if err != nil || cred.AccessToken != "still-valid" {
+			t.Fatalf("a valid token should be used while refresh fails: %+v, %v", cred, err)
+		}
+		// Within the retry interval the refresh is not attempted again.
+		r.Token()
+		if calls != attempt {
+			t.Fatalf("refresh attempts = %d, want %d", calls, attempt)
+		}
+		r.lastAttempt = time.Now().Add(-refreshRetryInterval)
+	}
+
+	ok, msg := r.Check()
+	if ok || !strings.Contains(msg, "invalid_grant") {
+		t.Errorf("Check() after repeated failures = %v, %q", ok, msg)
+	}
+
+	// Once the token has expired, the failure reaches the caller.
+	SetCredential("openai", &AuthCredential{
+		AccessToken:  "expired",
+		RefreshToken: "revoked",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+		Provider:     "openai",
+		AuthMethod:   "oauth",
+	})
+	if _, err := r.Token(); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired token with failing refresh should error, got %v", err)
+	}
+}
+
+func TestTokenRefresher_CannotRefresh(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	SetCredential("anthropic", &AuthCredential{AccessToken: "pasted", Provider: "anthropic", AuthMethod: "token"})
+	r := newTokenRefresher("anthropic", nil)
+	if cred, err := r.Token(); err != nil || cred.AccessToken != "pasted" {
+		t.Fatalf("Token() = %+v, %v", cred, err)
+	}
+	if ok, _ := r.Check(); !ok {
+		t.Error("a token without expiry is healthy")
+	}
+
+	SetCredential("anthropic", &AuthCredential{AccessToken: "pasted", ExpiresAt: time.Now().Add(-time.Hour), Provider: "anthropic", AuthMethod: "token"})
+	if ok, msg := r.Check(); ok || !strings.Contains(msg, "auth login") {
+		t.Errorf("an expired token that cannot be refreshed should fail the check: %q", msg)
+	}
+}
+
+func TestTokenRefresher_CachesUntilStoreChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	SetCredential("anthropic", &AuthCredential{AccessToken: "first", ExpiresAt: time.Now().Add(time.Hour), Provider: "anthropic", AuthMethod: "token"})
+	r := newTokenRefresher("anthropic", nil)
+	if cred, err := r.Token(); err != nil || cred.AccessToken != "first" {
+		t.Fatalf("Token() = %+v, %v", cred, err)
+	}
+
+	// With a key that cannot decrypt the store, only the cached credential works.
+	t.Setenv(secrets.KeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if cred, err := r.Token(); err != nil || cred.AccessToken != "first" {
+		t.Fatalf("cached credential should be used without decrypting, got %+v, %v", cred, err)
+	}
+
+	t.Setenv(secrets.KeyEnv, "")
+	SetCredential("anthropic", &AuthCredential{AccessToken: "second", ExpiresAt: time.Now().Add(time.Hour), Provider: "anthropic", AuthMethod: "token"})
+	if cred, err := r.Token(); err != nil || cred.AccessToken != "second" {
+		t.Errorf("a changed store should be re-read, got %+v, %v", cred, err)
+	}
+}
+
+func TestTokenRefresher_SkipsRefreshDoneByAnotherProcess(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	SetCredential("openai", &AuthCredential{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(time.Minute),
+		Provider:     "openai",
+		AuthMethod:   "oauth",
+	})
+	r := newTokenRefresher("openai", &OAuthProviderConfig{})
+	var calls atomic.Int32
+	r.refresh = func(*AuthCredential, OAuthProviderConfig) (*AuthCredential, error) {
+		calls.Add(1)
+		return nil, errors.New("refresh token already rotated")
+	}
+
+	// Another process holds the lock and refreshes meanwhile.
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go withAuthFileLock(func() error {
+		close(locked)
+		<-release
+		return SetCredential("openai", &AuthCredential{
+			AccessToken:  "other-access",
+			RefreshToken: "other-refresh",
+			ExpiresAt:    time.Now().Add(time.Hour),
+			Provider:     "openai",
+			AuthMethod:   "oauth",
+		})
+	})
+	<-locked
+	done := make(chan *AuthCredential, 1)
+	go func() {
+		cred, err := r.Token()
+		if err != nil {
+			t.Errorf("Token() error: %v", err)
+		}
+		done <- cred
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if cred := <-done; cred == nil || cred.AccessToken != "other-access" {
+		t.Errorf("expected the token refreshed by the other process, got %+v", cred)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("refresh called %d times, want 0", n)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
 )
 
 type AuthCredential struct {
@@ -35,19 +37,30 @@ func (c *AuthCredential) NeedsRefresh() bool {
 }
 
 func authFilePath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".picoclaw", "auth.json")
+	return filepath.Join(secrets.Dir(), "auth.json")
 }
 
+// LoadStore reads the credential store. A store still in plaintext (written
+// before encryption was added) is re-saved encrypted.
 func LoadStore() (*AuthStore, error) {
+	key, err := secrets.DefaultKey()
+	if err != nil {
+		return nil, err
+	}
 	path := authFilePath()
-	data, err := os.ReadFile(path)
+	raw, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &AuthStore{Credentials: make(map[string]*AuthCredential)}, nil
 		}
 		return nil, err
 	}
+	data := raw
+	if secrets.IsSealed(raw) {
+		if data, err = secrets.Open(raw, key); err != nil {
+			return nil, err
+		}
+	}
 
 	var store AuthStore
 	if err := json.Unmarshal(data, &store); err != nil {
@@ -56,21 +69,24 @@ func LoadStore() (*AuthStore, error) {
 	if store.Credentials == nil {
 		store.Credentials = make(map[string]*AuthCredential)
 	}
+	if !secrets.IsSealed(raw) {
+		// Best effort: the plaintext store keeps working if this fails.
+		_ = SaveStore(&store)
+	}
 	return &store, nil
 }
 
+// SaveStore writes the credential store encrypted (see package secrets).
 func SaveStore(store *AuthStore) error {
-	path := authFilePath()
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	key, err := secrets.DefaultKey()
+	if err != nil {
 		return err
 	}
-
-	data, err := json.MarshalIndent(store, "", "  ")
+	data, err := json.Marshal(store)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0600)
+	return secrets.WriteFile(authFilePath(), data, key)
 }
 
 func GetCredential(provider string) (*AuthCredential, error) {
@@ -3,6 +3,7 @@ package auth
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -187,3 +188,28 @@ func TestLoadStoreEmpty(t *testing.T) {
 		t.Errorf("expected empty credentials, got %d", len(store.Credentials))
 	}
 }
+
+func TestLoadStoreMigratesPlaintext(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	path := filepath.Join(tmpDir, ".picoclaw", "auth.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	plaintext := `{"credentials":{"openai":{"access_token":"legacy-token","refresh_token":"legacy-refresh","provider":"openai","auth_method":"oauth"}}}`
+	if err := os.WriteFile(path, []byte(plaintext), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := GetCredential("openai")
+	if err != nil || cred == nil || cred.AccessToken != "legacy-token" {
+		t.Fatalf("GetCredential() = %+v, %v", cred, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "legacy-token") || strings.Contains(string(data), "legacy-refresh") {
+		t.Fatalf("auth.json should be re-saved encrypted, got:\n%s", data)
+	}
+	if cred, err := GetCredential("openai"); err != nil || cred.RefreshToken != "legacy-refresh" {
+		t.Errorf("migrated store should still load: %+v, %v", cred, err)
+	}
+}
@@ -0,0 +1,135 @@
+package bus
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxAttachmentBytes is the largest attachment channels will upload.
+const MaxAttachmentBytes = 50 << 20
+
+// Attachment is a file sent along with an OutboundMessage. It is either a
+// local file (Path) or in-memory content (Data).
+type Attachment struct {
+	Path     string `json:"path,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	// URL is where the file can be downloaded, if anywhere. Channels that
+	// cannot upload files send it as a link instead.
+	URL string `json:"url,omitempty"`
+}
+
+// AttachmentKind groups attachments by how chat platforms present them.
+type AttachmentKind string
+
+const (
+	AttachmentImage AttachmentKind = "image"
+	AttachmentVideo AttachmentKind = "video"
+	AttachmentAudio AttachmentKind = "audio"
+	AttachmentFile  AttachmentKind = "file"
+)
+
+// Bytes returns the attachment content, reading Path when Data is empty.
+func (a Attachment) Bytes() ([]byte, error) {
+	if len(a.Data) > 0 {
+		if len(a.Data) > MaxAttachmentBytes {
+			return nil, fmt.Errorf("attachment %s is larger than %d MB", a.Name(), MaxAttachmentBytes>>20)
+		}
+		return a.Data, nil
+	}
+	if a.Path == "" {
+		return nil, fmt.Errorf("attachment %s has neither data nor a path", a.Name())
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("attachment %s is a directory", a.Path)
+	}
+	if info.Size() > MaxAttachmentBytes {
+		return nil, fmt.Errorf("attachment %s is larger than %d MB", a.Name(), MaxAttachmentBytes>>20)
+	}
+	return os.ReadFile(a.Path)
+}
+
+// Name returns the file name shown to the recipient.
+func (a Attachment) Name() string {
+	if a.Filename != "" {
+		return a.Filename
+	}
+	if a.Path != "" {
+		return filepath.Base(a.Path)
+	}
+	if exts, _ := mime.ExtensionsByType(a.MIMEType); len(exts) > 0 {
+		return "attachment" + exts[0]
+	}
+	return "attachment"
+}
+
+// ContentType returns MIMEType, or a type guessed from the file name or,
+// failing that, from data.
+func (a Attachment) ContentType(data []byte) string {
+	if a.MIMEType != "" {
+		return a.MIMEType
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Name()))); t != "" {
+		return t
+	}
+	if len(data) > 0 {
+		return http.DetectContentType(data)
+	}
+	return "application/octet-stream"
+}
+
+// Kind classifies the attachment by its content type.
+func (a Attachment) Kind(data []byte) AttachmentKind {
+	switch t := a.ContentType(data); {
+	case strings.HasPrefix(t, "image/"):
+		return AttachmentImage
+	case strings.HasPrefix(t, "video/"):
+		return AttachmentVideo
+	case strings.HasPrefix(t, "audio/"):
+		return AttachmentAudio
+	default:
+		return AttachmentFile
+	}
+}
+
+// LinkText describes the attachment in one line of text, for channels that
+// cannot upload it: the caption, the file name and the URL (or the local
+// path when there is no URL).
+func (a Attachment) LinkText() string {
+	var b strings.Builder
+	b.WriteString("📎 ")
+	if a.Caption != "" {
+		b.WriteString(a.Caption + " — ")
+	}
+	b.WriteString(a.Name())
+	switch {
+	case a.URL != "":
+		b.WriteString(": " + a.URL)
+	case a.Path != "":
+		b.WriteString(" (" + a.Path + ")")
+	}
+	return b.String()
+}
+
+// WithAttachmentLinks returns content followed by the LinkText of each
+// attachment.
+func WithAttachmentLinks(content string, attachments []Attachment) string {
+	lines := make([]string, 0, len(attachments)+1)
+	if strings.TrimSpace(content) != "" {
+		lines = append(lines, content)
+	}
+	for _, a := range attachments {
+		lines = append(lines, a.LinkText())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,52 @@
+package bus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachment_BytesAndType(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := Attachment{Path: path}
+	data, err := a.Bytes()
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Fatalf("Bytes() = %q, %v", data, err)
+	}
+	if a.Name() != "report.pdf" || a.ContentType(data) != "application/pdf" || a.Kind(data) != AttachmentFile {
+		t.Errorf("unexpected name/type/kind: %s %s %s", a.Name(), a.ContentType(data), a.Kind(data))
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	img := Attachment{Data: png}
+	if img.Kind(png) != AttachmentImage || img.Name() != "attachment" {
+		t.Errorf("in-memory image: kind=%s name=%s", img.Kind(png), img.Name())
+	}
+
+	if _, err := (Attachment{Path: dir}).Bytes(); err == nil {
+		t.Error("expected an error for a directory")
+	}
+	if _, err := (Attachment{}).Bytes(); err == nil {
+		t.Error("expected an error for an empty attachment")
+	}
+}
+
+func TestWithAttachmentLinks(t *testing.T) {
+	got := WithAttachmentLinks("done", []Attachment{
+		{Path: "/ws/out.patch", Caption: "the fix"},
+		{Data: []byte("x"), Filename: "a.png", URL: "https://example.com/a.png"},
+	})
+	want := "done\n📎 the fix — out.patch (/ws/out.patch)\n📎 a.png: https://example.com/a.png"
+	if got != want {
+		t.Errorf("WithAttachmentLinks =\n%s\nwant\n%s", got, want)
+	}
+	if got := WithAttachmentLinks("", []Attachment{{Filename: "x.txt"}}); strings.HasPrefix(got, "\n") {
+		t.Errorf("unexpected leading newline: %q", got)
+	}
+}
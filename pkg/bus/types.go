@@ -10,11 +10,34 @@ type InboundMessage struct {
 	Metadata   map[string]string `json:"metadata,omitempty"`
 }
 
+// OutboundKind tells a channel how to deliver an OutboundMessage.
+type OutboundKind string
+
+const (
+	// OutboundSend is a regular message (the zero value).
+	OutboundSend OutboundKind = ""
+	// OutboundEdit replaces the in-progress reply for the chat with Content.
+	// It carries the full text so far, not a delta. Channels that cannot edit
+	// messages never receive it; the final OutboundSend completes the reply.
+	OutboundEdit OutboundKind = "edit"
+	// OutboundStreamAbort tells editing channels that the streamed reply
+	// StreamID will not be finished (the turn failed or was cancelled), so
+	// no later message may edit it.
+	OutboundStreamAbort OutboundKind = "stream_abort"
+)
+
 type OutboundMessage struct {
 	Channel  string            `json:"channel"`
 	ChatID   string            `json:"chat_id"`
 	Content  string            `json:"content"`
+	Kind     OutboundKind      `json:"kind,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+	// StreamID ties the edits of a streamed reply to the regular message
+	// that finishes it. Messages that finish no stream leave it empty.
+	StreamID string `json:"stream_id,omitempty"`
+	// Attachments are sent after Content. Channels that cannot upload files
+	// receive them as text links appended to Content instead.
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
@@ -0,0 +1,805 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+const (
+	apiMaxPollWait         = 30 * time.Second
+	apiReplyRetention      = time.Hour
+	apiMaxBufferedReplies  = 100
+	apiHMACMaxSkew         = 5 * time.Minute
+	apiUploadTimeout       = 2 * time.Minute
+	apiWSWriteTimeout      = 10 * time.Second
+	apiWSPingInterval      = 30 * time.Second
+	apiWSSendBuffer        = 64
+	apiTempFileRetention   = 15 * time.Minute
+	apiTimestampHeader     = "X-Picoclaw-Timestamp"
+	apiNonceHeader         = "X-Picoclaw-Nonce"
+	apiMaxNonceLength      = 128
+	apiWSProtocol          = "picoclaw"
+	apiWSTokenProtocol     = "picoclaw.bearer."
+	apiMaxRequestBodyBytes = bus.MaxAttachmentBytes + 1<<20
+)
+
+// APIChannel lets custom frontends talk to the agent over HTTP. It has no
+// server of its own: the gateway mounts Handler under /api/.
+//
+// Each token has its own chats: a client's chat ID "x" is "<token name>:x"
+// on the bus (and "api:<token name>:x" as a session key), so clients cannot
+// read each other's replies by picking the same chat ID.
+//
+// Replies are kept per chat for apiReplyRetention so that REST clients can
+// poll for them; WebSocket clients get them (and streamed edits) pushed as
+// soon as they are sent, including cron and heartbeat messages for the chat.
+type APIChannel struct {
+	*BaseChannel
+	config   config.APIConfig
+	upgrader websocket.Upgrader
+
+	mu    sync.Mutex
+	chats map[string]*apiChat // by bus chat ID
+
+	nonceMu sync.Mutex
+	nonces  map[string]int64 // "<token name>:<nonce>" -> request timestamp
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type apiChat struct {
+	replies  []apiReply
+	lastSeq  int64
+	updated  chan struct{} // closed and replaced when a reply arrives
+	sockets  map[*apiSocket]struct{}
+	lastUsed time.Time
+}
+
+// apiReply is an outbound message as clients receive it. Seq orders the
+// replies of a chat; edits of a reply still being written have none.
+type apiReply struct {
+	Type        string          `json:"type"` // "message", "edit" or "error"
+	Seq         int64           `json:"seq,omitempty"`
+	ChatID      string          `json:"chat_id,omitempty"`
+	Content     string          `json:"content,omitempty"`
+	Attachments []apiAttachment `json:"attachments,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Time        time.Time       `json:"time"`
+}
+
+// apiAttachment is a file in either direction. Data is base64 in JSON.
+type apiAttachment struct {
+	Filename string `json:"filename"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// apiMessage is a message posted by a client, as a JSON request body or a
+// WebSocket frame.
+type apiMessage struct {
+	Type     string            `json:"type,omitempty"`
+	ChatID   string            `json:"chat_id"`
+	Sender   string            `json:"sender,omitempty"`
+	Content  string            `json:"content"`
+	Media    []apiAttachment   `json:"media,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type apiSocket struct {
+	conn   *websocket.Conn
+	token  *config.APIToken
+	chatID string
+	send   chan apiReply
+	once   sync.Once
+}
+
+func (s *apiSocket) close() {
+	s.once.Do(func() { s.conn.Close() })
+}
+
+// NewAPIChannel creates the api channel from cfg.
+func NewAPIChannel(cfg config.APIConfig, messageBus *bus.MessageBus) (*APIChannel, error) {
+	names := make(map[string]bool)
+	for i, t := range cfg.Tokens {
+		switch {
+		case t.Name == "" || strings.ContainsAny(t.Name, "|:"):
+			return nil, fmt.Errorf("api tokens[%d]: a name without \"|\" or \":\" is required", i)
+		case names[t.Name]:
+			return nil, fmt.Errorf("api tokens[%d]: duplicate name %q", i, t.Name)
+		case len(t.Token) < 16:
+			return nil, fmt.Errorf("api token %q: token must be at least 16 characters", t.Name)
+		case t.Auth != "" && t.Auth != "bearer" && t.Auth != "hmac":
+			return nil, fmt.Errorf("api token %q: unknown auth %q (use bearer or hmac)", t.Name, t.Auth)
+		}
+		names[t.Name] = true
+	}
+
+	c := &APIChannel{
+		BaseChannel: NewBaseChannel("api", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		chats:       make(map[string]*apiChat),
+		nonces:      make(map[string]int64),
+	}
+	c.upgrader = websocket.Upgrader{
+		CheckOrigin:  c.checkOrigin,
+		Subprotocols: []string{apiWSProtocol},
+	}
+	return c, nil
+}
+
+// checkOrigin accepts WebSockets from clients that send no Origin (not
+// browsers), from pages of the gateway itself (the web UI) and from the
+// configured allowed_origins.
+func (c *APIChannel) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.config.AllowedOrigins {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *APIChannel) Start(ctx context.Context) error {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	logger.InfoCF("api", "API channel started", map[string]interface{}{
+		"tokens": len(c.config.Tokens),
+	})
+	return nil
+}
+
+func (c *APIChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Lock()
+	for _, chat := range c.chats {
+		for s := range chat.sockets {
+			s.close()
+		}
+	}
+	c.mu.Unlock()
+	logger.InfoC("api", "API channel stopped")
+	return nil
+}
+
+// Handler serves the api channel:
+//
+//	POST /api/messages   post a message: JSON {chat_id, content, sender?, media?}
+//	                     or multipart/form-data with chat_id, content, sender
+//	                     fields and "media" files
+//	GET  /api/messages   replies for ?chat_id=, after the ?after= seq cursor,
+//	                     waiting up to ?wait= seconds for one
+//	GET  /api/ws         WebSocket for ?chat_id=: send message frames, receive
+//	                     message and edit frames
+//
+// Bearer clients send "Authorization: Bearer <token>". Browsers, which cannot
+// set headers on WebSockets, offer the subprotocols "picoclaw" and
+// "picoclaw.bearer.<unpadded base64url of the token>" instead; the server
+// selects "picoclaw". HMAC clients send
+// "Authorization: HMAC <name>:<signature>", X-Picoclaw-Timestamp (Unix
+// seconds) and X-Picoclaw-Nonce (unique per request, at most 128
+// characters), where the signature is the hex HMAC-SHA256 under the token
+// of "<timestamp>\n<nonce>\n<method>\n<path and query>\n<body>". A nonce
+// is accepted once.
+func (c *APIChannel) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/messages", c.handlePost)
+	mux.HandleFunc("GET /api/messages", c.handlePoll)
+	mux.HandleFunc("GET /api/ws", c.handleWebSocket)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.IsRunning() {
+			writeAPIError(w, http.StatusServiceUnavailable, "api channel not running")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the token the request is made with, and the request
+// body, which HMAC verification has to read.
+func (c *APIChannel) authenticate(r *http.Request) (*config.APIToken, []byte, error) {
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	isHMAC := strings.EqualFold(scheme, "HMAC")
+	var token *config.APIToken
+	var timestamp int64
+	var nonce string
+	var signature []byte
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		token = c.bearerToken(credentials)
+	case isHMAC:
+		token, timestamp, nonce, signature = c.hmacRequest(r, credentials)
+	case scheme == "" && websocket.IsWebSocketUpgrade(r):
+		token = c.bearerToken(wsProtocolToken(r))
+	}
+	// Reject before reading (up to an upload's worth of) body.
+	if token == nil {
+		return nil, nil, fmt.Errorf("invalid credentials")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, apiMaxRequestBodyBytes+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading request: %w", err)
+	}
+	if len(body) > apiMaxRequestBodyBytes {
+		return nil, nil, fmt.Errorf("request body too large")
+	}
+	if isHMAC {
+		if !hmac.Equal(signature, apiSignature(token.Token, timestamp, nonce, r.Method, r.URL.RequestURI(), body)) {
+			return nil, nil, fmt.Errorf("invalid credentials")
+		}
+		if !c.useNonce(token.Name+":"+nonce, timestamp) {
+			return nil, nil, fmt.Errorf("nonce already used")
+		}
+	}
+	return token, body, nil
+}
+
+// wsProtocolToken returns the bearer token offered as a WebSocket
+// subprotocol, or "".
+func wsProtocolToken(r *http.Request) string {
+	for _, p := range websocket.Subprotocols(r) {
+		if encoded, ok := strings.CutPrefix(p, apiWSTokenProtocol); ok {
+			token, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err == nil {
+				return string(token)
+			}
+		}
+	}
+	return ""
+}
+
+// useNonce records a signed request's nonce and reports whether it is new.
+// Nonces are kept while their timestamp is within the allowed skew; older
+// requests are refused anyway.
+func (c *APIChannel) useNonce(key string, timestamp int64) bool {
+	c.nonceMu.Lock()
+	defer c.nonceMu.Unlock()
+	cutoff := time.Now().Add(-apiHMACMaxSkew)
+	for k, ts := range c.nonces {
+		if time.Unix(ts, 0).Before(cutoff) {
+			delete(c.nonces, k)
+		}
+	}
+	if _, used := c.nonces[key]; used {
+		return false
+	}
+	c.nonces[key] = timestamp
+	return true
+}
+
+func (c *APIChannel) bearerToken(secret string) *config.APIToken {
+	if secret == "" {
+		return nil
+	}
+	for i := range c.config.Tokens {
+		t := &c.config.Tokens[i]
+		if t.Auth != "hmac" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(secret)) == 1 {
+			return t
+		}
+	}
+	return nil
+}
+
+// hmacRequest checks the parts of an HMAC authorization that do not need
+// the body: the token name, a fresh timestamp and a nonce.
+func (c *APIChannel) hmacRequest(r *http.Request, credentials string) (*config.APIToken, int64, string, []byte) {
+	name, signature, ok := strings.Cut(strings.TrimSpace(credentials), ":")
+	if !ok {
+		return nil, 0, "", nil
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(apiTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, 0, "", nil
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > apiHMACMaxSkew || skew < -apiHMACMaxSkew {
+		return nil, 0, "", nil
+	}
+	nonce := r.Header.Get(apiNonceHeader)
+	if nonce == "" || len(nonce) > apiMaxNonceLength {
+		return nil, 0, "", nil
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, 0, "", nil
+	}
+	for i := range c.config.Tokens {
+		if t := &c.config.Tokens[i]; t.Auth == "hmac" && t.Name == name {
+			return t, ts, nonce, got
+		}
+	}
+	return nil, 0, "", nil
+}
+
+// apiSignature is the HMAC a client signs a request with.
+func apiSignature(secret string, timestamp int64, nonce, method, requestURI string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n", timestamp, nonce, method, requestURI)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// apiChatID is the bus chat ID of t's chat chatID.
+func apiChatID(t *config.APIToken, chatID string) string {
+	return t.Name + ":" + chatID
+}
+
+// apiClientChatID is the chat ID the client knows of the bus chat ID chatID.
+func apiClientChatID(chatID string) string {
+	_, local, _ := strings.Cut(chatID, ":")
+	return local
+}
+
+// chatAllowed reports whether t may use its chat chatID. Without
+// AllowChats, every chat of its own is allowed.
+func chatAllowed(t *config.APIToken, chatID string) bool {
+	if len(t.AllowChats) == 0 {
+		return true
+	}
+	for _, pattern := range t.AllowChats {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(chatID, prefix) {
+				return true
+			}
+		} else if pattern == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *APIChannel) handlePost(w http.ResponseWriter, r *http.Request) {
+	// The gateway's short server timeouts are meant for health checks, not
+	// uploads.
+	http.NewResponseController(w).SetReadDeadline(time.Now().Add(apiUploadTimeout))
+
+	token, body, err := c.authenticate(r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var msg apiMessage
+	var media []string
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		msg, media, err = parseAPIMultipart(body, params["boundary"])
+	} else if err = json.Unmarshal(body, &msg); err == nil {
+		media = saveAPIMedia(msg.Media)
+	}
+	if err != nil {
+		removeFiles(media)
+		writeAPIError(w, http.StatusBadRequest, "invalid message: "+err.Error())
+		return
+	}
+	if msg.ChatID == "" || !chatAllowed(token, msg.ChatID) {
+		removeFiles(media)
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("chat %q not allowed", msg.ChatID))
+		return
+	}
+
+	clientChatID := msg.ChatID
+	msg.ChatID = apiChatID(token, clientChatID)
+	if err := c.publish(token, msg, media); err != nil {
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	writeAPIJSON(w, http.StatusAccepted, map[string]interface{}{
+		"chat_id": clientChatID,
+		"cursor":  c.cursor(msg.ChatID),
+	})
+}
+
+func parseAPIMultipart(body []byte, boundary string) (apiMessage, []string, error) {
+	var msg apiMessage
+	var media []string
+	if boundary == "" {
+		return msg, nil, fmt.Errorf("missing multipart boundary")
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return msg, media, nil
+		}
+		if err != nil {
+			return msg, media, err
+		}
+		if part.FormName() == "media" && part.FileName() != "" {
+			if path := saveInboundMedia("api", part.FileName(), part); path != "" {
+				media = append(media, path)
+			}
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, 1<<20))
+		if err != nil {
+			return msg, media, err
+		}
+		switch part.FormName() {
+		case "chat_id":
+			msg.ChatID = string(value)
+		case "sender":
+			msg.Sender = string(value)
+		case "content":
+			msg.Content = string(value)
+		}
+	}
+}
+
+func saveAPIMedia(files []apiAttachment) []string {
+	var media []string
+	for _, f := range files {
+		name := f.Filename
+		if name == "" {
+			name = "attachment"
+		}
+		if path := saveInboundMedia("api", name, bytes.NewReader(f.Data)); path != "" {
+			media = append(media, path)
+		}
+	}
+	return media
+}
+
+func removeFiles(files []string) {
+	for _, file := range files {
+		_ = os.Remove(file)
+	}
+}
+
+// publish hands a client message for the bus chat msg.ChatID to the agent.
+// The sender is the token name, qualified with the client's own sender ID when it sends one
+// ("<name>|<sender>"), so AllowFrom can list token names.
+func (c *APIChannel) publish(token *config.APIToken, msg apiMessage, media []string) error {
+	senderID := token.Name
+	if msg.Sender != "" {
+		senderID += "|" + strings.ReplaceAll(msg.Sender, "|", "_")
+	}
+	if !c.IsAllowed(senderID) {
+		removeFiles(media)
+		return fmt.Errorf("sender %q not allowed", senderID)
+	}
+	if strings.TrimSpace(msg.Content) == "" && len(media) == 0 {
+		return fmt.Errorf("content or media is required")
+	}
+
+	metadata := map[string]string{}
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata["platform"] = "api"
+	metadata["token"] = token.Name
+
+	c.mu.Lock()
+	c.chat(msg.ChatID).lastUsed = time.Now()
+	c.mu.Unlock()
+
+	logger.DebugCF("api", "Received message", map[string]interface{}{
+		"sender":  senderID,
+		"chat_id": msg.ChatID,
+		"media":   len(media),
+	})
+	c.HandleMessage(senderID, msg.ChatID, msg.Content, media, metadata)
+	c.cleanupTempFilesLater(media)
+	return nil
+}
+
+func (c *APIChannel) cleanupTempFilesLater(files []string) {
+	if len(files) == 0 {
+		return
+	}
+	go func() {
+		timer := time.NewTimer(apiTempFileRetention)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+		}
+		removeFiles(files)
+	}()
+}
+
+func (c *APIChannel) handlePoll(w http.ResponseWriter, r *http.Request) {
+	token, _, err := c.authenticate(r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	query := r.URL.Query()
+	clientChatID := query.Get("chat_id")
+	if clientChatID == "" || !chatAllowed(token, clientChatID) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("chat %q not allowed", clientChatID))
+		return
+	}
+	chatID := apiChatID(token, clientChatID)
+	after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+	waitSec, _ := strconv.Atoi(query.Get("wait"))
+	wait := time.Duration(waitSec) * time.Second
+	if wait > apiMaxPollWait {
+		wait = apiMaxPollWait
+	}
+	if wait > 0 {
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + apiWSWriteTimeout))
+	}
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		c.mu.Lock()
+		chat := c.chat(chatID)
+		chat.lastUsed = time.Now()
+		var replies []apiReply
+		for _, reply := range chat.replies {
+			if reply.Seq > after {
+				replies = append(replies, reply)
+			}
+		}
+		cursor, updated := chat.lastSeq, chat.updated
+		c.mu.Unlock()
+		if after > cursor {
+			// A cursor from before a gateway restart.
+			after = 0
+			continue
+		}
+
+		if len(replies) > 0 || wait <= 0 {
+			if replies == nil {
+				replies = []apiReply{}
+			}
+			writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+				"messages": replies,
+				"cursor":   cursor,
+			})
+			return
+		}
+		select {
+		case <-updated:
+		case <-deadline.C:
+			wait = 0
+		case <-r.Context().Done():
+			return
+		case <-c.ctx.Done():
+			wait = 0
+		}
+	}
+}
+
+func (c *APIChannel) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	token, _, err := c.authenticate(r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	clientChatID := r.URL.Query().Get("chat_id")
+	if clientChatID == "" || !chatAllowed(token, clientChatID) {
+		writeAPIError(w, http.StatusForbidden, fmt.Sprintf("chat %q not allowed", clientChatID))
+		return
+	}
+	chatID := apiChatID(token, clientChatID)
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(apiMaxRequestBodyBytes * 4 / 3)
+
+	s := &apiSocket{conn: conn, token: token, chatID: chatID, send: make(chan apiReply, apiWSSendBuffer)}
+	c.mu.Lock()
+	chat := c.chat(chatID)
+	chat.sockets[s] = struct{}{}
+	chat.lastUsed = time.Now()
+	c.mu.Unlock()
+	logger.DebugCF("api", "WebSocket connected", map[string]interface{}{
+		"token":   token.Name,
+		"chat_id": chatID,
+	})
+
+	go c.writeSocket(s)
+	c.readSocket(s)
+
+	c.mu.Lock()
+	delete(chat.sockets, s)
+	chat.lastUsed = time.Now()
+	c.mu.Unlock()
+	s.close()
+}
+
+func (c *APIChannel) readSocket(s *apiSocket) {
+	for {
+		var msg apiMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				c.queue(s, apiReply{Type: "error", Error: "invalid JSON", Time: time.Now()})
+				continue
+			}
+			return
+		}
+		if msg.Type != "" && msg.Type != "message" {
+			c.queue(s, apiReply{Type: "error", Error: fmt.Sprintf("unknown frame type %q", msg.Type), Time: time.Now()})
+			continue
+		}
+		msg.ChatID = s.chatID
+		if err := c.publish(s.token, msg, saveAPIMedia(msg.Media)); err != nil {
+			c.queue(s, apiReply{Type: "error", Error: err.Error(), Time: time.Now()})
+		}
+	}
+}
+
+func (c *APIChannel) writeSocket(s *apiSocket) {
+	ping := time.NewTicker(apiWSPingInterval)
+	defer ping.Stop()
+	defer s.close()
+	for {
+		select {
+		case reply, ok := <-s.send:
+			if !ok {
+				return
+			}
+			s.conn.SetWriteDeadline(time.Now().Add(apiWSWriteTimeout))
+			if err := s.conn.WriteJSON(reply); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(apiWSWriteTimeout)); err != nil {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// queue hands reply to the socket's writer. A client too slow to keep up
+// is disconnected rather than allowed to hold up the other chats.
+func (c *APIChannel) queue(s *apiSocket, reply apiReply) {
+	select {
+	case s.send <- reply:
+	default:
+		logger.WarnCF("api", "Disconnecting slow WebSocket client", map[string]interface{}{
+			"token":   s.token.Name,
+			"chat_id": s.chatID,
+		})
+		s.close()
+	}
+}
+
+// Send stores the reply for pollers and pushes it to the chat's sockets.
+func (c *APIChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("api channel not running")
+	}
+	reply := apiReply{Type: "message", ChatID: apiClientChatID(msg.ChatID), Content: msg.Content, Time: time.Now()}
+	var unreadable []bus.Attachment
+	for _, a := range msg.Attachments {
+		data, err := a.Bytes()
+		if err != nil && a.URL == "" {
+			logger.WarnCF("api", "Attachment upload failed, sending a link instead", map[string]interface{}{
+				"filename": a.Name(),
+				"error":    err.Error(),
+			})
+			unreadable = append(unreadable, a)
+			continue
+		}
+		reply.Attachments = append(reply.Attachments, apiAttachment{
+			Filename: a.Name(),
+			MIMEType: a.ContentType(data),
+			Caption:  a.Caption,
+			URL:      a.URL,
+			Data:     data,
+		})
+	}
+	if len(unreadable) > 0 {
+		reply.Content = bus.WithAttachmentLinks(reply.Content, unreadable)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chat := c.chat(msg.ChatID)
+	chat.lastSeq++
+	reply.Seq = chat.lastSeq
+	chat.replies = append(chat.replies, reply)
+	for len(chat.replies) > apiMaxBufferedReplies || time.Since(chat.replies[0].Time) > apiReplyRetention {
+		chat.replies = chat.replies[1:]
+	}
+	close(chat.updated)
+	chat.updated = make(chan struct{})
+	for s := range chat.sockets {
+		c.queue(s, reply)
+	}
+	return nil
+}
+
+// SendsAttachments reports that Send delivers attachment contents.
+func (c *APIChannel) SendsAttachments() bool { return true }
+
+// Edit pushes the partial reply to the chat's sockets. Pollers only get the
+// final reply.
+func (c *APIChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("api channel not running")
+	}
+	if msg.Kind == bus.OutboundStreamAbort {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chat, ok := c.chats[msg.ChatID]
+	if !ok {
+		return nil
+	}
+	for s := range chat.sockets {
+		c.queue(s, apiReply{Type: "edit", ChatID: apiClientChatID(msg.ChatID), Content: msg.Content, Time: time.Now()})
+	}
+	return nil
+}
+
+// chat returns the state of chatID, creating it (and forgetting chats idle
+// for longer than apiReplyRetention). c.mu must be held.
+func (c *APIChannel) chat(chatID string) *apiChat {
+	if chat, ok := c.chats[chatID]; ok {
+		return chat
+	}
+	for id, chat := range c.chats {
+		if len(chat.sockets) == 0 && time.Since(chat.lastUsed) > apiReplyRetention {
+			delete(c.chats, id)
+		}
+	}
+	chat := &apiChat{
+		updated:  make(chan struct{}),
+		sockets:  make(map[*apiSocket]struct{}),
+		lastUsed: time.Now(),
+	}
+	c.chats[chatID] = chat
+	return chat
+}
+
+func (c *APIChannel) cursor(chatID string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chat(chatID).lastSeq
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WarnCF("api", "Failed to write response", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	writeAPIJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,371 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+const (
+	testAPIBearer = "dashboard-secret-0123456789"
+	testAPIHMAC   = "kiosk-hmac-key-0123456789"
+)
+
+func startTestAPIChannel(t *testing.T) (*APIChannel, *bus.MessageBus, *httptest.Server) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewAPIChannel(config.APIConfig{
+		Enabled: true,
+		Tokens: []config.APIToken{
+			{Name: "dashboard", Token: testAPIBearer, AllowChats: []string{"dash-*"}},
+			{Name: "kiosk", Token: testAPIHMAC, Auth: "hmac"},
+		},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewAPIChannel failed: %v", err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	srv := httptest.NewServer(ch.Handler())
+	t.Cleanup(func() {
+		ch.Stop(context.Background())
+		srv.Close()
+	})
+	return ch, msgBus, srv
+}
+
+func consumeInbound(t *testing.T, msgBus *bus.MessageBus) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	return msg
+}
+
+func apiRequest(t *testing.T, method, url, contentType string, body []byte, header http.Header) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestAPIChannel_PostAndPoll(t *testing.T) {
+	ch, msgBus, srv := startTestAPIChannel(t)
+
+	body, _ := json.Marshal(apiMessage{
+		ChatID:  "dash-1",
+		Sender:  "alice",
+		Content: "what is in this file?",
+		Media:   []apiAttachment{{Filename: "notes.txt", Data: []byte("hello")}},
+	})
+	resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, bearer(testAPIBearer))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST status = %d", resp.StatusCode)
+	}
+	in := consumeInbound(t, msgBus)
+	if in.SessionKey != "api:dashboard:dash-1" || in.ChatID != "dashboard:dash-1" || in.SenderID != "dashboard|alice" || in.Content != "what is in this file?" {
+		t.Errorf("inbound = %+v", in)
+	}
+	if len(in.Media) != 1 {
+		t.Fatalf("Media = %v", in.Media)
+	}
+	if data, _ := os.ReadFile(in.Media[0]); string(data) != "hello" {
+		t.Errorf("media content = %q", data)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		chatID string
+		want   int
+	}{
+		{"wrong token", bearer("not-the-token-at-all"), "dash-1", http.StatusUnauthorized},
+		{"hmac key as bearer", bearer(testAPIHMAC), "dash-1", http.StatusUnauthorized},
+		{"chat outside allowlist", bearer(testAPIBearer), "admin", http.StatusForbidden},
+	} {
+		body, _ := json.Marshal(apiMessage{ChatID: tc.chatID, Content: "hi"})
+		if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, tc.header); resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+
+	// A long poll returns as soon as the reply is sent.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ch.Send(context.Background(), bus.OutboundMessage{
+			Channel:     "api",
+			ChatID:      "dashboard:dash-1",
+			Content:     "It says hello.",
+			Attachments: []bus.Attachment{{Data: []byte("a,b"), Filename: "out.csv"}},
+		})
+	}()
+	start := time.Now()
+	resp, out := apiRequest(t, http.MethodGet, srv.URL+"/api/messages?chat_id=dash-1&after=0&wait=10", "", nil, bearer(testAPIBearer))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("poll status = %d", resp.StatusCode)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("long poll took %v", time.Since(start))
+	}
+	messages := out["messages"].([]interface{})
+	if len(messages) != 1 || out["cursor"].(float64) != 1 {
+		t.Fatalf("poll = %v", out)
+	}
+	reply := messages[0].(map[string]interface{})
+	att := reply["attachments"].([]interface{})[0].(map[string]interface{})
+	if reply["content"] != "It says hello." || reply["chat_id"] != "dash-1" || att["filename"] != "out.csv" || att["data"] != "YSxi" {
+		t.Errorf("reply = %v", reply)
+	}
+
+	// Nothing new after the cursor.
+	_, out = apiRequest(t, http.MethodGet, srv.URL+"/api/messages?chat_id=dash-1&after=1", "", nil, bearer(testAPIBearer))
+	if len(out["messages"].([]interface{})) != 0 {
+		t.Errorf("expected no messages after cursor 1, got %v", out)
+	}
+}
+
+func TestAPIChannel_MultipartUpload(t *testing.T) {
+	_, msgBus, srv := startTestAPIChannel(t)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("chat_id", "dash-2")
+	mw.WriteField("content", "see photo")
+	fw, _ := mw.CreateFormFile("media", "photo.jpg")
+	fw.Write([]byte("JPEGDATA"))
+	mw.Close()
+
+	resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", mw.FormDataContentType(), buf.Bytes(), bearer(testAPIBearer))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	in := consumeInbound(t, msgBus)
+	if in.ChatID != "dashboard:dash-2" || in.Content != "see photo" || len(in.Media) != 1 || !strings.HasSuffix(in.Media[0], "_photo.jpg") {
+		t.Errorf("inbound = %+v", in)
+	}
+}
+
+func TestAPIChannel_HMAC(t *testing.T) {
+	_, msgBus, srv := startTestAPIChannel(t)
+
+	body := []byte(`{"chat_id":"lobby","content":"hello from the kiosk"}`)
+	sign := func(ts int64, nonce string, body []byte) http.Header {
+		sig := hex.EncodeToString(apiSignature(testAPIHMAC, ts, nonce, http.MethodPost, "/api/messages", body))
+		return http.Header{
+			"Authorization":    {"HMAC kiosk:" + sig},
+			apiTimestampHeader: {strconv.FormatInt(ts, 10)},
+			apiNonceHeader:     {nonce},
+		}
+	}
+
+	now := time.Now().Unix()
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, sign(now, "n-1", body)); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("signed request: status = %d", resp.StatusCode)
+	}
+	if in := consumeInbound(t, msgBus); in.SenderID != "kiosk" || in.ChatID != "kiosk:lobby" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, sign(now, "n-1", body)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed request: status = %d, want 401", resp.StatusCode)
+	}
+	tampered := []byte(`{"chat_id":"lobby","content":"something else"}`)
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", tampered, sign(now, "n-2", body)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered body: status = %d, want 401", resp.StatusCode)
+	}
+	stale := now - int64(apiHMACMaxSkew/time.Second) - 60
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, sign(stale, "n-3", body)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: status = %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, sign(now, "", body)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("missing nonce: status = %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, http.Header{"Authorization": {"HMAC kiosk:"}, apiTimestampHeader: {strconv.FormatInt(now, 10)}, apiNonceHeader: {"n-4"}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("empty signature: status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestAPIChannel_ChatsArePerToken(t *testing.T) {
+	ch, msgBus, srv := startTestAPIChannel(t)
+
+	// kiosk has no allow_chats, so it may use any chat ID of its own, but
+	// "dash-1" is then a different chat from dashboard's.
+	body := []byte(`{"chat_id":"dash-1","content":"hi"}`)
+	sig := hex.EncodeToString(apiSignature(testAPIHMAC, time.Now().Unix(), "n-1", http.MethodPost, "/api/messages", body))
+	header := http.Header{
+		"Authorization":    {"HMAC kiosk:" + sig},
+		apiTimestampHeader: {strconv.FormatInt(time.Now().Unix(), 10)},
+		apiNonceHeader:     {"n-1"},
+	}
+	if resp, _ := apiRequest(t, http.MethodPost, srv.URL+"/api/messages", "application/json", body, header); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if in := consumeInbound(t, msgBus); in.ChatID != "kiosk:dash-1" || in.SessionKey != "api:kiosk:dash-1" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "kiosk:dash-1", Content: "for the kiosk"})
+	_, out := apiRequest(t, http.MethodGet, srv.URL+"/api/messages?chat_id=dash-1&after=0", "", nil, bearer(testAPIBearer))
+	if len(out["messages"].([]interface{})) != 0 {
+		t.Errorf("dashboard read the kiosk's reply: %v", out)
+	}
+}
+
+// wsDialer offers token the way the web UI does.
+func wsDialer(token string) *websocket.Dialer {
+	return &websocket.Dialer{Subprotocols: []string{
+		apiWSProtocol,
+		apiWSTokenProtocol + base64.RawURLEncoding.EncodeToString([]byte(token)),
+	}}
+}
+
+func TestAPIChannel_WebSocket(t *testing.T) {
+	ch, msgBus, srv := startTestAPIChannel(t)
+	wsBase := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws"
+
+	if _, resp, err := wsDialer(testAPIBearer).Dial(wsBase+"?chat_id=admin", nil); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("socket for a chat outside the allowlist: err=%v", err)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsBase+"?chat_id=dash-ws&access_token="+testAPIBearer, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token in the query string should not authenticate: err=%v", err)
+	}
+
+	conn, _, err := wsDialer(testAPIBearer).Dial(wsBase+"?chat_id=dash-ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != apiWSProtocol {
+		t.Errorf("subprotocol = %q, want %q", conn.Subprotocol(), apiWSProtocol)
+	}
+
+	if err := conn.WriteJSON(apiMessage{Type: "message", ChatID: "ignored", Content: "hi over ws"}); err != nil {
+		t.Fatal(err)
+	}
+	in := consumeInbound(t, msgBus)
+	if in.ChatID != "dashboard:dash-ws" || in.Content != "hi over ws" || in.SenderID != "dashboard" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	// A streamed reply followed by the final one, and a later push such as
+	// a cron reminder.
+	ch.Edit(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "dashboard:dash-ws", Content: "Thinking"})
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "dashboard:dash-ws", Content: "Done"})
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "dashboard:dash-ws", Content: "Reminder: stand-up"})
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "dashboard:dash-other", Content: "not for this socket"})
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "api", ChatID: "kiosk:dash-ws", Content: "not for this token"})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []string
+	for len(got) < 3 {
+		var reply apiReply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("read: %v (got %v)", err, got)
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%s", reply.Type, reply.Seq, reply.Content))
+	}
+	want := "edit:0:Thinking message:1:Done message:2:Reminder: stand-up"
+	if strings.Join(got, " ") != want {
+		t.Errorf("frames = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if err := conn.WriteJSON(apiMessage{Type: "subscribe"}); err != nil {
+		t.Fatal(err)
+	}
+	var reply apiReply
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != "error" {
+		t.Errorf("unknown frame type: reply=%+v err=%v", reply, err)
+	}
+}
+
+func TestNewAPIChannel_Validation(t *testing.T) {
+	for _, tokens := range [][]config.APIToken{
+		{{Name: "", Token: testAPIBearer}},
+		{{Name: "a:b", Token: testAPIBearer}},
+		{{Name: "a", Token: "short"}},
+		{{Name: "a", Token: testAPIBearer, Auth: "basic"}},
+		{{Name: "a", Token: testAPIBearer}, {Name: "a", Token: testAPIHMAC}},
+	} {
+		if _, err := NewAPIChannel(config.APIConfig{Tokens: tokens}, bus.NewMessageBus()); err == nil {
+			t.Errorf("expected an error for %+v", tokens)
+		}
+	}
+}
+
+func TestAPIChannel_WebSocketOrigin(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch, err := NewAPIChannel(config.APIConfig{
+		Enabled:        true,
+		Tokens:         []config.APIToken{{Name: "dashboard", Token: testAPIBearer}},
+		AllowedOrigins: config.FlexibleStringSlice{"https://app.example.com"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewAPIChannel failed: %v", err)
+	}
+	ch.Start(context.Background())
+	defer ch.Stop(context.Background())
+	srv := httptest.NewServer(ch.Handler())
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/ws?chat_id=c1"
+
+	for _, tc := range []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{srv.URL, true},
+		{"https://APP.example.com", true},
+		{"https://evil.example.com", false},
+	} {
+		header := http.Header{}
+		if tc.origin != "" {
+			header.Set("Origin", tc.origin)
+		}
+		conn, _, err := wsDialer(testAPIBearer).Dial(wsURL, header)
+		if (err == nil) != tc.ok {
+			t.Errorf("origin %q: err = %v, want ok=%v", tc.origin, err, tc.ok)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
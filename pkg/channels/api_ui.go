@@ -0,0 +1,191 @@
+package channels
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/session"
+)
+
+//go:embed ui/index.html
+var uiFiles embed.FS
+
+// uiSession is a session as the web UI shows it.
+type uiSession struct {
+	session.SessionInfo
+	// ChatID is set for the chats the UI can write to; it is empty when the
+	// token may not send (see AllowFrom), making the session read-only.
+	ChatID string `json:"chat_id,omitempty"`
+}
+
+// uiEntry is one item of a session's timeline: a message, or a routing
+// decision ("route") shown above the user message it was made for.
+type uiEntry struct {
+	Role       string               `json:"role"`
+	Content    string               `json:"content,omitempty"`
+	ToolCalls  []uiToolCall         `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+	Route      *session.RouteRecord `json:"route,omitempty"`
+}
+
+type uiToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// UIHandler serves the built-in web chat:
+//
+//	GET /ui/                  the single-page app
+//	GET /ui/api/sessions      sessions the token may read
+//	GET /ui/api/session?key=  one session: flags, summary and timeline
+//
+// The page logs in with a bearer token of the api channel and chats
+// through /api/ws. A token reads only its own api chats (those in
+// allow_chats, if set), never other tokens' or other channels' sessions. HMAC tokens cannot log in.
+func (c *APIChannel) UIHandler(sessions *session.SessionManager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ui", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("GET /ui/{$}", func(w http.ResponseWriter, r *http.Request) {
+		page, err := uiFiles.ReadFile("ui/index.html")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; img-src 'self' data:; connect-src 'self' ws: wss:")
+		w.Write(page)
+	})
+	mux.HandleFunc("GET /ui/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		token := c.uiToken(r)
+		if token == nil {
+			writeAPIError(w, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+		list := []uiSession{}
+		for _, info := range sessions.ListSessions() {
+			if !c.uiCanRead(token, info.Key) {
+				continue
+			}
+			list = append(list, uiSession{SessionInfo: info, ChatID: c.uiChatID(token, info.Key)})
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+			"token":    token.Name,
+			"sessions": list,
+		})
+	})
+	mux.HandleFunc("GET /ui/api/session", func(w http.ResponseWriter, r *http.Request) {
+		token := c.uiToken(r)
+		if token == nil {
+			writeAPIError(w, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+		key := r.URL.Query().Get("key")
+		if key == "" || !c.uiCanRead(token, key) {
+			writeAPIError(w, http.StatusForbidden, "session not allowed")
+			return
+		}
+		messages := sessions.GetHistory(key)
+		summary := sessions.GetSummary(key)
+		routes := sessions.GetRoutes(key)
+		// The page leaves the host like session files do: redacted.
+		if rd := redact.Default(); rd != nil {
+			messages = session.RedactMessages(rd, key, messages)
+			summary = rd.Redact(key, summary)
+			for i := range routes {
+				routes[i].Text = rd.Redact(key, routes[i].Text)
+			}
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+			"key":      key,
+			"chat_id":  c.uiChatID(token, key),
+			"flags":    sessions.GetFlags(key),
+			"summary":  summary,
+			"timeline": uiTimeline(messages, routes),
+		})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.IsRunning() {
+			writeAPIError(w, http.StatusServiceUnavailable, "api channel not running")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// uiToken returns the bearer token the UI request is made with.
+func (c *APIChannel) uiToken(r *http.Request) *config.APIToken {
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil
+	}
+	return c.bearerToken(credentials)
+}
+
+// uiCanRead reports whether t may read the session key.
+func (c *APIChannel) uiCanRead(t *config.APIToken, key string) bool {
+	chatID, ok := c.uiOwnChat(t, key)
+	return ok && chatAllowed(t, chatID)
+}
+
+// uiChatID is the api chat ID of key if t may send to it, otherwise "".
+func (c *APIChannel) uiChatID(t *config.APIToken, key string) string {
+	chatID, ok := c.uiOwnChat(t, key)
+	if !ok || chatID == "" || !chatAllowed(t, chatID) || !c.IsAllowed(t.Name) {
+		return ""
+	}
+	return chatID
+}
+
+// uiOwnChat returns the client chat ID of key if it is one of t's chats.
+func (c *APIChannel) uiOwnChat(t *config.APIToken, key string) (string, bool) {
+	return strings.CutPrefix(key, c.Name()+":"+apiChatID(t, ""))
+}
+
+// uiTimeline interleaves the recorded routing decisions with the history.
+// A decision is placed above the first later user message that starts with
+// its text; decisions with no message of their own (e.g. /local, which is
+// answered directly, or turns already truncated from the history) stand
+// alone in order.
+func uiTimeline(messages []providers.Message, routes []session.RouteRecord) []uiEntry {
+	entries := make([]uiEntry, 0, len(messages)+len(routes))
+	next := 0
+	for _, m := range messages {
+		if m.Role == "user" {
+			for i := next; i < len(routes); i++ {
+				if routes[i].Text == "" || !strings.HasPrefix(m.Content, routes[i].Text) {
+					continue
+				}
+				for ; next <= i; next++ {
+					entries = append(entries, uiEntry{Role: "route", Route: &routes[next]})
+				}
+				break
+			}
+		}
+
+		entry := uiEntry{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			call := uiToolCall{ID: tc.ID, Name: tc.Name}
+			if tc.Function != nil {
+				call.Name = tc.Function.Name
+				call.Arguments = tc.Function.Arguments
+			} else if len(tc.Arguments) > 0 {
+				args, _ := json.Marshal(tc.Arguments)
+				call.Arguments = string(args)
+			}
+			entry.ToolCalls = append(entry.ToolCalls, call)
+		}
+		entries = append(entries, entry)
+	}
+	for ; next < len(routes); next++ {
+		entries = append(entries, uiEntry{Role: "route", Route: &routes[next]})
+	}
+	return entries
+}
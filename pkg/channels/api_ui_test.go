@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/session"
+)
+
+const testUIAdmin = "admin-secret-0123456789"
+
+func TestAPIChannel_UI(t *testing.T) {
+	ch, err := NewAPIChannel(config.APIConfig{
+		Enabled: true,
+		Tokens: []config.APIToken{
+			{Name: "admin", Token: testUIAdmin},
+			{Name: "dashboard", Token: testAPIBearer, AllowChats: []string{"dash-*"}},
+			{Name: "kiosk", Token: testAPIHMAC, Auth: "hmac"},
+		},
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewAPIChannel failed: %v", err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	sessions := session.NewSessionManager("")
+	sessions.AddMessage("telegram:1", "user", "from telegram")
+	sessions.AddMessage("api:admin:a-1", "user", "from the admin")
+	sessions.AddRoute("api:dashboard:dash-1", session.RouteRecord{Text: "/local", Route: "CHAT", Source: "command", LocalOnly: true})
+	sessions.AddRoute("api:dashboard:dash-1", session.RouteRecord{Text: "list files", Route: "OPS", Source: "rules", Confidence: 0.9, Declaration: "Worker に依頼します"})
+	sessions.AddMessage("api:dashboard:dash-1", "user", "list files")
+	sessions.AddFullMessage("api:dashboard:dash-1", providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{{
+			ID:       "call_1",
+			Function: &providers.FunctionCall{Name: "list_dir", Arguments: `{"path":"."}`},
+		}},
+	})
+	sessions.AddFullMessage("api:dashboard:dash-1", providers.Message{Role: "tool", Content: "a.txt", ToolCallID: "call_1"})
+	sessions.AddMessage("api:dashboard:dash-1", "assistant", "There is a.txt.")
+	sessions.AddRoute("api:dashboard:dash-1", session.RouteRecord{Text: "and now?", Route: "CHAT"})
+
+	srv := httptest.NewServer(ch.UIHandler(sessions))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ui/")
+	if err != nil {
+		t.Fatalf("GET /ui/: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "/ui/api/sessions") {
+		t.Errorf("GET /ui/ = %d, %d bytes", resp.StatusCode, len(page))
+	}
+
+	for _, h := range []http.Header{nil, bearer("wrong-token-0123456789"), bearer(testAPIHMAC)} {
+		if resp, _ := apiRequest(t, "GET", srv.URL+"/ui/api/sessions", "", nil, h); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("sessions with %v = %d, want 401", h, resp.StatusCode)
+		}
+	}
+
+	// A token without allow_chats reads all of its own chats and nothing else.
+	_, out := apiRequest(t, "GET", srv.URL+"/ui/api/sessions", "", nil, bearer(testUIAdmin))
+	chats := map[string]interface{}{}
+	for _, s := range out["sessions"].([]interface{}) {
+		s := s.(map[string]interface{})
+		chats[s["key"].(string)] = s["chat_id"]
+	}
+	if len(chats) != 1 || chats["api:admin:a-1"] != "a-1" {
+		t.Errorf("admin sessions = %v", chats)
+	}
+	for _, key := range []string{"telegram:1", "api:dashboard:dash-1"} {
+		if resp, _ := apiRequest(t, "GET", srv.URL+"/ui/api/session?key="+key, "", nil, bearer(testUIAdmin)); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("admin reading %s = %d, want 403", key, resp.StatusCode)
+		}
+	}
+
+	// A token limited to some chats sees only those.
+	_, out = apiRequest(t, "GET", srv.URL+"/ui/api/sessions", "", nil, bearer(testAPIBearer))
+	if list := out["sessions"].([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["key"] != "api:dashboard:dash-1" {
+		t.Errorf("dashboard sessions = %v", list)
+	}
+	if resp, _ := apiRequest(t, "GET", srv.URL+"/ui/api/session?key=telegram:1", "", nil, bearer(testAPIBearer)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dashboard reading telegram:1 = %d, want 403", resp.StatusCode)
+	}
+
+	resp, out = apiRequest(t, "GET", srv.URL+"/ui/api/session?key=api:dashboard:dash-1", "", nil, bearer(testAPIBearer))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET session = %d: %v", resp.StatusCode, out)
+	}
+	var roles []string
+	for _, e := range out["timeline"].([]interface{}) {
+		e := e.(map[string]interface{})
+		role := e["role"].(string)
+		if route, ok := e["route"].(map[string]interface{}); ok {
+			role += "(" + route["route"].(string) + ")"
+		}
+		roles = append(roles, role)
+	}
+	want := "route(CHAT) route(OPS) user assistant tool assistant route(CHAT)"
+	if got := strings.Join(roles, " "); got != want {
+		t.Errorf("timeline = %q, want %q", got, want)
+	}
+	call := out["timeline"].([]interface{})[3].(map[string]interface{})["tool_calls"].([]interface{})[0].(map[string]interface{})
+	if call["name"] != "list_dir" || call["arguments"] != `{"path":"."}` {
+		t.Errorf("tool call = %v", call)
+	}
+}
@@ -0,0 +1,79 @@
+package channels
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
+)
+
+// withAttachmentLinks moves the attachments of msg into its text when
+// channel cannot upload them.
+func withAttachmentLinks(channel Channel, msg bus.OutboundMessage) bus.OutboundMessage {
+	if len(msg.Attachments) == 0 {
+		return msg
+	}
+	if sender, ok := channel.(AttachmentSender); ok && sender.SendsAttachments() {
+		return msg
+	}
+	msg.Content = bus.WithAttachmentLinks(msg.Content, msg.Attachments)
+	msg.Attachments = nil
+	return msg
+}
+
+// sendAttachments uploads each attachment with upload. Attachments that
+// cannot be read or uploaded are sent as text links with sendText instead,
+// so the recipient at least learns about them.
+func sendAttachments(channel string, attachments []bus.Attachment, upload func(a bus.Attachment, data []byte) error, sendText func(text string) error) error {
+	var failed []bus.Attachment
+	for _, a := range attachments {
+		data, err := a.Bytes()
+		if err == nil {
+			err = upload(a, data)
+		}
+		if err != nil {
+			logger.WarnCF(channel, "Attachment upload failed, sending a link instead", map[string]interface{}{
+				"filename": a.Name(),
+				"error":    err.Error(),
+			})
+			failed = append(failed, a)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return sendText(bus.WithAttachmentLinks("", failed))
+}
+
+// saveInboundMedia stores received media in the temporary media directory,
+// like utils.DownloadFile, and returns its path. Files larger than
+// bus.MaxAttachmentBytes are dropped and "" is returned.
+func saveInboundMedia(channel, filename string, r io.Reader) string {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0700); err != nil {
+		return ""
+	}
+	path := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(filename))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return ""
+	}
+	n, err := io.Copy(f, io.LimitReader(r, bus.MaxAttachmentBytes+1))
+	f.Close()
+	if err != nil || n > bus.MaxAttachmentBytes {
+		logger.WarnCF(channel, "Dropping received media", map[string]interface{}{
+			"filename": filename,
+			"error":    fmt.Sprint(err),
+			"size":     n,
+		})
+		os.Remove(path)
+		return ""
+	}
+	return path
+}
@@ -17,6 +17,27 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// MessageEditor is implemented by channels that can update a sent message in
+// place. Outbound messages of kind bus.OutboundEdit and bus.OutboundStreamAbort
+// are delivered only to channels implementing it; the regular Send with the
+// same StreamID finalizes the reply, an abort forgets it.
+type MessageEditor interface {
+	Edit(ctx context.Context, msg bus.OutboundMessage) error
+}
+
+// streamKey identifies the reply being streamed for msg, so that a stream
+// left unfinished is never continued by another turn in the same chat.
+func streamKey(msg bus.OutboundMessage) string {
+	return msg.ChatID + "\x00" + msg.StreamID
+}
+
+// AttachmentSender is implemented by channels whose Send uploads
+// msg.Attachments. Other channels receive the attachments as text links
+// appended to Content.
+type AttachmentSender interface {
+	SendsAttachments() bool
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
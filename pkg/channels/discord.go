@@ -1,10 +1,12 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -26,6 +28,7 @@ type DiscordChannel struct {
 	config      config.DiscordConfig
 	transcriber *voice.GroqTranscriber
 	ctx         context.Context
+	streaming   sync.Map // streamKey -> message ID of the reply being streamed
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -103,17 +106,81 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 
 	runes := []rune(msg.Content)
 	if len(runes) == 0 {
-		return nil
+		return c.sendAttachments(ctx, channelID, msg.Attachments)
 	}
 
 	chunks := splitMessage(msg.Content, 1500) // Discord has a limit of 2000 characters per message, leave 500 for natural split e.g. code blocks
 
+	// Finish a streamed reply in place: the first chunk replaces the partial message.
+	if ref, ok := c.streaming.LoadAndDelete(streamKey(msg)); ok {
+		if _, err := c.session.ChannelMessageEdit(channelID, ref.(string), chunks[0], discordgo.WithContext(ctx)); err == nil {
+			chunks = chunks[1:]
+		}
+	}
+
 	for _, chunk := range chunks {
 		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
 			return err
 		}
 	}
 
+	return c.sendAttachments(ctx, channelID, msg.Attachments)
+}
+
+// SendsAttachments reports that Send uploads attachments as message files.
+func (c *DiscordChannel) SendsAttachments() bool { return true }
+
+// sendAttachments uploads each attachment in its own message, with its
+// caption as the message text.
+func (c *DiscordChannel) sendAttachments(ctx context.Context, channelID string, attachments []bus.Attachment) error {
+	return sendAttachments("discord", attachments, func(a bus.Attachment, data []byte) error {
+		_, err := c.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: utils.Truncate(a.Caption, 1900),
+			Files: []*discordgo.File{{
+				Name:        a.Name(),
+				ContentType: a.ContentType(data),
+				Reader:      bytes.NewReader(data),
+			}},
+		}, discordgo.WithContext(ctx))
+		return err
+	}, func(text string) error {
+		return c.sendChunk(ctx, channelID, text)
+	})
+}
+
+// Edit sends the partial reply on the first call and edits it on later calls.
+// Partial text longer than one Discord message shows only its beginning.
+func (c *DiscordChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	if msg.Kind == bus.OutboundStreamAbort {
+		c.streaming.Delete(streamKey(msg))
+		return nil
+	}
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	channelID := msg.ChatID
+	if channelID == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	content := utils.Truncate(msg.Content, 1900)
+	if ref, ok := c.streaming.Load(streamKey(msg)); ok {
+		if _, err := c.session.ChannelMessageEdit(channelID, ref.(string), content, discordgo.WithContext(ctx)); err != nil {
+			c.streaming.Delete(streamKey(msg))
+			return fmt.Errorf("failed to edit discord message: %w", err)
+		}
+		return nil
+	}
+
+	sent, err := c.session.ChannelMessageSend(channelID, content, discordgo.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to send discord message: %w", err)
+	}
+	c.streaming.Store(streamKey(msg), sent.ID)
 	return nil
 }
 
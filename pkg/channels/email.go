@@ -0,0 +1,956 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/google/uuid"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+const (
+	emailReconnectDelay    = 10 * time.Second
+	emailTempFileRetention = 15 * time.Minute
+	// emailMaxThreads bounds the threads (and message IDs) kept for replies.
+	emailMaxThreads = 1000
+	// emailMaxFetch bounds the messages fetched and handled at once.
+	emailMaxFetch = 20
+)
+
+// emailThread is what a reply needs to land in the same conversation.
+type emailThread struct {
+	subject    string
+	recipient  string   // authenticated From of the latest mail
+	references []string // Message-IDs of the thread, oldest first
+	updated    time.Time
+}
+
+// EmailChannel receives mail over IMAP (IDLE, falling back to polling) and
+// replies over SMTP. Each mail thread is one chat: the chat ID is the
+// correspondent's address and a hash of the thread's first Message-ID, so
+// replies keep their session and can be sent after a restart. Only mail
+// whose sender a trusted server authenticated (DMARC or DKIM) is accepted,
+// and only mail that arrived after the channel first connected.
+type EmailChannel struct {
+	*BaseChannel
+	config  config.EmailConfig
+	address string // our From address, lower case
+	md      goldmark.Markdown
+	trusted map[string]bool // trusted authserv-ids, lower case
+
+	mu          sync.Mutex
+	threads     map[string]*emailThread // chatID -> thread
+	messageOf   map[string]string       // Message-ID -> chatID
+	uidValidity uint32
+	nextUID     uint32 // mail below this UID is not handled
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEmailChannel creates an email channel from cfg.
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("email imap_host and smtp_host are required")
+	}
+	address := cfg.Address
+	if address == "" {
+		address = cfg.Username
+	}
+	if !strings.Contains(address, "@") {
+		return nil, fmt.Errorf("email address is required when username is not an email address")
+	}
+	for _, security := range []string{cfg.IMAPSecurity, cfg.SMTPSecurity} {
+		switch security {
+		case "", "tls", "starttls", "none":
+		default:
+			return nil, fmt.Errorf("unknown email security %q (use tls, starttls or none)", security)
+		}
+	}
+	if len(cfg.TrustedAuthServIDs) == 0 {
+		return nil, fmt.Errorf("email trusted_authserv_ids is required: mail is only accepted when the receiving server's Authentication-Results show a DMARC or DKIM pass")
+	}
+	trusted := make(map[string]bool, len(cfg.TrustedAuthServIDs))
+	for _, id := range cfg.TrustedAuthServIDs {
+		trusted[strings.ToLower(strings.TrimSpace(id))] = true
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 60
+	}
+
+	allow := make([]string, len(cfg.AllowFrom))
+	for i, a := range cfg.AllowFrom {
+		allow[i] = strings.ToLower(strings.TrimSpace(a))
+	}
+
+	return &EmailChannel{
+		BaseChannel: NewBaseChannel("email", cfg, messageBus, allow),
+		config:      cfg,
+		address:     strings.ToLower(address),
+		md:          goldmark.New(goldmark.WithExtensions(extension.GFM)),
+		trusted:     trusted,
+		threads:     make(map[string]*emailThread),
+		messageOf:   make(map[string]string),
+	}, nil
+}
+
+// Start begins watching the mailbox.
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoC("email", "Starting Email channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.receiveLoop(c.ctx)
+	}()
+
+	c.setRunning(true)
+	logger.InfoC("email", "Email channel started")
+	return nil
+}
+
+// Stop closes the IMAP connection and waits for the receiver to exit.
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping Email channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+
+	c.setRunning(false)
+	logger.InfoC("email", "Email channel stopped")
+	return nil
+}
+
+// receiveLoop keeps a connection to the mailbox, reconnecting after errors.
+func (c *EmailChannel) receiveLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := c.watchMailbox(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.WarnCF("email", "IMAP connection lost, reconnecting", map[string]interface{}{
+			"error": fmt.Sprint(err),
+			"delay": emailReconnectDelay.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(emailReconnectDelay):
+		}
+	}
+}
+
+// watchMailbox fetches unseen mail, then waits in IDLE until the server
+// reports new mail or the poll interval passes, and repeats. Servers without
+// IDLE are polled.
+func (c *EmailChannel) watchMailbox(ctx context.Context) error {
+	cl, err := c.dialIMAP()
+	if err != nil {
+		return err
+	}
+
+	updates := make(chan client.Update, 16)
+	wake := make(chan struct{}, 1)
+	cl.Updates = updates
+	go func() {
+		for u := range updates {
+			if _, ok := u.(*client.MailboxUpdate); ok {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	finished := make(chan struct{})
+	defer func() {
+		close(finished)
+		cl.Logout()
+		<-cl.LoggedOut()
+		close(updates)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cl.Terminate()
+		case <-finished:
+		}
+	}()
+
+	if err := cl.Login(c.config.Username, c.config.Password); err != nil {
+		return fmt.Errorf("IMAP login: %w", err)
+	}
+	mbox, err := cl.Select(c.config.Mailbox, false)
+	if err != nil {
+		return fmt.Errorf("selecting %s: %w", c.config.Mailbox, err)
+	}
+	c.setBaseline(mbox)
+	logger.InfoCF("email", "Watching mailbox", map[string]interface{}{
+		"mailbox": c.config.Mailbox,
+	})
+
+	poll := time.Duration(c.config.PollInterval) * time.Second
+	for {
+		more, err := c.fetchUnseen(cl)
+		if err != nil {
+			return err
+		}
+		if more {
+			continue
+		}
+
+		stop := make(chan struct{})
+		idleDone := make(chan error, 1)
+		go func() {
+			idleDone <- cl.Idle(stop, &client.IdleOptions{PollInterval: poll})
+		}()
+		timer := time.NewTimer(poll)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-ctx.Done():
+		case err := <-idleDone:
+			timer.Stop()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		timer.Stop()
+		close(stop)
+		if err := <-idleDone; err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (c *EmailChannel) dialIMAP() (*client.Client, error) {
+	addr := net.JoinHostPort(c.config.IMAPHost, strconv.Itoa(c.config.IMAPPort))
+	tlsConfig := &tls.Config{ServerName: c.config.IMAPHost}
+	switch c.config.IMAPSecurity {
+	case "none":
+		return client.Dial(addr)
+	case "starttls":
+		cl, err := client.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := cl.StartTLS(tlsConfig); err != nil {
+			cl.Logout()
+			return nil, fmt.Errorf("IMAP STARTTLS: %w", err)
+		}
+		return cl, nil
+	default:
+		return client.DialTLS(addr, tlsConfig)
+	}
+}
+
+// setBaseline starts handling mail at the mailbox's UIDNEXT on the first
+// connection, and again when the server reset the mailbox's UIDs: mail that
+// was already there is left alone instead of being answered all at once.
+func (c *EmailChannel) setBaseline(mbox *imap.MailboxStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nextUID != 0 && c.uidValidity == mbox.UidValidity {
+		return
+	}
+	c.uidValidity = mbox.UidValidity
+	c.nextUID = mbox.UidNext
+	if c.nextUID == 0 {
+		c.nextUID = 1
+	}
+	logger.InfoCF("email", "Handling mail from UIDNEXT on", map[string]interface{}{
+		"uid_validity": mbox.UidValidity,
+		"uid_next":     mbox.UidNext,
+	})
+}
+
+// fetchUnseen handles the oldest unseen messages since the baseline, at most
+// emailMaxFetch of them, and marks them seen. more reports that others are
+// waiting.
+func (c *EmailChannel) fetchUnseen(cl *client.Client) (more bool, err error) {
+	c.mu.Lock()
+	next := c.nextUID
+	c.mu.Unlock()
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(next, 0)
+	found, err := cl.UidSearch(criteria)
+	if err != nil {
+		return false, fmt.Errorf("searching unseen mail: %w", err)
+	}
+	// "n:*" always includes the newest message, even below n.
+	var uids []uint32
+	for _, uid := range found {
+		if uid >= next {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return false, nil
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	if len(uids) > emailMaxFetch {
+		uids, more = uids[:emailMaxFetch], true
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var raws [][]byte
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			continue
+		}
+		raws = append(raws, data)
+	}
+	if err := <-done; err != nil {
+		return false, fmt.Errorf("fetching mail: %w", err)
+	}
+
+	// Mark before handling: a message that makes the handler fail must not
+	// be delivered again on every poll.
+	if err := cl.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+		return false, fmt.Errorf("marking mail seen: %w", err)
+	}
+	c.mu.Lock()
+	if last := uids[len(uids)-1] + 1; last > c.nextUID {
+		c.nextUID = last
+	}
+	c.mu.Unlock()
+	for _, raw := range raws {
+		if err := c.handleMail(raw); err != nil {
+			logger.WarnCF("email", "Failed to parse mail", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	return more, nil
+}
+
+// handleMail parses one raw message and publishes it on the bus.
+func (c *EmailChannel) handleMail(raw []byte) error {
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	defer mr.Close()
+	h := mr.Header
+
+	from, err := h.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return fmt.Errorf("missing From address")
+	}
+	senderID := strings.ToLower(from[0].Address)
+	if senderID == c.address || isAutomatedMail(h) {
+		logger.DebugCF("email", "Ignoring own or automated mail", map[string]interface{}{
+			"from": senderID,
+		})
+		return nil
+	}
+	// From is only the sender's claim; a trusted server must have checked it.
+	if !c.authenticated(h, senderID) {
+		logger.WarnCF("email", "Ignoring mail whose sender is not authenticated", map[string]interface{}{
+			"from": senderID,
+		})
+		return nil
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("email", "Mail from sender not in allow list", map[string]interface{}{
+			"from": senderID,
+		})
+		return nil
+	}
+
+	subject, _ := h.Subject()
+	messageID, _ := h.MessageID()
+	inReplyTo, _ := h.MsgIDList("In-Reply-To")
+	references, _ := h.MsgIDList("References")
+	if messageID == "" {
+		messageID = uuid.New().String() + "@picoclaw.invalid"
+	}
+
+	text, htmlBody, media := c.readParts(mr)
+	if text == "" && htmlBody != "" {
+		text = htmlToText(htmlBody)
+	}
+	text = stripQuotedReply(text)
+
+	// Replies go to the authenticated From only, never to Reply-To.
+	chatID := c.recordIncoming(messageID, inReplyTo, references, subject, senderID)
+
+	content := text
+	if len(references) == 0 && len(inReplyTo) == 0 && subject != "" {
+		content = "Subject: " + subject + "\n\n" + text
+	}
+	if strings.TrimSpace(content) == "" && len(media) == 0 {
+		return nil
+	}
+
+	metadata := map[string]string{
+		"platform":   "email",
+		"message_id": messageID,
+		"subject":    subject,
+		"from":       senderID,
+	}
+
+	logger.InfoCF("email", "Received mail", map[string]interface{}{
+		"from":    senderID,
+		"chat_id": chatID,
+		"media":   len(media),
+	})
+
+	c.HandleMessage(senderID, chatID, content, media, metadata)
+	c.cleanupTempFilesLater(media)
+	return nil
+}
+
+// readParts returns the plain text and HTML bodies of the message and saves
+// its attachments to temporary files.
+func (c *EmailChannel) readParts(mr *mail.Reader) (text, htmlBody string, media []string) {
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if err != io.EOF {
+				logger.DebugCF("email", "Stopped reading mail parts", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return
+		}
+		switch ph := p.Header.(type) {
+		case *mail.InlineHeader:
+			contentType, _, _ := ph.ContentType()
+			body, err := io.ReadAll(io.LimitReader(p.Body, bus.MaxAttachmentBytes))
+			if err != nil {
+				continue
+			}
+			switch {
+			case contentType == "text/plain" && text == "":
+				text = string(body)
+			case contentType == "text/html" && htmlBody == "":
+				htmlBody = string(body)
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := ph.Filename()
+			if filename == "" {
+				filename = "attachment"
+			}
+			if path := saveInboundMedia("email", filename, p.Body); path != "" {
+				media = append(media, path)
+			}
+		}
+	}
+}
+
+func (c *EmailChannel) cleanupTempFilesLater(files []string) {
+	if len(files) == 0 {
+		return
+	}
+	go func() {
+		timer := time.NewTimer(emailTempFileRetention)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+		}
+		for _, file := range files {
+			_ = os.Remove(file)
+		}
+	}()
+}
+
+// recordIncoming files the message from sender under its thread and returns
+// the chat ID. A thread is named after its first Message-ID (the first
+// References entry); replies that only carry In-Reply-To are matched through
+// the IDs seen so far.
+func (c *EmailChannel) recordIncoming(messageID string, inReplyTo, references []string, subject, sender string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	chatID := ""
+	for _, id := range append(append([]string(nil), references...), inReplyTo...) {
+		if known, ok := c.messageOf[id]; ok {
+			chatID = known
+			break
+		}
+	}
+	if chatID == "" {
+		root := messageID
+		if len(references) > 0 {
+			root = references[0]
+		} else if len(inReplyTo) > 0 {
+			root = inReplyTo[0]
+		}
+		chatID = emailChatID(sender, root)
+	}
+
+	t, ok := c.threads[chatID]
+	if !ok {
+		t = &emailThread{subject: subject, references: references}
+		c.threads[chatID] = t
+	}
+	if t.subject == "" {
+		t.subject = subject
+	}
+	t.recipient = sender
+	t.references = appendMessageID(t.references, messageID)
+	t.updated = time.Now()
+	c.messageOf[messageID] = chatID
+	c.pruneThreads()
+	return chatID
+}
+
+// pruneThreads forgets the least recently used threads beyond
+// emailMaxThreads. Replies in a forgotten thread still reach their session
+// through the References header.
+func (c *EmailChannel) pruneThreads() {
+	for len(c.threads) > emailMaxThreads {
+		oldest := ""
+		for id, t := range c.threads {
+			if oldest == "" || t.updated.Before(c.threads[oldest].updated) {
+				oldest = id
+			}
+		}
+		delete(c.threads, oldest)
+		for msgID, chatID := range c.messageOf {
+			if chatID == oldest {
+				delete(c.messageOf, msgID)
+			}
+		}
+	}
+}
+
+// emailChatID names the thread started by rootMessageID with address:
+// "<address>#<hash>".
+func emailChatID(address, rootMessageID string) string {
+	sum := sha256.Sum256([]byte(rootMessageID))
+	return address + "#" + hex.EncodeToString(sum[:8])
+}
+
+// emailChatAddress returns the correspondent's address of a chat ID, which
+// is either a bare address or made by emailChatID.
+func emailChatAddress(chatID string) string {
+	if i := strings.LastIndex(chatID, "#"); i >= 0 {
+		chatID = chatID[:i]
+	}
+	if !strings.Contains(chatID, "@") {
+		return ""
+	}
+	return chatID
+}
+
+func appendMessageID(ids []string, id string) []string {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// Send replies in the thread of msg.ChatID. A chat ID that is an email
+// address starts a new thread with that recipient; a thread not known (any
+// more, e.g. after a restart) gets a new mail to its correspondent.
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+
+	c.mu.Lock()
+	var t emailThread
+	if known, ok := c.threads[msg.ChatID]; ok {
+		t = *known
+		t.references = append([]string(nil), known.references...)
+	} else if address := emailChatAddress(msg.ChatID); address != "" {
+		t = emailThread{recipient: address, subject: msg.Metadata["subject"]}
+	} else {
+		c.mu.Unlock()
+		return fmt.Errorf("unknown email thread %q", msg.ChatID)
+	}
+	c.mu.Unlock()
+
+	data, messageID, err := c.buildReply(t, msg)
+	if err != nil {
+		return err
+	}
+	if err := c.sendMail(ctx, t.recipient, data); err != nil {
+		return err
+	}
+
+	chatID := msg.ChatID
+	if chatID == t.recipient {
+		chatID = emailChatID(t.recipient, messageID)
+	}
+	c.mu.Lock()
+	known, ok := c.threads[chatID]
+	if !ok {
+		known = &emailThread{subject: t.subject, recipient: t.recipient}
+		c.threads[chatID] = known
+	}
+	known.references = appendMessageID(known.references, messageID)
+	known.updated = time.Now()
+	c.messageOf[messageID] = chatID
+	c.pruneThreads()
+	c.mu.Unlock()
+
+	logger.DebugCF("email", "Mail sent", map[string]interface{}{
+		"to":      t.recipient,
+		"chat_id": chatID,
+	})
+	return nil
+}
+
+// SendsAttachments reports that Send attaches files to the mail.
+func (c *EmailChannel) SendsAttachments() bool { return true }
+
+// buildReply renders msg as a multipart mail with a plain text (Markdown)
+// and an HTML body, threaded under t.
+func (c *EmailChannel) buildReply(t emailThread, msg bus.OutboundMessage) ([]byte, string, error) {
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Address: c.address}})
+	h.SetAddressList("To", []*mail.Address{{Address: t.recipient}})
+	h.SetSubject(replySubject(t.subject))
+	_, domain, _ := strings.Cut(c.address, "@")
+	if err := h.GenerateMessageIDWithHostname(domain); err != nil {
+		return nil, "", err
+	}
+	messageID, _ := h.MessageID()
+	if len(t.references) > 0 {
+		h.SetMsgIDList("In-Reply-To", t.references[len(t.references)-1:])
+		h.SetMsgIDList("References", t.references)
+	}
+	h.Set("Auto-Submitted", "auto-replied")
+
+	text := msg.Content
+	var attachments []bus.Attachment
+	var unreadable []bus.Attachment
+	var contents [][]byte
+	for _, a := range msg.Attachments {
+		data, err := a.Bytes()
+		if err != nil {
+			logger.WarnCF("email", "Attachment upload failed, sending a link instead", map[string]interface{}{
+				"filename": a.Name(),
+				"error":    err.Error(),
+			})
+			unreadable = append(unreadable, a)
+			continue
+		}
+		attachments = append(attachments, a)
+		contents = append(contents, data)
+	}
+	if len(unreadable) > 0 {
+		text = bus.WithAttachmentLinks(text, unreadable)
+	}
+
+	var htmlBody bytes.Buffer
+	if err := c.md.Convert([]byte(text), &htmlBody); err != nil {
+		return nil, "", fmt.Errorf("rendering mail: %w", err)
+	}
+
+	var buf bytes.Buffer
+	mw, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, "", err
+	}
+	alt, err := mw.CreateInline()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", text},
+		{"text/html", "<!DOCTYPE html>\n<html><body>\n" + htmlBody.String() + "</body></html>\n"},
+	} {
+		var ph mail.InlineHeader
+		ph.SetContentType(part.contentType, map[string]string{"charset": "utf-8"})
+		w, err := alt.CreatePart(ph)
+		if err != nil {
+			return nil, "", err
+		}
+		io.WriteString(w, part.body)
+		w.Close()
+	}
+	alt.Close()
+
+	for i, a := range attachments {
+		var ah mail.AttachmentHeader
+		ah.SetContentType(a.ContentType(contents[i]), nil)
+		ah.SetFilename(a.Name())
+		if a.Caption != "" {
+			ah.Set("Content-Description", mime.QEncoding.Encode("utf-8", a.Caption))
+		}
+		w, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return nil, "", err
+		}
+		w.Write(contents[i])
+		w.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), messageID, nil
+}
+
+func replySubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "Message from picoclaw"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+// sendMail delivers data to the recipient through the configured SMTP
+// server.
+func (c *EmailChannel) sendMail(ctx context.Context, to string, data []byte) error {
+	addr := net.JoinHostPort(c.config.SMTPHost, strconv.Itoa(c.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: c.config.SMTPHost}
+
+	var sc *smtp.Client
+	var err error
+	if c.config.SMTPSecurity == "tls" {
+		sc, err = smtp.DialTLS(addr, tlsConfig)
+	} else {
+		sc, err = smtp.Dial(addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to SMTP server: %w", err)
+	}
+	defer sc.Close()
+
+	// The SMTP client has no context support: closing the connection aborts
+	// a send that outlives ctx.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			sc.Close()
+		case <-done:
+		}
+	}()
+
+	if c.config.SMTPSecurity == "starttls" || c.config.SMTPSecurity == "" {
+		if err := sc.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS: %w", err)
+		}
+	}
+	if c.config.Username != "" {
+		if err := sc.Auth(sasl.NewPlainClient("", c.config.Username, c.config.Password)); err != nil {
+			return fmt.Errorf("SMTP auth: %w", err)
+		}
+	}
+	if err := sc.Mail(c.address, nil); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM: %w", err)
+	}
+	if err := sc.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO: %w", err)
+	}
+	w, err := sc.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("writing mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return sc.Quit()
+}
+
+// authResult is one method's result in an Authentication-Results header.
+type authResult struct {
+	method, result string
+	props          map[string]string // e.g. "header.d" -> "example.com"
+}
+
+var reAuthComment = regexp.MustCompile(`\([^()]*\)`)
+
+// parseAuthResults splits an Authentication-Results header (RFC 8601) into
+// its authserv-id and results.
+func parseAuthResults(v string) (string, []authResult) {
+	v = reAuthComment.ReplaceAllString(strings.Join(strings.Fields(v), " "), " ")
+	parts := strings.Split(v, ";")
+	fields := strings.Fields(parts[0])
+	if len(fields) == 0 {
+		return "", nil
+	}
+	var results []authResult
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		method, _, _ = strings.Cut(method, "/")
+		r := authResult{method: strings.ToLower(method), result: strings.ToLower(result), props: make(map[string]string)}
+		for _, f := range fields[1:] {
+			if k, val, ok := strings.Cut(f, "="); ok {
+				r.props[strings.ToLower(k)] = strings.Trim(val, `"`)
+			}
+		}
+		results = append(results, r)
+	}
+	return strings.ToLower(fields[0]), results
+}
+
+// authenticated reports whether the topmost Authentication-Results header of
+// a trusted authserv-id (the one the receiving server added) shows a DMARC
+// pass for from's domain, or a DKIM signature passing for that domain or a
+// parent of it. The trusted server must remove such headers claiming its id
+// from incoming mail, as RFC 8601 requires.
+func (c *EmailChannel) authenticated(h mail.Header, from string) bool {
+	_, domain, _ := strings.Cut(from, "@")
+	for _, v := range h.Values("Authentication-Results") {
+		id, results := parseAuthResults(v)
+		if !c.trusted[id] {
+			continue
+		}
+		for _, r := range results {
+			if r.result != "pass" {
+				continue
+			}
+			switch r.method {
+			case "dmarc":
+				if d := r.props["header.from"]; d == "" || strings.EqualFold(d, domain) {
+					return true
+				}
+			case "dkim":
+				d := r.props["header.d"]
+				if d == "" {
+					_, d, _ = strings.Cut(r.props["header.i"], "@")
+				}
+				if alignedDomain(domain, d) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// alignedDomain reports whether domain is signer or below it (relaxed
+// alignment).
+func alignedDomain(domain, signer string) bool {
+	domain, signer = strings.ToLower(domain), strings.ToLower(signer)
+	return signer != "" && (domain == signer || strings.HasSuffix(domain, "."+signer))
+}
+
+// isAutomatedMail reports auto-replies, bounces and list mail, which must
+// not be answered to avoid mail loops.
+func isAutomatedMail(h mail.Header) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "list", "junk", "auto_reply":
+		return true
+	}
+	return h.Get("List-Id") != "" || h.Get("X-Autoreply") != ""
+}
+
+var (
+	reQuoteHeader = regexp.MustCompile(`^(On .+ wrote:|.+ (?:wrote|schrieb|a écrit)\s*:|\d{4}年.+(?:書きました|wrote)[:：]?)\s*$`)
+	reHTMLBreak   = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>|</h[1-6]>`)
+	reHTMLTag     = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]+>`)
+	reBlankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripQuotedReply drops the quoted previous mail ("> ..." lines and the
+// "On ... wrote:" line introducing them) that clients append to replies;
+// the session already holds that history.
+func stripQuotedReply(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		if reQuoteHeader.MatchString(trimmed) && quotedFollows(lines[i+1:]) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func quotedFollows(lines []string) bool {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		return strings.HasPrefix(trimmed, ">")
+	}
+	return false
+}
+
+// htmlToText is a rough conversion for mail without a plain text part.
+func htmlToText(s string) string {
+	s = reHTMLBreak.ReplaceAllString(s, "\n")
+	s = reHTMLTag.ReplaceAllString(s, "")
+	for _, r := range [][2]string{{"&nbsp;", " "}, {"&lt;", "<"}, {"&gt;", ">"}, {"&quot;", `"`}, {"&#39;", "'"}, {"&amp;", "&"}} {
+		s = strings.ReplaceAll(s, r[0], r[1])
+	}
+	return strings.TrimSpace(reBlankLines.ReplaceAllString(s, "\n\n"))
+}
@@ -3,9 +3,12 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -97,7 +100,29 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("chat ID is empty")
 	}
 
-	payload, err := json.Marshal(map[string]string{"text": msg.Content})
+	if msg.Content != "" || len(msg.Attachments) == 0 {
+		if err := c.sendMessage(ctx, msg.ChatID, larkim.MsgTypeText, map[string]string{"text": msg.Content}); err != nil {
+			return err
+		}
+	}
+
+	return sendAttachments("feishu", msg.Attachments, func(a bus.Attachment, data []byte) error {
+		if a.Caption != "" {
+			if err := c.sendMessage(ctx, msg.ChatID, larkim.MsgTypeText, map[string]string{"text": a.Caption}); err != nil {
+				return err
+			}
+		}
+		return c.sendAttachment(ctx, msg.ChatID, a, data)
+	}, func(text string) error {
+		return c.sendMessage(ctx, msg.ChatID, larkim.MsgTypeText, map[string]string{"text": text})
+	})
+}
+
+// SendsAttachments reports that Send uploads attachments as images or files.
+func (c *FeishuChannel) SendsAttachments() bool { return true }
+
+func (c *FeishuChannel) sendMessage(ctx context.Context, chatID, msgType string, content interface{}) error {
+	payload, err := json.Marshal(content)
 	if err != nil {
 		return fmt.Errorf("failed to marshal feishu content: %w", err)
 	}
@@ -105,8 +130,8 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	req := larkim.NewCreateMessageReqBuilder().
 		ReceiveIdType(larkim.ReceiveIdTypeChatId).
 		Body(larkim.NewCreateMessageReqBodyBuilder().
-			ReceiveId(msg.ChatID).
-			MsgType(larkim.MsgTypeText).
+			ReceiveId(chatID).
+			MsgType(msgType).
 			Content(string(payload)).
 			Uuid(fmt.Sprintf("picoclaw-%d", time.Now().UnixNano())).
 			Build()).
@@ -122,12 +147,67 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	}
 
 	logger.DebugCF("feishu", "Feishu message sent", map[string]interface{}{
-		"chat_id": msg.ChatID,
+		"chat_id":  chatID,
+		"msg_type": msgType,
 	})
 
 	return nil
 }
 
+// sendAttachment uploads an image or file and sends it as a message.
+func (c *FeishuChannel) sendAttachment(ctx context.Context, chatID string, a bus.Attachment, data []byte) error {
+	if a.Kind(data) == bus.AttachmentImage {
+		resp, err := c.client.Im.V1.Image.Create(ctx, larkim.NewCreateImageReqBuilder().
+			Body(larkim.NewCreateImageReqBodyBuilder().
+				ImageType(larkim.ImageTypeMessage).
+				Image(bytes.NewReader(data)).
+				Build()).
+			Build())
+		if err != nil {
+			return fmt.Errorf("failed to upload feishu image: %w", err)
+		}
+		if !resp.Success() || resp.Data == nil {
+			return fmt.Errorf("feishu image upload error: code=%d msg=%s", resp.Code, resp.Msg)
+		}
+		return c.sendMessage(ctx, chatID, larkim.MsgTypeImage, map[string]string{"image_key": stringValue(resp.Data.ImageKey)})
+	}
+
+	resp, err := c.client.Im.V1.File.Create(ctx, larkim.NewCreateFileReqBuilder().
+		Body(larkim.NewCreateFileReqBodyBuilder().
+			FileType(feishuFileType(a.Name())).
+			FileName(a.Name()).
+			File(bytes.NewReader(data)).
+			Build()).
+		Build())
+	if err != nil {
+		return fmt.Errorf("failed to upload feishu file: %w", err)
+	}
+	if !resp.Success() || resp.Data == nil {
+		return fmt.Errorf("feishu file upload error: code=%d msg=%s", resp.Code, resp.Msg)
+	}
+	return c.sendMessage(ctx, chatID, larkim.MsgTypeFile, map[string]string{"file_key": stringValue(resp.Data.FileKey)})
+}
+
+// feishuFileType maps a file name to the upload type Feishu expects.
+func feishuFileType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return larkim.FileTypePdf
+	case ".doc", ".docx":
+		return larkim.FileTypeDoc
+	case ".xls", ".xlsx":
+		return larkim.FileTypeXls
+	case ".ppt", ".pptx":
+		return larkim.FileTypePpt
+	case ".mp4":
+		return larkim.FileTypeMp4
+	case ".opus":
+		return larkim.FileTypeOpus
+	default:
+		return larkim.FileTypeStream
+	}
+}
+
 func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2MessageReceiveV1) error {
 	if event == nil || event.Event == nil || event.Event.Message == nil {
 		return nil
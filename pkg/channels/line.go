@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -51,12 +55,28 @@ type LINEChannel struct {
 	replyTokens    sync.Map // chatID -> replyTokenEntry
 	quoteTokens    sync.Map // chatID -> quoteToken (string)
 	originQuotes   sync.Map // "chatID|messageID" -> replyTokenEntry
+	media          sync.Map // token -> lineMedia
 	ctx            context.Context
 	cancel         context.CancelFunc
 }
 
 const lineTempFileRetention = 15 * time.Minute
 
+// Attachments are served to LINE from the webhook server under
+// lineMediaPath for lineMediaRetention.
+const (
+	lineMediaPath      = "/media/line/"
+	lineMediaRetention = time.Hour
+	// linePushMaxMessages is the most messages one push request may carry.
+	linePushMaxMessages = 5
+)
+
+type lineMedia struct {
+	data        []byte
+	contentType string
+	expires     time.Time
+}
+
 // NewLINEChannel creates a new LINE channel instance.
 func NewLINEChannel(cfg config.LINEConfig, messageBus *bus.MessageBus) (*LINEChannel, error) {
 	if cfg.ChannelSecret == "" || cfg.ChannelAccessToken == "" {
@@ -96,6 +116,7 @@ func (c *LINEChannel) Start(ctx context.Context) error {
 		path = "/webhook/line"
 	}
 	mux.HandleFunc(path, c.webhookHandler)
+	mux.HandleFunc(lineMediaPath, c.mediaHandler)
 
 	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
 	c.httpServer = &http.Server{
@@ -542,7 +563,107 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	c.quoteTokens.Delete(msg.ChatID)
 	c.replyTokens.Delete(msg.ChatID)
 
-	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
+	if msg.Content != "" || len(msg.Attachments) == 0 {
+		if err := c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken); err != nil {
+			return err
+		}
+	}
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+	return c.sendAttachments(ctx, msg.ChatID, msg.Attachments)
+}
+
+// SendsAttachments reports whether attachments can be sent: LINE fetches
+// them from the webhook server, which needs a public URL.
+func (c *LINEChannel) SendsAttachments() bool {
+	return c.config.PublicURL != ""
+}
+
+// sendAttachments serves each attachment from the webhook server and pushes
+// JPEG and PNG images as image messages, everything else as a link.
+func (c *LINEChannel) sendAttachments(ctx context.Context, to string, attachments []bus.Attachment) error {
+	var messages []map[string]string
+	for _, a := range attachments {
+		data, err := a.Bytes()
+		if err != nil {
+			logger.WarnCF("line", "Attachment upload failed, sending a link instead", map[string]interface{}{
+				"filename": a.Name(),
+				"error":    err.Error(),
+			})
+			messages = append(messages, buildTextMessage(a.LinkText(), ""))
+			continue
+		}
+		a.URL = c.hostMedia(a, data)
+		switch a.ContentType(data) {
+		case "image/jpeg", "image/png":
+			if a.Caption != "" {
+				messages = append(messages, buildTextMessage(a.Caption, ""))
+			}
+			messages = append(messages, map[string]string{
+				"type":               "image",
+				"originalContentUrl": a.URL,
+				"previewImageUrl":    a.URL,
+			})
+		default:
+			messages = append(messages, buildTextMessage(a.LinkText(), ""))
+		}
+	}
+
+	for len(messages) > 0 {
+		n := min(len(messages), linePushMaxMessages)
+		payload := map[string]interface{}{
+			"to":       to,
+			"messages": messages[:n],
+		}
+		if err := c.callAPI(ctx, linePushEndpoint, payload); err != nil {
+			return err
+		}
+		messages = messages[n:]
+	}
+	return nil
+}
+
+// hostMedia makes data downloadable from the webhook server for
+// lineMediaRetention and returns its public URL.
+func (c *LINEChannel) hostMedia(a bus.Attachment, data []byte) string {
+	now := time.Now()
+	c.media.Range(func(key, value interface{}) bool {
+		if now.After(value.(lineMedia).expires) {
+			c.media.Delete(key)
+		}
+		return true
+	})
+
+	var raw [16]byte
+	rand.Read(raw[:])
+	token := hex.EncodeToString(raw[:])
+	c.media.Store(token, lineMedia{
+		data:        data,
+		contentType: a.ContentType(data),
+		expires:     now.Add(lineMediaRetention),
+	})
+	return strings.TrimRight(c.config.PublicURL, "/") + lineMediaPath + token + "/" + url.PathEscape(a.Name())
+}
+
+// mediaHandler serves attachments stored by hostMedia. The unguessable
+// token in the path is the only credential.
+func (c *LINEChannel) mediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, lineMediaPath), "/")
+	value, ok := c.media.Load(token)
+	if !ok || time.Now().After(value.(lineMedia).expires) {
+		http.NotFound(w, r)
+		return
+	}
+	m := value.(lineMedia)
+	w.Header().Set("Content-Type", m.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(m.data)
 }
 
 func (c *LINEChannel) originQuoteKey(chatID, messageID string) string {
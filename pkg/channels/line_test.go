@@ -0,0 +1,49 @@
+package channels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+func TestLINEChannel_HostMedia(t *testing.T) {
+	ch, err := NewLINEChannel(config.LINEConfig{
+		ChannelSecret:      "secret",
+		ChannelAccessToken: "token",
+		PublicURL:          "https://bot.example.com/",
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewLINEChannel failed: %v", err)
+	}
+	if !ch.SendsAttachments() {
+		t.Fatal("expected attachments to be supported with a public URL")
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	link := ch.hostMedia(bus.Attachment{Data: png, Filename: "chart 1.png"}, png)
+	if !strings.HasPrefix(link, "https://bot.example.com"+lineMediaPath) || !strings.HasSuffix(link, "/chart%201.png") {
+		t.Fatalf("unexpected media URL %q", link)
+	}
+
+	path := strings.TrimPrefix(link, "https://bot.example.com")
+	rec := httptest.NewRecorder()
+	ch.mediaHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(png) || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("GET %s: status=%d type=%q body=%q", path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ch.mediaHandler(rec, httptest.NewRequest(http.MethodGet, lineMediaPath+"0123456789abcdef/chart.png", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown token: status=%d, want 404", rec.Code)
+	}
+
+	ch.config.PublicURL = ""
+	if ch.SendsAttachments() {
+		t.Error("attachments should fall back to links without a public URL")
+	}
+}
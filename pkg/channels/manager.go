@@ -176,6 +176,45 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Email.Enabled && m.config.Channels.Email.IMAPHost != "" {
+		logger.DebugC("channels", "Attempting to initialize Email channel")
+		email, err := NewEmailChannel(m.config.Channels.Email, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Email channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["email"] = email
+			logger.InfoC("channels", "Email channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Matrix.Enabled && m.config.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		matrix, err := NewMatrixChannel(m.config.Channels.Matrix, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.API.Enabled && len(m.config.Channels.API.Tokens) > 0 {
+		logger.DebugC("channels", "Attempting to initialize API channel")
+		api, err := NewAPIChannel(m.config.Channels.API, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize API channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["api"] = api
+			logger.InfoC("channels", "API channel enabled successfully")
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -272,7 +311,21 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
+			if msg.Kind == bus.OutboundEdit || msg.Kind == bus.OutboundStreamAbort {
+				editor, ok := channel.(MessageEditor)
+				if !ok {
+					continue
+				}
+				if err := editor.Edit(ctx, msg); err != nil {
+					logger.DebugCF("channels", "Error editing message in channel", map[string]interface{}{
+						"channel": msg.Channel,
+						"error":   err.Error(),
+					})
+				}
+				continue
+			}
+
+			if err := channel.Send(ctx, withAttachmentLinks(channel, msg)); err != nil {
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
 					"channel": msg.Channel,
 					"error":   err.Error(),
@@ -0,0 +1,112 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+type recordingChannel struct {
+	*BaseChannel
+	mu    sync.Mutex
+	sent  []bus.OutboundMessage
+	edits []bus.OutboundMessage
+}
+
+func (c *recordingChannel) Start(ctx context.Context) error { return nil }
+func (c *recordingChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *recordingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *recordingChannel) counts() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent), len(c.edits)
+}
+
+type editingChannel struct {
+	*recordingChannel
+}
+
+func (c *editingChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.edits = append(c.edits, msg)
+	return nil
+}
+
+func TestManager_DispatchesEditsOnlyToEditors(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	m, err := NewManager(&config.Config{}, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	plain := &recordingChannel{BaseChannel: NewBaseChannel("line", nil, msgBus, nil)}
+	editor := &editingChannel{&recordingChannel{BaseChannel: NewBaseChannel("telegram", nil, msgBus, nil)}}
+	m.RegisterChannel("line", plain)
+	m.RegisterChannel("telegram", editor)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.dispatchOutbound(ctx)
+
+	for _, ch := range []string{"line", "telegram"} {
+		msgBus.PublishOutbound(bus.OutboundMessage{Channel: ch, ChatID: "1", Content: "par", Kind: bus.OutboundEdit})
+		msgBus.PublishOutbound(bus.OutboundMessage{Channel: ch, ChatID: "1", Content: "partial"})
+		msgBus.PublishOutbound(bus.OutboundMessage{Channel: ch, ChatID: "1", Kind: bus.OutboundStreamAbort})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		ps, _ := plain.counts()
+		es, _ := editor.counts()
+		if ps == 1 && es == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if sent, edits := plain.counts(); sent != 1 || edits != 0 {
+		t.Errorf("plain channel: sent=%d edits=%d, want 1/0", sent, edits)
+	}
+	if sent, edits := editor.counts(); sent != 1 || edits != 2 {
+		t.Errorf("editing channel: sent=%d edits=%d, want 1/2", sent, edits)
+	}
+}
+
+type uploadingChannel struct {
+	*recordingChannel
+}
+
+func (c *uploadingChannel) SendsAttachments() bool { return true }
+
+func TestWithAttachmentLinks(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	msg := bus.OutboundMessage{
+		Channel:     "qq",
+		ChatID:      "1",
+		Content:     "see file",
+		Attachments: []bus.Attachment{{Path: "/ws/report.pdf", URL: "https://example.com/r.pdf"}},
+	}
+
+	plain := &recordingChannel{BaseChannel: NewBaseChannel("qq", nil, msgBus, nil)}
+	got := withAttachmentLinks(plain, msg)
+	if len(got.Attachments) != 0 || got.Content != "see file\n📎 report.pdf: https://example.com/r.pdf" {
+		t.Errorf("plain channel got %+v", got)
+	}
+
+	uploader := &uploadingChannel{&recordingChannel{BaseChannel: NewBaseChannel("telegram", nil, msgBus, nil)}}
+	if got := withAttachmentLinks(uploader, msg); len(got.Attachments) != 1 || got.Content != "see file" {
+		t.Errorf("uploading channel got %+v", got)
+	}
+}
@@ -0,0 +1,746 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
+)
+
+const (
+	matrixSyncTimeout       = 30 * time.Second
+	matrixRetryDelay        = 5 * time.Second
+	matrixMaxRateLimitWait  = 10 * time.Second
+	matrixTempFileRetention = 15 * time.Minute
+	// matrixE2EUnsupported is the reason given when refusing or leaving an
+	// encrypted room.
+	matrixE2EUnsupported = "end-to-end encrypted rooms are not supported by this bot"
+)
+
+// MatrixChannel talks to a Matrix homeserver over the client-server API: it
+// long-polls /sync for invites and messages and sends replies as events.
+//
+// A room's ChatID is its room ID; messages in a thread get their own chat,
+// "<room ID>/<thread root event ID>", like Slack threads. There is no
+// end-to-end encryption: encrypted rooms are refused or left.
+type MatrixChannel struct {
+	*BaseChannel
+	config     config.MatrixConfig
+	homeserver string
+	client     *http.Client
+	md         goldmark.Markdown
+	userID     string
+
+	mu         sync.RWMutex
+	allowRooms map[string]bool // room IDs; nil allows every room
+
+	txnCounter atomic.Int64
+	replyTo    sync.Map // chatID -> event ID the reply answers
+	streaming  sync.Map // streamKey -> event ID of the reply being streamed
+	encrypted  sync.Map // room ID -> struct{}, encrypted rooms already left
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type matrixMessageContent struct {
+	MsgType    string          `json:"msgtype"`
+	Body       string          `json:"body"`
+	FileName   string          `json:"filename"`
+	URL        string          `json:"url"`
+	Membership string          `json:"membership"`
+	RelatesTo  *matrixRelation `json:"m.relates_to"`
+}
+
+type matrixRelation struct {
+	RelType       string          `json:"rel_type,omitempty"`
+	EventID       string          `json:"event_id,omitempty"`
+	IsFallingBack bool            `json:"is_falling_back,omitempty"`
+	InReplyTo     *matrixEventRef `json:"m.in_reply_to,omitempty"`
+}
+
+type matrixEventRef struct {
+	EventID string `json:"event_id"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// matrixError is the error body of the client-server API.
+type matrixError struct {
+	Status       int    `json:"-"`
+	ErrCode      string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("matrix API error (status %d): %s %s", e.Status, e.ErrCode, e.Message)
+}
+
+// NewMatrixChannel creates a Matrix channel from cfg.
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+	homeserver, err := url.Parse(strings.TrimRight(cfg.Homeserver, "/"))
+	if err != nil || (homeserver.Scheme != "http" && homeserver.Scheme != "https") || homeserver.Host == "" {
+		return nil, fmt.Errorf("invalid matrix homeserver URL %q", cfg.Homeserver)
+	}
+
+	c := &MatrixChannel{
+		BaseChannel: NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		homeserver:  homeserver.String(),
+		client:      &http.Client{Timeout: matrixSyncTimeout + 30*time.Second},
+		md:          goldmark.New(goldmark.WithExtensions(extension.GFM)),
+		userID:      cfg.UserID,
+	}
+	if len(cfg.AllowRooms) > 0 {
+		c.allowRooms = make(map[string]bool)
+		for _, room := range cfg.AllowRooms {
+			if strings.HasPrefix(room, "!") {
+				c.allowRooms[room] = true
+			}
+		}
+	}
+	return c, nil
+}
+
+// Start checks the access token, resolves room aliases and starts syncing.
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.call(c.ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, nil, &whoami); err != nil {
+		return fmt.Errorf("matrix login check failed: %w", err)
+	}
+	if c.userID != "" && c.userID != whoami.UserID {
+		logger.WarnCF("matrix", "Access token belongs to a different user than user_id", map[string]interface{}{
+			"user_id": c.userID,
+			"token":   whoami.UserID,
+		})
+	}
+	c.userID = whoami.UserID
+	c.resolveAllowedAliases()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.syncLoop(c.ctx)
+	}()
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]interface{}{
+		"user_id": c.userID,
+	})
+	return nil
+}
+
+// Stop ends the sync loop.
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+
+	c.setRunning(false)
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+func (c *MatrixChannel) resolveAllowedAliases() {
+	for _, room := range c.config.AllowRooms {
+		if !strings.HasPrefix(room, "#") {
+			continue
+		}
+		var resp struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := c.call(c.ctx, http.MethodGet, "/_matrix/client/v3/directory/room/"+url.PathEscape(room), nil, nil, &resp); err != nil {
+			logger.WarnCF("matrix", "Failed to resolve room alias", map[string]interface{}{
+				"alias": room,
+				"error": err.Error(),
+			})
+			continue
+		}
+		c.mu.Lock()
+		c.allowRooms[resp.RoomID] = true
+		c.mu.Unlock()
+	}
+}
+
+func (c *MatrixChannel) roomAllowed(roomID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.allowRooms == nil || c.allowRooms[roomID]
+}
+
+// syncLoop long-polls /sync. The first sync only catches up: invites are
+// handled, but messages sent while picoclaw was offline are not answered.
+func (c *MatrixChannel) syncLoop(ctx context.Context) {
+	since := ""
+	for ctx.Err() == nil {
+		timeout := matrixSyncTimeout
+		if since == "" {
+			timeout = 0
+		}
+		resp, err := c.sync(ctx, since, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]interface{}{
+				"error": err.Error(),
+				"delay": matrixRetryDelay.String(),
+			})
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(matrixRetryDelay):
+			}
+			continue
+		}
+
+		for roomID, room := range resp.Rooms.Invite {
+			c.handleInvite(ctx, roomID, room.InviteState.Events)
+		}
+		if since != "" {
+			for roomID, room := range resp.Rooms.Join {
+				for _, ev := range room.Timeline.Events {
+					c.handleEvent(roomID, ev)
+				}
+			}
+		}
+		since = resp.NextBatch
+	}
+}
+
+func (c *MatrixChannel) sync(ctx context.Context, since string, timeout time.Duration) (*matrixSyncResponse, error) {
+	query := url.Values{"timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)}}
+	if since != "" {
+		query.Set("since", since)
+	}
+	var resp matrixSyncResponse
+	if err := c.call(ctx, http.MethodGet, "/_matrix/client/v3/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// handleInvite joins rooms that an allowed user invited us to and rejects
+// the other invites, and those to encrypted rooms.
+func (c *MatrixChannel) handleInvite(ctx context.Context, roomID string, events []matrixEvent) {
+	inviter := ""
+	encrypted := false
+	for _, ev := range events {
+		if ev.Type == "m.room.encryption" {
+			encrypted = true
+		}
+		if ev.Type != "m.room.member" || ev.StateKey == nil || *ev.StateKey != c.userID {
+			continue
+		}
+		var content matrixMessageContent
+		if json.Unmarshal(ev.Content, &content) == nil && content.Membership == "invite" {
+			inviter = ev.Sender
+		}
+	}
+	if inviter == "" {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"room_id": roomID,
+		"inviter": inviter,
+	}
+	action := "/join/" + url.PathEscape(roomID)
+	payload := map[string]interface{}{}
+	if !c.IsAllowed(inviter) || !c.roomAllowed(roomID) {
+		action = "/rooms/" + url.PathEscape(roomID) + "/leave"
+	} else if encrypted {
+		action = "/rooms/" + url.PathEscape(roomID) + "/leave"
+		payload["reason"] = matrixE2EUnsupported
+	}
+	if err := c.call(ctx, http.MethodPost, "/_matrix/client/v3"+action, nil, payload, nil); err != nil {
+		fields["error"] = err.Error()
+		logger.WarnCF("matrix", "Failed to answer room invite", fields)
+		return
+	}
+	switch {
+	case strings.HasPrefix(action, "/join/"):
+		logger.InfoCF("matrix", "Joined room", fields)
+	case encrypted:
+		logger.ErrorCF("matrix", "Rejected invite to an encrypted room: end-to-end encryption is not supported, invite the bot to an unencrypted room", fields)
+	default:
+		logger.InfoCF("matrix", "Rejected room invite", fields)
+	}
+}
+
+// leaveEncryptedRoom leaves a joined room that turned out to be encrypted:
+// its messages cannot be read, and replies would go out unencrypted.
+func (c *MatrixChannel) leaveEncryptedRoom(roomID string) {
+	if _, left := c.encrypted.LoadOrStore(roomID, struct{}{}); left {
+		return
+	}
+	fields := map[string]interface{}{"room_id": roomID}
+	err := c.call(c.ctx, http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/leave", nil,
+		map[string]interface{}{"reason": matrixE2EUnsupported}, nil)
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	logger.ErrorCF("matrix", "Leaving encrypted room: end-to-end encryption is not supported, invite the bot to an unencrypted room", fields)
+}
+
+// handleEvent publishes a room message on the bus.
+func (c *MatrixChannel) handleEvent(roomID string, ev matrixEvent) {
+	if ev.Sender == c.userID || !c.roomAllowed(roomID) {
+		return
+	}
+	if ev.Type == "m.room.encryption" || ev.Type == "m.room.encrypted" {
+		c.leaveEncryptedRoom(roomID)
+		return
+	}
+	if ev.Type != "m.room.message" {
+		return
+	}
+
+	var content matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return
+	}
+	// Edits repeat a message that was already handled; notices come from
+	// other bots.
+	if content.RelatesTo != nil && content.RelatesTo.RelType == "m.replace" {
+		return
+	}
+	if content.MsgType == "m.notice" {
+		return
+	}
+
+	if !c.IsAllowed(ev.Sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]interface{}{
+			"sender": ev.Sender,
+		})
+		return
+	}
+
+	chatID := roomID
+	if content.RelatesTo != nil && content.RelatesTo.RelType == "m.thread" && content.RelatesTo.EventID != "" {
+		chatID = roomID + "/" + content.RelatesTo.EventID
+	}
+
+	var text string
+	var media []string
+	switch content.MsgType {
+	case "m.text", "m.emote":
+		text = stripMatrixReplyFallback(content.Body)
+	case "m.image", "m.file", "m.audio", "m.video":
+		name := content.FileName
+		caption := ""
+		if name == "" {
+			name = content.Body
+		} else if content.Body != name {
+			caption = content.Body
+		}
+		kind := strings.TrimPrefix(content.MsgType, "m.")
+		text = fmt.Sprintf("[%s: %s]", kind, name)
+		if caption != "" {
+			text = caption + "\n" + text
+		}
+		if path := c.downloadMedia(content.URL, name); path != "" {
+			media = append(media, path)
+		}
+	default:
+		return
+	}
+	if strings.TrimSpace(text) == "" && len(media) == 0 {
+		return
+	}
+
+	c.replyTo.Store(chatID, ev.EventID)
+
+	metadata := map[string]string{
+		"platform": "matrix",
+		"room_id":  roomID,
+		"event_id": ev.EventID,
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]interface{}{
+		"sender":  ev.Sender,
+		"chat_id": chatID,
+		"preview": utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage(ev.Sender, chatID, text, media, metadata)
+	c.cleanupTempFilesLater(media)
+}
+
+// stripMatrixReplyFallback removes the quoted "> <@user> ..." lines that
+// clients put in front of a reply's body.
+func stripMatrixReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
+
+// downloadMedia saves the content of an mxc:// URI to a temporary file.
+func (c *MatrixChannel) downloadMedia(mxc, filename string) string {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok || !strings.Contains(serverAndID, "/") {
+		return ""
+	}
+	// Authenticated media (Matrix 1.11) first, then the legacy endpoint of
+	// older homeservers.
+	for _, endpoint := range []string{"/_matrix/client/v1/media/download/", "/_matrix/media/v3/download/"} {
+		path, status := c.downloadTo(endpoint+serverAndID, filename)
+		if path != "" || (status != http.StatusNotFound && status != http.StatusBadRequest) {
+			return path
+		}
+	}
+	return ""
+}
+
+func (c *MatrixChannel) downloadTo(path, filename string) (string, int) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.homeserver+path, nil)
+	if err != nil {
+		return "", 0
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		logger.WarnCF("matrix", "Failed to download media", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return "", 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode
+	}
+
+	return saveInboundMedia("matrix", filename, resp.Body), resp.StatusCode
+}
+
+func (c *MatrixChannel) cleanupTempFilesLater(files []string) {
+	if len(files) == 0 {
+		return
+	}
+	go func() {
+		timer := time.NewTimer(matrixTempFileRetention)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+		}
+		for _, file := range files {
+			_ = os.Remove(file)
+		}
+	}()
+}
+
+// Send posts the reply in the message's room (and thread), as a reply to
+// the message being answered. A reply streamed with Edit is finalized in
+// place instead.
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+	roomID, threadRoot := parseMatrixChatID(msg.ChatID)
+	if roomID == "" {
+		return fmt.Errorf("invalid matrix chat ID: %s", msg.ChatID)
+	}
+	replyTo := ""
+	if v, ok := c.replyTo.LoadAndDelete(msg.ChatID); ok {
+		replyTo = v.(string)
+	}
+
+	sent := msg.Content == "" && len(msg.Attachments) > 0
+	if v, ok := c.streaming.LoadAndDelete(streamKey(msg)); ok {
+		_, err := c.sendEvent(ctx, roomID, c.replaceContent(v.(string), msg.Content))
+		sent = err == nil
+	}
+	if !sent {
+		content := withMatrixRelation(c.textContent(msg.Content), matrixRelationTo(threadRoot, replyTo))
+		if _, err := c.sendEvent(ctx, roomID, content); err != nil {
+			return fmt.Errorf("failed to send matrix message: %w", err)
+		}
+	}
+
+	err := sendAttachments("matrix", msg.Attachments, func(a bus.Attachment, data []byte) error {
+		contentType := a.ContentType(data)
+		uri, err := c.upload(ctx, a.Name(), contentType, data)
+		if err != nil {
+			return err
+		}
+		body := a.Name()
+		if a.Caption != "" {
+			body = a.Caption
+		}
+		content := withMatrixRelation(map[string]interface{}{
+			"msgtype":  "m." + string(a.Kind(data)),
+			"body":     body,
+			"filename": a.Name(),
+			"url":      uri,
+			"info": map[string]interface{}{
+				"mimetype": contentType,
+				"size":     len(data),
+			},
+		}, matrixRelationTo(threadRoot, ""))
+		_, err = c.sendEvent(ctx, roomID, content)
+		return err
+	}, func(text string) error {
+		content := withMatrixRelation(c.textContent(text), matrixRelationTo(threadRoot, ""))
+		_, err := c.sendEvent(ctx, roomID, content)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send matrix attachment links: %w", err)
+	}
+
+	logger.DebugCF("matrix", "Message sent", map[string]interface{}{
+		"room_id": roomID,
+	})
+	return nil
+}
+
+// SendsAttachments reports that Send uploads attachments to the homeserver.
+func (c *MatrixChannel) SendsAttachments() bool { return true }
+
+// Edit posts the partial reply on the first call and replaces it (an
+// m.replace edit) on later calls.
+func (c *MatrixChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	if msg.Kind == bus.OutboundStreamAbort {
+		c.streaming.Delete(streamKey(msg))
+		return nil
+	}
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+	roomID, threadRoot := parseMatrixChatID(msg.ChatID)
+	if roomID == "" {
+		return fmt.Errorf("invalid matrix chat ID: %s", msg.ChatID)
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	if v, ok := c.streaming.Load(streamKey(msg)); ok {
+		if _, err := c.sendEvent(ctx, roomID, c.replaceContent(v.(string), msg.Content)); err != nil {
+			c.streaming.Delete(streamKey(msg))
+			return fmt.Errorf("failed to edit matrix message: %w", err)
+		}
+		return nil
+	}
+
+	replyTo := ""
+	if v, ok := c.replyTo.Load(msg.ChatID); ok {
+		replyTo = v.(string)
+	}
+	content := withMatrixRelation(c.textContent(msg.Content), matrixRelationTo(threadRoot, replyTo))
+	eventID, err := c.sendEvent(ctx, roomID, content)
+	if err != nil {
+		return fmt.Errorf("failed to send matrix message: %w", err)
+	}
+	c.streaming.Store(streamKey(msg), eventID)
+	return nil
+}
+
+func parseMatrixChatID(chatID string) (roomID, threadRoot string) {
+	roomID, threadRoot, _ = strings.Cut(chatID, "/")
+	return roomID, threadRoot
+}
+
+// matrixRelationTo relates a reply to its thread, if any, and to the event
+// it answers.
+func matrixRelationTo(threadRoot, replyTo string) *matrixRelation {
+	rel := &matrixRelation{}
+	if threadRoot != "" {
+		rel.RelType = "m.thread"
+		rel.EventID = threadRoot
+		rel.IsFallingBack = replyTo == ""
+		if replyTo == "" {
+			replyTo = threadRoot
+		}
+	}
+	if replyTo == "" {
+		return nil
+	}
+	rel.InReplyTo = &matrixEventRef{EventID: replyTo}
+	return rel
+}
+
+func withMatrixRelation(content map[string]interface{}, rel *matrixRelation) map[string]interface{} {
+	if rel != nil {
+		content["m.relates_to"] = rel
+	}
+	return content
+}
+
+// textContent renders Markdown text as an m.text message with an HTML
+// formatted body.
+func (c *MatrixChannel) textContent(text string) map[string]interface{} {
+	content := map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    text,
+	}
+	var html bytes.Buffer
+	if err := c.md.Convert([]byte(text), &html); err == nil {
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = strings.TrimSpace(html.String())
+	}
+	return content
+}
+
+// replaceContent is an edit of eventID to text.
+func (c *MatrixChannel) replaceContent(eventID, text string) map[string]interface{} {
+	newContent := c.textContent(text)
+	content := c.textContent("* " + text)
+	content["m.new_content"] = newContent
+	return withMatrixRelation(content, &matrixRelation{RelType: "m.replace", EventID: eventID})
+}
+
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID string, content map[string]interface{}) (string, error) {
+	txnID := fmt.Sprintf("picoclaw%d.%d", time.Now().UnixNano(), c.txnCounter.Add(1))
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + txnID
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.call(ctx, http.MethodPut, path, nil, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// upload stores data in the homeserver's media repository and returns its
+// mxc:// URI.
+func (c *MatrixChannel) upload(ctx context.Context, filename, contentType string, data []byte) (string, error) {
+	endpoint := c.homeserver + "/_matrix/media/v3/upload?filename=" + url.QueryEscape(filename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	var resp struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := c.do(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ContentURI, nil
+}
+
+// call sends a JSON request to the client-server API and decodes the
+// response into out. A rate-limited request is retried once.
+func (c *MatrixChannel) call(ctx context.Context, method, path string, query url.Values, payload, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+	}
+	endpoint := c.homeserver + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		err = c.do(req, out)
+		apiErr, ok := err.(*matrixError)
+		if !ok || apiErr.Status != http.StatusTooManyRequests || attempt > 0 {
+			return err
+		}
+		wait := time.Duration(apiErr.RetryAfterMs) * time.Millisecond
+		if wait <= 0 || wait > matrixMaxRateLimitWait {
+			wait = matrixMaxRateLimitWait
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *MatrixChannel) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &matrixError{Status: resp.StatusCode}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(respBody, apiErr) != nil || apiErr.ErrCode == "" {
+			apiErr.Message = string(respBody)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
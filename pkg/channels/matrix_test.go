@@ -0,0 +1,329 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+// matrixStub is a homeserver serving canned /sync batches and recording
+// what the channel sends.
+type matrixStub struct {
+	t       *testing.T
+	batches []string // /sync responses, in order
+
+	mu      sync.Mutex
+	syncs   int
+	actions []string                 // "join <room>" / "leave <room>"
+	events  []map[string]interface{} // sent m.room.message contents
+	uploads []string
+}
+
+func (s *matrixStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/_matrix/client/v3/account/whoami":
+		io.WriteString(w, `{"user_id":"@bot:local"}`)
+	case path == "/_matrix/client/v3/sync":
+		if s.syncs >= len(s.batches) {
+			// Nothing new: hold the long poll briefly like a real server.
+			s.mu.Unlock()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+			s.mu.Lock()
+			fmt.Fprintf(w, `{"next_batch":"s%d"}`, s.syncs)
+			return
+		}
+		if s.syncs > 0 && r.URL.Query().Get("since") == "" {
+			s.t.Errorf("sync %d without since", s.syncs)
+		}
+		io.WriteString(w, s.batches[s.syncs])
+		s.syncs++
+	case strings.HasPrefix(path, "/_matrix/client/v3/join/"):
+		s.actions = append(s.actions, "join "+strings.TrimPrefix(path, "/_matrix/client/v3/join/"))
+		io.WriteString(w, `{}`)
+	case strings.HasPrefix(path, "/_matrix/client/v3/rooms/") && strings.HasSuffix(path, "/leave"):
+		room := strings.TrimSuffix(strings.TrimPrefix(path, "/_matrix/client/v3/rooms/"), "/leave")
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Reason != "" {
+			room += " (" + body.Reason + ")"
+		}
+		s.actions = append(s.actions, "leave "+room)
+		io.WriteString(w, `{}`)
+	case strings.HasPrefix(path, "/_matrix/client/v3/rooms/") && strings.Contains(path, "/send/m.room.message/"):
+		var content map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
+			s.t.Errorf("decoding sent event: %v", err)
+		}
+		s.events = append(s.events, content)
+		fmt.Fprintf(w, `{"event_id":"$sent%d"}`, len(s.events))
+	case path == "/_matrix/client/v1/media/download/local/img1":
+		// An older homeserver without authenticated media.
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"errcode":"M_UNRECOGNIZED","error":"unrecognized"}`)
+	case path == "/_matrix/media/v3/download/local/img1":
+		io.WriteString(w, "PNGDATA")
+	case path == "/_matrix/media/v3/upload":
+		data, _ := io.ReadAll(r.Body)
+		s.uploads = append(s.uploads, r.URL.Query().Get("filename")+"="+string(data))
+		io.WriteString(w, `{"content_uri":"mxc://local/up1"}`)
+	default:
+		s.t.Errorf("unexpected request %s %s", r.Method, path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *matrixStub) sent() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.events...)
+}
+
+const matrixInitialSync = `{
+  "next_batch": "s1",
+  "rooms": {
+    "invite": {
+      "!good:local": {"invite_state": {"events": [
+        {"type": "m.room.member", "sender": "@alice:local", "state_key": "@bot:local", "content": {"membership": "invite"}}
+      ]}},
+      "!bad:local": {"invite_state": {"events": [
+        {"type": "m.room.member", "sender": "@mallory:local", "state_key": "@bot:local", "content": {"membership": "invite"}}
+      ]}}
+    },
+    "join": {
+      "!good:local": {"timeline": {"events": [
+        {"type": "m.room.message", "event_id": "$old", "sender": "@alice:local", "content": {"msgtype": "m.text", "body": "sent while offline"}}
+      ]}}
+    }
+  }
+}`
+
+const matrixMessagesSync = `{
+  "next_batch": "s2",
+  "rooms": {
+    "join": {
+      "!good:local": {"timeline": {"events": [
+        {"type": "m.room.message", "event_id": "$e1", "sender": "@alice:local", "content": {"msgtype": "m.text", "body": "> <@bot:local> earlier answer\n\nhello"}},
+        {"type": "m.room.message", "event_id": "$own", "sender": "@bot:local", "content": {"msgtype": "m.text", "body": "own message"}},
+        {"type": "m.room.message", "event_id": "$m1", "sender": "@mallory:local", "content": {"msgtype": "m.text", "body": "let me in"}},
+        {"type": "m.room.message", "event_id": "$edit", "sender": "@alice:local", "content": {"msgtype": "m.text", "body": "* hello!", "m.relates_to": {"rel_type": "m.replace", "event_id": "$e1"}}},
+        {"type": "m.room.message", "event_id": "$e2", "sender": "@alice:local", "content": {"msgtype": "m.image", "body": "what is this?", "filename": "cat.png", "url": "mxc://local/img1"}},
+        {"type": "m.room.message", "event_id": "$e3", "sender": "@alice:local", "content": {"msgtype": "m.text", "body": "in a thread", "m.relates_to": {"rel_type": "m.thread", "event_id": "$e1"}}}
+      ]}}
+    }
+  }
+}`
+
+func TestMatrixChannel_SyncAndReply(t *testing.T) {
+	stub := &matrixStub{t: t, batches: []string{matrixInitialSync, matrixMessagesSync}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Homeserver:  srv.URL + "/",
+		AccessToken: "secret",
+		AllowFrom:   config.FlexibleStringSlice{"@alice:local"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel failed: %v", err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var inbound []bus.InboundMessage
+	for len(inbound) < 3 {
+		msg, ok := msgBus.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatalf("got %d inbound messages, want 3", len(inbound))
+		}
+		inbound = append(inbound, msg)
+	}
+
+	if in := inbound[0]; in.ChatID != "!good:local" || in.SenderID != "@alice:local" || in.Content != "hello" {
+		t.Errorf("first message = %+v", in)
+	}
+	if in := inbound[1]; in.Content != "what is this?\n[image: cat.png]" || len(in.Media) != 1 {
+		t.Errorf("image message = %+v", in)
+	} else if data, _ := os.ReadFile(in.Media[0]); string(data) != "PNGDATA" {
+		t.Errorf("downloaded media = %q", data)
+	}
+	if in := inbound[2]; in.ChatID != "!good:local/$e1" || in.SessionKey != "matrix:!good:local/$e1" {
+		t.Errorf("thread message = %+v", in)
+	}
+
+	stub.mu.Lock()
+	actions := strings.Join(stub.actions, ", ")
+	stub.mu.Unlock()
+	if !strings.Contains(actions, "join !good:local") || !strings.Contains(actions, "leave !bad:local") || strings.Count(actions, ",") != 1 {
+		t.Errorf("invite handling = %q, want join !good:local and leave !bad:local", actions)
+	}
+
+	// Stream a reply in the room, then finalize it.
+	for _, content := range []string{"Work", "Working..."} {
+		if err := ch.Edit(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!good:local", Content: content}); err != nil {
+			t.Fatalf("Edit failed: %v", err)
+		}
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!good:local", Content: "Done, **ok**"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	events := stub.sent()
+	if len(events) != 3 {
+		t.Fatalf("sent %d events, want 3: %v", len(events), events)
+	}
+	if rel := relation(events[0]); rel["m.in_reply_to"] == nil || rel["m.in_reply_to"].(map[string]interface{})["event_id"] != "$e2" {
+		t.Errorf("first streamed event relation = %v, want a reply to $e2", rel)
+	}
+	for _, ev := range events[1:] {
+		if rel := relation(ev); rel["rel_type"] != "m.replace" || rel["event_id"] != "$sent1" {
+			t.Errorf("edit relation = %v, want m.replace of $sent1", rel)
+		}
+	}
+	final := events[2]["m.new_content"].(map[string]interface{})
+	if final["body"] != "Done, **ok**" || !strings.Contains(final["formatted_body"].(string), "<strong>ok</strong>") {
+		t.Errorf("final content = %v", final)
+	}
+
+	// An aborted stream is forgotten: the next turn's reply is a new message.
+	if err := ch.Edit(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!good:local", Content: "Half", StreamID: "r2"}); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	if err := ch.Edit(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!good:local", Kind: bus.OutboundStreamAbort, StreamID: "r2"}); err != nil {
+		t.Fatalf("abort failed: %v", err)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!good:local", Content: "Fresh", StreamID: "r3"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	events = stub.sent()[3:]
+	if len(events) != 2 {
+		t.Fatalf("sent %d events after the abort, want 2: %v", len(events), events)
+	}
+	if rel := relation(events[1]); rel["rel_type"] == "m.replace" || events[1]["body"] != "Fresh" {
+		t.Errorf("reply after an aborted stream = %v, want a new message", events[1])
+	}
+
+	// A threaded reply with an attachment.
+	err = ch.Send(ctx, bus.OutboundMessage{
+		Channel:     "matrix",
+		ChatID:      "!good:local/$e1",
+		Content:     "Here you go",
+		Attachments: []bus.Attachment{{Data: []byte("a,b"), Filename: "data.csv", Caption: "the data"}},
+	})
+	if err != nil {
+		t.Fatalf("Send with attachment failed: %v", err)
+	}
+	events = stub.sent()[5:]
+	if len(events) != 2 {
+		t.Fatalf("sent %d events for the threaded reply, want 2", len(events))
+	}
+	rel := relation(events[0])
+	if rel["rel_type"] != "m.thread" || rel["event_id"] != "$e1" || rel["m.in_reply_to"].(map[string]interface{})["event_id"] != "$e3" {
+		t.Errorf("threaded reply relation = %v", rel)
+	}
+	if events[1]["msgtype"] != "m.file" || events[1]["url"] != "mxc://local/up1" || events[1]["body"] != "the data" || relation(events[1])["rel_type"] != "m.thread" {
+		t.Errorf("attachment event = %v", events[1])
+	}
+	if len(stub.uploads) != 1 || stub.uploads[0] != "data.csv=a,b" {
+		t.Errorf("uploads = %v", stub.uploads)
+	}
+}
+
+func relation(content map[string]interface{}) map[string]interface{} {
+	rel, _ := content["m.relates_to"].(map[string]interface{})
+	return rel
+}
+
+func TestMatrixChannel_RejectsEncryptedRooms(t *testing.T) {
+	stub := &matrixStub{t: t, batches: []string{`{
+  "next_batch": "s1",
+  "rooms": {"invite": {"!secret:local": {"invite_state": {"events": [
+    {"type": "m.room.encryption", "sender": "@alice:local", "state_key": "", "content": {"algorithm": "m.megolm.v1.aes-sha2"}},
+    {"type": "m.room.member", "sender": "@alice:local", "state_key": "@bot:local", "content": {"membership": "invite"}}
+  ]}}}}
+}`, `{
+  "next_batch": "s2",
+  "rooms": {"join": {"!later:local": {"timeline": {"events": [
+    {"type": "m.room.encryption", "event_id": "$enc", "sender": "@alice:local", "state_key": "", "content": {"algorithm": "m.megolm.v1.aes-sha2"}},
+    {"type": "m.room.encrypted", "event_id": "$e1", "sender": "@alice:local", "content": {"algorithm": "m.megolm.v1.aes-sha2", "ciphertext": "..."}}
+  ]}}}}
+}`}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Homeserver:  srv.URL,
+		AccessToken: "secret",
+		AllowFrom:   config.FlexibleStringSlice{"@alice:local"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel failed: %v", err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	want := "leave !secret:local (" + matrixE2EUnsupported + "), leave !later:local (" + matrixE2EUnsupported + ")"
+	var actions string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && actions != want; time.Sleep(10 * time.Millisecond) {
+		stub.mu.Lock()
+		actions = strings.Join(stub.actions, ", ")
+		stub.mu.Unlock()
+	}
+	if actions != want {
+		t.Errorf("actions = %q, want %q", actions, want)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+		t.Errorf("encrypted event was published: %+v", msg)
+	}
+}
+
+func TestMatrixChannel_AllowRooms(t *testing.T) {
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Homeserver:  "https://matrix.example.com",
+		AccessToken: "secret",
+		AllowRooms:  config.FlexibleStringSlice{"!team:example.com", "#ops:example.com"},
+	}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewMatrixChannel failed: %v", err)
+	}
+	if !ch.roomAllowed("!team:example.com") || ch.roomAllowed("!other:example.com") {
+		t.Error("only rooms in allow_rooms should be allowed")
+	}
+
+	if _, err := NewMatrixChannel(config.MatrixConfig{Homeserver: "matrix.example.com", AccessToken: "secret"}, bus.NewMessageBus()); err == nil {
+		t.Error("expected an error for a homeserver without scheme")
+	}
+}
@@ -2,6 +2,7 @@ package channels
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -255,8 +256,58 @@ func (c *OneBotChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// SendsAttachments reports that Send embeds images, audio and video as CQ
+// codes; other files become text links.
+func (c *OneBotChannel) SendsAttachments() bool { return true }
+
+// oneBotCQTypes are the CQ codes used to embed attachments by kind.
+var oneBotCQTypes = map[bus.AttachmentKind]string{
+	bus.AttachmentImage: "image",
+	bus.AttachmentAudio: "record",
+	bus.AttachmentVideo: "video",
+}
+
+// withAttachments appends the attachments of msg to its content: media as
+// base64 CQ codes, everything else (and unreadable files) as text links.
+func (c *OneBotChannel) withAttachments(msg bus.OutboundMessage) string {
+	var b strings.Builder
+	b.WriteString(msg.Content)
+	var links []bus.Attachment
+	for _, a := range msg.Attachments {
+		data, err := a.Bytes()
+		if err != nil {
+			logger.WarnCF("onebot", "Attachment upload failed, sending a link instead", map[string]interface{}{
+				"filename": a.Name(),
+				"error":    err.Error(),
+			})
+		}
+		cqType, ok := oneBotCQTypes[a.Kind(data)]
+		if err != nil || !ok {
+			links = append(links, a)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		if a.Caption != "" {
+			b.WriteString(a.Caption + "\n")
+		}
+		fmt.Fprintf(&b, "[CQ:%s,file=base64://%s]", cqType, base64.StdEncoding.EncodeToString(data))
+	}
+	if len(links) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(bus.WithAttachmentLinks("", links))
+	}
+	return b.String()
+}
+
 func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, interface{}, error) {
 	chatID := msg.ChatID
+	if len(msg.Attachments) > 0 {
+		msg.Content = c.withAttachments(msg)
+	}
 
 	if len(chatID) > 6 && chatID[:6] == "group:" {
 		groupID, err := strconv.ParseInt(chatID[6:], 10, 64)
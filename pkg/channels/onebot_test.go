@@ -0,0 +1,35 @@
+package channels
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
+)
+
+func TestOneBotChannel_BuildSendRequestWithAttachments(t *testing.T) {
+	c := &OneBotChannel{}
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+
+	action, params, err := c.buildSendRequest(bus.OutboundMessage{
+		ChatID:  "group:42",
+		Content: "result",
+		Attachments: []bus.Attachment{
+			{Data: png, Caption: "chart"},
+			{Path: "/ws/fix.patch", URL: "https://example.com/fix.patch"},
+		},
+	})
+	if err != nil || action != "send_group_msg" {
+		t.Fatalf("buildSendRequest = %q, %v", action, err)
+	}
+
+	message := params.(oneBotSendGroupMsgParams).Message
+	want := "result\nchart\n[CQ:image,file=base64://" + base64.StdEncoding.EncodeToString(png) + "]\n📎 fix.patch: https://example.com/fix.patch"
+	if message != want {
+		t.Errorf("message =\n%s\nwant\n%s", message, want)
+	}
+	if strings.Contains(message, "/ws/") {
+		t.Error("the link should use the URL, not the local path")
+	}
+}
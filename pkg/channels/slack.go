@@ -1,6 +1,7 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -29,6 +30,7 @@ type SlackChannel struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	streaming    sync.Map // streamKey -> slackMessageRef of the reply being streamed
 }
 
 type slackMessageRef struct {
@@ -117,17 +119,50 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
+	// Finish a streamed reply in place instead of posting a second message.
+	// A message with only attachments has no text to post.
+	sent := msg.Content == "" && len(msg.Attachments) > 0
+	if ref, ok := c.streaming.LoadAndDelete(streamKey(msg)); ok {
+		msgRef := ref.(slackMessageRef)
+		_, _, _, err := c.api.UpdateMessageContext(ctx, msgRef.ChannelID, msgRef.Timestamp, slack.MsgOptionText(msg.Content, false))
+		sent = err == nil
 	}
 
-	if threadTS != "" {
-		opts = append(opts, slack.MsgOptionTS(threadTS))
+	if !sent {
+		opts := []slack.MsgOption{
+			slack.MsgOptionText(msg.Content, false),
+		}
+
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+
+		_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
 	}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	err := sendAttachments("slack", msg.Attachments, func(a bus.Attachment, data []byte) error {
+		_, err := c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			Reader:          bytes.NewReader(data),
+			FileSize:        len(data),
+			Filename:        a.Name(),
+			InitialComment:  a.Caption,
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+		})
+		return err
+	}, func(text string) error {
+		opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
+		_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+		return fmt.Errorf("failed to send slack attachment links: %w", err)
 	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
@@ -146,6 +181,51 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// SendsAttachments reports that Send uploads attachments as Slack files.
+func (c *SlackChannel) SendsAttachments() bool { return true }
+
+// Edit posts the partial reply on the first call and updates it on later calls.
+func (c *SlackChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	if msg.Kind == bus.OutboundStreamAbort {
+		c.streaming.Delete(streamKey(msg))
+		return nil
+	}
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	if ref, ok := c.streaming.Load(streamKey(msg)); ok {
+		msgRef := ref.(slackMessageRef)
+		_, _, _, err := c.api.UpdateMessageContext(ctx, msgRef.ChannelID, msgRef.Timestamp, slack.MsgOptionText(msg.Content, false))
+		if err != nil {
+			c.streaming.Delete(streamKey(msg))
+			return fmt.Errorf("failed to update slack message: %w", err)
+		}
+		return nil
+	}
+
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(msg.Content, false),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	respChannel, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	c.streaming.Store(streamKey(msg), slackMessageRef{ChannelID: respChannel, Timestamp: ts})
+	return nil
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -1,6 +1,7 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -149,14 +150,31 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
 
-	// Stop thinking animation
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
+	c.stopThinkingFor(msg.ChatID)
+
+	if strings.TrimSpace(msg.Content) == "" && len(msg.Attachments) > 0 {
+		// Files only: drop the "Thinking..." placeholder instead of leaving it.
+		if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+			c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
 		}
-		c.stopThinking.Delete(msg.ChatID)
+	} else if err := c.sendText(ctx, chatID, msg); err != nil {
+		return err
 	}
 
+	return sendAttachments("telegram", msg.Attachments, func(a bus.Attachment, data []byte) error {
+		return c.sendAttachment(ctx, chatID, a, data)
+	}, func(text string) error {
+		_, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), text))
+		return err
+	})
+}
+
+// SendsAttachments reports that Send uploads attachments as photos, videos,
+// audio or documents.
+func (c *TelegramChannel) SendsAttachments() bool { return true }
+
+// sendText delivers msg.Content, replacing the placeholder when there is one.
+func (c *TelegramChannel) sendText(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
 	htmlContent := markdownToTelegramHTML(msg.Content)
 
 	// Try to edit placeholder
@@ -165,7 +183,11 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
 		editMsg.ParseMode = telego.ModeHTML
 
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
+		_, err := c.bot.EditMessageText(ctx, editMsg)
+		if err == nil {
+			return nil
+		} else if strings.Contains(err.Error(), "message is not modified") {
+			// A streamed reply already shows exactly this text.
 			return nil
 		}
 		// Fallback to new message if edit fails
@@ -174,7 +196,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
 	tgMsg.ParseMode = telego.ModeHTML
 
-	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+	if _, err := c.bot.SendMessage(ctx, tgMsg); err != nil {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
 			"error": err.Error(),
 		})
@@ -186,6 +208,71 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// sendAttachment uploads one attachment with the method matching its kind.
+func (c *TelegramChannel) sendAttachment(ctx context.Context, chatID int64, a bus.Attachment, data []byte) error {
+	file := tu.File(tu.NameReader(bytes.NewReader(data), a.Name()))
+	caption := utils.Truncate(a.Caption, telegramCaptionMaxRunes)
+	var err error
+	switch a.Kind(data) {
+	case bus.AttachmentImage:
+		_, err = c.bot.SendPhoto(ctx, tu.Photo(tu.ID(chatID), file).WithCaption(caption))
+	case bus.AttachmentVideo:
+		_, err = c.bot.SendVideo(ctx, tu.Video(tu.ID(chatID), file).WithCaption(caption))
+	case bus.AttachmentAudio:
+		_, err = c.bot.SendAudio(ctx, tu.Audio(tu.ID(chatID), file).WithCaption(caption))
+	default:
+		_, err = c.bot.SendDocument(ctx, tu.Document(tu.ID(chatID), file).WithCaption(caption))
+	}
+	return err
+}
+
+// Edit shows partial output by updating the "Thinking..." placeholder.
+// The placeholder is kept so that the final Send replaces it with the full reply.
+// Partial text is sent as plain text because unfinished Markdown may not convert cleanly.
+func (c *TelegramChannel) Edit(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	chatID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	c.stopThinkingFor(msg.ChatID)
+
+	text := utils.Truncate(msg.Content, telegramEditMaxRunes)
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+		_, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), text))
+		return err
+	}
+
+	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), text))
+	if err != nil {
+		return err
+	}
+	c.placeholders.Store(msg.ChatID, pMsg.MessageID)
+	return nil
+}
+
+// telegramEditMaxRunes keeps streamed edits under Telegram's 4096 character limit.
+const telegramEditMaxRunes = 4000
+
+// telegramCaptionMaxRunes is Telegram's limit for media captions.
+const telegramCaptionMaxRunes = 1024
+
+func (c *TelegramChannel) stopThinkingFor(chatID string) {
+	if stop, ok := c.stopThinking.Load(chatID); ok {
+		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+		c.stopThinking.Delete(chatID)
+	}
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
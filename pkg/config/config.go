@@ -57,7 +57,13 @@ type Config struct {
 	MCP          MCPConfig           `json:"mcp"`
 	Worker       WorkerConfig        `json:"worker"`
 	Architecture ArchitectureConfig  `json:"architecture"`
+	Usage        UsageConfig         `json:"usage"`
+	Budget       BudgetConfig        `json:"budget"`
+	Jobs         JobsConfig          `json:"jobs"`
+	Redaction    RedactionConfig     `json:"redaction"`
 	mu           sync.RWMutex
+	secretRefs   map[string]secretRef // values loaded from "secret:<name>", by field path
+	plaintext    []string             // credential paths written in plaintext in the config file
 }
 
 type AgentsConfig struct {
@@ -72,6 +78,10 @@ type AgentDefaults struct {
 	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
 	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	// Admins may see and act on pending approvals and jobs (/jobs, /status,
+	// /cancel) of every chat; others only those of the chat they write from. Entries are "<channel>:<sender_id>",
+	// or a bare channel name for every sender on it (e.g. "cli").
+	Admins FlexibleStringSlice `json:"admins" env:"PICOCLAW_AGENTS_DEFAULTS_ADMINS"`
 }
 
 type ChannelsConfig struct {
@@ -85,6 +95,9 @@ type ChannelsConfig struct {
 	Slack    SlackConfig    `json:"slack"`
 	LINE     LINEConfig     `json:"line"`
 	OneBot   OneBotConfig   `json:"onebot"`
+	Email    EmailConfig    `json:"email"`
+	Matrix   MatrixConfig   `json:"matrix"`
+	API      APIConfig      `json:"api"`
 }
 
 type WhatsAppConfig struct {
@@ -143,6 +156,9 @@ type SlackConfig struct {
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_FROM"`
 }
 
+// LINEConfig configures the LINE channel. PublicURL is the HTTPS base URL at
+// which LINE reaches the webhook server; LINE fetches attachments from it, so
+// they are only sent when it is set.
 type LINEConfig struct {
 	Enabled            bool                `json:"enabled" env:"PICOCLAW_CHANNELS_LINE_ENABLED"`
 	ChannelSecret      string              `json:"channel_secret" env:"PICOCLAW_CHANNELS_LINE_CHANNEL_SECRET"`
@@ -150,6 +166,7 @@ type LINEConfig struct {
 	WebhookHost        string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_HOST"`
 	WebhookPort        int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PORT"`
 	WebhookPath        string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PATH"`
+	PublicURL          string              `json:"public_url" env:"PICOCLAW_CHANNELS_LINE_PUBLIC_URL"`
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_LINE_ALLOW_FROM"`
 }
 
@@ -162,6 +179,70 @@ type OneBotConfig struct {
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_ONEBOT_ALLOW_FROM"`
 }
 
+// EmailConfig configures the email channel: mail is received over IMAP and
+// replies go out over SMTP, both with Username and Password. IMAPSecurity and
+// SMTPSecurity are "tls", "starttls" or "none". Address is the From address
+// of replies (default: Username). PollInterval is in seconds.
+type EmailConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	IMAPHost     string              `json:"imap_host" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort     int                 `json:"imap_port" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	IMAPSecurity string              `json:"imap_security" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_SECURITY"`
+	SMTPHost     string              `json:"smtp_host" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort     int                 `json:"smtp_port" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	SMTPSecurity string              `json:"smtp_security" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_SECURITY"`
+	Username     string              `json:"username" env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password     string              `json:"password" env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Address      string              `json:"address" env:"PICOCLAW_CHANNELS_EMAIL_ADDRESS"`
+	Mailbox      string              `json:"mailbox" env:"PICOCLAW_CHANNELS_EMAIL_MAILBOX"`
+	PollInterval int                 `json:"poll_interval" env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"`
+	AllowFrom    FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+	// TrustedAuthServIDs are the authserv-ids of the receiving mail servers
+	// (e.g. "mx.google.com") whose Authentication-Results are believed. Mail
+	// is only handled when one of them reports a DMARC or aligned DKIM pass
+	// for the From address.
+	TrustedAuthServIDs FlexibleStringSlice `json:"trusted_authserv_ids" env:"PICOCLAW_CHANNELS_EMAIL_TRUSTED_AUTHSERV_IDS"`
+}
+
+// MatrixConfig configures the Matrix channel, which logs in to Homeserver
+// with AccessToken. Invites are accepted from senders in AllowFrom; when
+// AllowRooms is set, only those rooms (IDs or aliases) are joined and
+// answered. End-to-end encrypted rooms are not supported: invites to them
+// are rejected and rooms that turn on encryption are left.
+type MatrixConfig struct {
+	Enabled     bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver  string              `json:"homeserver" env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	UserID      string              `json:"user_id" env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	AllowFrom   FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+	AllowRooms  FlexibleStringSlice `json:"allow_rooms" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_ROOMS"`
+}
+
+// APIConfig configures the api channel, an HTTP and WebSocket endpoint on
+// the gateway (under /api/) for custom frontends. AllowFrom lists the token
+// names that may send messages. With UI, the gateway also serves a web chat
+// at /ui that logs in with a bearer token.
+type APIConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_API_ENABLED"`
+	Tokens    []APIToken          `json:"tokens"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_API_ALLOW_FROM"`
+	UI        bool                `json:"ui" env:"PICOCLAW_CHANNELS_API_UI"`
+	// AllowedOrigins are the browser origins ("https://app.example.com")
+	// allowed to open WebSockets besides the gateway's own.
+	AllowedOrigins FlexibleStringSlice `json:"allowed_origins" env:"PICOCLAW_CHANNELS_API_ALLOWED_ORIGINS"`
+}
+
+// APIToken is a client of the api channel. With Auth "bearer" (the default)
+// the client sends Token as a bearer token; with "hmac" it signs each
+// request with Token instead. Chat IDs are per client; AllowChats limits the
+// ones it may use ("prefix*" matches by prefix), empty allows all of its own.
+type APIToken struct {
+	Name       string   `json:"name"`
+	Token      string   `json:"token"`
+	Auth       string   `json:"auth"`
+	AllowChats []string `json:"allow_chats"`
+}
+
 type HeartbeatConfig struct {
 	Enabled  bool `json:"enabled" env:"PICOCLAW_HEARTBEAT_ENABLED"`
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
@@ -174,6 +255,53 @@ type DevicesConfig struct {
 
 type MCPConfig struct {
 	Chrome MCPChromeConfig `json:"chrome"`
+
+	// Servers are MCP servers whose tools are registered as mcp_<name>_<tool>.
+	Servers map[string]MCPServerConfig `json:"servers,omitempty"`
+
+	// Serve configures "picoclaw mcp serve".
+	Serve MCPServeConfig `json:"serve"`
+}
+
+// MCPServeConfig controls what "picoclaw mcp serve" exposes and who may call
+// it over HTTP.
+type MCPServeConfig struct {
+	// Token is required as "Authorization: Bearer <token>" on every HTTP
+	// request; use "secret:<name>" to keep it in the encrypted store. Serving
+	// HTTP on a non-loopback address without a token is refused.
+	Token string `json:"token,omitempty" env:"PICOCLAW_MCP_SERVE_TOKEN"`
+
+	// AllowedOrigins are browser origins allowed to call the HTTP server.
+	// Requests carrying any other Origin header are rejected.
+	AllowedOrigins FlexibleStringSlice `json:"allowed_origins,omitempty" env:"PICOCLAW_MCP_SERVE_ALLOWED_ORIGINS"`
+
+	// AllowedHosts are Host header names accepted besides localhost and
+	// loopback addresses. Other hosts are rejected to stop DNS rebinding.
+	AllowedHosts FlexibleStringSlice `json:"allowed_hosts,omitempty" env:"PICOCLAW_MCP_SERVE_ALLOWED_HOSTS"`
+
+	// Tools lists the tools exported over MCP, including ask_agent. Empty
+	// exports every tool of the agent plus ask_agent.
+	Tools FlexibleStringSlice `json:"tools,omitempty" env:"PICOCLAW_MCP_SERVE_TOOLS"`
+}
+
+// MCPServerConfig describes how to reach one MCP server.
+type MCPServerConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Transport is "stdio", "http" (streamable HTTP) or "sse" (legacy HTTP+SSE).
+	// Empty means stdio when Command is set and http otherwise.
+	Transport string `json:"transport,omitempty"`
+
+	// Command, Args and Env start a stdio server.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	// URL and Headers reach an http or sse server.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	TimeoutSec int `json:"timeout_sec,omitempty"`
 }
 
 type MCPChromeConfig struct {
@@ -261,15 +389,42 @@ type CronToolsConfig struct {
 	ExecTimeoutMinutes int `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
 }
 
+// ExecToolsConfig selects how the exec tool and the Worker run shell
+// commands: "direct" (the default) as plain child processes with picoclaw's
+// full environment and file access, or, opt-in, "sandbox" in Linux
+// namespaces with a read-only root, a writable workspace, ~/.picoclaw hidden,
+// a minimal environment and the limits below.
+type ExecToolsConfig struct {
+	Backend      string `json:"backend" env:"PICOCLAW_TOOLS_EXEC_BACKEND"`
+	AllowNetwork bool   `json:"allow_network" env:"PICOCLAW_TOOLS_EXEC_ALLOW_NETWORK"` // sandbox only
+	CPUSeconds   int    `json:"cpu_seconds" env:"PICOCLAW_TOOLS_EXEC_CPU_SECONDS"`     // sandbox only; 0 means no limit
+	MemoryMB     int    `json:"memory_mb" env:"PICOCLAW_TOOLS_EXEC_MEMORY_MB"`         // sandbox only; 0 means no limit
+	MaxOutputMB  int    `json:"max_output_mb" env:"PICOCLAW_TOOLS_EXEC_MAX_OUTPUT_MB"` // sandbox only; 0 means no limit
+}
+
+// EgressConfig adjusts which hosts web_fetch, media downloads and the skill
+// installer may reach. Loopback, private, link-local and metadata addresses
+// are blocked unless listed in AllowHosts. Entries are host names,
+// "*.example.com", IP addresses or CIDRs; DenyHosts wins over AllowHosts.
+// With HTTP_PROXY/HTTPS_PROXY set, connections go to the proxy, which must be
+// allowed if internal; destinations are then checked by name only.
+type EgressConfig struct {
+	AllowHosts []string `json:"allow_hosts" env:"PICOCLAW_TOOLS_EGRESS_ALLOW_HOSTS"`
+	DenyHosts  []string `json:"deny_hosts" env:"PICOCLAW_TOOLS_EGRESS_DENY_HOSTS"`
+}
+
 type ToolsConfig struct {
-	Web  WebToolsConfig  `json:"web"`
-	Cron CronToolsConfig `json:"cron"`
+	Web    WebToolsConfig  `json:"web"`
+	Cron   CronToolsConfig `json:"cron"`
+	Exec   ExecToolsConfig `json:"exec"`
+	Egress EgressConfig    `json:"egress"`
 }
 
 type RoutingConfig struct {
-	Classifier    RoutingClassifierConfig `json:"classifier"`
-	FallbackRoute string                  `json:"fallback_route" env:"PICOCLAW_ROUTING_FALLBACK_ROUTE"`
-	LLM           RouteLLMConfig          `json:"llm"`
+	Classifier     RoutingClassifierConfig `json:"classifier"`
+	FallbackRoute  string                  `json:"fallback_route" env:"PICOCLAW_ROUTING_FALLBACK_ROUTE"`
+	LLM            RouteLLMConfig          `json:"llm"`
+	CircuitBreaker CircuitBreakerConfig    `json:"circuit_breaker"`
 }
 
 type RoutingClassifierConfig struct {
@@ -294,16 +449,107 @@ type RouteLLMConfig struct {
 	Coder3Alias    string `json:"coder3_alias" env:"PICOCLAW_ROUTING_LLM_CODER3_ALIAS"`
 	Coder3Provider string `json:"coder3_provider" env:"PICOCLAW_ROUTING_LLM_CODER3_PROVIDER"`
 	Coder3Model    string `json:"coder3_model" env:"PICOCLAW_ROUTING_LLM_CODER3_MODEL"`
+	// Ordered fallback chains tried when the role's provider fails or its
+	// circuit is open. Entries are "provider/model" (e.g. "deepseek/deepseek-chat")
+	// or just "provider" to use that provider's default model.
+	ChatFallbacks   []string `json:"chat_fallbacks,omitempty" env:"PICOCLAW_ROUTING_LLM_CHAT_FALLBACKS"`
+	WorkerFallbacks []string `json:"worker_fallbacks,omitempty" env:"PICOCLAW_ROUTING_LLM_WORKER_FALLBACKS"`
+	CoderFallbacks  []string `json:"coder_fallbacks,omitempty" env:"PICOCLAW_ROUTING_LLM_CODER_FALLBACKS"`
+	Coder2Fallbacks []string `json:"coder2_fallbacks,omitempty" env:"PICOCLAW_ROUTING_LLM_CODER2_FALLBACKS"`
+	Coder3Fallbacks []string `json:"coder3_fallbacks,omitempty" env:"PICOCLAW_ROUTING_LLM_CODER3_FALLBACKS"`
 	// Legacy keys kept for backward compatibility.
 	CodeProvider string `json:"code_provider,omitempty" env:"PICOCLAW_ROUTING_LLM_CODE_PROVIDER"`
 	CodeModel    string `json:"code_model,omitempty" env:"PICOCLAW_ROUTING_LLM_CODE_MODEL"`
 }
 
+// CircuitBreakerConfig controls per-provider circuit breakers used by fallback chains.
+type CircuitBreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold" env:"PICOCLAW_ROUTING_CIRCUIT_BREAKER_FAILURE_THRESHOLD"`
+	OpenSeconds      int `json:"open_seconds" env:"PICOCLAW_ROUTING_CIRCUIT_BREAKER_OPEN_SECONDS"`
+	// SlowCallMS counts successful calls slower than this as failures (0 disables).
+	SlowCallMS int `json:"slow_call_ms" env:"PICOCLAW_ROUTING_CIRCUIT_BREAKER_SLOW_CALL_MS"`
+}
+
 type LoopConfig struct {
 	MaxLoops                    int  `json:"max_loops" env:"PICOCLAW_LOOP_MAX_LOOPS"`
 	MaxMillis                   int  `json:"max_millis" env:"PICOCLAW_LOOP_MAX_MILLIS"`
 	AllowAutoRerouteOnce        bool `json:"allow_auto_reroute_once" env:"PICOCLAW_LOOP_ALLOW_AUTO_REROUTE_ONCE"`
 	AllowChatProposeRerouteOnce bool `json:"allow_chat_propose_reroute_once" env:"PICOCLAW_LOOP_ALLOW_CHAT_PROPOSE_REROUTE_ONCE"`
+	// MaxConcurrentSessions caps how many sessions are processed in parallel.
+	// Messages within a single session are always handled in order.
+	MaxConcurrentSessions int `json:"max_concurrent_sessions" env:"PICOCLAW_LOOP_MAX_CONCURRENT_SESSIONS"`
+	// StreamReplies shows replies progressively on channels that can edit
+	// messages (Telegram, Slack, Discord) when the provider supports streaming.
+	StreamReplies bool `json:"stream_replies" env:"PICOCLAW_LOOP_STREAM_REPLIES"`
+	// StreamEditIntervalMS is the minimum time between progressive edits.
+	StreamEditIntervalMS int `json:"stream_edit_interval_ms" env:"PICOCLAW_LOOP_STREAM_EDIT_INTERVAL_MS"`
+}
+
+// UsageConfig controls the token/cost ledger written to workspace/usage.
+type UsageConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_USAGE_ENABLED"`
+	// Prices maps "provider/model", "model" or "provider" to a USD price per
+	// million tokens. Unpriced models are recorded with zero cost.
+	Prices map[string]ModelPrice `json:"prices,omitempty"`
+}
+
+// ModelPrice is a USD price per million input/output tokens.
+type ModelPrice struct {
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+// BudgetConfig sets daily limits. A zero value disables that limit.
+// Reaching a soft limit demotes turns to local models (LocalOnly); reaching a
+// hard limit refuses the turn. Counters reset at local midnight.
+type BudgetConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_BUDGET_ENABLED"`
+	// Total LLM tokens per day per SenderID.
+	SenderDailyTokensSoft int `json:"sender_daily_tokens_soft" env:"PICOCLAW_BUDGET_SENDER_DAILY_TOKENS_SOFT"`
+	SenderDailyTokensHard int `json:"sender_daily_tokens_hard" env:"PICOCLAW_BUDGET_SENDER_DAILY_TOKENS_HARD"`
+	// Cloud (non-local provider) spend in USD per day per channel, priced from usage.prices.
+	ChannelDailyCloudUSDSoft float64 `json:"channel_daily_cloud_usd_soft" env:"PICOCLAW_BUDGET_CHANNEL_DAILY_CLOUD_USD_SOFT"`
+	ChannelDailyCloudUSDHard float64 `json:"channel_daily_cloud_usd_hard" env:"PICOCLAW_BUDGET_CHANNEL_DAILY_CLOUD_USD_HARD"`
+	// Cloud CODE3 turns per session per day, however the turn reached the CODE3
+	// binding (/code3, a CODE task sent there, or order3 in deliberation).
+	SessionCode3CallsSoft int `json:"session_code3_calls_soft" env:"PICOCLAW_BUDGET_SESSION_CODE3_CALLS_SOFT"`
+	SessionCode3CallsHard int `json:"session_code3_calls_hard" env:"PICOCLAW_BUDGET_SESSION_CODE3_CALLS_HARD"`
+}
+
+// JobsConfig controls the job journal in workspace/state/jobs.jsonl, which
+// lets the gateway resume or fail jobs interrupted by a restart.
+type JobsConfig struct {
+	// ResumeOnRestart re-queues unfinished jobs at gateway startup. When false
+	// they are marked failed and the origin chat is told to resend.
+	ResumeOnRestart bool `json:"resume_on_restart" env:"PICOCLAW_JOBS_RESUME_ON_RESTART"`
+	// MaxResumes is how many times one job may be resumed before it is failed.
+	MaxResumes int `json:"max_resumes" env:"PICOCLAW_JOBS_MAX_RESUMES"`
+	// RetentionDays drops finished jobs older than this from the journal at startup (0 keeps all).
+	RetentionDays int `json:"retention_days" env:"PICOCLAW_JOBS_RETENTION_DAYS"`
+}
+
+// RedactionConfig masks API keys, bearer tokens, private keys and other
+// credentials in logs, session files, the job journal and pending proposals,
+// and optionally in what is sent to LLM providers. Files only get redacted
+// copies, so history reloaded after a restart has the values masked.
+type RedactionConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_REDACTION_ENABLED"`
+	// Detectors are the built-in detectors to use (private_key, bearer_token,
+	// api_key, credential, email, phone); empty means all but email and
+	// phone, which only run when listed.
+	Detectors []string `json:"detectors" env:"PICOCLAW_REDACTION_DETECTORS"`
+	// Patterns are extra detectors. A pattern with a capture group masks
+	// only the first group.
+	Patterns []RedactionPattern `json:"patterns"`
+	// LLMPayloads also redacts the messages sent to LLM providers.
+	LLMPayloads bool `json:"llm_payloads" env:"PICOCLAW_REDACTION_LLM_PAYLOADS"`
+}
+
+// RedactionPattern is a user-defined detector; its matches are replaced by
+// "[REDACTED:<name>]".
+type RedactionPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
 }
 
 // WorkerConfig は Worker の設定
@@ -313,6 +559,7 @@ type WorkerConfig struct {
 	CommandTimeout      int    `json:"command_timeout" env:"PICOCLAW_WORKER_COMMAND_TIMEOUT"`
 	GitTimeout          int    `json:"git_timeout" env:"PICOCLAW_WORKER_GIT_TIMEOUT"`
 	StopOnError         bool   `json:"stop_on_error" env:"PICOCLAW_WORKER_STOP_ON_ERROR"`
+	DryRun              bool   `json:"dry_run" env:"PICOCLAW_WORKER_DRY_RUN"`
 }
 
 // ArchitectureConfig は新アーキテクチャの設定（2026-03-01追加）
@@ -325,6 +572,14 @@ type ArchitectureConfig struct {
 
 	// EnableDeliberation enables deliberation mode for multi-Order proposals (default: false)
 	EnableDeliberation bool `json:"enable_deliberation" env:"PICOCLAW_ARCHITECTURE_ENABLE_DELIBERATION"`
+
+	// DeliberationTimeoutSec limits each Order and the judge in deliberation mode (default: 180)
+	DeliberationTimeoutSec int `json:"deliberation_timeout_sec" env:"PICOCLAW_ARCHITECTURE_DELIBERATION_TIMEOUT_SEC"`
+
+	// HeartbeatProgressTimeoutSec is how long a processing agent may go without
+	// an LLM or tool call starting or finishing before it stops beating and is
+	// reported stale (default: 300)
+	HeartbeatProgressTimeoutSec int `json:"heartbeat_progress_timeout_sec" env:"PICOCLAW_ARCHITECTURE_HEARTBEAT_PROGRESS_TIMEOUT_SEC"`
 }
 
 func DefaultConfig() *Config {
@@ -405,6 +660,28 @@ func DefaultConfig() *Config {
 				GroupTriggerPrefix: []string{},
 				AllowFrom:          FlexibleStringSlice{},
 			},
+			Email: EmailConfig{
+				Enabled:      false,
+				IMAPPort:     993,
+				IMAPSecurity: "tls",
+				SMTPPort:     587,
+				SMTPSecurity: "starttls",
+				Mailbox:      "INBOX",
+				PollInterval: 60,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Matrix: MatrixConfig{
+				Enabled:    false,
+				Homeserver: "https://matrix.org",
+				AllowFrom:  FlexibleStringSlice{},
+				AllowRooms: FlexibleStringSlice{},
+			},
+			API: APIConfig{
+				Enabled:   false,
+				Tokens:    []APIToken{},
+				AllowFrom: FlexibleStringSlice{},
+				UI:        false,
+			},
 		},
 		Providers: ProvidersConfig{
 			Anthropic:    ProviderConfig{},
@@ -463,6 +740,16 @@ func DefaultConfig() *Config {
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5, // default 5 minutes for LLM operations
 			},
+			Exec: ExecToolsConfig{
+				Backend:     "direct",
+				CPUSeconds:  300,
+				MemoryMB:    2048,
+				MaxOutputMB: 16,
+			},
+			Egress: EgressConfig{
+				AllowHosts: []string{},
+				DenyHosts:  []string{},
+			},
 		},
 		Routing: RoutingConfig{
 			Classifier: RoutingClassifierConfig{
@@ -488,12 +775,20 @@ func DefaultConfig() *Config {
 			Coder3Provider: "",
 			Coder3Model:    "",
 			},
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 3,
+				OpenSeconds:      60,
+				SlowCallMS:       0,
+			},
 		},
 		Loop: LoopConfig{
 			MaxLoops:                    3,
 			MaxMillis:                   25000,
 			AllowAutoRerouteOnce:        true,
 			AllowChatProposeRerouteOnce: true,
+			MaxConcurrentSessions:       4,
+			StreamReplies:               true,
+			StreamEditIntervalMS:        1000,
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
@@ -516,11 +811,31 @@ func DefaultConfig() *Config {
 			CommandTimeout:      300, // 5 minutes
 			GitTimeout:          30,  // 30 seconds
 			StopOnError:         false,
+			DryRun:              false,
 		},
 		Architecture: ArchitectureConfig{
-			UseNewArchitecture: false, // デフォルトは旧アーキテクチャ
-			EnableHeartbeat:    false,
-			EnableDeliberation: false,
+			UseNewArchitecture:          false, // デフォルトは旧アーキテクチャ
+			EnableHeartbeat:             false,
+			EnableDeliberation:          false,
+			DeliberationTimeoutSec:      180,
+			HeartbeatProgressTimeoutSec: 300,
+		},
+		Usage: UsageConfig{
+			Enabled: true,
+		},
+		Budget: BudgetConfig{
+			Enabled: false,
+		},
+		Jobs: JobsConfig{
+			ResumeOnRestart: true,
+			MaxResumes:      1,
+			RetentionDays:   7,
+		},
+		Redaction: RedactionConfig{
+			Enabled:     true,
+			Detectors:   []string{},
+			Patterns:    []RedactionPattern{},
+			LLMPayloads: false,
 		},
 	}
 }
@@ -539,11 +854,16 @@ func LoadConfig(path string) (*Config, error) {
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	cfg.plaintext = cfg.findPlaintextSecrets()
 
 	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
 
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
@@ -551,7 +871,7 @@ func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	data, err := cfg.marshalWithSecretRefs()
 	if err != nil {
 		return err
 	}
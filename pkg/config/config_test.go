@@ -4,7 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
 )
 
 // TestDefaultConfig_HeartbeatEnabled verifies heartbeat is enabled by default
@@ -237,3 +240,95 @@ func TestConfig_Complete(t *testing.T) {
 		t.Error("Loop max settings should be initialized")
 	}
 }
+
+func TestLoadConfig_ResolvesSecretRefs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(secrets.KeyEnv, "")
+	t.Setenv(secrets.PassphraseEnv, "")
+	t.Setenv(secrets.KeyFileEnv, "")
+
+	store, _ := secrets.LoadDefault()
+	store.Set("anthropic", "sk-ant-secret")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(home, "config.json")
+	os.WriteFile(path, []byte(`{"providers":{"anthropic":{"api_key":"secret:anthropic"},"openai":{"api_key":"sk-plain"}}}`), 0600)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if cfg.Providers.Anthropic.APIKey != "sk-ant-secret" || cfg.Providers.OpenAI.APIKey != "sk-plain" {
+		t.Errorf("unexpected keys: anthropic=%q openai=%q", cfg.Providers.Anthropic.APIKey, cfg.Providers.OpenAI.APIKey)
+	}
+
+	// Saving keeps the reference instead of writing the secret.
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "sk-ant-secret") || !strings.Contains(string(data), `"secret:anthropic"`) {
+		t.Errorf("saved config should keep the secret reference:\n%s", data)
+	}
+	if reloaded, err := LoadConfig(path); err != nil || reloaded.Providers.Anthropic.APIKey != "sk-ant-secret" {
+		t.Errorf("reload = %v", err)
+	}
+
+	os.WriteFile(path, []byte(`{"providers":{"groq":{"api_key":"secret:missing"}}}`), 0600)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "Providers.Groq.APIKey") {
+		t.Errorf("a missing secret should fail with the field path, got %v", err)
+	}
+}
+
+func TestMoveSecretsToStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(secrets.KeyEnv, "")
+	t.Setenv(secrets.PassphraseEnv, "")
+	t.Setenv(secrets.KeyFileEnv, "")
+
+	path := filepath.Join(home, "config.json")
+	os.WriteFile(path, []byte(`{"providers":{"anthropic":{"api_key":"sk-ant-plain"}},"channels":{"slack":{"bot_token":"xoxb-plain"}}}`), 0600)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	got := cfg.PlaintextSecrets()
+	if strings.Join(got, ",") != "Channels.Slack.BotToken,Providers.Anthropic.APIKey" {
+		t.Fatalf("PlaintextSecrets() = %v", got)
+	}
+
+	store, _ := secrets.LoadDefault()
+	names, err := cfg.MoveSecretsToStore(store)
+	if err != nil {
+		t.Fatalf("MoveSecretsToStore() error: %v", err)
+	}
+	if strings.Join(names, ",") != "channels.slack.bottoken,providers.anthropic.apikey" {
+		t.Errorf("secret names = %v", names)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "sk-ant-plain") || strings.Contains(string(data), "xoxb-plain") {
+		t.Errorf("saved config still holds plaintext credentials:\n%s", data)
+	}
+
+	reloaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if reloaded.Providers.Anthropic.APIKey != "sk-ant-plain" || reloaded.Channels.Slack.BotToken != "xoxb-plain" {
+		t.Errorf("moved secrets should resolve on reload, got %q %q", reloaded.Providers.Anthropic.APIKey, reloaded.Channels.Slack.BotToken)
+	}
+	if left := reloaded.PlaintextSecrets(); len(left) != 0 {
+		t.Errorf("no plaintext credentials should remain, got %v", left)
+	}
+}
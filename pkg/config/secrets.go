@@ -0,0 +1,217 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
+)
+
+// secretRef is a config value that was loaded from "secret:<name>".
+type secretRef struct {
+	name  string
+	value string
+}
+
+// resolveSecrets replaces every "secret:<name>" string in the config with the
+// named secret from the encrypted store. The store is only opened when a
+// reference exists.
+func (c *Config) resolveSecrets() error {
+	var store *secrets.Store
+	var resolveErr error
+	refs := make(map[string]secretRef)
+
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path, s string) string {
+		name, ok := secrets.ParseRef(s)
+		if !ok || resolveErr != nil {
+			return s
+		}
+		if store == nil {
+			var err error
+			if store, err = secrets.LoadDefault(); err != nil {
+				resolveErr = fmt.Errorf("%s: failed to load secrets: %w", path, err)
+				return s
+			}
+		}
+		value, ok := store.Get(name)
+		if !ok {
+			resolveErr = fmt.Errorf("%s: secret %q not found (add it with: picoclaw auth secrets set %s)", path, name, name)
+			return s
+		}
+		refs[path] = secretRef{name: name, value: value}
+		return value
+	})
+	if resolveErr != nil {
+		return resolveErr
+	}
+	c.secretRefs = refs
+	return nil
+}
+
+// marshalWithSecretRefs marshals the config with resolved secrets put back as
+// their "secret:<name>" references, so that saving never writes them in
+// plaintext. A value changed since loading is saved as is. Must be called with
+// c.mu held.
+func (c *Config) marshalWithSecretRefs() ([]byte, error) {
+	if len(c.secretRefs) == 0 {
+		return json.MarshalIndent(c, "", "  ")
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	out := &Config{}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	walkStrings(reflect.ValueOf(out).Elem(), "", func(path, s string) string {
+		if ref, ok := c.secretRefs[path]; ok && ref.value == s {
+			return secrets.RefPrefix + ref.name
+		}
+		return s
+	})
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// credentialSuffixes are the field name endings of config values that hold
+// credentials.
+var credentialSuffixes = []string{"APIKey", "Token", "Secret", "Password", "EncryptKey"}
+
+// isCredentialPath reports whether path (e.g. "Providers.Anthropic.APIKey")
+// names a credential.
+func isCredentialPath(path string) bool {
+	name := path[strings.LastIndex(path, ".")+1:]
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	for _, suffix := range credentialSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findPlaintextSecrets returns the paths of credentials set in plaintext, that
+// is neither empty nor a "secret:<name>" reference.
+func (c *Config) findPlaintextSecrets() []string {
+	var paths []string
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path, s string) string {
+		if _, ref := secrets.ParseRef(s); s != "" && !ref && isCredentialPath(path) {
+			paths = append(paths, path)
+		}
+		return s
+	})
+	sort.Strings(paths)
+	return paths
+}
+
+// PlaintextSecrets returns the paths of credentials that the loaded config file
+// holds in plaintext, e.g. "Providers.Anthropic.APIKey". Move them to the
+// encrypted store with MoveSecretsToStore.
+func (c *Config) PlaintextSecrets() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.plaintext...)
+}
+
+// MoveSecretsToStore puts every plaintext credential of the config file in
+// store, named after its path (e.g. "providers.anthropic.apikey"), and
+// remembers it as a reference so that the next SaveConfig writes
+// "secret:<name>" instead of the value. The caller saves store and config.
+// It returns the names of the moved secrets.
+func (c *Config) MoveSecretsToStore(store *secrets.Store) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := make(map[string]bool, len(c.plaintext))
+	for _, path := range c.plaintext {
+		pending[path] = true
+	}
+	var names []string
+	var moveErr error
+	walkStrings(reflect.ValueOf(c).Elem(), "", func(path, s string) string {
+		if !pending[path] || s == "" || moveErr != nil {
+			return s
+		}
+		name := secretNameForPath(path)
+		if err := store.Set(name, s); err != nil {
+			moveErr = fmt.Errorf("%s: %w", path, err)
+			return s
+		}
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[path] = secretRef{name: name, value: s}
+		names = append(names, name)
+		return s
+	})
+	if moveErr != nil {
+		return nil, moveErr
+	}
+	c.plaintext = nil
+	sort.Strings(names)
+	return names, nil
+}
+
+// secretNameForPath derives a secret name from a field path:
+// "Channels.API.Tokens[0].Token" becomes "channels.api.tokens.0.token".
+func secretNameForPath(path string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '.'
+	}, path)
+	for strings.Contains(name, "..") {
+		name = strings.ReplaceAll(name, "..", ".")
+	}
+	return strings.Trim(name, ".")
+}
+
+// walkStrings calls fn for every string reachable from v through exported
+// struct fields, pointers, slices and string-keyed maps, and stores what fn
+// returns. path names the string, e.g. "Providers.Anthropic.APIKey".
+func walkStrings(v reflect.Value, path string, fn func(path, s string) string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				walkStrings(v.Field(i), strings.TrimPrefix(path+"."+f.Name, "."), fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			// Map values are not addressable: edit a copy and store it back.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			walkStrings(elem, fmt.Sprintf("%s[%s]", path, k.String()), fn)
+			v.SetMapIndex(k, elem)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			if s := fn(path, v.String()); s != v.String() {
+				v.SetString(s)
+			}
+		}
+	}
+}
@@ -20,6 +20,7 @@ type periodicCheck struct {
 
 type Server struct {
 	server         *http.Server
+	mux            *http.ServeMux
 	mu             sync.RWMutex
 	ready          bool
 	checks         map[string]Check
@@ -43,6 +44,7 @@ type StatusResponse struct {
 func NewServer(host string, port int) *Server {
 	mux := http.NewServeMux()
 	s := &Server{
+		mux:       mux,
 		ready:     false,
 		checks:    make(map[string]Check),
 		startTime: time.Now(),
@@ -62,6 +64,12 @@ func NewServer(host string, port int) *Server {
 	return s
 }
 
+// Handle mounts an additional endpoint (e.g. the jobs API) on the gateway's
+// HTTP server. It must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 func (s *Server) Start() error {
 	s.mu.Lock()
 	s.ready = true
@@ -46,6 +46,29 @@ func (g *Generator) Next() string {
 	return fmt.Sprintf("job_%s_%03d", g.currentDate, g.counter)
 }
 
+// Observe records an existing JobID (e.g. one loaded from the job journal)
+// so that Next never returns it again today. IDs from other days or in
+// another format are ignored.
+func (g *Generator) Observe(jobID string) {
+	var date string
+	var n int
+	if _, err := fmt.Sscanf(jobID, "job_%8s_%d", &date, &n); err != nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	today := time.Now().Format("20060102")
+	if today != g.currentDate {
+		g.currentDate = today
+		g.counter = 0
+	}
+	if date == g.currentDate && n > g.counter {
+		g.counter = n
+	}
+}
+
 // Reset resets the generator's counter (primarily for testing).
 func (g *Generator) Reset() {
 	g.mu.Lock()
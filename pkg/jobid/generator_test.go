@@ -130,3 +130,18 @@ func TestGenerator_DateRollover(t *testing.T) {
 		t.Logf("Warning: dates are same (expected different on reset), id1=%s, id3=%s", id1, id3)
 	}
 }
+
+func TestGenerator_Observe(t *testing.T) {
+	g := NewGenerator()
+	today := time.Now().Format("20060102")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("20060102")
+
+	g.Observe("job_" + today + "_041")
+	g.Observe("job_" + today + "_007")     // lower counters are ignored
+	g.Observe("job_" + yesterday + "_900") // other days are ignored
+	g.Observe("not-a-job-id")
+
+	if got, want := g.Next(), "job_"+today+"_042"; got != want {
+		t.Errorf("Next() after Observe = %s, want %s", got, want)
+	}
+}
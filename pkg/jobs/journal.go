@@ -0,0 +1,373 @@
+// Package jobs keeps a durable journal of job state transitions so that work
+// interrupted by a gateway restart can be resumed or failed cleanly.
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
+)
+
+// JournalFile is the file name of the job journal under workspace/state.
+const JournalFile = "jobs.jsonl"
+
+// State is a step in a job's lifecycle.
+type State string
+
+const (
+	StateReceived  State = "received"  // message accepted for processing
+	StateRouted    State = "routed"    // route decided
+	StateDelegated State = "delegated" // handed to a Worker/Coder/Order
+	StateProposal  State = "proposal"  // patch waiting for /approve
+	StateExecuting State = "executing" // Worker is applying a patch
+	StateDone      State = "done"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled" // stopped by /cancel or `picoclaw jobs cancel`
+)
+
+// Finished reports whether no more work will happen for a job in state s.
+func (s State) Finished() bool {
+	return s == StateDone || s == StateFailed || s == StateCancelled
+}
+
+// InFlight reports whether a job in state s was being worked on. Jobs parked
+// as proposals are not in flight: they wait for the user, not for the gateway.
+func (s State) InFlight() bool {
+	switch s {
+	case StateReceived, StateRouted, StateDelegated, StateExecuting:
+		return true
+	}
+	return false
+}
+
+// Event is one line of the journal. Only JobID and State are required; other
+// fields update the job when set.
+type Event struct {
+	Time       time.Time         `json:"ts"`
+	JobID      string            `json:"job_id"`
+	State      State             `json:"state"`
+	Channel    string            `json:"channel,omitempty"`
+	ChatID     string            `json:"chat_id,omitempty"`
+	SessionKey string            `json:"session_key,omitempty"`
+	SenderID   string            `json:"sender_id,omitempty"`
+	Route      string            `json:"route,omitempty"`
+	Content    string            `json:"content,omitempty"`
+	Media      []string          `json:"media,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Detail     string            `json:"detail,omitempty"`
+	// Attempt is the run number (1 for the first run, 2 after one resume).
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Job is the current view of a job, folded from its events.
+type Job struct {
+	ID         string            `json:"job_id"`
+	State      State             `json:"state"`
+	Channel    string            `json:"channel,omitempty"`
+	ChatID     string            `json:"chat_id,omitempty"`
+	SessionKey string            `json:"session_key,omitempty"`
+	SenderID   string            `json:"sender_id,omitempty"`
+	Route      string            `json:"route,omitempty"`
+	Content    string            `json:"content,omitempty"`
+	Media      []string          `json:"media,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Detail     string            `json:"detail,omitempty"`
+	Attempts   int               `json:"attempts"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// Journal is an append-only JSONL log of job events with an in-memory index.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	jobs map[string]*Job
+}
+
+// Open loads the journal at path, creating it on the first Record.
+// Lines that cannot be parsed are skipped. A last line without its newline
+// is a write cut short by a crash: it is cut off the file (or, if it is
+// complete, given its newline) so that the next Record starts a line of its
+// own instead of being glued onto it and lost.
+func Open(path string) (*Journal, error) {
+	j := &Journal{path: path, jobs: make(map[string]*Job)}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return nil, fmt.Errorf("failed to open job journal: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64 // end of the last complete line
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			if err := j.repairTail(f, offset, line); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if len(line) > 0 {
+			offset += int64(len(line))
+			j.applyLine(line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job journal: %w", err)
+		}
+	}
+	return j, nil
+}
+
+// applyLine applies one journal line, reporting whether it was an event.
+func (j *Journal) applyLine(line []byte) bool {
+	var ev Event
+	if err := json.Unmarshal(line, &ev); err != nil || ev.JobID == "" {
+		return false
+	}
+	j.apply(ev)
+	return true
+}
+
+// repairTail handles a last line that lacks its newline: a complete event
+// is kept and terminated, anything else is truncated away.
+func (j *Journal) repairTail(f *os.File, offset int64, line []byte) error {
+	if j.applyLine(line) {
+		if _, err := f.WriteAt([]byte{'\n'}, offset+int64(len(line))); err != nil {
+			return fmt.Errorf("failed to repair job journal: %w", err)
+		}
+	} else if err := f.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to repair job journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to repair job journal: %w", err)
+	}
+	return nil
+}
+
+// Record appends ev to the journal and updates the job. Finished is final:
+// events for a job that is already done, failed or cancelled are ignored.
+func (j *Journal) Record(ev Event) error {
+	if ev.JobID == "" || ev.State == "" {
+		return fmt.Errorf("job event requires job_id and state")
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(redacted(ev))
+	if err != nil {
+		return fmt.Errorf("failed to marshal job event: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job, ok := j.jobs[ev.JobID]; ok && job.State.Finished() {
+		return nil
+	}
+	if err := j.append(data); err != nil {
+		return err
+	}
+	j.apply(ev)
+	return nil
+}
+
+func (j *Journal) append(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("failed to create job journal dir: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open job journal: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write job event: %w", err)
+	}
+	// Every event is a state transition the gateway relies on after a crash.
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync job journal: %w", err)
+	}
+	return nil
+}
+
+func (j *Journal) apply(ev Event) {
+	job, ok := j.jobs[ev.JobID]
+	if !ok {
+		job = &Job{ID: ev.JobID, CreatedAt: ev.Time}
+		j.jobs[ev.JobID] = job
+	}
+	job.State = ev.State
+	job.UpdatedAt = ev.Time
+	if ev.Channel != "" {
+		job.Channel = ev.Channel
+	}
+	if ev.ChatID != "" {
+		job.ChatID = ev.ChatID
+	}
+	if ev.SessionKey != "" {
+		job.SessionKey = ev.SessionKey
+	}
+	if ev.SenderID != "" {
+		job.SenderID = ev.SenderID
+	}
+	if ev.Route != "" {
+		job.Route = ev.Route
+	}
+	if ev.Content != "" {
+		job.Content = ev.Content
+	}
+	if len(ev.Media) > 0 {
+		job.Media = ev.Media
+	}
+	if len(ev.Metadata) > 0 {
+		job.Metadata = ev.Metadata
+	}
+	job.Detail = ev.Detail
+	if ev.Attempt > job.Attempts {
+		job.Attempts = ev.Attempt
+	}
+}
+
+// Get returns the job with the given ID.
+func (j *Journal) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns all jobs, oldest first.
+func (j *Journal) List() []Job {
+	j.mu.Lock()
+	list := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		list = append(list, *job)
+	}
+	j.mu.Unlock()
+
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].CreatedAt.Equal(list[b].CreatedAt) {
+			return list[a].ID < list[b].ID
+		}
+		return list[a].CreatedAt.Before(list[b].CreatedAt)
+	})
+	return list
+}
+
+// Unfinished returns the jobs that were in flight, oldest first.
+func (j *Journal) Unfinished() []Job {
+	var out []Job
+	for _, job := range j.List() {
+		if job.State.InFlight() {
+			out = append(out, job)
+		}
+	}
+	return out
+}
+
+// Compact rewrites the journal as a snapshot of each job, dropping finished jobs
+// last updated before cutoff.
+func (j *Journal) Compact(cutoff time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var kept []*Job
+	for id, job := range j.jobs {
+		if job.State.Finished() && job.UpdatedAt.Before(cutoff) {
+			delete(j.jobs, id)
+			continue
+		}
+		kept = append(kept, job)
+	}
+	sort.Slice(kept, func(a, b int) bool { return kept[a].CreatedAt.Before(kept[b].CreatedAt) })
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("failed to create job journal dir: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to compact job journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, job := range kept {
+		// The creation event keeps CreatedAt; the snapshot carries the rest.
+		for _, ev := range []Event{
+			{Time: job.CreatedAt, JobID: job.ID, State: StateReceived},
+			snapshot(job),
+		} {
+			data, err := json.Marshal(redacted(ev))
+			if err != nil {
+				f.Close()
+				os.Remove(tmp)
+				return fmt.Errorf("failed to marshal job event: %w", err)
+			}
+			w.Write(append(data, '\n'))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact job journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact job journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact job journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact job journal: %w", err)
+	}
+	return nil
+}
+
+// redacted returns ev as written to the file: message contents and details
+// go through the default redactor, while the in-memory jobs keep them
+// intact. A job resumed after a restart gets the redacted content.
+func redacted(ev Event) Event {
+	if r := redact.Default(); r != nil {
+		ev.Content = r.Redact(ev.SessionKey, ev.Content)
+		ev.Detail = r.Redact(ev.SessionKey, ev.Detail)
+	}
+	return ev
+}
+
+func snapshot(job *Job) Event {
+	return Event{
+		Time:       job.UpdatedAt,
+		JobID:      job.ID,
+		State:      job.State,
+		Channel:    job.Channel,
+		ChatID:     job.ChatID,
+		SessionKey: job.SessionKey,
+		SenderID:   job.SenderID,
+		Route:      job.Route,
+		Content:    job.Content,
+		Media:      job.Media,
+		Metadata:   job.Metadata,
+		Detail:     job.Detail,
+		Attempt:    job.Attempts,
+	}
+}
@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal_ReplayAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", JournalFile)
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	events := []Event{
+		{JobID: "job_1", State: StateReceived, Channel: "telegram", ChatID: "42", Content: "/code fix it", Attempt: 1},
+		{JobID: "job_1", State: StateRouted, Route: "CODE"},
+		{JobID: "job_1", State: StateDelegated},
+		{JobID: "job_2", State: StateReceived, Channel: "line", ChatID: "u1", Content: "hello", Attempt: 1},
+		{JobID: "job_2", State: StateDone},
+		{JobID: "job_3", State: StateReceived, Channel: "slack", ChatID: "c1", Content: "patch"},
+		{JobID: "job_3", State: StateProposal},
+	}
+	for _, ev := range events {
+		if err := j.Record(ev); err != nil {
+			t.Fatalf("Record(%+v) error: %v", ev, err)
+		}
+	}
+
+	// A torn last line from a crash must not break replay.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"job_id":"job_4","sta`)
+	f.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	job, ok := reopened.Get("job_1")
+	if !ok {
+		t.Fatal("job_1 missing after reopen")
+	}
+	if job.State != StateDelegated || job.Route != "CODE" || job.Channel != "telegram" ||
+		job.ChatID != "42" || job.Content != "/code fix it" || job.Attempts != 1 {
+		t.Errorf("unexpected job_1: %+v", job)
+	}
+
+	unfinished := reopened.Unfinished()
+	if len(unfinished) != 1 || unfinished[0].ID != "job_1" {
+		t.Errorf("Unfinished() = %+v, want only job_1 (proposals and done jobs are not in flight)", unfinished)
+	}
+	if len(reopened.List()) != 3 {
+		t.Errorf("List() = %d jobs, want 3", len(reopened.List()))
+	}
+}
+
+func TestJournal_RecordAfterTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), JournalFile)
+	for _, tail := range []string{
+		`{"job_id":"job_2","sta`,
+		`{"ts":"2026-10-16T10:00:00Z","job_id":"job_2","state":"received"}`,
+	} {
+		os.WriteFile(path, []byte(`{"ts":"2026-10-16T09:00:00Z","job_id":"job_1","state":"routed"}`+"\n"+tail), 0644)
+
+		// The first event after the restart is the recovery record; it must
+		// survive the next restart.
+		j, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		if err := j.Record(Event{JobID: "job_1", State: StateFailed, Detail: "interrupted by restart"}); err != nil {
+			t.Fatalf("Record() error: %v", err)
+		}
+
+		reopened, err := Open(path)
+		if err != nil {
+			t.Fatalf("reopen error: %v", err)
+		}
+		if job, _ := reopened.Get("job_1"); job.State != StateFailed {
+			t.Errorf("tail %q: recovery event lost, job_1 = %+v", tail, job)
+		}
+		_, kept := reopened.Get("job_2")
+		if complete := strings.HasSuffix(tail, "}"); kept != complete {
+			t.Errorf("tail %q: job_2 kept = %v, want %v", tail, kept, complete)
+		}
+	}
+}
+
+func TestJournal_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), JournalFile)
+	j, _ := Open(path)
+	old := time.Now().AddDate(0, 0, -30)
+
+	j.Record(Event{Time: old, JobID: "job_old", State: StateReceived, Channel: "telegram", Content: "old"})
+	j.Record(Event{Time: old, JobID: "job_old", State: StateDone})
+	j.Record(Event{Time: old, JobID: "job_stuck", State: StateReceived, Channel: "telegram", Content: "stuck", Attempt: 2})
+	j.Record(Event{JobID: "job_new", State: StateReceived, Channel: "line", Content: "new"})
+	j.Record(Event{JobID: "job_new", State: StateFailed, Detail: "boom"})
+
+	if err := j.Compact(time.Now().AddDate(0, 0, -7)); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	if _, ok := reopened.Get("job_old"); ok {
+		t.Error("finished job older than the cutoff should be dropped")
+	}
+	stuck, ok := reopened.Get("job_stuck")
+	if !ok || stuck.State != StateReceived || stuck.Attempts != 2 || stuck.Content != "stuck" ||
+		!stuck.CreatedAt.Equal(old.Round(0)) {
+		t.Errorf("unfinished job should survive compaction unchanged: %+v", stuck)
+	}
+	if job, ok := reopened.Get("job_new"); !ok || job.State != StateFailed || job.Detail != "boom" {
+		t.Errorf("recent job should survive compaction: %+v", job)
+	}
+}
+
+func TestJournal_RedactsFileOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), JournalFile)
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	secret := "sk-abcdefghijklmnopqrstuvwx"
+	j.Record(Event{JobID: "job_1", State: StateReceived, Content: "use key " + secret})
+	j.Record(Event{JobID: "job_1", State: StateFailed, Detail: "401 for " + secret})
+
+	if job, _ := j.Get("job_1"); !strings.Contains(job.Content, secret) {
+		t.Errorf("in-memory content was redacted: %q", job.Content)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), secret) {
+		t.Errorf("journal contains the secret:\n%s", data)
+	}
+	if err := j.Compact(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), secret) || !strings.Contains(string(data), "[REDACTED:api_key]") {
+		t.Errorf("compacted journal not redacted:\n%s", data)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
 )
 
 type LogLevel int
@@ -101,6 +103,13 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 		return
 	}
 
+	// Secrets and personal data never reach the console or the log file.
+	if r := redact.Default(); r != nil {
+		session, _ := fields["session_key"].(string)
+		message = r.Redact(session, message)
+		fields = redactFields(r, session, fields)
+	}
+
 	entry := LogEntry{
 		Level:     logLevelNames[level],
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -143,6 +152,47 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 	}
 }
 
+// redactFields returns a copy of fields with their values redacted. Values
+// that are not strings are redacted in their printed form, and replaced by it
+// only when something was masked.
+func redactFields(r *redact.Redactor, session string, fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return fields
+	}
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		out[k] = redactValue(r, session, v)
+	}
+	return out
+}
+
+func redactValue(r *redact.Redactor, session string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return r.Redact(session, v)
+	case error:
+		return r.Redact(session, v.Error())
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			out[i] = r.Redact(session, s)
+		}
+		return out
+	case map[string]interface{}:
+		return redactFields(r, session, v)
+	case bool, int, int64, float64, time.Duration:
+		return v
+	default:
+		printed := fmt.Sprint(v)
+		if redacted := r.Redact(session, printed); redacted != printed {
+			return redacted
+		}
+		return v
+	}
+}
+
 func formatComponent(component string) string {
 	if component == "" {
 		return ""
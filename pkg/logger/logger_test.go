@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +140,36 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]interface{}{"key": "value"})
 }
+
+func TestLogRedactsSecrets(t *testing.T) {
+	initialLevel := GetLevel()
+	defer SetLevel(initialLevel)
+	SetLevel(INFO)
+
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	if err := EnableFileLogging(path); err != nil {
+		t.Fatalf("EnableFileLogging failed: %v", err)
+	}
+	InfoCF("test", "sending to alice@example.com", map[string]interface{}{
+		"session_key": "telegram:1",
+		"header":      "Bearer abcdefgh12345678",
+		"nested":      map[string]interface{}{"api_key": "sk-abcdefghijklmnopqrstuvwx"},
+		"count":       3,
+	})
+	DisableFileLogging()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	out := string(data)
+	for _, secret := range []string{"abcdefgh12345678", "sk-abcdefghijklmnopqrstuvwx"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q:\n%s", secret, out)
+		}
+	}
+	// Emails are only masked when the email detector is enabled.
+	if !strings.Contains(out, "alice@example.com") || !strings.Contains(out, "[REDACTED:bearer_token]") || !strings.Contains(out, `"count":3`) {
+		t.Errorf("unexpected log entry:\n%s", out)
+	}
+}
@@ -2,7 +2,11 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"net/http"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
 )
 
 // ChromeNavigate はブラウザで指定 URL に移動
@@ -67,6 +71,30 @@ func (c *Client) ChromeScreenshot(ctx context.Context) (string, error) {
 	return result, nil
 }
 
+// ChromeScreenshotAttachment はスクリーンショットを取得し、チャットに送れる添付ファイルとして返す
+func (c *Client) ChromeScreenshotAttachment(ctx context.Context) (bus.Attachment, error) {
+	encoded, err := c.ChromeScreenshot(ctx)
+	if err != nil {
+		return bus.Attachment{}, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return bus.Attachment{}, fmt.Errorf("invalid screenshot data: %w", err)
+	}
+
+	contentType := http.DetectContentType(data)
+	filename := "screenshot.png"
+	if contentType == "image/jpeg" {
+		filename = "screenshot.jpg"
+	}
+	return bus.Attachment{
+		Data:     data,
+		MIMEType: contentType,
+		Filename: filename,
+	}, nil
+}
+
 // ChromeGetText は指定セレクタの要素のテキストを取得
 func (c *Client) ChromeGetText(ctx context.Context, selector string) (string, error) {
 	resp, err := c.CallTool(ctx, "chrome_get_text", map[string]interface{}{
@@ -1,137 +1,199 @@
 package mcp
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultTimeout は1回の呼び出しのデフォルトタイムアウト
+const DefaultTimeout = 30 * time.Second
+
+// clientInfo は initialize でサーバーに名乗るクライアント情報
+var clientInfo = Implementation{Name: "picoclaw", Version: "1.0.0"}
+
 // Client は MCP クライアント
+// 最初の呼び出し時に initialize ハンドシェイクを行い、サーバーの機能を記録する
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	transport Transport
+	timeout   time.Duration
+	nextID    atomic.Int64
+
+	initMu      sync.Mutex
+	initialized bool
+	initResult  InitializeResult
+
+	notifyMu       sync.RWMutex
+	onToolsChanged func()
 }
 
-// NewClient は新しい MCP クライアントを作成
+// NewClient は baseURL + "/mcp" に Streamable HTTP で接続する MCP クライアントを作成
 func NewClient(baseURL string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}
+	return NewClientWithTransport(NewHTTPTransport(strings.TrimRight(baseURL, "/")+"/mcp", nil), DefaultTimeout)
 }
 
-// ListTools は利用可能なツール一覧を取得
-func (c *Client) ListTools(ctx context.Context) (*ToolListResponse, error) {
-	req := MCPRequest{
-		Method: "tools/list",
-		Params: make(map[string]interface{}),
+// NewClientWithTransport は任意のトランスポートで MCP クライアントを作成
+// timeout が 0 以下ならデフォルトを使う
+func NewClientWithTransport(transport Transport, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
+	c := &Client{transport: transport, timeout: timeout}
+	transport.SetHandler(c.handleServerMessage)
+	return c
+}
 
-	resp, err := c.call(ctx, req)
-	if err != nil {
-		return nil, err
-	}
+// OnToolsChanged は notifications/tools/list_changed を受けたときに呼ぶ関数を設定
+func (c *Client) OnToolsChanged(fn func()) {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	c.onToolsChanged = fn
+}
 
-	if resp.Error != nil {
-		return nil, fmt.Errorf("MCP error: %s", resp.Error.Message)
+// Initialize は initialize ハンドシェイクを行う（2回目以降は記録済みの結果を返す）
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+	c.initMu.Lock()
+	defer c.initMu.Unlock()
+	if c.initialized {
+		result := c.initResult
+		return &result, nil
 	}
 
-	var result ToolListResponse
-	data, _ := json.Marshal(resp.Result)
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal tools: %w", err)
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    ClientCapabilities{},
+		ClientInfo:      clientInfo,
+	}
+	var result InitializeResult
+	if err := c.request(ctx, "initialize", params, &result); err != nil {
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, fmt.Errorf("initialized notification: %w", err)
 	}
 
+	c.initResult = result
+	c.initialized = true
 	return &result, nil
 }
 
-// CallTool は指定されたツールを呼び出す
-func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*ToolCallResponse, error) {
-	req := MCPRequest{
-		Method: "tools/call",
-		Params: map[string]interface{}{
-			"name":      name,
-			"arguments": args,
-		},
-	}
+// ServerInfo は initialize で得たサーバー情報を返す（未初期化なら ok=false）
+func (c *Client) ServerInfo() (InitializeResult, bool) {
+	c.initMu.Lock()
+	defer c.initMu.Unlock()
+	return c.initResult, c.initialized
+}
 
-	resp, err := c.call(ctx, req)
-	if err != nil {
+// ListTools は利用可能なツール一覧を取得（nextCursor を辿ってすべて取得する）
+func (c *Client) ListTools(ctx context.Context) (*ToolListResponse, error) {
+	if _, err := c.Initialize(ctx); err != nil {
 		return nil, err
 	}
 
-	if resp.Error != nil {
-		return nil, fmt.Errorf("MCP error: %s", resp.Error.Message)
+	all := &ToolListResponse{}
+	cursor := ""
+	for {
+		var page ToolListResponse
+		if err := c.request(ctx, "tools/list", ToolListRequest{Cursor: cursor}, &page); err != nil {
+			return nil, err
+		}
+		all.Tools = append(all.Tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return all, nil
+		}
+		cursor = page.NextCursor
 	}
+}
 
-	var result ToolCallResponse
-	data, _ := json.Marshal(resp.Result)
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal tool response: %w", err)
+// CallTool は指定されたツールを呼び出す
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*ToolCallResponse, error) {
+	if _, err := c.Initialize(ctx); err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = map[string]interface{}{}
 	}
 
+	var result ToolCallResponse
+	if err := c.request(ctx, "tools/call", ToolCallRequest{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
 	return &result, nil
 }
 
-// call は MCP サーバーに HTTP リクエストを送信
-func (c *Client) call(ctx context.Context, req MCPRequest) (*MCPResponse, error) {
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+// Ping は MCP サーバーのヘルスチェック
+func (c *Client) Ping(ctx context.Context) error {
+	if _, err := c.Initialize(ctx); err != nil {
+		return err
 	}
+	return c.request(ctx, "ping", nil, nil)
+}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/mcp", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
+// Close はトランスポートを閉じる
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+// request は JSON-RPC リクエストを送り、result に結果をデコードする
+func (c *Client) request(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
 
-	httpResp, err := c.httpClient.Do(httpReq)
+	req, err := NewRequest(c.nextID.Add(1), method, params)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return fmt.Errorf("marshal request: %w", err)
 	}
-	defer httpResp.Body.Close()
-
-	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status: %d", httpResp.StatusCode)
-	}
-
-	respBody, err := io.ReadAll(httpResp.Body)
+	resp, err := c.transport.Send(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return err
 	}
-
-	var mcpResp MCPResponse
-	if err := json.Unmarshal(respBody, &mcpResp); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if resp == nil {
+		return fmt.Errorf("%s: empty response", method)
 	}
-
-	return &mcpResp, nil
+	if resp.Error != nil {
+		return fmt.Errorf("MCP error: %s", resp.Error.Message)
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("unmarshal %s result: %w", method, err)
+	}
+	return nil
 }
 
-// Ping は MCP サーバーのヘルスチェック
-func (c *Client) Ping(ctx context.Context) error {
-	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/health", nil)
-	if err != nil {
-		return fmt.Errorf("create request: %w", err)
-	}
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
 
-	httpResp, err := c.httpClient.Do(httpReq)
+	msg, err := NewNotification(method, params)
 	if err != nil {
-		return fmt.Errorf("http request: %w", err)
+		return fmt.Errorf("marshal notification: %w", err)
 	}
-	defer httpResp.Body.Close()
+	_, err = c.transport.Send(ctx, msg)
+	return err
+}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("http status: %d", httpResp.StatusCode)
+// handleServerMessage はサーバーからのリクエスト・通知に応答する
+func (c *Client) handleServerMessage(ctx context.Context, msg *Message) *Message {
+	switch msg.Method {
+	case "ping":
+		return NewResult(msg.ID, map[string]interface{}{})
+	case "notifications/tools/list_changed":
+		c.notifyMu.RLock()
+		fn := c.onToolsChanged
+		c.notifyMu.RUnlock()
+		if fn != nil {
+			fn()
+		}
+		return nil
+	}
+	if msg.IsRequest() {
+		return NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found: "+msg.Method)
 	}
-
 	return nil
 }
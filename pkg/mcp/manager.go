@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// Manager は設定された MCP サーバーへ接続し、各サーバーのツールを
+// tools.ToolRegistry に登録する。tools/list_changed を受けると登録し直す
+type Manager struct {
+	registry *tools.ToolRegistry
+
+	mu         sync.Mutex
+	clients    map[string]*Client
+	registered map[string][]string // サーバー名 → 登録したツール名
+}
+
+// NewManager は registry にツールを登録する Manager を作成
+func NewManager(registry *tools.ToolRegistry) *Manager {
+	return &Manager{
+		registry:   registry,
+		clients:    make(map[string]*Client),
+		registered: make(map[string][]string),
+	}
+}
+
+// ConnectAll は有効なサーバーすべてに並行して接続する
+// 接続に失敗したサーバーはログに残してスキップする
+func (m *Manager) ConnectAll(ctx context.Context, servers map[string]config.MCPServerConfig) {
+	var wg sync.WaitGroup
+	for name, cfg := range servers {
+		if !cfg.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, cfg config.MCPServerConfig) {
+			defer wg.Done()
+			if err := m.Connect(ctx, name, cfg); err != nil {
+				logger.WarnCF("mcp", "server.connect_failed", map[string]interface{}{
+					"server": name,
+					"error":  err.Error(),
+				})
+			}
+		}(name, cfg)
+	}
+	wg.Wait()
+}
+
+// Connect は name のサーバーに接続し、initialize してツールを登録する
+func (m *Manager) Connect(ctx context.Context, name string, cfg config.MCPServerConfig) error {
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	transport, err := NewTransport(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return m.Add(ctx, name, NewClientWithTransport(transport, timeout))
+}
+
+// Add は接続済みのクライアントを name として登録し、ツールを同期する
+func (m *Manager) Add(ctx context.Context, name string, client *Client) error {
+	info, err := client.Initialize(ctx)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	if old, ok := m.clients[name]; ok {
+		old.Close()
+	}
+	m.clients[name] = client
+	m.mu.Unlock()
+
+	client.OnToolsChanged(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancel()
+		if err := m.SyncTools(ctx, name); err != nil {
+			logger.WarnCF("mcp", "server.tools_sync_failed", map[string]interface{}{
+				"server": name,
+				"error":  err.Error(),
+			})
+		}
+	})
+
+	if err := m.SyncTools(ctx, name); err != nil {
+		return err
+	}
+	logger.InfoCF("mcp", "server.connected", map[string]interface{}{
+		"server":           name,
+		"server_name":      info.ServerInfo.Name,
+		"server_version":   info.ServerInfo.Version,
+		"protocol_version": info.ProtocolVersion,
+		"tools":            len(m.ToolNames(name)),
+	})
+	return nil
+}
+
+// SyncTools は name のサーバーの tools/list を取得し、登録済みツールを置き換える
+func (m *Manager) SyncTools(ctx context.Context, name string) error {
+	m.mu.Lock()
+	client, ok := m.clients[name]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown MCP server: %s", name)
+	}
+
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		return fmt.Errorf("list tools: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, toolName := range m.registered[name] {
+		m.registry.Unregister(toolName)
+	}
+	names := make([]string, 0, len(list.Tools))
+	for _, t := range list.Tools {
+		tool := NewRemoteTool(name, client, t)
+		// 名前の正規化で別のツール（組み込みツールや他サーバーのツールを含む）と
+		// 同じ名前になったものは登録せず、先に登録されたものを残す
+		if _, exists := m.registry.Get(tool.Name()); exists {
+			logger.WarnCF("mcp", "server.tool_name_conflict", map[string]interface{}{
+				"server": name,
+				"tool":   t.Name,
+				"name":   tool.Name(),
+			})
+			continue
+		}
+		m.registry.Register(tool)
+		names = append(names, tool.Name())
+	}
+	m.registered[name] = names
+	return nil
+}
+
+// ToolNames は name のサーバーから登録したツール名を返す
+func (m *Manager) ToolNames(name string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.registered[name]...)
+}
+
+// Client は name のサーバーのクライアントを返す
+func (m *Manager) Client(name string) (*Client, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.clients[name]
+	return c, ok
+}
+
+// Servers は接続済みのサーバー名を返す
+func (m *Manager) Servers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close はすべての接続を閉じ、登録したツールを外す
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, client := range m.clients {
+		for _, toolName := range m.registered[name] {
+			m.registry.Unregister(toolName)
+		}
+		if err := client.Close(); err != nil {
+			logger.WarnCF("mcp", "server.close_failed", map[string]interface{}{
+				"server": name,
+				"error":  err.Error(),
+			})
+		}
+	}
+	m.clients = make(map[string]*Client)
+	m.registered = make(map[string][]string)
+}
+
+// NewTransport は設定に応じたトランスポートを作成
+func NewTransport(ctx context.Context, cfg config.MCPServerConfig) (Transport, error) {
+	kind := strings.ToLower(strings.TrimSpace(cfg.Transport))
+	if kind == "" {
+		kind = "http"
+		if cfg.Command != "" {
+			kind = "stdio"
+		}
+	}
+
+	switch kind {
+	case "stdio":
+		return NewStdioTransport(cfg.Command, cfg.Args, cfg.Env)
+	case "http", "streamable-http", "streamable_http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("http transport requires a url")
+		}
+		return NewHTTPTransport(cfg.URL, cfg.Headers), nil
+	case "sse":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("sse transport requires a url")
+		}
+		return NewSSETransport(ctx, cfg.URL, cfg.Headers)
+	default:
+		return nil, fmt.Errorf("unknown MCP transport: %s", cfg.Transport)
+	}
+}
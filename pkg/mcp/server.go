@@ -0,0 +1,438 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// ServerChannel はMCP 経由のツール呼び出しに渡すチャネル名
+const ServerChannel = "mcp"
+
+const (
+	// maxHTTPBodyBytes は Streamable HTTP で受け付けるリクエストボディの上限
+	maxHTTPBodyBytes = 4 << 20
+	// maxSessions を超えてセッションを発行すると、最も長く使われていないものを捨てる
+	maxSessions = 1024
+	// sessionIdleTimeout だけ使われなかったセッションは失効する
+	sessionIdleTimeout = time.Hour
+)
+
+// Server は tools.ToolRegistry のツールを MCP サーバーとして公開する
+// ツールはレジストリ上のインスタンスをそのまま実行するため、
+// workspace 制限や ExecTool のガードも通常どおり適用される
+type Server struct {
+	registry *tools.ToolRegistry
+	info     Implementation
+	http     HTTPOptions
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // initialize で発行したセッション ID → 最終利用時刻
+	now      func() time.Time
+}
+
+// HTTPOptions は Streamable HTTP で公開するときのアクセス制御
+type HTTPOptions struct {
+	// Token を設定すると Authorization: Bearer <token> のないリクエストを拒否する
+	Token string
+	// AllowedOrigins はブラウザからの呼び出しを許す Origin。Origin ヘッダーが
+	// 付いていてここにないリクエストは拒否する
+	AllowedOrigins []string
+	// AllowedHosts はループバック以外に受け付ける Host ヘッダーの値（ポート無し）。
+	// DNS リバインディング対策として、それ以外の Host は拒否する
+	AllowedHosts []string
+}
+
+// NewServer は registry のツールを公開する MCP サーバーを作成
+func NewServer(registry *tools.ToolRegistry, info Implementation) *Server {
+	return &Server{registry: registry, info: info, sessions: make(map[string]time.Time), now: time.Now}
+}
+
+// ExportRegistry は src のツールと extra のうち names にあるものを登録した
+// 公開用のレジストリを返す。names が空ならすべてを公開する。
+// extra は MCP サーバーだけに置くツール（ask_agent など）に使う
+func ExportRegistry(src *tools.ToolRegistry, names []string, extra ...tools.Tool) *tools.ToolRegistry {
+	exported := tools.NewToolRegistry()
+	allowed := func(name string) bool {
+		return len(names) == 0 || containsFold(names, name)
+	}
+	for _, name := range src.List() {
+		if tool, ok := src.Get(name); ok && allowed(name) {
+			exported.Register(tool)
+		}
+	}
+	for _, tool := range extra {
+		if allowed(tool.Name()) {
+			exported.Register(tool)
+		}
+	}
+	return exported
+}
+
+// SetHTTPOptions は ServeHTTP のアクセス制御を設定する
+func (s *Server) SetHTTPOptions(opts HTTPOptions) {
+	s.http = opts
+}
+
+// HandleMessage は1つのメッセージを処理し、レスポンスを返す（通知なら nil）
+func (s *Server) HandleMessage(ctx context.Context, msg *Message) *Message {
+	if msg.IsResponse() {
+		return nil
+	}
+	if msg.Method == "" {
+		return NewErrorResponse(msg.ID, ErrCodeInvalidRequest, "missing method")
+	}
+
+	var resp *Message
+	switch msg.Method {
+	case "initialize":
+		resp = s.handleInitialize(msg)
+	case "ping":
+		resp = NewResult(msg.ID, map[string]interface{}{})
+	case "tools/list":
+		resp = NewResult(msg.ID, ToolListResponse{Tools: s.listTools()})
+	case "tools/call":
+		resp = s.handleToolCall(ctx, msg)
+	default:
+		if strings.HasPrefix(msg.Method, "notifications/") {
+			return nil
+		}
+		resp = NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found: "+msg.Method)
+	}
+	if msg.IsNotification() {
+		return nil
+	}
+	return resp
+}
+
+func (s *Server) handleInitialize(msg *Message) *Message {
+	var params InitializeParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return NewErrorResponse(msg.ID, ErrCodeInvalidParams, err.Error())
+		}
+	}
+	logger.InfoCF("mcp", "server.initialize", map[string]interface{}{
+		"client":           params.ClientInfo.Name,
+		"client_version":   params.ClientInfo.Version,
+		"protocol_version": params.ProtocolVersion,
+	})
+	return NewResult(msg.ID, InitializeResult{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+		ServerInfo:      s.info,
+	})
+}
+
+// listTools はレジストリのツールを名前順で返す（inputSchema は Parameters() そのまま）
+func (s *Server) listTools() []Tool {
+	names := s.registry.List()
+	sort.Strings(names)
+	list := make([]Tool, 0, len(names))
+	for _, name := range names {
+		tool, ok := s.registry.Get(name)
+		if !ok {
+			continue
+		}
+		list = append(list, Tool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.Parameters(),
+		})
+	}
+	return list
+}
+
+func (s *Server) handleToolCall(ctx context.Context, msg *Message) *Message {
+	var params ToolCallRequest
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return NewErrorResponse(msg.ID, ErrCodeInvalidParams, err.Error())
+	}
+	if _, ok := s.registry.Get(params.Name); !ok {
+		return NewErrorResponse(msg.ID, ErrCodeInvalidParams, "unknown tool: "+params.Name)
+	}
+	if params.Arguments == nil {
+		params.Arguments = map[string]interface{}{}
+	}
+
+	result := s.registry.ExecuteWithContext(ctx, params.Name, params.Arguments, ServerChannel, "direct", nil)
+	text := result.ForLLM
+	if text == "" {
+		text = result.ForUser
+	}
+	return NewResult(msg.ID, ToolCallResponse{
+		Content: []map[string]interface{}{{"type": "text", "text": text}},
+		IsError: result.IsError,
+	})
+}
+
+// ServeStdio は r/w の改行区切り JSON で MCP を提供する。r が EOF になるか ctx が終わると戻る
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	var writeMu sync.Mutex
+	write := func(msg *Message) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+		scanErr <- scanner.Err()
+		close(lines)
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return <-scanErr
+			}
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				write(NewErrorResponse(json.RawMessage("null"), ErrCodeParse, err.Error()))
+				continue
+			}
+			// ツール呼び出しは時間がかかるので並行に処理する
+			wg.Add(1)
+			go func(msg *Message) {
+				defer wg.Done()
+				if resp := s.HandleMessage(ctx, msg); resp != nil {
+					write(resp)
+				}
+			}(&msg)
+		}
+	}
+}
+
+// ServeHTTP は Streamable HTTP で MCP を提供する
+// POST のリクエストには application/json で応答し、通知には 202 を返す
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, reason := s.checkHTTPAccess(r); status != 0 {
+		logger.WarnCF("mcp", "server.http_rejected", map[string]interface{}{
+			"reason": reason,
+			"remote": r.RemoteAddr,
+			"host":   r.Host,
+			"origin": r.Header.Get("Origin"),
+		})
+		http.Error(w, reason, status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		sid := r.Header.Get(sessionHeader)
+		if !s.endSession(sid) {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// JSON-RPC のバッチにも対応する
+	var batch []*Message
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, NewErrorResponse(json.RawMessage("null"), ErrCodeParse, err.Error()))
+			return
+		}
+	} else {
+		var msg Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			writeJSON(w, NewErrorResponse(json.RawMessage("null"), ErrCodeParse, err.Error()))
+			return
+		}
+		batch = []*Message{&msg}
+	}
+
+	// initialize 以外は発行済みの Mcp-Session-Id が必要
+	initializing := false
+	for _, msg := range batch {
+		if msg.Method == "initialize" {
+			initializing = true
+		}
+	}
+	if initializing {
+		w.Header().Set(sessionHeader, s.startSession())
+	} else if sid := r.Header.Get(sessionHeader); sid == "" {
+		http.Error(w, "missing "+sessionHeader, http.StatusBadRequest)
+		return
+	} else if !s.hasSession(sid) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	var responses []*Message
+	for _, msg := range batch {
+		if resp := s.HandleMessage(r.Context(), msg); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case len(batch) == 1:
+		writeJSON(w, responses[0])
+	default:
+		writeJSON(w, responses)
+	}
+}
+
+// checkHTTPAccess は Host・Origin・トークンを検査し、拒否するときは
+// ステータスコードと理由を返す（許可なら 0）
+func (s *Server) checkHTTPAccess(r *http.Request) (int, string) {
+	if !s.hostAllowed(r.Host) {
+		return http.StatusForbidden, "host not allowed"
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !containsFold(s.http.AllowedOrigins, origin) {
+		return http.StatusForbidden, "origin not allowed"
+	}
+	if s.http.Token != "" {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.http.Token)) != 1 {
+			return http.StatusUnauthorized, "unauthorized"
+		}
+	}
+	return 0, ""
+}
+
+// hostAllowed は Host ヘッダーがループバックか AllowedHosts にあるかを返す
+func (s *Server) hostAllowed(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return containsFold(s.http.AllowedHosts, host)
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// startSession はセッションを発行する。失効したセッションを掃除し、
+// 上限に達していれば最も長く使われていないセッションを捨てる
+func (s *Server) startSession() string {
+	sid := newSessionID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for id, last := range s.sessions {
+		if now.Sub(last) > sessionIdleTimeout {
+			delete(s.sessions, id)
+		}
+	}
+	for len(s.sessions) >= maxSessions {
+		oldest, oldestAt := "", now
+		for id, last := range s.sessions {
+			if oldest == "" || last.Before(oldestAt) {
+				oldest, oldestAt = id, last
+			}
+		}
+		delete(s.sessions, oldest)
+	}
+	s.sessions[sid] = now
+	return sid
+}
+
+// hasSession はセッションが有効かを返し、有効なら最終利用時刻を更新する
+func (s *Server) hasSession(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.sessions[sid]
+	if !ok {
+		return false
+	}
+	now := s.now()
+	if now.Sub(last) > sessionIdleTimeout {
+		delete(s.sessions, sid)
+		return false
+	}
+	s.sessions[sid] = now
+	return true
+}
+
+func (s *Server) endSession(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[sid]; !ok {
+		return false
+	}
+	delete(s.sessions, sid)
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WarnCF("mcp", "server.write_failed", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("session-%p", &b)
+	}
+	return hex.EncodeToString(b)
+}
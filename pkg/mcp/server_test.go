@@ -0,0 +1,289 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+type fakeAgent struct {
+	gotSession string
+}
+
+func (a *fakeAgent) ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error) {
+	a.gotSession = sessionKey
+	return "agent says: " + content, nil
+}
+
+func newTestServer(t *testing.T) (*Server, string, *fakeAgent) {
+	t.Helper()
+	workspace := t.TempDir()
+	registry := tools.NewToolRegistry()
+	registry.Register(tools.NewReadFileTool(workspace, true))
+	registry.Register(tools.NewExecTool(workspace, true))
+	agent := &fakeAgent{}
+	registry.Register(tools.NewAskAgentTool(agent, ServerChannel))
+	return NewServer(registry, Implementation{Name: "picoclaw", Version: "test"}), workspace, agent
+}
+
+func TestServer_HTTPRoundTrip(t *testing.T) {
+	server, workspace, agent := newTestServer(t)
+	os.WriteFile(filepath.Join(workspace, "note.txt"), []byte("inside"), 0644)
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := NewClientWithTransport(NewHTTPTransport(ts.URL, nil), 0)
+	defer client.Close()
+	ctx := context.Background()
+
+	info, err := client.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if info.ServerInfo.Name != "picoclaw" {
+		t.Errorf("unexpected server info: %+v", info.ServerInfo)
+	}
+
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		if tool.Name == "read_file" && tool.InputSchema["type"] != "object" {
+			t.Errorf("read_file schema not exported: %v", tool.InputSchema)
+		}
+	}
+	if strings.Join(names, ",") != "ask_agent,exec,read_file" {
+		t.Errorf("unexpected tools: %v", names)
+	}
+
+	resp, err := client.CallTool(ctx, "read_file", map[string]interface{}{"path": "note.txt"})
+	if err != nil || resp.IsError || FormatContent(resp.Content) != "inside" {
+		t.Errorf("read_file inside workspace: resp=%+v err=%v", resp, err)
+	}
+
+	resp, err = client.CallTool(ctx, "read_file", map[string]interface{}{"path": "/etc/hostname"})
+	if err != nil || !resp.IsError {
+		t.Errorf("read_file outside workspace should fail: resp=%+v err=%v", resp, err)
+	}
+
+	resp, err = client.CallTool(ctx, "exec", map[string]interface{}{"command": "rm -rf /"})
+	if err != nil || !resp.IsError {
+		t.Errorf("exec guard should block rm -rf: resp=%+v err=%v", resp, err)
+	}
+
+	resp, err = client.CallTool(ctx, "ask_agent", map[string]interface{}{"message": "hello", "session": "editor"})
+	if err != nil || FormatContent(resp.Content) != "agent says: hello" {
+		t.Errorf("ask_agent: resp=%+v err=%v", resp, err)
+	}
+	if agent.gotSession != "mcp:editor" {
+		t.Errorf("ask_agent session = %q, want mcp:editor", agent.gotSession)
+	}
+}
+
+func TestServer_ServeStdio(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	var in bytes.Buffer
+	for i, method := range []string{"initialize", "notifications/initialized", "tools/list", "unknown/method"} {
+		var msg *Message
+		if strings.HasPrefix(method, "notifications/") {
+			msg, _ = NewNotification(method, nil)
+		} else {
+			msg, _ = NewRequest(int64(i+1), method, map[string]interface{}{})
+		}
+		data, _ := json.Marshal(msg)
+		in.Write(append(data, '\n'))
+	}
+
+	var out bytes.Buffer
+	if err := server.ServeStdio(context.Background(), &in, &out); err != nil {
+		t.Fatalf("ServeStdio() error: %v", err)
+	}
+
+	responses := map[string]*Message{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		responses[idKey(msg.ID)] = &msg
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses (no reply to the notification), got %d: %s", len(responses), out.String())
+	}
+	if responses["1"].Error != nil || responses["3"].Error != nil {
+		t.Errorf("unexpected errors: %s", out.String())
+	}
+	if responses["4"].Error == nil || responses["4"].Error.Code != ErrCodeMethodNotFound {
+		t.Errorf("unknown method should return method not found: %s", out.String())
+	}
+}
+
+func TestServer_HTTPAccessControl(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	server.SetHTTPOptions(HTTPOptions{
+		Token:          "s3cret",
+		AllowedOrigins: []string{"https://editor.example"},
+		AllowedHosts:   []string{"mcp.example"},
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	post := func(host, origin, token, session string) *http.Response {
+		t.Helper()
+		msg, _ := NewRequest(1, "tools/list", map[string]interface{}{})
+		body, _ := json.Marshal(msg)
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(body))
+		if host != "" {
+			req.Host = host
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if session != "" {
+			req.Header.Set(sessionHeader, session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// トークンを付けたクライアントはセッションを張れる
+	client := NewClientWithTransport(NewHTTPTransport(ts.URL, map[string]string{"Authorization": "Bearer s3cret"}), 0)
+	defer client.Close()
+	if _, err := client.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize() with token: %v", err)
+	}
+	if _, err := client.ListTools(context.Background()); err != nil {
+		t.Fatalf("ListTools() with token: %v", err)
+	}
+
+	cases := []struct {
+		name                         string
+		host, origin, token, session string
+		want                         int
+	}{
+		{"missing token", "", "", "", "x", http.StatusUnauthorized},
+		{"wrong token", "", "", "nope", "x", http.StatusUnauthorized},
+		{"rebound host", "attacker.example", "", "s3cret", "x", http.StatusForbidden},
+		{"foreign origin", "", "https://attacker.example", "s3cret", "x", http.StatusForbidden},
+		{"missing session", "", "", "s3cret", "", http.StatusBadRequest},
+		{"unknown session", "", "", "s3cret", "forged", http.StatusNotFound},
+		{"allowed host and origin", "mcp.example:8080", "https://editor.example", "s3cret", "forged", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if resp := post(tc.host, tc.origin, tc.token, tc.session); resp.StatusCode != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestServer_HTTPLimits(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	post := func(body []byte, session string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(body))
+		if session != "" {
+			req.Header.Set(sessionHeader, session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// 上限を超えるボディは読み切らずに拒否する
+	if resp := post(bytes.Repeat([]byte(" "), maxHTTPBodyBytes+1), ""); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status = %d, want 413", resp.StatusCode)
+	}
+
+	// セッションは上限を超えると古いものから捨てられ、使われないものは失効する
+	now := time.Now()
+	server.now = func() time.Time { return now }
+	first := server.startSession()
+	now = now.Add(time.Second)
+	kept := server.startSession()
+	for i := 2; i < maxSessions; i++ {
+		server.startSession()
+	}
+	now = now.Add(time.Second)
+	if !server.hasSession(kept) {
+		t.Fatal("session should still be valid")
+	}
+	server.startSession()
+	if len(server.sessions) != maxSessions {
+		t.Errorf("sessions = %d, want %d", len(server.sessions), maxSessions)
+	}
+	if server.hasSession(first) {
+		t.Error("the least recently used session should be evicted")
+	}
+	if !server.hasSession(kept) {
+		t.Error("a recently used session should be kept")
+	}
+	now = now.Add(sessionIdleTimeout + time.Second)
+	if server.hasSession(kept) {
+		t.Error("an idle session should expire")
+	}
+
+	// DELETE でセッションを終了できる
+	msg, _ := NewRequest(1, "initialize", map[string]interface{}{})
+	body, _ := json.Marshal(msg)
+	resp := post(body, "")
+	sid := resp.Header.Get(sessionHeader)
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL, nil)
+	req.Header.Set(sessionHeader, sid)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE: resp=%v err=%v", resp, err)
+	}
+	if server.hasSession(sid) {
+		t.Error("a deleted session should be gone")
+	}
+}
+
+func TestExportRegistry_FiltersTools(t *testing.T) {
+	src := tools.NewToolRegistry()
+	src.Register(tools.NewReadFileTool(t.TempDir(), true))
+	src.Register(tools.NewExecTool(t.TempDir(), true))
+	ask := tools.NewAskAgentTool(&fakeAgent{}, ServerChannel)
+
+	exported := ExportRegistry(src, []string{"read_file", "ask_agent"}, ask)
+	if got := strings.Join(sortedNames(exported), ","); got != "ask_agent,read_file" {
+		t.Errorf("exported tools = %s", got)
+	}
+	if _, ok := src.Get("ask_agent"); ok {
+		t.Error("ask_agent must not be added to the source registry")
+	}
+	if got := len(ExportRegistry(src, nil, ask).List()); got != 3 {
+		t.Errorf("empty list should export every tool, got %d", got)
+	}
+}
+
+func sortedNames(r *tools.ToolRegistry) []string {
+	names := r.List()
+	sort.Strings(names)
+	return names
+}
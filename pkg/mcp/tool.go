@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// maxToolNameLen は LLM プロバイダが受け付けるツール名の最大長
+const maxToolNameLen = 64
+
+// RemoteTool は MCP サーバーのツールを tools.Tool として公開する
+// 名前は mcp_<server>_<tool> で名前空間を分ける
+type RemoteTool struct {
+	server string
+	client *Client
+	tool   Tool
+	name   string
+}
+
+// NewRemoteTool は server の tool を呼び出す tools.Tool を作成
+func NewRemoteTool(server string, client *Client, tool Tool) *RemoteTool {
+	return &RemoteTool{
+		server: server,
+		client: client,
+		tool:   tool,
+		name:   RemoteToolName(server, tool.Name),
+	}
+}
+
+// RemoteToolName は MCP ツールを登録するときの名前を返す
+// 長すぎる名前は切り詰め、元のサーバー名・ツール名の短いハッシュを付けて
+// 先頭が同じ別のツールと衝突しないようにする
+func RemoteToolName(server, tool string) string {
+	name := "mcp_" + sanitizeToolName(server) + "_" + sanitizeToolName(tool)
+	if len(name) > maxToolNameLen {
+		sum := sha256.Sum256([]byte(server + "\x00" + tool))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		name = name[:maxToolNameLen-len(suffix)] + suffix
+	}
+	return name
+}
+
+// sanitizeToolName は英数字・_・- 以外を _ に置き換える
+func sanitizeToolName(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+func (t *RemoteTool) Name() string {
+	return t.name
+}
+
+func (t *RemoteTool) Description() string {
+	desc := strings.TrimSpace(t.tool.Description)
+	if desc == "" {
+		desc = t.tool.Name
+	}
+	return fmt.Sprintf("[MCP %s] %s", t.server, desc)
+}
+
+// Parameters はサーバーが tools/list で返した inputSchema をそのまま返す
+func (t *RemoteTool) Parameters() map[string]interface{} {
+	if len(t.tool.InputSchema) == 0 {
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+	return t.tool.InputSchema
+}
+
+// Server はツールを提供する MCP サーバー名を返す
+func (t *RemoteTool) Server() string {
+	return t.server
+}
+
+// RemoteName はサーバー側でのツール名を返す
+func (t *RemoteTool) RemoteName() string {
+	return t.tool.Name
+}
+
+func (t *RemoteTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	resp, err := t.client.CallTool(ctx, t.tool.Name, args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("MCP %s/%s failed: %v", t.server, t.tool.Name, err)).WithError(err)
+	}
+	text := FormatContent(resp.Content)
+	if resp.IsError {
+		if text == "" {
+			text = "tool reported an error"
+		}
+		return tools.ErrorResult(fmt.Sprintf("MCP %s/%s error: %s", t.server, t.tool.Name, text))
+	}
+	return tools.NewToolResult(text)
+}
+
+// FormatContent は tools/call の content をテキストにまとめる
+// テキスト以外（画像・音声）は種類だけを示し、リソースは中身のテキストを使う
+func FormatContent(content []map[string]interface{}) string {
+	parts := make([]string, 0, len(content))
+	for _, item := range content {
+		kind, _ := item["type"].(string)
+		switch kind {
+		case "text":
+			if s, ok := item["text"].(string); ok {
+				parts = append(parts, s)
+			}
+		case "image", "audio":
+			mimeType, _ := item["mimeType"].(string)
+			parts = append(parts, fmt.Sprintf("[%s %s]", kind, mimeType))
+		case "resource":
+			res, _ := item["resource"].(map[string]interface{})
+			if s, ok := res["text"].(string); ok {
+				parts = append(parts, s)
+			} else if uri, ok := res["uri"].(string); ok {
+				parts = append(parts, fmt.Sprintf("[resource %s]", uri))
+			}
+		default:
+			data, _ := json.Marshal(item)
+			parts = append(parts, string(data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
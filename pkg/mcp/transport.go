@@ -0,0 +1,295 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+// MessageHandler はサーバーから届いたリクエスト・通知を処理する
+// リクエストに対しては返り値がレスポンスとして送り返される（通知では nil を返す）
+type MessageHandler func(ctx context.Context, msg *Message) *Message
+
+// Transport は JSON-RPC メッセージを MCP サーバーとやり取りする
+type Transport interface {
+	// Send は msg を送信する。リクエストなら対応するレスポンスを待って返し、
+	// 通知なら送信後に nil を返す
+	Send(ctx context.Context, msg *Message) (*Message, error)
+	// SetHandler はサーバーからのリクエスト・通知のハンドラを設定する
+	SetHandler(handler MessageHandler)
+	// Close は接続（とサブプロセス）を閉じる
+	Close() error
+}
+
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func idKey(id json.RawMessage) string {
+	return strings.TrimSpace(string(id))
+}
+
+// pendingCalls はレスポンス待ちのリクエストを ID で管理する
+type pendingCalls struct {
+	mu      sync.Mutex
+	waiters map[string]chan *Message
+	err     error // 接続が切れた理由。以降の呼び出しはこのエラーで失敗する
+}
+
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{waiters: make(map[string]chan *Message)}
+}
+
+func (p *pendingCalls) add(id json.RawMessage) (chan *Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	ch := make(chan *Message, 1)
+	p.waiters[idKey(id)] = ch
+	return ch, nil
+}
+
+func (p *pendingCalls) remove(id json.RawMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiters, idKey(id))
+}
+
+// resolve はレスポンスを待機中の呼び出しに渡す。該当がなければ false
+func (p *pendingCalls) resolve(msg *Message) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch, ok := p.waiters[idKey(msg.ID)]
+	if ok {
+		delete(p.waiters, idKey(msg.ID))
+		ch <- msg
+	}
+	return ok
+}
+
+// fail は待機中の呼び出しをすべて err で終わらせる
+func (p *pendingCalls) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	for key, ch := range p.waiters {
+		close(ch)
+		delete(p.waiters, key)
+	}
+}
+
+func (p *pendingCalls) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// wait は ch へのレスポンスを待つ
+func (p *pendingCalls) wait(ctx context.Context, id json.RawMessage, ch chan *Message) (*Message, error) {
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			if err := p.failure(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("connection closed")
+		}
+		return resp, nil
+	case <-ctx.Done():
+		p.remove(id)
+		return nil, ctx.Err()
+	}
+}
+
+// stdioCloseGrace は stdin を閉じてからサブプロセスを強制終了するまでの猶予
+const stdioCloseGrace = 2 * time.Second
+
+// StdioTransport はサブプロセスを起動し、stdin/stdout の改行区切り JSON で通信する
+type StdioTransport struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	pending *pendingCalls
+
+	handlerMu sync.RWMutex
+	handler   MessageHandler
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStdioTransport は command を起動して stdio トランスポートを作成
+// env は親プロセスの環境変数に追加される
+func NewStdioTransport(command string, args []string, env map[string]string) (*StdioTransport, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("stdio transport requires a command")
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	t := &StdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: newPendingCalls(),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	go t.logStderr(command, stderr)
+	return t, nil
+}
+
+// SetHandler はサーバーからのリクエスト・通知のハンドラを設定する
+func (t *StdioTransport) SetHandler(handler MessageHandler) {
+	t.handlerMu.Lock()
+	defer t.handlerMu.Unlock()
+	t.handler = handler
+}
+
+// Send は msg を送信し、リクエストならレスポンスを待つ
+func (t *StdioTransport) Send(ctx context.Context, msg *Message) (*Message, error) {
+	var ch chan *Message
+	if msg.IsRequest() {
+		var err error
+		if ch, err = t.pending.add(msg.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.write(msg); err != nil {
+		if ch != nil {
+			t.pending.remove(msg.ID)
+		}
+		return nil, err
+	}
+	if ch == nil {
+		return nil, nil
+	}
+	return t.pending.wait(ctx, msg.ID, ch)
+}
+
+func (t *StdioTransport) write(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write to server: %w", err)
+	}
+	return nil
+}
+
+func (t *StdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			logger.WarnCF("mcp", "stdio.invalid_message", map[string]interface{}{
+				"error": err.Error(),
+				"line":  line,
+			})
+			continue
+		}
+		t.dispatch(&msg)
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	t.pending.fail(fmt.Errorf("server closed stdout: %w", err))
+	t.closeOnce.Do(func() { close(t.done) })
+}
+
+func (t *StdioTransport) dispatch(msg *Message) {
+	if msg.IsResponse() {
+		t.pending.resolve(msg)
+		return
+	}
+	t.handlerMu.RLock()
+	handler := t.handler
+	t.handlerMu.RUnlock()
+
+	go func() {
+		var resp *Message
+		if handler != nil {
+			resp = handler(context.Background(), msg)
+		} else if msg.IsRequest() {
+			resp = NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found: "+msg.Method)
+		}
+		if resp != nil && msg.IsRequest() {
+			if err := t.write(resp); err != nil {
+				logger.WarnCF("mcp", "stdio.reply_failed", map[string]interface{}{
+					"method": msg.Method,
+					"error":  err.Error(),
+				})
+			}
+		}
+	}()
+}
+
+func (t *StdioTransport) logStderr(command string, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.DebugCF("mcp", "stdio.stderr", map[string]interface{}{
+			"command": command,
+			"line":    scanner.Text(),
+		})
+	}
+}
+
+// Close は stdin を閉じ、サブプロセスを終了させる
+func (t *StdioTransport) Close() error {
+	t.stdin.Close()
+	t.pending.fail(fmt.Errorf("transport closed"))
+	select {
+	case <-t.done:
+	case <-time.After(stdioCloseGrace):
+		if t.cmd.Process != nil {
+			t.cmd.Process.Kill()
+		}
+	}
+	err := t.cmd.Wait()
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,425 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+// sessionHeader は Streamable HTTP のセッション ID ヘッダー
+const sessionHeader = "Mcp-Session-Id"
+
+// HTTPTransport は Streamable HTTP トランスポート
+// 各メッセージを POST し、レスポンスは JSON または SSE ストリームで受け取る
+type HTTPTransport struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+
+	mu        sync.RWMutex
+	sessionID string
+	handler   MessageHandler
+}
+
+// NewHTTPTransport は endpoint に POST する Streamable HTTP トランスポートを作成
+func NewHTTPTransport(endpoint string, headers map[string]string) *HTTPTransport {
+	return &HTTPTransport{
+		url:        endpoint,
+		headers:    headers,
+		httpClient: &http.Client{},
+	}
+}
+
+// SetHandler はサーバーからのリクエスト・通知のハンドラを設定する
+func (t *HTTPTransport) SetHandler(handler MessageHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+}
+
+// SessionID はサーバーから割り当てられたセッション ID を返す
+func (t *HTTPTransport) SessionID() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sessionID
+}
+
+// Send は msg を POST し、リクエストならレスポンスを返す
+func (t *HTTPTransport) Send(ctx context.Context, msg *Message) (*Message, error) {
+	httpResp, err := t.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if sid := httpResp.Header.Get(sessionHeader); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+
+	if !msg.IsRequest() {
+		io.Copy(io.Discard, httpResp.Body)
+		if httpResp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("http status: %d", httpResp.StatusCode)
+		}
+		return nil, nil
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status: %d", httpResp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return t.readStream(ctx, httpResp.Body, msg.ID)
+	}
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	var resp Message
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (t *HTTPTransport) post(ctx context.Context, msg *Message) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	if sid := t.SessionID(); sid != "" {
+		httpReq.Header.Set(sessionHeader, sid)
+	}
+
+	httpResp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	return httpResp, nil
+}
+
+// readStream は SSE ストリームから id へのレスポンスを探す
+// 途中で届いたサーバーからのリクエスト・通知はハンドラに渡す
+func (t *HTTPTransport) readStream(ctx context.Context, body io.Reader, id json.RawMessage) (*Message, error) {
+	var found *Message
+	err := readSSE(body, func(event, data string) bool {
+		if event != "" && event != "message" {
+			return true
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			logger.WarnCF("mcp", "http.invalid_event", map[string]interface{}{"error": err.Error()})
+			return true
+		}
+		if msg.IsResponse() && idKey(msg.ID) == idKey(id) {
+			found = &msg
+			return false
+		}
+		if msg.Method != "" {
+			t.handleServerMessage(&msg)
+		}
+		return true
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read event stream: %w", err)
+	}
+	return nil, fmt.Errorf("event stream ended without a response")
+}
+
+func (t *HTTPTransport) handleServerMessage(msg *Message) {
+	t.mu.RLock()
+	handler := t.handler
+	t.mu.RUnlock()
+
+	go func() {
+		var resp *Message
+		if handler != nil {
+			resp = handler(context.Background(), msg)
+		} else if msg.IsRequest() {
+			resp = NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found: "+msg.Method)
+		}
+		if resp == nil || !msg.IsRequest() {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := t.Send(ctx, resp); err != nil {
+			logger.WarnCF("mcp", "http.reply_failed", map[string]interface{}{
+				"method": msg.Method,
+				"error":  err.Error(),
+			})
+		}
+	}()
+}
+
+// Close はセッションがあれば DELETE で終了を通知する
+func (t *HTTPTransport) Close() error {
+	sid := t.SessionID()
+	if sid == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set(sessionHeader, sid)
+	httpResp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	httpResp.Body.Close()
+	return nil
+}
+
+// SSETransport は旧来の HTTP+SSE トランスポート（2024-11-05）
+// GET で SSE ストリームを開き、endpoint イベントで通知された URL に POST する
+type SSETransport struct {
+	headers    map[string]string
+	httpClient *http.Client
+	endpoint   string
+	pending    *pendingCalls
+	cancel     context.CancelFunc
+
+	mu      sync.RWMutex
+	handler MessageHandler
+}
+
+// NewSSETransport は streamURL に接続し、endpoint イベントを待って SSE トランスポートを作成
+func NewSSETransport(ctx context.Context, streamURL string, headers map[string]string) (*SSETransport, error) {
+	base, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	httpReq, err := http.NewRequestWithContext(streamCtx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	for k, v := range headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	t := &SSETransport{
+		headers:    headers,
+		httpClient: &http.Client{},
+		pending:    newPendingCalls(),
+		cancel:     cancel,
+	}
+
+	httpResp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		httpResp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("http status: %d", httpResp.StatusCode)
+	}
+
+	endpointCh := make(chan string, 1)
+	go t.readLoop(httpResp.Body, base, endpointCh)
+
+	select {
+	case endpoint, ok := <-endpointCh:
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("event stream ended before endpoint event")
+		}
+		t.endpoint = endpoint
+		return t, nil
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *SSETransport) readLoop(body io.ReadCloser, base *url.URL, endpointCh chan string) {
+	defer body.Close()
+	sentEndpoint := false
+	err := readSSE(body, func(event, data string) bool {
+		switch event {
+		case "endpoint":
+			if !sentEndpoint {
+				ref, err := url.Parse(strings.TrimSpace(data))
+				if err == nil {
+					endpointCh <- base.ResolveReference(ref).String()
+					sentEndpoint = true
+				}
+			}
+		case "", "message":
+			var msg Message
+			if err := json.Unmarshal([]byte(data), &msg); err != nil {
+				logger.WarnCF("mcp", "sse.invalid_event", map[string]interface{}{"error": err.Error()})
+				return true
+			}
+			if msg.IsResponse() {
+				t.pending.resolve(&msg)
+			} else if msg.Method != "" {
+				t.handleServerMessage(&msg)
+			}
+		}
+		return true
+	})
+	if !sentEndpoint {
+		close(endpointCh)
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	t.pending.fail(fmt.Errorf("event stream closed: %w", err))
+}
+
+// SetHandler はサーバーからのリクエスト・通知のハンドラを設定する
+func (t *SSETransport) SetHandler(handler MessageHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+}
+
+// Send は msg を endpoint に POST し、リクエストならストリーム上のレスポンスを待つ
+func (t *SSETransport) Send(ctx context.Context, msg *Message) (*Message, error) {
+	var ch chan *Message
+	if msg.IsRequest() {
+		var err error
+		if ch, err = t.pending.add(msg.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.post(ctx, msg); err != nil {
+		if ch != nil {
+			t.pending.remove(msg.ID)
+		}
+		return nil, err
+	}
+	if ch == nil {
+		return nil, nil
+	}
+	return t.pending.wait(ctx, msg.ID, ch)
+}
+
+func (t *SSETransport) post(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpResp, err := t.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	io.Copy(io.Discard, httpResp.Body)
+	httpResp.Body.Close()
+	if httpResp.StatusCode/100 != 2 {
+		return fmt.Errorf("http status: %d", httpResp.StatusCode)
+	}
+	return nil
+}
+
+func (t *SSETransport) handleServerMessage(msg *Message) {
+	t.mu.RLock()
+	handler := t.handler
+	t.mu.RUnlock()
+
+	go func() {
+		var resp *Message
+		if handler != nil {
+			resp = handler(context.Background(), msg)
+		} else if msg.IsRequest() {
+			resp = NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found: "+msg.Method)
+		}
+		if resp == nil || !msg.IsRequest() {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := t.post(ctx, resp); err != nil {
+			logger.WarnCF("mcp", "sse.reply_failed", map[string]interface{}{
+				"method": msg.Method,
+				"error":  err.Error(),
+			})
+		}
+	}()
+}
+
+// Close は SSE ストリームを閉じる
+func (t *SSETransport) Close() error {
+	t.cancel()
+	t.pending.fail(fmt.Errorf("transport closed"))
+	return nil
+}
+
+// readSSE は Server-Sent Events を読み、イベントごとに fn を呼ぶ
+// fn が false を返すと読み取りを終了する
+func readSSE(r io.Reader, fn func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if !fn(event, strings.Join(data, "\n")) {
+					return nil
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// コメント（keep-alive）
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+	return scanner.Err()
+}
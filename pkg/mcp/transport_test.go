@@ -0,0 +1,289 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// fakeServer は テスト用の最小 MCP サーバー
+type fakeServer struct {
+	mu          sync.Mutex
+	tools       []Tool
+	initialized bool
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{tools: []Tool{{
+		Name:        "echo",
+		Description: "Echo the text back",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text": map[string]interface{}{"type": "string"},
+			},
+			"required": []interface{}{"text"},
+		},
+	}}}
+}
+
+func (s *fakeServer) handle(msg *Message) *Message {
+	switch msg.Method {
+	case "initialize":
+		return NewResult(msg.ID, InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{ListChanged: true}},
+			ServerInfo:      Implementation{Name: "fake", Version: "0.1"},
+		})
+	case "notifications/initialized":
+		s.mu.Lock()
+		s.initialized = true
+		s.mu.Unlock()
+		return nil
+	case "tools/list":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.initialized {
+			return NewErrorResponse(msg.ID, ErrCodeInvalidRequest, "not initialized")
+		}
+		return NewResult(msg.ID, ToolListResponse{Tools: s.tools})
+	case "tools/call":
+		var params ToolCallRequest
+		json.Unmarshal(msg.Params, &params)
+		if params.Name != "echo" {
+			return NewResult(msg.ID, ToolCallResponse{
+				Content: []map[string]interface{}{{"type": "text", "text": "unknown tool"}},
+				IsError: true,
+			})
+		}
+		return NewResult(msg.ID, ToolCallResponse{
+			Content: []map[string]interface{}{{"type": "text", "text": fmt.Sprint(params.Arguments["text"])}},
+		})
+	case "ping":
+		return NewResult(msg.ID, map[string]interface{}{})
+	}
+	if msg.IsRequest() {
+		return NewErrorResponse(msg.ID, ErrCodeMethodNotFound, "method not found")
+	}
+	return nil
+}
+
+// serveStdio は改行区切り JSON で fakeServer を提供する
+func (s *fakeServer) serveStdio(r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if resp := s.handle(&msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			fmt.Fprintf(w, "%s\n", data)
+		}
+	}
+}
+
+// TestHelperProcess は stdio トランスポートのテストで起動されるサーバー
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PICOCLAW_MCP_HELPER") != "1" {
+		return
+	}
+	newFakeServer().serveStdio(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+func startStdioClient(t *testing.T) *Client {
+	t.Helper()
+	transport, err := NewStdioTransport(os.Args[0], []string{"-test.run=TestHelperProcess"},
+		map[string]string{"PICOCLAW_MCP_HELPER": "1"})
+	if err != nil {
+		t.Fatalf("NewStdioTransport() error: %v", err)
+	}
+	client := NewClientWithTransport(transport, 10*time.Second)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestStdioClient_InitializeListCall(t *testing.T) {
+	client := startStdioClient(t)
+	ctx := context.Background()
+
+	info, err := client.Initialize(ctx)
+	if err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if info.ServerInfo.Name != "fake" || info.Capabilities.Tools == nil || !info.Capabilities.Tools.ListChanged {
+		t.Errorf("unexpected initialize result: %+v", info)
+	}
+
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(list.Tools) != 1 || list.Tools[0].Name != "echo" {
+		t.Fatalf("unexpected tools: %+v", list.Tools)
+	}
+
+	resp, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "hi"})
+	if err != nil {
+		t.Fatalf("CallTool() error: %v", err)
+	}
+	if got := FormatContent(resp.Content); got != "hi" {
+		t.Errorf("CallTool() content = %q, want %q", got, "hi")
+	}
+}
+
+func TestHTTPClient_JSONAndSSE(t *testing.T) {
+	server := newFakeServer()
+	var sessionSeen bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method == "initialize" {
+			w.Header().Set(sessionHeader, "session-1")
+		} else if r.Header.Get(sessionHeader) == "session-1" {
+			sessionSeen = true
+		}
+		resp := server.handle(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if msg.Method == "tools/call" {
+			// tools/call は SSE で、途中に通知を挟んで返す
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": keep-alive\n\n")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	defer client.Close()
+	ctx := context.Background()
+
+	list, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(list.Tools) != 1 {
+		t.Fatalf("expected 1 tool, got %d", len(list.Tools))
+	}
+	resp, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "over sse"})
+	if err != nil {
+		t.Fatalf("CallTool() error: %v", err)
+	}
+	if got := FormatContent(resp.Content); got != "over sse" {
+		t.Errorf("CallTool() content = %q", got)
+	}
+	if !sessionSeen {
+		t.Error("expected Mcp-Session-Id to be sent after initialize")
+	}
+}
+
+func TestManager_RegistersNamespacedTools(t *testing.T) {
+	registry := tools.NewToolRegistry()
+	manager := NewManager(registry)
+	defer manager.Close()
+
+	err := manager.Connect(context.Background(), "fake server", config.MCPServerConfig{
+		Enabled: true,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperProcess"},
+		Env:     map[string]string{"PICOCLAW_MCP_HELPER": "1"},
+	})
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+
+	tool, ok := registry.Get("mcp_fake_server_echo")
+	if !ok {
+		t.Fatalf("tool not registered, have %v", registry.List())
+	}
+	params := tool.Parameters()
+	if required, _ := params["required"].([]interface{}); len(required) != 1 || required[0] != "text" {
+		t.Errorf("inputSchema not passed through: %v", params)
+	}
+	if !strings.Contains(tool.Description(), "Echo the text back") {
+		t.Errorf("unexpected description: %q", tool.Description())
+	}
+
+	result := registry.Execute(context.Background(), "mcp_fake_server_echo", map[string]interface{}{"text": "ok"})
+	if result.IsError || result.ForLLM != "ok" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	manager.Close()
+	if _, ok := registry.Get("mcp_fake_server_echo"); ok {
+		t.Error("tool should be unregistered after Close")
+	}
+}
+
+func TestRemoteToolName_TruncatesWithHash(t *testing.T) {
+	long := strings.Repeat("x", 80)
+	a := RemoteToolName("srv", long+"_a")
+	b := RemoteToolName("srv", long+"_b")
+	if len(a) > maxToolNameLen || len(b) > maxToolNameLen {
+		t.Fatalf("names exceed %d chars: %q %q", maxToolNameLen, a, b)
+	}
+	if a == b {
+		t.Fatalf("truncated names must stay distinct, both %q", a)
+	}
+	if got := RemoteToolName("srv", "echo"); got != "mcp_srv_echo" {
+		t.Errorf("short names must not be hashed, got %q", got)
+	}
+}
+
+func TestManager_RejectsDuplicateToolNames(t *testing.T) {
+	registry := tools.NewToolRegistry()
+	manager := NewManager(registry)
+	defer manager.Close()
+
+	cfg := config.MCPServerConfig{
+		Enabled: true,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperProcess"},
+		Env:     map[string]string{"PICOCLAW_MCP_HELPER": "1"},
+	}
+	// "fake server" と "fake_server" はどちらも mcp_fake_server_echo になる
+	for _, name := range []string{"fake server", "fake_server"} {
+		if err := manager.Connect(context.Background(), name, cfg); err != nil {
+			t.Fatalf("Connect(%q) error: %v", name, err)
+		}
+	}
+
+	tool, ok := registry.Get("mcp_fake_server_echo")
+	if !ok {
+		t.Fatalf("tool not registered, have %v", registry.List())
+	}
+	if server := tool.(*RemoteTool).Server(); server != "fake server" {
+		t.Errorf("first registration must be kept, got server %q", server)
+	}
+	if names := manager.ToolNames("fake_server"); len(names) != 0 {
+		t.Errorf("conflicting tool must not be registered, got %v", names)
+	}
+}
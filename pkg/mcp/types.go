@@ -1,21 +1,131 @@
 package mcp
 
-// MCPRequest は MCP サーバーへのリクエスト
-type MCPRequest struct {
-	Method string                 `json:"method"`
-	Params map[string]interface{} `json:"params"`
+import "encoding/json"
+
+// ProtocolVersion は initialize で要求する MCP プロトコルのバージョン
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC のエラーコード
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternal       = -32603
+)
+
+// Message は JSON-RPC 2.0 のメッセージ（リクエスト・通知・レスポンス共通）
+// ID がなければ通知、Method がなければレスポンス
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *MCPError       `json:"error,omitempty"`
+}
+
+// IsRequest はサーバー（または相手）からのリクエストかを返す
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification は通知かを返す
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse はレスポンスかを返す
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// NewRequest は params を埋め込んだリクエストを作成
+func NewRequest(id int64, method string, params interface{}) (*Message, error) {
+	msg, err := NewNotification(method, params)
+	if err != nil {
+		return nil, err
+	}
+	msg.ID = json.RawMessage(formatID(id))
+	return msg, nil
+}
+
+// NewNotification は params を埋め込んだ通知を作成
+func NewNotification(method string, params interface{}) (*Message, error) {
+	msg := &Message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = data
+	}
+	return msg, nil
+}
+
+// NewResult は id への成功レスポンスを作成
+func NewResult(id json.RawMessage, result interface{}) *Message {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return NewErrorResponse(id, ErrCodeInternal, err.Error())
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Result: data}
 }
 
-// MCPResponse は MCP サーバーからのレスポンス
-type MCPResponse struct {
-	Result map[string]interface{} `json:"result,omitempty"`
-	Error  *MCPError              `json:"error,omitempty"`
+// NewErrorResponse は id へのエラーレスポンスを作成
+func NewErrorResponse(id json.RawMessage, code int, message string) *Message {
+	return &Message{JSONRPC: "2.0", ID: id, Error: &MCPError{Code: code, Message: message}}
 }
 
 // MCPError は MCP エラー
 type MCPError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *MCPError) Error() string {
+	return e.Message
+}
+
+// Implementation はクライアント/サーバーの名前とバージョン
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ClientCapabilities はクライアントが提供する機能
+type ClientCapabilities struct {
+	Roots    map[string]interface{} `json:"roots,omitempty"`
+	Sampling map[string]interface{} `json:"sampling,omitempty"`
+}
+
+// ServerCapabilities はサーバーが提供する機能
+type ServerCapabilities struct {
+	Tools     *ListChangedCapability `json:"tools,omitempty"`
+	Prompts   *ListChangedCapability `json:"prompts,omitempty"`
+	Resources *ListChangedCapability `json:"resources,omitempty"`
+	Logging   map[string]interface{} `json:"logging,omitempty"`
+}
+
+// ListChangedCapability は list_changed 通知に対応しているかを示す
+type ListChangedCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// InitializeParams は initialize のパラメータ
+type InitializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	ClientInfo      Implementation     `json:"clientInfo"`
+}
+
+// InitializeResult は initialize のレスポンス
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
 }
 
 // Tool は MCP ツール定義
@@ -25,9 +135,15 @@ type Tool struct {
 	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
 }
 
+// ToolListRequest は tools/list のパラメータ
+type ToolListRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
 // ToolListResponse は tools/list のレスポンス
 type ToolListResponse struct {
-	Tools []Tool `json:"tools"`
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // ToolCallRequest は tools/call のリクエスト
@@ -39,4 +155,5 @@ type ToolCallRequest struct {
 // ToolCallResponse は tools/call のレスポンス
 type ToolCallResponse struct {
 	Content []map[string]interface{} `json:"content"`
+	IsError bool                     `json:"isError,omitempty"`
 }
@@ -1,28 +1,75 @@
 package order
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
 )
 
 // AnalysisRequest contains the information needed for code analysis.
 type AnalysisRequest struct {
-	JobID    string
-	Route    string
-	Target   string // File path or code snippet
-	Context  map[string]interface{}
+	JobID   string
+	Route   string
+	Target  string // File path, directory or code snippet
+	Context map[string]interface{}
+}
+
+// Issue is a single finding reported by the LLM or a static checker.
+type Issue struct {
+	Severity   string `json:"severity"` // "error", "warning" or "info"
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Source     string `json:"source,omitempty"` // "llm" or "go vet"
 }
 
 // AnalysisResult contains the results of code analysis.
 type AnalysisResult struct {
-	JobID      string
-	OrderID    string
-	Summary    string
-	Issues     []string
+	JobID       string
+	OrderID     string
+	Summary     string
+	Issues      []Issue
 	Suggestions []string
-	Metadata   map[string]interface{}
+	Metadata    map[string]interface{}
+}
+
+const (
+	// analysisChunkLines and analysisChunkBytes bound a single LLM request.
+	analysisChunkLines = 300
+	analysisChunkBytes = 16 * 1024
+	// analysisMaxFiles limits how many files of a directory are analyzed.
+	analysisMaxFiles = 20
+	// analysisMaxFileBytes skips generated or vendored blobs.
+	analysisMaxFileBytes = 512 * 1024
+	// analysisMaxTotalBytes stops reading a directory once this much source
+	// has been collected, and analysisMaxChunks caps the LLM requests of one
+	// analysis; what is left over is reported as skipped.
+	analysisMaxTotalBytes = 1024 * 1024
+	analysisMaxChunks     = 32
+	analysisVetTimeout    = 2 * time.Minute
+)
+
+// analysisExtensions are the source files picked up when the target is a directory.
+var analysisExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".ts": true, ".tsx": true, ".jsx": true,
+	".java": true, ".rs": true, ".c": true, ".h": true, ".cpp": true, ".rb": true,
+	".php": true, ".sh": true, ".kt": true, ".swift": true, ".cs": true,
 }
 
 // CodeAnalysisModule performs code analysis and review.
@@ -53,30 +100,503 @@ func (m *CodeAnalysisModule) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// sourceFile is a file (or snippet) to analyze. Name is what the LLM and the
+// user see; it is relative to the workspace when possible.
+type sourceFile struct {
+	Name    string
+	Path    string // empty for snippets
+	Content string
+}
+
+// analysisChunk is a slice of a source file starting at StartLine (1-based).
+type analysisChunk struct {
+	File      string
+	StartLine int
+	Lines     []string
+}
+
 // AnalyzeCode performs code analysis on the given target.
+// The target is read through the workspace-restricted path checks, split into
+// chunks and reviewed by the Order's LLM. For Go modules, `go vet` findings
+// are merged in.
 func (m *CodeAnalysisModule) AnalyzeCode(ctx context.Context, req AnalysisRequest) (AnalysisResult, error) {
 	logger.InfoCF("analysis", "order.analyze", map[string]interface{}{
 		"job_id":   req.JobID,
 		"order_id": m.agent.ID,
-		"target":   req.Target,
+		"target":   truncateForLog(req.Target),
 	})
 
-	// TODO: Implement actual code analysis using Provider
-	// This is a placeholder that will be filled in Phase 3
+	if m.agent.Provider == nil {
+		return AnalysisResult{}, fmt.Errorf("LLM provider not configured for %s", m.agent.ID)
+	}
+
+	files, root, err := m.loadTarget(req.Target)
+	if err != nil {
+		return AnalysisResult{}, err
+	}
+
+	var chunks []analysisChunk
+	for _, f := range files {
+		chunks = append(chunks, chunkSource(f)...)
+	}
+	skipped := 0
+	if len(chunks) > analysisMaxChunks {
+		skipped = len(chunks) - analysisMaxChunks
+		chunks = chunks[:analysisMaxChunks]
+		logger.WarnCF("analysis", "order.analyze.truncated", map[string]interface{}{
+			"job_id":  req.JobID,
+			"chunks":  len(chunks),
+			"skipped": skipped,
+		})
+	}
+
+	var issues []Issue
+	var suggestions, summaries []string
+	failed := 0
+	var lastErr error
+	for _, c := range chunks {
+		r, err := m.analyzeChunk(ctx, c, len(chunks))
+		if err != nil {
+			failed++
+			lastErr = err
+			logger.WarnCF("analysis", "order.analyze.chunk_failed", map[string]interface{}{
+				"job_id":     req.JobID,
+				"file":       c.File,
+				"start_line": c.StartLine,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		issues = append(issues, r.Issues...)
+		suggestions = append(suggestions, r.Suggestions...)
+		if s := strings.TrimSpace(r.Summary); s != "" {
+			summaries = append(summaries, s)
+		}
+	}
+	if len(chunks) > 0 && failed == len(chunks) {
+		return AnalysisResult{}, fmt.Errorf("code analysis failed: %w", lastErr)
+	}
+
+	vetRan := false
+	if root != "" {
+		if vetIssues, ok := runGoVet(ctx, tools.DefaultExecutor(), root, m.workspace()); ok {
+			vetRan = true
+			issues = append(issues, vetIssues...)
+		}
+	}
+
+	issues = mergeIssues(issues)
 	result := AnalysisResult{
 		JobID:       req.JobID,
 		OrderID:     m.agent.ID,
-		Summary:     "Code analysis placeholder",
-		Issues:      []string{},
-		Suggestions: []string{},
-		Metadata:    make(map[string]interface{}),
+		Summary:     strings.Join(summaries, "\n"),
+		Issues:      issues,
+		Suggestions: dedupeStrings(suggestions),
+		Metadata: map[string]interface{}{
+			"files":          len(files),
+			"chunks":         len(chunks),
+			"failed_chunks":  failed,
+			"skipped_chunks": skipped,
+			"go_vet":         vetRan,
+			"model":          m.agent.Model,
+		},
+	}
+	if result.Summary == "" {
+		result.Summary = fmt.Sprintf("%d 件の指摘が見つかりました。", len(issues))
+	}
+	if skipped > 0 {
+		result.Summary += fmt.Sprintf("\n（対象が大きいため、先頭 %d チャンクのみ解析しました。残り %d チャンクは未解析です。）", len(chunks), skipped)
 	}
 
 	logger.InfoCF("analysis", "order.analyzed", map[string]interface{}{
 		"job_id":      req.JobID,
 		"order_id":    m.agent.ID,
 		"issue_count": len(result.Issues),
+		"chunks":      len(chunks),
+		"go_vet":      vetRan,
 	})
 
 	return result, nil
 }
+
+// workspace returns the agent's workspace, or "" when no config is attached.
+func (m *CodeAnalysisModule) workspace() string {
+	if m.agent == nil || m.agent.Config == nil {
+		return ""
+	}
+	return m.agent.Config.WorkspacePath()
+}
+
+// loadTarget reads the target. A target that resolves to an existing file or
+// directory inside the workspace is read from disk; anything else is treated
+// as a snippet. root is the directory to vet, or "" when the target is not
+// inside a Go module.
+func (m *CodeAnalysisModule) loadTarget(target string) ([]sourceFile, string, error) {
+	trimmed := strings.TrimSpace(target)
+	if trimmed == "" {
+		return nil, "", fmt.Errorf("empty analysis target")
+	}
+
+	workspace := m.workspace()
+	if workspace == "" || strings.Contains(trimmed, "\n") {
+		return []sourceFile{{Name: "snippet", Content: target}}, "", nil
+	}
+
+	restrict := m.agent.Config.Agents.Defaults.RestrictToWorkspace
+	path, err := tools.ResolvePath(trimmed, workspace, restrict)
+	if err != nil {
+		if strings.Contains(err.Error(), "access denied") {
+			return nil, "", err
+		}
+		return []sourceFile{{Name: "snippet", Content: target}}, "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return []sourceFile{{Name: "snippet", Content: target}}, "", nil
+	}
+
+	var files []sourceFile
+	dir := path
+	if info.IsDir() {
+		files, err = readSourceDir(path, workspace)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(files) == 0 {
+			return nil, "", fmt.Errorf("no source files found in %s", trimmed)
+		}
+	} else {
+		if info.Size() > analysisMaxFileBytes {
+			return nil, "", fmt.Errorf("%s is too large to analyze (%d bytes)", trimmed, info.Size())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read %s: %w", trimmed, err)
+		}
+		files = []sourceFile{{Name: displayName(path, workspace), Path: path, Content: string(data)}}
+		dir = filepath.Dir(path)
+	}
+
+	root := ""
+	if hasGoSource(files) {
+		if _, ok := findGoModule(dir, workspace); ok {
+			root = dir
+		}
+	}
+	return files, root, nil
+}
+
+// readSourceDir collects up to analysisMaxFiles source files (and
+// analysisMaxTotalBytes) under dir, skipping hidden, vendored and dependency
+// directories.
+func readSourceDir(dir, workspace string) ([]sourceFile, error) {
+	var files []sourceFile
+	total := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(files) >= analysisMaxFiles || total >= analysisMaxTotalBytes {
+			return filepath.SkipAll
+		}
+		if !analysisExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > analysisMaxFileBytes {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, sourceFile{Name: displayName(path, workspace), Path: path, Content: string(data)})
+		total += len(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func displayName(path, workspace string) string {
+	if workspace != "" {
+		if rel, err := filepath.Rel(workspace, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+// chunkSource splits a file into chunks of at most analysisChunkLines lines
+// and analysisChunkBytes bytes.
+func chunkSource(f sourceFile) []analysisChunk {
+	lines := strings.Split(strings.TrimRight(f.Content, "\n"), "\n")
+	var chunks []analysisChunk
+	start, size := 0, 0
+	for i, line := range lines {
+		if i > start && (i-start >= analysisChunkLines || size+len(line) > analysisChunkBytes) {
+			chunks = append(chunks, analysisChunk{File: f.Name, StartLine: start + 1, Lines: lines[start:i]})
+			start, size = i, 0
+		}
+		size += len(line) + 1
+	}
+	chunks = append(chunks, analysisChunk{File: f.Name, StartLine: start + 1, Lines: lines[start:]})
+	return chunks
+}
+
+// chunkAnalysis is the JSON the LLM is asked to return for a chunk.
+type chunkAnalysis struct {
+	Summary     string   `json:"summary"`
+	Issues      []Issue  `json:"issues"`
+	Suggestions []string `json:"suggestions"`
+}
+
+func (m *CodeAnalysisModule) analyzeChunk(ctx context.Context, c analysisChunk, total int) (chunkAnalysis, error) {
+	var code strings.Builder
+	for i, line := range c.Lines {
+		fmt.Fprintf(&code, "%5d| %s\n", c.StartLine+i, line)
+	}
+	part := ""
+	if total > 1 {
+		part = fmt.Sprintf("（全 %d チャンクのうち、%d 行目から）", total, c.StartLine)
+	}
+
+	systemPrompt := `あなたはコードレビューのスペシャリストです。バグ、セキュリティ上の問題、エラー処理の漏れ、保守性の問題を見つけます。
+必ず次の JSON だけを返してください（説明文やコードブロックは不要）:
+{"summary":"全体の所見を1〜2文で","issues":[{"severity":"error|warning|info","file":"ファイル名","line":行番号,"message":"問題点","suggestion":"修正案"}],"suggestions":["全体への改善提案"]}
+行番号はコードの左端に付いている番号を使ってください。問題がなければ issues は空配列にしてください。`
+	userPrompt := fmt.Sprintf("ファイル: %s%s\n\n%s", c.File, part, code.String())
+
+	response, err := m.agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}, nil, m.agent.Model, nil)
+	if err != nil {
+		return chunkAnalysis{}, fmt.Errorf("analysis request failed: %w", err)
+	}
+
+	r, err := parseAnalysisResponse(response.Content)
+	if err != nil {
+		return chunkAnalysis{}, err
+	}
+	for i := range r.Issues {
+		if r.Issues[i].File == "" {
+			r.Issues[i].File = c.File
+		}
+		r.Issues[i].Source = "llm"
+	}
+	return r, nil
+}
+
+// parseAnalysisResponse extracts the JSON object from the LLM reply.
+func parseAnalysisResponse(content string) (chunkAnalysis, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end <= start {
+		return chunkAnalysis{}, fmt.Errorf("no JSON object in analysis response")
+	}
+	var r chunkAnalysis
+	if err := json.Unmarshal([]byte(content[start:end+1]), &r); err != nil {
+		return chunkAnalysis{}, fmt.Errorf("failed to parse analysis response: %w", err)
+	}
+	for i := range r.Issues {
+		r.Issues[i].Severity = normalizeSeverity(r.Issues[i].Severity)
+	}
+	return r, nil
+}
+
+func normalizeSeverity(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "error", "critical", "high", "bug":
+		return "error"
+	case "warning", "warn", "medium":
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+func severityRank(s string) int {
+	switch s {
+	case "error":
+		return 0
+	case "warning":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// mergeIssues drops duplicates (same file, line and message) and sorts by
+// severity, then file and line.
+func mergeIssues(issues []Issue) []Issue {
+	seen := make(map[string]bool)
+	merged := make([]Issue, 0, len(issues))
+	for _, is := range issues {
+		if strings.TrimSpace(is.Message) == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d:%s", is.File, is.Line, strings.ToLower(strings.TrimSpace(is.Message)))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, is)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i], merged[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return merged
+}
+
+func dedupeStrings(list []string) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+func hasGoSource(files []sourceFile) bool {
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+// findGoModule walks up from dir to the workspace root looking for go.mod.
+func findGoModule(dir, workspace string) (string, bool) {
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		if _, err := os.Stat(filepath.Join(current, "go.mod")); err == nil {
+			return current, true
+		}
+		if current == filepath.Clean(workspace) || filepath.Dir(current) == current {
+			return "", false
+		}
+	}
+}
+
+// goVetLine matches "path/file.go:12:5: message" and "path/file.go:12: message".
+var goVetLine = regexp.MustCompile(`^(.+\.go):(\d+)(?::\d+)?: (.+)$`)
+
+// runGoVet vets the package in dir through executor, the one the exec tool
+// uses, so that building the analyzed code (cgo, build tags, test helpers)
+// gets the same isolation as any other command. ok is false when go is
+// unavailable or the package could not be vetted at all.
+func runGoVet(ctx context.Context, executor tools.Executor, dir, workspace string) ([]Issue, bool) {
+	vetCtx, cancel := context.WithTimeout(ctx, analysisVetTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	err := executor.Run(vetCtx, tools.Command{
+		Args: []string{"go", "vet", "."},
+		Dir:  dir,
+		// Never download modules or toolchains just to analyze code. The
+		// build cache goes to /tmp, which is writable in the sandbox.
+		Env:    []string{"GOPROXY=off", "GOTOOLCHAIN=local", "GOCACHE=" + filepath.Join(os.TempDir(), "picoclaw-vet-cache")},
+		Stdout: &output,
+		Stderr: &output,
+	})
+	issues := parseGoVetOutput(output.String(), dir, workspace)
+	if err != nil && len(issues) == 0 {
+		logger.WarnCF("analysis", "order.analyze.go_vet_failed", map[string]interface{}{
+			"dir":   dir,
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+	return issues, true
+}
+
+func parseGoVetOutput(output, dir, workspace string) []Issue {
+	var issues []Issue
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		match := goVetLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		file := match[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		line, _ := strconv.Atoi(match[2])
+		issues = append(issues, Issue{
+			Severity: "warning",
+			File:     displayName(file, workspace),
+			Line:     line,
+			Message:  match[3],
+			Source:   "go vet",
+		})
+	}
+	return issues
+}
+
+func truncateForLog(s string) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > 80 {
+		return string(r[:80]) + "..."
+	}
+	return s
+}
+
+// FormatAnalysis renders an AnalysisResult for the user.
+func FormatAnalysis(result AnalysisResult) string {
+	var sb strings.Builder
+	sb.WriteString("## 解析結果\n")
+	sb.WriteString(strings.TrimSpace(result.Summary))
+	sb.WriteString("\n")
+
+	if len(result.Issues) > 0 {
+		sb.WriteString(fmt.Sprintf("\n## 指摘（%d 件）\n", len(result.Issues)))
+		for _, is := range result.Issues {
+			loc := is.File
+			if is.Line > 0 {
+				loc = fmt.Sprintf("%s:%d", is.File, is.Line)
+			}
+			source := ""
+			if is.Source == "go vet" {
+				source = " (go vet)"
+			}
+			sb.WriteString(fmt.Sprintf("- [%s] %s%s: %s\n", is.Severity, loc, source, is.Message))
+			if is.Suggestion != "" {
+				sb.WriteString(fmt.Sprintf("  → %s\n", is.Suggestion))
+			}
+		}
+	}
+
+	if len(result.Suggestions) > 0 {
+		sb.WriteString("\n## 改善提案\n")
+		for _, s := range result.Suggestions {
+			sb.WriteString("- " + s + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
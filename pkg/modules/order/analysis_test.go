@@ -0,0 +1,224 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/tools"
+)
+
+// reviewProvider returns a fixed review and records the prompts it received.
+type reviewProvider struct {
+	mu      sync.Mutex
+	reply   string
+	err     error
+	prompts []string
+}
+
+func (p *reviewProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	p.prompts = append(p.prompts, messages[len(messages)-1].Content)
+	p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &providers.LLMResponse{Content: p.reply}, nil
+}
+
+func (p *reviewProvider) GetDefaultModel() string { return "review" }
+
+func newAnalysisModule(t *testing.T, provider providers.LLMProvider, workspace string) *CodeAnalysisModule {
+	t.Helper()
+	var cfg *config.Config
+	if workspace != "" {
+		cfg = config.DefaultConfig()
+		cfg.Agents.Defaults.Workspace = workspace
+		cfg.Agents.Defaults.RestrictToWorkspace = true
+	}
+	module := NewCodeAnalysisModule()
+	if err := module.Initialize(context.Background(), &modules.AgentCore{ID: "order1", Provider: provider, Config: cfg}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	return module
+}
+
+func TestCodeAnalysisModule_Snippet(t *testing.T) {
+	provider := &reviewProvider{reply: "```json\n" + `{"summary":"nil チェックが不足しています","issues":[` +
+		`{"severity":"info","line":3,"message":"命名が曖昧"},` +
+		`{"severity":"critical","line":2,"message":"nil ポインタ参照","suggestion":"nil を確認する"}],` +
+		`"suggestions":["テストを追加する","テストを追加する"]}` + "\n```"}
+	module := newAnalysisModule(t, provider, "")
+
+	result, err := module.AnalyzeCode(context.Background(), AnalysisRequest{
+		JobID:  "job_20261016_001",
+		Target: "func f(p *T) int {\n\treturn p.x\n}",
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCode failed: %v", err)
+	}
+	if len(result.Issues) != 2 {
+		t.Fatalf("expected 2 issues, got %+v", result.Issues)
+	}
+	first := result.Issues[0]
+	if first.Severity != "error" || first.Line != 2 || first.File != "snippet" || first.Suggestion == "" {
+		t.Errorf("errors should sort first with normalized severity, got %+v", first)
+	}
+	if len(result.Suggestions) != 1 {
+		t.Errorf("suggestions should be deduplicated, got %v", result.Suggestions)
+	}
+	if !strings.Contains(provider.prompts[0], "    2| \treturn p.x") {
+		t.Errorf("prompt should carry line numbers, got:\n%s", provider.prompts[0])
+	}
+
+	out := FormatAnalysis(result)
+	for _, want := range []string{"nil チェックが不足しています", "[error] snippet:2: nil ポインタ参照", "→ nil を確認する"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("formatted analysis missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCodeAnalysisModule_ChunksLargeFiles(t *testing.T) {
+	workspace := t.TempDir()
+	var sb strings.Builder
+	for i := 0; i < 2*analysisChunkLines+10; i++ {
+		sb.WriteString("x = 1\n")
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "big.py"), []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &reviewProvider{reply: `{"summary":"ok","issues":[]}`}
+	module := newAnalysisModule(t, provider, workspace)
+
+	result, err := module.AnalyzeCode(context.Background(), AnalysisRequest{JobID: "job_20261016_002", Target: "big.py"})
+	if err != nil {
+		t.Fatalf("AnalyzeCode failed: %v", err)
+	}
+	if len(provider.prompts) != 3 || result.Metadata["chunks"] != 3 {
+		t.Fatalf("expected 3 chunks, got %d prompts", len(provider.prompts))
+	}
+	if !strings.Contains(provider.prompts[2], "  601| x = 1") {
+		t.Errorf("third chunk should start at line 601, got:\n%s", provider.prompts[2][:200])
+	}
+}
+
+func TestCodeAnalysisModule_RejectsPathsOutsideWorkspace(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.go")
+	if err := os.WriteFile(outside, []byte("package secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &reviewProvider{reply: `{"issues":[]}`}
+	module := newAnalysisModule(t, provider, t.TempDir())
+
+	if _, err := module.AnalyzeCode(context.Background(), AnalysisRequest{Target: outside}); err == nil {
+		t.Fatal("expected access to a file outside the workspace to be denied")
+	}
+	if len(provider.prompts) != 0 {
+		t.Error("nothing outside the workspace should reach the LLM")
+	}
+}
+
+func TestCodeAnalysisModule_FailsWhenEveryChunkFails(t *testing.T) {
+	module := newAnalysisModule(t, &reviewProvider{err: errors.New("provider down")}, "")
+	if _, err := module.AnalyzeCode(context.Background(), AnalysisRequest{Target: "x := 1\ny := 2"}); err == nil {
+		t.Fatal("expected an error when no chunk could be analyzed")
+	}
+}
+
+func TestCodeAnalysisModule_MergesGoVet(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	workspace := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/demo\n\ngo 1.21\n",
+		"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Printf(\"%d\\n\", \"text\")\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(workspace, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider := &reviewProvider{reply: `{"summary":"小さなプログラムです","issues":[]}`}
+	module := newAnalysisModule(t, provider, workspace)
+
+	result, err := module.AnalyzeCode(context.Background(), AnalysisRequest{Target: "main.go"})
+	if err != nil {
+		t.Fatalf("AnalyzeCode failed: %v", err)
+	}
+	found := false
+	for _, is := range result.Issues {
+		if is.Source == "go vet" && is.File == "main.go" && is.Line == 6 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a go vet finding on main.go:6, got %+v", result.Issues)
+	}
+}
+
+func TestCodeAnalysisModule_CapsChunks(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < (analysisMaxChunks+5)*analysisChunkLines; i++ {
+		sb.WriteString("x = 1\n")
+	}
+	provider := &reviewProvider{reply: `{"summary":"ok","issues":[]}`}
+	module := newAnalysisModule(t, provider, "")
+
+	result, err := module.AnalyzeCode(context.Background(), AnalysisRequest{Target: sb.String()})
+	if err != nil {
+		t.Fatalf("AnalyzeCode failed: %v", err)
+	}
+	if len(provider.prompts) != analysisMaxChunks || result.Metadata["skipped_chunks"] != 5 {
+		t.Fatalf("expected %d requests and 5 skipped chunks, got %d and %v", analysisMaxChunks, len(provider.prompts), result.Metadata["skipped_chunks"])
+	}
+	if !strings.Contains(result.Summary, "未解析") {
+		t.Errorf("summary should say the analysis was partial, got %q", result.Summary)
+	}
+}
+
+// recordingExecutor records commands instead of running them.
+type recordingExecutor struct {
+	cmds []tools.Command
+}
+
+func (e *recordingExecutor) Run(ctx context.Context, c tools.Command) error {
+	e.cmds = append(e.cmds, c)
+	fmt.Fprintln(c.Stdout, "./main.go:6:2: bad format")
+	return errors.New("exit status 1")
+}
+
+func TestRunGoVet_UsesExecutor(t *testing.T) {
+	executor := &recordingExecutor{}
+	issues, ok := runGoVet(context.Background(), executor, "/ws/demo", "/ws")
+	if !ok || len(issues) != 1 || issues[0].File != "demo/main.go" {
+		t.Fatalf("unexpected vet result ok=%v issues=%+v", ok, issues)
+	}
+	if len(executor.cmds) != 1 || strings.Join(executor.cmds[0].Args, " ") != "go vet ." || executor.cmds[0].Dir != "/ws/demo" {
+		t.Fatalf("go vet should run through the executor, got %+v", executor.cmds)
+	}
+	if !strings.Contains(strings.Join(executor.cmds[0].Env, " "), "GOPROXY=off") {
+		t.Errorf("go vet must not download modules, env %v", executor.cmds[0].Env)
+	}
+}
+
+func TestParseGoVetOutput(t *testing.T) {
+	out := "# example.com/demo\n./main.go:6:2: fmt.Printf format %d has arg \"text\" of wrong type string\nvet: something else\n"
+	issues := parseGoVetOutput(out, "/ws/demo", "/ws")
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %+v", issues)
+	}
+	if issues[0].File != "demo/main.go" || issues[0].Line != 6 || issues[0].Severity != "warning" {
+		t.Errorf("unexpected issue %+v", issues[0])
+	}
+}
@@ -2,24 +2,73 @@ package order
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
 )
 
+// PendingProposalsFile is the file name used for persisted pending proposals.
+const PendingProposalsFile = "pending_proposals.json"
+
+// PendingProposal is a proposal waiting for /approve or /deny, together with
+// the chat it came from so the execution result can be reported back there.
+type PendingProposal struct {
+	Proposal   Proposal  `json:"proposal"`
+	Channel    string    `json:"channel,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	SessionKey string    `json:"session_key,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 // ApprovalFlowModule manages the approval workflow for proposals.
 // This module handles storing pending proposals, checking approval status,
-// and managing auto-approve rules.
+// and managing auto-approve rules. Pending proposals are keyed by JobID and,
+// when a store path is set, persisted so they survive restarts.
 type ApprovalFlowModule struct {
 	agent            *modules.AgentCore
-	pendingProposals map[string]Proposal
+	mu               sync.RWMutex
+	pendingProposals map[string]PendingProposal
+	storePath        string
 }
 
-// NewApprovalFlowModule creates a new approval flow module.
+// NewApprovalFlowModule creates a new in-memory approval flow module.
 func NewApprovalFlowModule() *ApprovalFlowModule {
 	return &ApprovalFlowModule{
-		pendingProposals: make(map[string]Proposal),
+		pendingProposals: make(map[string]PendingProposal),
+	}
+}
+
+// NewPersistentApprovalFlowModule creates an approval flow module that loads
+// pending proposals from path and saves every change back to it.
+func NewPersistentApprovalFlowModule(path string) (*ApprovalFlowModule, error) {
+	m := NewApprovalFlowModule()
+	m.storePath = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("failed to read pending proposals: %w", err)
 	}
+	var pending []PendingProposal
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse pending proposals: %w", err)
+	}
+	for _, p := range pending {
+		if p.Proposal.JobID != "" {
+			m.pendingProposals[p.Proposal.JobID] = p
+		}
+	}
+	return m, nil
 }
 
 // Name returns the module name.
@@ -40,49 +89,164 @@ func (m *ApprovalFlowModule) Shutdown(ctx context.Context) error {
 
 // StorePendingProposal stores a proposal pending approval.
 func (m *ApprovalFlowModule) StorePendingProposal(proposal Proposal) {
-	m.pendingProposals[proposal.JobID] = proposal
+	m.StorePending(PendingProposal{Proposal: proposal})
+}
+
+// StorePending stores a pending proposal with its origin. A proposal with the
+// same JobID replaces the previous one.
+func (m *ApprovalFlowModule) StorePending(pending PendingProposal) {
+	if pending.CreatedAt.IsZero() {
+		pending.CreatedAt = time.Now()
+	}
+
+	m.mu.Lock()
+	m.pendingProposals[pending.Proposal.JobID] = pending
+	m.saveLocked()
+	m.mu.Unlock()
 
 	logger.InfoCF("approval", "proposal.pending", map[string]interface{}{
-		"job_id":   proposal.JobID,
-		"order_id": proposal.OrderID,
+		"job_id":   pending.Proposal.JobID,
+		"order_id": pending.Proposal.OrderID,
+		"channel":  pending.Channel,
+		"chat_id":  pending.ChatID,
 	})
 }
 
 // GetPendingProposal retrieves a pending proposal by JobID.
 func (m *ApprovalFlowModule) GetPendingProposal(jobID string) (Proposal, bool) {
-	proposal, exists := m.pendingProposals[jobID]
-	return proposal, exists
+	pending, exists := m.GetPending(jobID)
+	return pending.Proposal, exists
+}
+
+// GetPending retrieves a pending proposal and its origin by JobID.
+func (m *ApprovalFlowModule) GetPending(jobID string) (PendingProposal, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pending, exists := m.pendingProposals[jobID]
+	return pending, exists
+}
+
+// ListPending returns all pending proposals, oldest first.
+func (m *ApprovalFlowModule) ListPending() []PendingProposal {
+	m.mu.RLock()
+	// The file only gets redacted copies; a proposal approved after a
+	// restart runs the redacted plan and patch.
+	list := make([]PendingProposal, 0, len(m.pendingProposals))
+	for _, p := range m.pendingProposals {
+		if r := redact.Default(); r != nil {
+			p.Proposal.Plan = r.Redact(p.SessionKey, p.Proposal.Plan)
+			p.Proposal.Patch = r.Redact(p.SessionKey, p.Proposal.Patch)
+			p.Proposal.Risk = r.Redact(p.SessionKey, p.Proposal.Risk)
+		}
+		list = append(list, p)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].Proposal.JobID < list[j].Proposal.JobID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
 }
 
 // ApprovePendingProposal marks a proposal as approved.
 func (m *ApprovalFlowModule) ApprovePendingProposal(jobID string) bool {
-	proposal, exists := m.pendingProposals[jobID]
+	_, ok := m.Approve(jobID)
+	return ok
+}
+
+// Approve removes an approved proposal from the pending set and returns it so
+// the caller can execute it.
+func (m *ApprovalFlowModule) Approve(jobID string) (PendingProposal, bool) {
+	pending, exists := m.take(jobID)
 	if !exists {
-		return false
+		return PendingProposal{}, false
 	}
 
 	logger.InfoCF("approval", "proposal.approved", map[string]interface{}{
 		"job_id":   jobID,
-		"order_id": proposal.OrderID,
+		"order_id": pending.Proposal.OrderID,
 	})
-
-	// TODO: Trigger execution of approved proposal
-	delete(m.pendingProposals, jobID)
-	return true
+	return pending, true
 }
 
 // DenyPendingProposal marks a proposal as denied.
 func (m *ApprovalFlowModule) DenyPendingProposal(jobID string) bool {
-	proposal, exists := m.pendingProposals[jobID]
+	_, ok := m.Deny(jobID)
+	return ok
+}
+
+// Deny removes a denied proposal from the pending set and returns it.
+func (m *ApprovalFlowModule) Deny(jobID string) (PendingProposal, bool) {
+	pending, exists := m.take(jobID)
 	if !exists {
-		return false
+		return PendingProposal{}, false
 	}
 
 	logger.InfoCF("approval", "proposal.denied", map[string]interface{}{
 		"job_id":   jobID,
-		"order_id": proposal.OrderID,
+		"order_id": pending.Proposal.OrderID,
 	})
+	return pending, true
+}
 
+// take removes and returns the pending proposal for jobID.
+func (m *ApprovalFlowModule) take(jobID string) (PendingProposal, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, exists := m.pendingProposals[jobID]
+	if !exists {
+		return PendingProposal{}, false
+	}
 	delete(m.pendingProposals, jobID)
-	return true
+	m.saveLocked()
+	return pending, true
+}
+
+// saveLocked writes the pending set to storePath using temp file + rename.
+// Must be called with the lock held.
+func (m *ApprovalFlowModule) saveLocked() {
+	if m.storePath == "" {
+		return
+	}
+	if err := m.writeLocked(); err != nil {
+		logger.WarnCF("approval", "proposal.save_failed", map[string]interface{}{
+			"path":  m.storePath,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (m *ApprovalFlowModule) writeLocked() error {
+	// The file only gets redacted copies; a proposal approved after a
+	// restart runs the redacted plan and patch.
+	list := make([]PendingProposal, 0, len(m.pendingProposals))
+	for _, p := range m.pendingProposals {
+		if r := redact.Default(); r != nil {
+			p.Proposal.Plan = r.Redact(p.SessionKey, p.Proposal.Plan)
+			p.Proposal.Patch = r.Redact(p.SessionKey, p.Proposal.Patch)
+			p.Proposal.Risk = r.Redact(p.SessionKey, p.Proposal.Risk)
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Proposal.JobID < list[j].Proposal.JobID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.storePath), 0755); err != nil {
+		return err
+	}
+	tempFile := m.storePath + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, m.storePath); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
 }
@@ -2,7 +2,13 @@ package order
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
 )
@@ -94,3 +100,80 @@ func TestApprovalFlowModule(t *testing.T) {
 		t.Fatalf("Shutdown failed: %v", err)
 	}
 }
+
+func TestApprovalFlowModule_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", PendingProposalsFile)
+	module, err := NewPersistentApprovalFlowModule(path)
+	if err != nil {
+		t.Fatalf("NewPersistentApprovalFlowModule failed: %v", err)
+	}
+
+	module.StorePending(PendingProposal{
+		Proposal:   Proposal{JobID: "job_20261016_002", OrderID: "order3", Patch: "p2"},
+		Channel:    "telegram",
+		ChatID:     "42",
+		SessionKey: "telegram:42",
+		CreatedAt:  time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC),
+	})
+	module.StorePending(PendingProposal{
+		Proposal:  Proposal{JobID: "job_20261016_001", OrderID: "order1", Plan: "set token=sk-abcdefghijklmnopqrstuvwx", Patch: "p1"},
+		CreatedAt: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+	})
+
+	// The file only gets a redacted copy.
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "sk-abcdefghijklmnopqrstuvwx") {
+		t.Errorf("pending proposals file contains the secret:\n%s", data)
+	}
+	if p, _ := module.GetPending("job_20261016_001"); !strings.Contains(p.Proposal.Plan, "sk-abcdefghijklmnopqrstuvwx") {
+		t.Errorf("in-memory plan was redacted: %q", p.Proposal.Plan)
+	}
+
+	reloaded, err := NewPersistentApprovalFlowModule(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	list := reloaded.ListPending()
+	if len(list) != 2 || list[0].Proposal.JobID != "job_20261016_001" {
+		t.Fatalf("expected 2 proposals oldest first, got %+v", list)
+	}
+	if list[1].Channel != "telegram" || list[1].ChatID != "42" || list[1].Proposal.Patch != "p2" {
+		t.Errorf("origin not persisted: %+v", list[1])
+	}
+
+	if _, ok := reloaded.Approve("job_20261016_002"); !ok {
+		t.Fatal("expected approval to succeed")
+	}
+	again, err := NewPersistentApprovalFlowModule(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := again.GetPending("job_20261016_002"); ok {
+		t.Error("approved proposal should be removed from the store")
+	}
+}
+
+func TestApprovalFlowModule_ConcurrentAccess(t *testing.T) {
+	module, err := NewPersistentApprovalFlowModule(filepath.Join(t.TempDir(), PendingProposalsFile))
+	if err != nil {
+		t.Fatalf("NewPersistentApprovalFlowModule failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jobID := fmt.Sprintf("job_20261016_%03d", i)
+			module.StorePendingProposal(Proposal{JobID: jobID})
+			module.ListPending()
+			if i%2 == 0 {
+				module.DenyPendingProposal(jobID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(module.ListPending()); n != 10 {
+		t.Errorf("expected 10 pending proposals, got %d", n)
+	}
+}
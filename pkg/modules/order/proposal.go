@@ -21,13 +21,13 @@ type ProposalRequest struct {
 
 // Proposal represents a generated proposal from an Order agent.
 type Proposal struct {
-	JobID      string
-	OrderID    string
-	Plan       string
-	Patch      string
-	Risk       string
-	Confidence float64
-	Metadata   map[string]interface{}
+	JobID      string                 `json:"job_id"`
+	OrderID    string                 `json:"order_id"`
+	Plan       string                 `json:"plan"`
+	Patch      string                 `json:"patch"`
+	Risk       string                 `json:"risk"`
+	Confidence float64                `json:"confidence"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // ProposalGenerationModule generates implementation proposals.
@@ -107,6 +107,10 @@ func (m *ProposalGenerationModule) GenerateProposal(ctx context.Context, req Pro
 
 	// Parse response into plan/patch/risk
 	plan, patch, risk := m.parseProposalResponse(response.Content)
+	tokens := 0
+	if response.Usage != nil {
+		tokens = response.Usage.TotalTokens
+	}
 
 	proposal := Proposal{
 		JobID:      req.JobID,
@@ -116,7 +120,7 @@ func (m *ProposalGenerationModule) GenerateProposal(ctx context.Context, req Pro
 		Risk:       risk,
 		Confidence: 0.8, // TODO: Calculate confidence from response
 		Metadata: map[string]interface{}{
-			"tokens": response.Usage.TotalTokens,
+			"tokens": tokens,
 			"model":  m.agent.Model,
 		},
 	}
@@ -125,7 +129,7 @@ func (m *ProposalGenerationModule) GenerateProposal(ctx context.Context, req Pro
 		"job_id":     req.JobID,
 		"order_id":   m.agent.ID,
 		"confidence": proposal.Confidence,
-		"tokens":     response.Usage.TotalTokens,
+		"tokens":     tokens,
 	})
 
 	return proposal, nil
@@ -2,30 +2,54 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
 )
 
 // OrderResult represents the result from an Order agent (Order1/Order2/Order3).
 type OrderResult struct {
-	JobID      string
-	OrderID    string
-	Success    bool
-	Output     string
-	Plan       string
-	Patch      string
-	Risk       string
-	Error      error
-	Metadata   map[string]interface{}
+	JobID    string
+	OrderID  string
+	Success  bool
+	Output   string
+	Plan     string
+	Patch    string
+	Risk     string
+	Error    error
+	Metadata map[string]interface{}
 }
 
+// ProposalScore is the Worker's assessment of one Order proposal in Deliberation Mode.
+type ProposalScore struct {
+	OrderID      string
+	Success      bool
+	PatchApplies bool   // the patch parsed and passed the PatchChecker
+	PatchError   string // why the patch does not apply, if it does not
+	TestsNamed   bool   // the proposal names the tests that verify it
+	RiskSeverity string // "low", "medium", "high" or "unknown"
+	Heuristic    float64
+	Judge        float64 // 0-10 from the LLM judge, or -1 when unavailable
+	JudgeReason  string
+	Total        float64
+}
+
+// PatchChecker reports whether patch could be applied to the workspace.
+// It must not modify anything.
+type PatchChecker func(patch string) error
+
 // AggregationModule aggregates results from Order agents.
 // When multiple Orders provide proposals (Deliberation Mode),
-// this module collects and combines their results.
+// this module ranks them with heuristics plus an LLM judge.
 type AggregationModule struct {
-	agent *modules.AgentCore
+	agent        *modules.AgentCore
+	patchChecker PatchChecker
 }
 
 // NewAggregationModule creates a new aggregation module.
@@ -49,10 +73,18 @@ func (m *AggregationModule) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// SetPatchChecker installs the check used for the "patch applies" heuristic.
+// Without one, a patch counts as applicable when it is non-empty.
+func (m *AggregationModule) SetPatchChecker(fn PatchChecker) {
+	m.patchChecker = fn
+}
+
 // Aggregate combines results from Order agents into a single result.
 // For single Order execution, it just packages the result.
-// For Deliberation Mode, it compares and ranks proposals.
-func (m *AggregationModule) Aggregate(ctx context.Context, results []OrderResult) (OrderResult, error) {
+// For Deliberation Mode, it ranks the proposals (judged on judge, see Rank)
+// and returns the winner with a comparison appended to its Output and the
+// scores in Metadata["deliberation"].
+func (m *AggregationModule) Aggregate(ctx context.Context, results []OrderResult, judge LLM) (OrderResult, error) {
 	if len(results) == 0 {
 		return OrderResult{}, fmt.Errorf("no results to aggregate")
 	}
@@ -67,15 +99,286 @@ func (m *AggregationModule) Aggregate(ctx context.Context, results []OrderResult
 		return results[0], nil
 	}
 
-	// For multiple results (Deliberation Mode), select the best one
-	// TODO: Implement sophisticated comparison logic
-	// For now, just return the first successful result
-	for _, result := range results {
-		if result.Success {
-			return result, nil
+	scores := m.Rank(ctx, results, judge)
+	if !scores[0].Success {
+		// All Orders failed: report the first failure.
+		return results[0], nil
+	}
+
+	var winner OrderResult
+	for _, r := range results {
+		if r.OrderID == scores[0].OrderID {
+			winner = r
+			break
+		}
+	}
+	comparison := FormatComparison(scores, results)
+
+	metadata := make(map[string]interface{}, len(winner.Metadata)+2)
+	for k, v := range winner.Metadata {
+		metadata[k] = v
+	}
+	metadata["deliberation"] = scores
+	metadata["comparison"] = comparison
+	winner.Metadata = metadata
+	winner.Output = strings.TrimRight(winner.Output, "\n") + "\n\n" + comparison
+
+	logger.InfoCF("aggregation", "worker.deliberation.winner", map[string]interface{}{
+		"job_id":   winner.JobID,
+		"order_id": winner.OrderID,
+		"total":    scores[0].Total,
+	})
+	return winner, nil
+}
+
+// Rank scores every result and returns them best first. Failed results are
+// always ranked last; ties keep the input order. Successful proposals are also
+// scored by the LLM judge when judge has a provider.
+func (m *AggregationModule) Rank(ctx context.Context, results []OrderResult, judge LLM) []ProposalScore {
+	scores := make([]ProposalScore, len(results))
+	successful := make([]OrderResult, 0, len(results))
+	for i, r := range results {
+		scores[i] = m.scoreHeuristics(r)
+		if r.Success {
+			successful = append(successful, r)
+		}
+	}
+
+	// Without a Worker LLM the ranking falls back to heuristics only.
+	judged := map[string]judgeScore{}
+	if len(successful) > 1 && judge.Provider != nil {
+		var err error
+		judged, err = m.judge(ctx, judge, successful)
+		if err != nil {
+			logger.WarnCF("aggregation", "worker.deliberation.judge_failed", map[string]interface{}{
+				"job_id": results[0].JobID,
+				"error":  err.Error(),
+			})
+		}
+	}
+
+	for i := range scores {
+		s := &scores[i]
+		s.Judge = -1
+		if j, ok := judged[strings.ToLower(s.OrderID)]; ok {
+			s.Judge = j.Score
+			s.JudgeReason = j.Reason
+		}
+		s.Total = s.Heuristic
+		if s.Judge >= 0 {
+			s.Total += s.Judge / 2
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Success != scores[j].Success {
+			return scores[i].Success
+		}
+		return scores[i].Total > scores[j].Total
+	})
+	return scores
+}
+
+// scoreHeuristics rates a proposal without an LLM:
+// patch applies +3 (a broken patch -2), tests named +2,
+// risk low +1 / medium 0 / high -2.
+func (m *AggregationModule) scoreHeuristics(r OrderResult) ProposalScore {
+	s := ProposalScore{OrderID: r.OrderID, Success: r.Success, RiskSeverity: "unknown"}
+	if !r.Success {
+		return s
+	}
+
+	if strings.TrimSpace(r.Patch) != "" {
+		s.PatchApplies = true
+		if m.patchChecker != nil {
+			if err := m.patchChecker(r.Patch); err != nil {
+				s.PatchApplies = false
+				s.PatchError = err.Error()
+			}
+		}
+		if s.PatchApplies {
+			s.Heuristic += 3
+		} else {
+			s.Heuristic -= 2
+		}
+	}
+
+	s.TestsNamed = namesTests(r.Plan + "\n" + r.Patch)
+	if s.TestsNamed {
+		s.Heuristic += 2
+	}
+
+	s.RiskSeverity = riskSeverity(r.Risk)
+	switch s.RiskSeverity {
+	case "low":
+		s.Heuristic += 1
+	case "high":
+		s.Heuristic -= 2
+	}
+	return s
+}
+
+var testNamePattern = regexp.MustCompile(`(?i)(_test\.(go|py|ts|js)\b|\bTest[A-Z]\w*|\btest_\w+|\.(spec|test)\.(ts|js|tsx|jsx)\b|\bgo test\b|\bpytest\b|\b(npm|pnpm|yarn) (run )?test\b|\bcargo test\b)`)
+
+// namesTests reports whether text names concrete tests or a test command.
+func namesTests(text string) bool {
+	return testNamePattern.MatchString(text)
+}
+
+var (
+	highRiskPattern   = regexp.MustCompile(`(?i)\b(critical|high|severe)\b|高リスク|リスク[:：]\s*高|重大|危険|破壊的|データ損失`)
+	mediumRiskPattern = regexp.MustCompile(`(?i)\b(medium|moderate)\b|リスク[:：]\s*中|中程度`)
+	lowRiskPattern    = regexp.MustCompile(`(?i)\b(low|minimal|negligible|none)\b|低リスク|リスク[:：]\s*低|軽微|特になし`)
+)
+
+// riskSeverity classifies a RISK section. The highest severity mentioned wins.
+func riskSeverity(risk string) string {
+	switch {
+	case strings.TrimSpace(risk) == "":
+		return "unknown"
+	case highRiskPattern.MatchString(risk):
+		return "high"
+	case mediumRiskPattern.MatchString(risk):
+		return "medium"
+	case lowRiskPattern.MatchString(risk):
+		return "low"
+	default:
+		return "unknown"
+	}
+}
+
+type judgeScore struct {
+	Score  float64
+	Reason string
+}
+
+// judge asks llm to score each proposal from 0 to 10.
+func (m *AggregationModule) judge(ctx context.Context, llm LLM, results []OrderResult) (map[string]judgeScore, error) {
+	var b strings.Builder
+	b.WriteString("同じタスクに対する複数の実装提案を比較し、それぞれを 0〜10 点で採点してください。\n")
+	b.WriteString("観点: 正しさ、タスクへの適合、パッチが適用可能か、テストの有無、リスクの低さ。\n\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "=== %s ===\n## PLAN\n%s\n\n## PATCH\n%s\n\n## RISK\n%s\n\n",
+			r.OrderID, truncateForJudge(r.Plan, 4000), truncateForJudge(r.Patch, 8000), truncateForJudge(r.Risk, 2000))
+	}
+	b.WriteString(`JSON のみで回答してください: {"scores":[{"order_id":"order1","score":7,"reason":"短い理由"}]}`)
+
+	messages := []providers.Message{
+		{
+			Role:    "system",
+			Content: "あなたは厳格なコードレビュアーです。提案を公平に比較し、指定された JSON だけを返します。",
+		},
+		{
+			Role:    "user",
+			Content: b.String(),
+		},
+	}
+
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("judge call failed: %w", err)
+	}
+	return parseJudgeResponse(response.Content)
+}
+
+func parseJudgeResponse(content string) (map[string]judgeScore, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end <= start {
+		return nil, fmt.Errorf("judge returned no JSON")
+	}
+
+	var parsed struct {
+		Scores []struct {
+			OrderID string  `json:"order_id"`
+			Score   float64 `json:"score"`
+			Reason  string  `json:"reason"`
+		} `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse judge JSON: %w", err)
+	}
+
+	out := make(map[string]judgeScore, len(parsed.Scores))
+	for _, s := range parsed.Scores {
+		score := s.Score
+		if score < 0 {
+			score = 0
+		} else if score > 10 {
+			score = 10
 		}
+		out[strings.ToLower(strings.TrimSpace(s.OrderID))] = judgeScore{Score: score, Reason: strings.TrimSpace(s.Reason)}
+	}
+	return out, nil
+}
+
+func truncateForJudge(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "\n...(truncated)"
+}
+
+// FormatComparison renders ranked scores as a short comparison for the user.
+// Failed Orders are listed with their error so partial results are visible.
+func FormatComparison(scores []ProposalScore, results []OrderResult) string {
+	errs := make(map[string]error, len(results))
+	for _, r := range results {
+		errs[r.OrderID] = r.Error
 	}
 
-	// If all failed, return the first error
-	return results[0], nil
+	var b strings.Builder
+	b.WriteString("## 比較（熟議モード）\n")
+	rank := 0
+	for _, s := range scores {
+		if !s.Success {
+			reason := "失敗"
+			if err := errs[s.OrderID]; err != nil {
+				reason = err.Error()
+			}
+			fmt.Fprintf(&b, "- %s: 提案なし（%s）\n", s.OrderID, reason)
+			continue
+		}
+		rank++
+		var notes []string
+		if s.PatchApplies {
+			notes = append(notes, "パッチ適用可")
+		} else if s.PatchError != "" {
+			notes = append(notes, "パッチ適用不可")
+		} else {
+			notes = append(notes, "パッチなし")
+		}
+		if s.TestsNamed {
+			notes = append(notes, "テストあり")
+		} else {
+			notes = append(notes, "テスト未記載")
+		}
+		notes = append(notes, "リスク"+riskLabel(s.RiskSeverity))
+		if s.Judge >= 0 {
+			judge := fmt.Sprintf("審査 %.0f/10", s.Judge)
+			if s.JudgeReason != "" {
+				judge += "（" + s.JudgeReason + "）"
+			}
+			notes = append(notes, judge)
+		}
+		marker := ""
+		if rank == 1 {
+			marker = " ★採用"
+		}
+		fmt.Fprintf(&b, "%d. %s%s: 総合 %.1f — %s\n", rank, s.OrderID, marker, s.Total, strings.Join(notes, " / "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func riskLabel(severity string) string {
+	switch severity {
+	case "low":
+		return "低"
+	case "medium":
+		return "中"
+	case "high":
+		return "高"
+	default:
+		return "不明"
+	}
 }
@@ -3,9 +3,11 @@ package worker
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
 )
 
 func TestAggregationModule(t *testing.T) {
@@ -37,7 +39,7 @@ func TestAggregationModule(t *testing.T) {
 		},
 	}
 
-	aggregated, err := module.Aggregate(context.Background(), results)
+	aggregated, err := module.Aggregate(context.Background(), results, LLM{})
 	if err != nil {
 		t.Fatalf("Aggregate failed: %v", err)
 	}
@@ -62,7 +64,7 @@ func TestAggregationModule(t *testing.T) {
 		},
 	}
 
-	aggregated, err = module.Aggregate(context.Background(), results)
+	aggregated, err = module.Aggregate(context.Background(), results, LLM{})
 	if err != nil {
 		t.Fatalf("Aggregate failed: %v", err)
 	}
@@ -87,7 +89,7 @@ func TestAggregationModule(t *testing.T) {
 		},
 	}
 
-	aggregated, err = module.Aggregate(context.Background(), results)
+	aggregated, err = module.Aggregate(context.Background(), results, LLM{})
 	if err != nil {
 		t.Fatalf("Aggregate failed: %v", err)
 	}
@@ -98,7 +100,7 @@ func TestAggregationModule(t *testing.T) {
 
 	// Test empty results
 	results = []OrderResult{}
-	_, err = module.Aggregate(context.Background(), results)
+	_, err = module.Aggregate(context.Background(), results, LLM{})
 	if err == nil {
 		t.Error("Expected error for empty results")
 	}
@@ -109,3 +111,115 @@ func TestAggregationModule(t *testing.T) {
 		t.Fatalf("Shutdown failed: %v", err)
 	}
 }
+
+type judgeProvider struct {
+	content string
+	err     error
+}
+
+func (p *judgeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &providers.LLMResponse{Content: p.content}, nil
+}
+
+func (p *judgeProvider) GetDefaultModel() string { return "judge" }
+
+func deliberationResults() []OrderResult {
+	return []OrderResult{
+		{
+			JobID: "job_20261016_001", OrderID: "order1", Success: true,
+			Output: "order1 output", Plan: "設計のみ", Risk: "リスク: 高（既存 API を破壊的に変更）",
+		},
+		{
+			JobID: "job_20261016_001", OrderID: "order2", Success: true,
+			Output: "order2 output", Plan: "実装して TestParseConfig を追加", Patch: "```go:/ws/config.go\npackage config\n```", Risk: "low",
+		},
+		{
+			JobID: "job_20261016_001", OrderID: "order3", Success: false,
+			Error: errors.New("timed out after 3m0s"),
+		},
+	}
+}
+
+func TestAggregationModule_DeliberationHeuristics(t *testing.T) {
+	module := NewAggregationModule()
+	module.Initialize(context.Background(), &modules.AgentCore{ID: "worker"})
+
+	aggregated, err := module.Aggregate(context.Background(), deliberationResults(), LLM{})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if aggregated.OrderID != "order2" {
+		t.Fatalf("expected order2 (patch, tests, low risk) to win, got %s", aggregated.OrderID)
+	}
+	comparison, _ := aggregated.Metadata["comparison"].(string)
+	for _, want := range []string{"★採用", "order1", "order3", "timed out"} {
+		if !strings.Contains(comparison, want) {
+			t.Errorf("comparison missing %q:\n%s", want, comparison)
+		}
+	}
+	if !strings.Contains(aggregated.Output, comparison) {
+		t.Error("winner output should include the comparison")
+	}
+
+	scores, _ := aggregated.Metadata["deliberation"].([]ProposalScore)
+	if len(scores) != 3 || scores[2].OrderID != "order3" || scores[2].Success {
+		t.Errorf("failed Orders should rank last, got %+v", scores)
+	}
+	if scores[0].Judge != -1 {
+		t.Errorf("no judge was configured, got score %v", scores[0].Judge)
+	}
+}
+
+func TestAggregationModule_JudgeAndPatchChecker(t *testing.T) {
+	module := NewAggregationModule()
+	module.Initialize(context.Background(), &modules.AgentCore{ID: "worker"})
+	judge := LLM{Provider: &judgeProvider{content: "```json\n{\"scores\":[{\"order_id\":\"order1\",\"score\":10,\"reason\":\"設計が堅実\"},{\"order_id\":\"order2\",\"score\":1,\"reason\":\"誤り\"}]}\n```"}}
+	module.SetPatchChecker(func(patch string) error {
+		return errors.New("file path outside workspace")
+	})
+
+	scores := module.Rank(context.Background(), deliberationResults(), judge)
+	if scores[0].OrderID != "order1" {
+		t.Fatalf("judge plus broken patch should make order1 win, got %+v", scores)
+	}
+	for _, s := range scores {
+		if s.OrderID == "order2" && (s.PatchApplies || s.PatchError == "") {
+			t.Errorf("patch checker result not recorded: %+v", s)
+		}
+	}
+	if scores[0].JudgeReason != "設計が堅実" {
+		t.Errorf("judge reason not recorded: %+v", scores[0])
+	}
+}
+
+func TestAggregationModule_JudgeFailureFallsBackToHeuristics(t *testing.T) {
+	module := NewAggregationModule()
+	module.Initialize(context.Background(), &modules.AgentCore{ID: "worker"})
+
+	aggregated, err := module.Aggregate(context.Background(), deliberationResults(), LLM{Provider: &judgeProvider{err: errors.New("judge down")}})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	if aggregated.OrderID != "order2" {
+		t.Errorf("expected heuristic winner order2, got %s", aggregated.OrderID)
+	}
+}
+
+func TestRiskSeverity(t *testing.T) {
+	tests := map[string]string{
+		"":                        "unknown",
+		"Risk: high, data loss":   "high",
+		"リスク：中":                   "medium",
+		"Low. Only affects tests": "low",
+		"特になし":                    "low",
+		"allow list is followed":  "unknown",
+	}
+	for in, want := range tests {
+		if got := riskSeverity(in); got != want {
+			t.Errorf("riskSeverity(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -16,6 +16,13 @@ type ExecutionModule struct {
 	agent *modules.AgentCore
 }
 
+// LLM is the provider and model a Worker call runs on. It is bound per turn
+// by the caller, so /local and budget demotion apply to the Worker as well.
+type LLM struct {
+	Provider providers.LLMProvider
+	Model    string
+}
+
 // NewExecutionModule creates a new execution module.
 func NewExecutionModule() *ExecutionModule {
 	return &ExecutionModule{}
@@ -37,36 +44,36 @@ func (m *ExecutionModule) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// ExecuteTask executes a task directly using Worker's capabilities.
+// ExecuteTask executes a task directly on llm.
 // This is used for non-coding tasks that don't require delegation to Order agents.
-func (m *ExecutionModule) ExecuteTask(ctx context.Context, jobID, route, userText string) (string, error) {
+func (m *ExecutionModule) ExecuteTask(ctx context.Context, jobID, route, userText string, llm LLM) (string, error) {
 	logger.InfoCF("execution", "worker.execute", map[string]interface{}{
 		"job_id": jobID,
 		"route":  route,
 	})
 
-	if m.agent.Provider == nil {
+	if llm.Provider == nil {
 		return "", fmt.Errorf("LLM provider not configured for Worker")
 	}
 
 	// Execute based on route
 	switch route {
 	case "CHAT":
-		return m.executeChat(ctx, userText)
+		return m.executeChat(ctx, llm, userText)
 	case "OPS":
-		return m.executeOps(ctx, userText)
+		return m.executeOps(ctx, llm, userText)
 	case "RESEARCH":
-		return m.executeResearch(ctx, userText)
+		return m.executeResearch(ctx, llm, userText)
 	case "PLAN":
-		return m.executePlan(ctx, userText)
+		return m.executePlan(ctx, llm, userText)
 	case "ANALYZE":
-		return m.executeAnalyze(ctx, userText)
+		return m.executeAnalyze(ctx, llm, userText)
 	default:
 		return "", fmt.Errorf("unsupported route for direct execution: %s", route)
 	}
 }
 
-func (m *ExecutionModule) executeChat(ctx context.Context, userText string) (string, error) {
+func (m *ExecutionModule) executeChat(ctx context.Context, llm LLM, userText string) (string, error) {
 	// Use Provider to generate chat response
 	messages := []providers.Message{
 		{
@@ -75,19 +82,23 @@ func (m *ExecutionModule) executeChat(ctx context.Context, userText string) (str
 		},
 	}
 
-	response, err := m.agent.Provider.Chat(ctx, messages, nil, m.agent.Model, nil)
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
 	if err != nil {
 		return "", fmt.Errorf("chat execution failed: %w", err)
 	}
 
+	tokens := 0
+	if response.Usage != nil {
+		tokens = response.Usage.TotalTokens
+	}
 	logger.InfoCF("execution", "worker.chat.complete", map[string]interface{}{
-		"tokens": response.Usage.TotalTokens,
+		"tokens": tokens,
 	})
 
 	return response.Content, nil
 }
 
-func (m *ExecutionModule) executeOps(ctx context.Context, userText string) (string, error) {
+func (m *ExecutionModule) executeOps(ctx context.Context, llm LLM, userText string) (string, error) {
 	// Use Provider with OPS-specific system prompt
 	systemPrompt := "あなたは運用・手順のスペシャリストです。手順を明確に説明します。"
 	messages := []providers.Message{
@@ -101,7 +112,7 @@ func (m *ExecutionModule) executeOps(ctx context.Context, userText string) (stri
 		},
 	}
 
-	response, err := m.agent.Provider.Chat(ctx, messages, nil, m.agent.Model, nil)
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
 	if err != nil {
 		return "", fmt.Errorf("ops execution failed: %w", err)
 	}
@@ -109,7 +120,7 @@ func (m *ExecutionModule) executeOps(ctx context.Context, userText string) (stri
 	return response.Content, nil
 }
 
-func (m *ExecutionModule) executeResearch(ctx context.Context, userText string) (string, error) {
+func (m *ExecutionModule) executeResearch(ctx context.Context, llm LLM, userText string) (string, error) {
 	// Use Provider with RESEARCH-specific system prompt
 	systemPrompt := "あなたは調査のスペシャリストです。情報を収集・整理してまとめます。"
 	messages := []providers.Message{
@@ -123,7 +134,7 @@ func (m *ExecutionModule) executeResearch(ctx context.Context, userText string)
 		},
 	}
 
-	response, err := m.agent.Provider.Chat(ctx, messages, nil, m.agent.Model, nil)
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
 	if err != nil {
 		return "", fmt.Errorf("research execution failed: %w", err)
 	}
@@ -131,7 +142,7 @@ func (m *ExecutionModule) executeResearch(ctx context.Context, userText string)
 	return response.Content, nil
 }
 
-func (m *ExecutionModule) executePlan(ctx context.Context, userText string) (string, error) {
+func (m *ExecutionModule) executePlan(ctx context.Context, llm LLM, userText string) (string, error) {
 	// Use Provider with PLAN-specific system prompt
 	systemPrompt := "あなたは計画立案のスペシャリストです。段取りを整理して提示します。"
 	messages := []providers.Message{
@@ -145,7 +156,7 @@ func (m *ExecutionModule) executePlan(ctx context.Context, userText string) (str
 		},
 	}
 
-	response, err := m.agent.Provider.Chat(ctx, messages, nil, m.agent.Model, nil)
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
 	if err != nil {
 		return "", fmt.Errorf("plan execution failed: %w", err)
 	}
@@ -153,7 +164,7 @@ func (m *ExecutionModule) executePlan(ctx context.Context, userText string) (str
 	return response.Content, nil
 }
 
-func (m *ExecutionModule) executeAnalyze(ctx context.Context, userText string) (string, error) {
+func (m *ExecutionModule) executeAnalyze(ctx context.Context, llm LLM, userText string) (string, error) {
 	// Use Provider with ANALYZE-specific system prompt
 	systemPrompt := "あなたは分析のスペシャリストです。情報を整理・分析して提示します。"
 	messages := []providers.Message{
@@ -167,7 +178,7 @@ func (m *ExecutionModule) executeAnalyze(ctx context.Context, userText string) (
 		},
 	}
 
-	response, err := m.agent.Provider.Chat(ctx, messages, nil, m.agent.Model, nil)
+	response, err := llm.Provider.Chat(ctx, messages, nil, llm.Model, nil)
 	if err != nil {
 		return "", fmt.Errorf("analyze execution failed: %w", err)
 	}
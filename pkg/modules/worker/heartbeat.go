@@ -5,23 +5,26 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
 )
 
 // AgentStatus represents the current status of an agent.
 type AgentStatus struct {
-	AgentID  string
-	Alias    string
-	Status   string // "idle", "processing", "timeout"
-	LastSeen time.Time
-	JobID    string
+	AgentID  string    `json:"agent_id"`
+	Alias    string    `json:"alias,omitempty"`
+	Status   string    `json:"status"` // "idle", "processing", "waiting", "timeout"
+	LastSeen time.Time `json:"last_seen"`
+	JobID    string    `json:"job_id,omitempty"`
+	// Since is when the agent entered Status for JobID.
+	Since time.Time `json:"since"`
 }
 
 // HeartbeatReport contains the status of all agents.
 type HeartbeatReport struct {
-	Timestamp time.Time
-	Agents    []AgentStatus
+	Timestamp time.Time     `json:"timestamp"`
+	Agents    []AgentStatus `json:"agents"`
 }
 
 // HeartbeatCollectorModule collects and monitors heartbeats from all agents.
@@ -42,6 +45,21 @@ func NewHeartbeatCollectorModule() *HeartbeatCollectorModule {
 	}
 }
 
+// SetTimeout sets how long an agent may go without a heartbeat before it is
+// reported as "timeout".
+func (m *HeartbeatCollectorModule) SetTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeout = timeout
+}
+
+// Timeout returns the heartbeat timeout.
+func (m *HeartbeatCollectorModule) Timeout() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.timeout
+}
+
 // Name returns the module name.
 func (m *HeartbeatCollectorModule) Name() string {
 	return "HeartbeatCollector"
@@ -74,12 +92,17 @@ func (m *HeartbeatCollectorModule) ReportHeartbeat(agentID, alias, status, jobID
 	defer m.mu.Unlock()
 
 	now := time.Now()
+	since := now
+	if prev, ok := m.agents[agentID]; ok && prev.Status == status && prev.JobID == jobID {
+		since = prev.Since
+	}
 	m.agents[agentID] = &AgentStatus{
 		AgentID:  agentID,
 		Alias:    alias,
 		Status:   status,
 		LastSeen: now,
 		JobID:    jobID,
+		Since:    since,
 	}
 
 	// Periodic cleanup of old entries
@@ -113,12 +136,30 @@ func (m *HeartbeatCollectorModule) GetReport() HeartbeatReport {
 			Status:   currentStatus,
 			LastSeen: status.LastSeen,
 			JobID:    status.JobID,
+			Since:    status.Since,
 		})
 	}
 
 	return report
 }
 
+// Collect records every heartbeat published on hb until ctx is done.
+// The agent alias is taken from the heartbeat's "alias" metadata.
+func (m *HeartbeatCollectorModule) Collect(ctx context.Context, hb *heartbeat.HeartbeatBus) {
+	ch := hb.Subscribe("*")
+	defer hb.Unsubscribe("*", ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case beat := <-ch:
+			alias, _ := beat.Metadata["alias"].(string)
+			m.ReportHeartbeat(beat.AgentID, alias, beat.Status, beat.JobID)
+		}
+	}
+}
+
 // cleanupOldEntries removes agents that haven't been seen in a long time.
 // Must be called with lock held.
 func (m *HeartbeatCollectorModule) cleanupOldEntries(now time.Time) {
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/heartbeat"
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/modules"
 )
 
@@ -82,3 +83,51 @@ func TestHeartbeatCollectorModule(t *testing.T) {
 		t.Errorf("Expected 0 agents after shutdown, got %d", len(report.Agents))
 	}
 }
+
+func TestHeartbeatCollectorModule_Collect(t *testing.T) {
+	module := NewHeartbeatCollectorModule()
+	hb := heartbeat.NewHeartbeatBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go module.Collect(ctx, hb)
+
+	waitFor := func(status string) AgentStatus {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			for _, a := range module.GetReport().Agents {
+				if a.AgentID == "order2" && a.Status == status {
+					return a
+				}
+			}
+		}
+		t.Fatalf("order2 never reported %q", status)
+		return AgentStatus{}
+	}
+
+	// Heartbeats published before Collect subscribes are not seen; repeat
+	// until the first one arrives.
+	for len(module.GetReport().Agents) == 0 {
+		hb.Report(heartbeat.AgentHeartbeat{AgentID: "order2", Status: "idle", Metadata: map[string]interface{}{"alias": "Ao"}})
+		time.Sleep(5 * time.Millisecond)
+	}
+	waitFor("idle")
+
+	hb.Report(heartbeat.AgentHeartbeat{AgentID: "order2", JobID: "job_1", Status: "processing", Metadata: map[string]interface{}{"alias": "Ao"}})
+	first := waitFor("processing")
+	if first.Alias != "Ao" || first.JobID != "job_1" {
+		t.Errorf("unexpected status: %+v", first)
+	}
+
+	// Repeated heartbeats for the same work keep Since.
+	time.Sleep(10 * time.Millisecond)
+	hb.Report(heartbeat.AgentHeartbeat{AgentID: "order2", JobID: "job_1", Status: "processing"})
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if a := waitFor("processing"); a.LastSeen.After(first.LastSeen) {
+			if !a.Since.Equal(first.Since) {
+				t.Errorf("Since changed from %v to %v for the same job", first.Since, a.Since)
+			}
+			return
+		}
+	}
+	t.Fatal("second heartbeat was not collected")
+}
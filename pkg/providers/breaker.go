@@ -0,0 +1,185 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BreakerConfig controls when a provider's circuit opens.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+	// OpenDuration is how long an open circuit rejects calls before a trial call is allowed.
+	OpenDuration time.Duration
+	// SlowCallThreshold counts successful calls slower than this as failures. Zero disables it.
+	SlowCallThreshold time.Duration
+}
+
+// BreakerStatus is a point-in-time view of one provider's circuit.
+type BreakerStatus struct {
+	Provider            string
+	Open                bool
+	ConsecutiveFailures int
+	LastError           string
+	LastLatency         time.Duration
+	OpenUntil           time.Time
+}
+
+type breakerState struct {
+	failures    int
+	lastError   string
+	lastLatency time.Duration
+	openUntil   time.Time
+	trial       bool // a half-open trial call is in flight
+}
+
+// CircuitBreakers tracks one circuit per provider name. It is safe for concurrent use.
+type CircuitBreakers struct {
+	cfg    BreakerConfig
+	now    func() time.Time
+	mu     sync.Mutex
+	states map[string]*breakerState
+	onOpen func(provider, reason string)
+}
+
+// NewCircuitBreakers creates a breaker registry. Non-positive thresholds fall back to
+// 3 failures and a 60 second open period.
+func NewCircuitBreakers(cfg BreakerConfig) *CircuitBreakers {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 60 * time.Second
+	}
+	return &CircuitBreakers{
+		cfg:    cfg,
+		now:    time.Now,
+		states: make(map[string]*breakerState),
+	}
+}
+
+// SetOnOpen registers a callback invoked (in its own goroutine) whenever a circuit opens.
+func (c *CircuitBreakers) SetOnOpen(fn func(provider, reason string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onOpen = fn
+}
+
+// Allow reports whether provider may be called. When the circuit is open it
+// returns false and a human readable reason. Once the open period has passed
+// the circuit is half-open: exactly one caller is admitted as a trial call and
+// the rest are rejected until Record (or Release) reports on it; the trial's
+// outcome closes or re-opens the circuit.
+func (c *CircuitBreakers) Allow(provider string) (bool, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.states[breakerKey(provider)]
+	if !ok || st.openUntil.IsZero() {
+		return true, ""
+	}
+	if c.now().Before(st.openUntil) {
+		return false, fmt.Sprintf("circuit open after %d consecutive failures (last: %s)", st.failures, st.lastError)
+	}
+	return c.admitTrial(st)
+}
+
+// Probe admits a trial call even while the open period lasts, still one at a
+// time. It is used when every candidate of a chain is open.
+func (c *CircuitBreakers) Probe(provider string) (bool, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.states[breakerKey(provider)]
+	if !ok || st.openUntil.IsZero() {
+		return true, ""
+	}
+	return c.admitTrial(st)
+}
+
+func (c *CircuitBreakers) admitTrial(st *breakerState) (bool, string) {
+	if st.trial {
+		return false, fmt.Sprintf("circuit half-open, trial call in flight (last: %s)", st.lastError)
+	}
+	st.trial = true
+	return true, ""
+}
+
+// Release gives up a trial call admitted by Allow or Probe without an
+// outcome, e.g. because the caller's turn was cancelled.
+func (c *CircuitBreakers) Release(provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st, ok := c.states[breakerKey(provider)]; ok {
+		st.trial = false
+	}
+}
+
+// Record stores the outcome of a call. A nil err with latency above
+// SlowCallThreshold is recorded as a failure.
+func (c *CircuitBreakers) Record(provider string, latency time.Duration, err error) {
+	key := breakerKey(provider)
+
+	c.mu.Lock()
+	st, ok := c.states[key]
+	if !ok {
+		st = &breakerState{}
+		c.states[key] = st
+	}
+	st.lastLatency = latency
+	st.trial = false
+
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	} else if c.cfg.SlowCallThreshold > 0 && latency > c.cfg.SlowCallThreshold {
+		reason = fmt.Sprintf("slow call: %s > %s", latency.Round(time.Millisecond), c.cfg.SlowCallThreshold)
+	}
+
+	if reason == "" {
+		st.failures = 0
+		st.lastError = ""
+		st.openUntil = time.Time{}
+		c.mu.Unlock()
+		return
+	}
+
+	st.failures++
+	st.lastError = reason
+	var onOpen func(string, string)
+	if st.failures >= c.cfg.FailureThreshold {
+		wasOpen := !st.openUntil.IsZero()
+		st.openUntil = c.now().Add(c.cfg.OpenDuration)
+		if !wasOpen {
+			onOpen = c.onOpen
+		}
+	}
+	c.mu.Unlock()
+
+	if onOpen != nil {
+		go onOpen(key, reason)
+	}
+}
+
+// Status returns the state of every provider seen so far.
+func (c *CircuitBreakers) Status() []BreakerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	out := make([]BreakerStatus, 0, len(c.states))
+	for name, st := range c.states {
+		out = append(out, BreakerStatus{
+			Provider:            name,
+			Open:                !st.openUntil.IsZero() && now.Before(st.openUntil),
+			ConsecutiveFailures: st.failures,
+			LastError:           st.lastError,
+			LastLatency:         st.lastLatency,
+			OpenUntil:           st.openUntil,
+		})
+	}
+	return out
+}
+
+func breakerKey(provider string) string {
+	return strings.ToLower(strings.TrimSpace(provider))
+}
@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakers_OpensAfterConsecutiveFailures(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cb := NewCircuitBreakers(BreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute})
+	cb.now = func() time.Time { return now }
+
+	opened := make(chan string, 1)
+	cb.SetOnOpen(func(provider, reason string) { opened <- provider })
+
+	cb.Record("Ollama", time.Second, errors.New("connection refused"))
+	if ok, _ := cb.Allow("ollama"); !ok {
+		t.Fatal("circuit should stay closed below the threshold")
+	}
+	cb.Record("ollama", time.Second, errors.New("connection refused"))
+	ok, reason := cb.Allow("ollama")
+	if ok || reason == "" {
+		t.Fatalf("circuit should be open with a reason, got ok=%v reason=%q", ok, reason)
+	}
+	select {
+	case p := <-opened:
+		if p != "ollama" {
+			t.Errorf("onOpen provider = %q", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onOpen was not called")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if ok, _ := cb.Allow("ollama"); !ok {
+		t.Fatal("a trial call should be allowed after the open period")
+	}
+	cb.Record("ollama", time.Second, nil)
+	if ok, _ := cb.Allow("ollama"); !ok {
+		t.Fatal("a successful trial should close the circuit")
+	}
+}
+
+func TestCircuitBreakers_SuccessResetsFailures(t *testing.T) {
+	cb := NewCircuitBreakers(BreakerConfig{FailureThreshold: 2})
+	cb.Record("deepseek", time.Second, errors.New("500"))
+	cb.Record("deepseek", time.Second, nil)
+	cb.Record("deepseek", time.Second, errors.New("500"))
+	if ok, _ := cb.Allow("deepseek"); !ok {
+		t.Fatal("failures must be consecutive to open the circuit")
+	}
+}
+
+func TestCircuitBreakers_SlowCallsCountAsFailures(t *testing.T) {
+	cb := NewCircuitBreakers(BreakerConfig{FailureThreshold: 1, SlowCallThreshold: time.Second})
+	cb.Record("anthropic", 3*time.Second, nil)
+	if ok, _ := cb.Allow("anthropic"); ok {
+		t.Fatal("slow call should open the circuit")
+	}
+	status := cb.Status()
+	if len(status) != 1 || !status[0].Open || status[0].LastLatency != 3*time.Second {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestCircuitBreakers_HalfOpenAdmitsOneTrial(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cb := NewCircuitBreakers(BreakerConfig{FailureThreshold: 1, OpenDuration: time.Minute})
+	cb.now = func() time.Time { return now }
+	cb.Record("vllm", time.Second, errors.New("down"))
+
+	now = now.Add(2 * time.Minute)
+	if ok, _ := cb.Allow("vllm"); !ok {
+		t.Fatal("the first caller should get the trial call")
+	}
+	if ok, reason := cb.Allow("vllm"); ok || reason == "" {
+		t.Fatalf("a second caller must wait for the trial, got ok=%v reason=%q", ok, reason)
+	}
+	if ok, _ := cb.Probe("vllm"); ok {
+		t.Fatal("Probe must not admit a second trial either")
+	}
+
+	cb.Release("vllm")
+	if ok, _ := cb.Allow("vllm"); !ok {
+		t.Fatal("a released trial should be handed to the next caller")
+	}
+	cb.Record("vllm", time.Second, errors.New("still down"))
+	if ok, _ := cb.Allow("vllm"); ok {
+		t.Fatal("a failed trial should re-open the circuit")
+	}
+	if ok, _ := cb.Probe("vllm"); !ok {
+		t.Fatal("Probe should admit a trial while the circuit is open")
+	}
+}
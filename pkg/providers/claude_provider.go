@@ -56,6 +56,62 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return parseClaudeResponse(resp), nil
 }
 
+// ChatStream streams text and tool-input deltas while accumulating the final message.
+func (p *ClaudeProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+
+	params, err := buildClaudeParams(messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	var msg anthropic.Message
+	for stream.Next() {
+		evt := stream.Current()
+		if err := msg.Accumulate(evt); err != nil {
+			return nil, fmt.Errorf("claude stream: %w", err)
+		}
+		if onDelta == nil {
+			continue
+		}
+		switch evt.Type {
+		case "content_block_start":
+			if evt.ContentBlock.Type == "tool_use" {
+				onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+					Index: int(evt.Index),
+					ID:    evt.ContentBlock.ID,
+					Name:  evt.ContentBlock.Name,
+				}})
+			}
+		case "content_block_delta":
+			switch evt.Delta.Type {
+			case "text_delta":
+				onDelta(StreamDelta{Content: evt.Delta.Text})
+			case "input_json_delta":
+				onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+					Index:          int(evt.Index),
+					ArgumentsDelta: evt.Delta.PartialJSON,
+				}})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("claude API call: %w", err)
+	}
+
+	return parseClaudeResponse(&msg), nil
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return "claude-sonnet-4-5-20250929"
 }
@@ -250,13 +306,11 @@ func parseClaudeResponse(resp *anthropic.Message) *LLMResponse {
 }
 
 func createClaudeTokenSource() func() (string, error) {
+	refresher := auth.RefresherFor("anthropic")
 	return func() (string, error) {
-		cred, err := auth.GetCredential("anthropic")
+		cred, err := refresher.Token()
 		if err != nil {
-			return "", fmt.Errorf("loading auth credentials: %w", err)
-		}
-		if cred == nil {
-			return "", fmt.Errorf("no credentials for anthropic. Run: picoclaw auth login --provider anthropic")
+			return "", err
 		}
 		return cred.AccessToken, nil
 	}
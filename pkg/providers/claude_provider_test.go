@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -194,6 +195,60 @@ func TestClaudeProvider_ChatRoundTrip(t *testing.T) {
 	}
 }
 
+func TestClaudeProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929","content":[],"usage":{"input_tokens":12,"output_tokens":0}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"a.txt\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, e := range events {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(e), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, e)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewClaudeProvider("test-token")
+	provider.client = createAnthropicTestClient(server.URL, "test-token")
+
+	var text string
+	var toolDeltas int
+	resp, err := provider.ChatStream(t.Context(), []Message{{Role: "user", Content: "read a.txt"}}, nil, "claude-sonnet-4-5-20250929", nil, func(d StreamDelta) {
+		text += d.Content
+		if d.ToolCall != nil {
+			toolDeltas++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if text != "Let me check." || resp.Content != "Let me check." {
+		t.Errorf("streamed %q, final %q", text, resp.Content)
+	}
+	if toolDeltas != 3 {
+		t.Errorf("expected 3 tool deltas, got %d", toolDeltas)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["path"] != "a.txt" {
+		t.Fatalf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+}
+
 func TestClaudeProvider_GetDefaultModel(t *testing.T) {
 	p := NewClaudeProvider("test-token")
 	if got := p.GetDefaultModel(); got != "claude-sonnet-4-5-20250929" {
@@ -49,6 +49,12 @@ func NewCodexProviderWithTokenSource(token, accountID string, tokenSource func()
 }
 
 func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream forwards output text and function-call argument deltas from the
+// Responses stream. The backend always streams, so Chat is ChatStream without a handler.
+func (p *CodexProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
 	var opts []option.RequestOption
 	accountID := p.accountID
 	resolvedModel, fallbackReason := resolveCodexModel(model)
@@ -86,6 +92,9 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 	var resp *responses.Response
 	for stream.Next() {
 		evt := stream.Current()
+		if onDelta != nil {
+			emitCodexDelta(evt, onDelta)
+		}
 		if evt.Type == "response.completed" || evt.Type == "response.failed" || evt.Type == "response.incomplete" {
 			evtResp := evt.Response
 			if evtResp.ID != "" {
@@ -136,6 +145,26 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 	return parseCodexResponse(resp), nil
 }
 
+func emitCodexDelta(evt responses.ResponseStreamEventUnion, onDelta StreamHandler) {
+	switch evt.Type {
+	case "response.output_text.delta":
+		onDelta(StreamDelta{Content: evt.Delta})
+	case "response.output_item.added":
+		if evt.Item.Type == "function_call" {
+			onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+				Index: int(evt.OutputIndex),
+				ID:    evt.Item.CallID,
+				Name:  evt.Item.Name,
+			}})
+		}
+	case "response.function_call_arguments.delta":
+		onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+			Index:          int(evt.OutputIndex),
+			ArgumentsDelta: evt.Delta,
+		}})
+	}
+}
+
 func (p *CodexProvider) GetDefaultModel() string {
 	return codexDefaultModel
 }
@@ -338,30 +367,12 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 }
 
 func createCodexTokenSource() func() (string, string, error) {
+	refresher := auth.RefresherFor("openai")
 	return func() (string, string, error) {
-		cred, err := auth.GetCredential("openai")
+		cred, err := refresher.Token()
 		if err != nil {
-			return "", "", fmt.Errorf("loading auth credentials: %w", err)
+			return "", "", err
 		}
-		if cred == nil {
-			return "", "", fmt.Errorf("no credentials for openai. Run: picoclaw auth login --provider openai")
-		}
-
-		if cred.AuthMethod == "oauth" && cred.NeedsRefresh() && cred.RefreshToken != "" {
-			oauthCfg := auth.OpenAIOAuthConfig()
-			refreshed, err := auth.RefreshAccessToken(cred, oauthCfg)
-			if err != nil {
-				return "", "", fmt.Errorf("refreshing token: %w", err)
-			}
-			if refreshed.AccountID == "" {
-				refreshed.AccountID = cred.AccountID
-			}
-			if err := auth.SetCredential("openai", refreshed); err != nil {
-				return "", "", fmt.Errorf("saving refreshed token: %w", err)
-			}
-			return refreshed.AccessToken, refreshed.AccountID, nil
-		}
-
 		return cred.AccessToken, cred.AccountID, nil
 	}
 }
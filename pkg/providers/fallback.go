@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+)
+
+// FallbackCandidate is one provider/model in a fallback chain.
+type FallbackCandidate struct {
+	Name     string
+	Model    string
+	Provider LLMProvider
+}
+
+// FallbackProvider calls its candidates in order until one succeeds.
+// Candidates whose circuit is open are skipped; every hop is logged with its reason.
+type FallbackProvider struct {
+	route      string
+	candidates []FallbackCandidate
+	breakers   *CircuitBreakers
+}
+
+// NewFallbackProvider builds a chain for route. candidates[0] is the primary;
+// its model follows the model passed to Chat so that /switch model keeps working.
+func NewFallbackProvider(route string, candidates []FallbackCandidate, breakers *CircuitBreakers) *FallbackProvider {
+	return &FallbackProvider{
+		route:      route,
+		candidates: candidates,
+		breakers:   breakers,
+	}
+}
+
+// Candidates returns the chain in call order.
+func (p *FallbackProvider) Candidates() []FallbackCandidate {
+	return p.candidates
+}
+
+func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	if len(p.candidates) == 0 {
+		return nil, fmt.Errorf("no providers configured for route %s", p.route)
+	}
+
+	streamed := false
+	var prev string
+	var lastErr error
+	for c := range p.available() {
+		callModel := c.Model
+		if c.Name == p.candidates[0].Name && c.Model == p.candidates[0].Model && model != "" {
+			callModel = model
+		}
+		if callModel == "" {
+			callModel = c.Provider.GetDefaultModel()
+		}
+		if prev != "" {
+			logger.WarnCF("provider.fallback", "Falling back to next provider", map[string]interface{}{
+				"route":  p.route,
+				"from":   prev,
+				"to":     c.Name,
+				"model":  callModel,
+				"reason": lastErr.Error(),
+			})
+			if streamed && onDelta != nil {
+				onDelta(StreamDelta{Restart: true})
+				streamed = false
+			}
+		}
+
+		handler := onDelta
+		if onDelta != nil {
+			handler = func(d StreamDelta) {
+				streamed = true
+				onDelta(d)
+			}
+		}
+
+		start := time.Now()
+		resp, err := callCandidate(ctx, c.Provider, messages, tools, callModel, options, handler)
+		if ctx.Err() != nil {
+			// The turn was cancelled or timed out; that says nothing about the provider.
+			p.release(c.Name)
+			if err == nil {
+				return resp, nil
+			}
+			return nil, err
+		}
+		p.record(c.Name, time.Since(start), err)
+		if err == nil {
+			return resp, nil
+		}
+		prev = c.Name
+		lastErr = fmt.Errorf("%s/%s: %w", c.Name, callModel, err)
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("all providers unavailable for route %s: circuits open", p.route)
+	}
+	return nil, fmt.Errorf("all providers failed for route %s: %w", p.route, lastErr)
+}
+
+func (p *FallbackProvider) GetDefaultModel() string {
+	if len(p.candidates) == 0 {
+		return ""
+	}
+	if p.candidates[0].Model != "" {
+		return p.candidates[0].Model
+	}
+	return p.candidates[0].Provider.GetDefaultModel()
+}
+
+// available yields the candidates whose circuit admits a call, asking each
+// breaker only when the previous candidate has failed: a half-open circuit
+// admits a single trial call, which must not be taken by a caller that never
+// gets that far. If every circuit is open the primary is still probed, so a
+// recovered provider is noticed without waiting; only one caller probes at a
+// time and the rest fail fast.
+func (p *FallbackProvider) available() iter.Seq[FallbackCandidate] {
+	return func(yield func(FallbackCandidate) bool) {
+		if p.breakers == nil {
+			for _, c := range p.candidates {
+				if !yield(c) {
+					return
+				}
+			}
+			return
+		}
+		admitted := false
+		for _, c := range p.candidates {
+			if ok, reason := p.breakers.Allow(c.Name); !ok {
+				logger.WarnCF("provider.fallback", "Skipping provider with open circuit", map[string]interface{}{
+					"route":    p.route,
+					"provider": c.Name,
+					"model":    c.Model,
+					"reason":   reason,
+				})
+				continue
+			}
+			admitted = true
+			if !yield(c) {
+				return
+			}
+		}
+		if admitted {
+			return
+		}
+		primary := p.candidates[0]
+		if ok, reason := p.breakers.Probe(primary.Name); !ok {
+			logger.WarnCF("provider.fallback", "All circuits open, primary already being probed", map[string]interface{}{
+				"route":    p.route,
+				"provider": primary.Name,
+				"reason":   reason,
+			})
+			return
+		}
+		logger.WarnCF("provider.fallback", "All circuits open, trying primary provider", map[string]interface{}{
+			"route":    p.route,
+			"provider": primary.Name,
+		})
+		yield(primary)
+	}
+}
+
+func (p *FallbackProvider) release(name string) {
+	if p.breakers != nil {
+		p.breakers.Release(name)
+	}
+}
+
+func (p *FallbackProvider) record(name string, latency time.Duration, err error) {
+	if p.breakers != nil {
+		p.breakers.Record(name, latency, err)
+	}
+}
+
+func callCandidate(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	if onDelta != nil {
+		if sp, ok := provider.(StreamingProvider); ok {
+			return sp.ChatStream(ctx, messages, tools, model, options, onDelta)
+		}
+	}
+	return provider.Chat(ctx, messages, tools, model, options)
+}
+
+// IsLocalProvider reports whether provider runs on the user's own machines.
+// /local sessions never fall back to anything else.
+func IsLocalProvider(provider string) bool {
+	switch breakerKey(provider) {
+	case "ollama", "vllm":
+		return true
+	}
+	return false
+}
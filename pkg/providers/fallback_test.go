@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type scriptedProvider struct {
+	content string
+	err     error
+	deltas  []string
+	calls   int
+	models  []string
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+func (p *scriptedProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	p.calls++
+	p.models = append(p.models, model)
+	for _, d := range p.deltas {
+		if onDelta != nil {
+			onDelta(StreamDelta{Content: d})
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &LLMResponse{Content: p.content}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string { return "default-model" }
+
+func TestFallbackProvider_FallsBackOnError(t *testing.T) {
+	local := &scriptedProvider{err: errors.New("connection refused")}
+	cloud := &scriptedProvider{content: "from deepseek"}
+	fp := NewFallbackProvider("CHAT", []FallbackCandidate{
+		{Name: "ollama", Model: "chat-v1", Provider: local},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: cloud},
+	}, NewCircuitBreakers(BreakerConfig{}))
+
+	resp, err := fp.Chat(context.Background(), nil, nil, "chat-v2", nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Content != "from deepseek" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if local.models[0] != "chat-v2" {
+		t.Errorf("primary should use the requested model, got %q", local.models[0])
+	}
+	if cloud.models[0] != "deepseek-chat" {
+		t.Errorf("fallback should use its own model, got %q", cloud.models[0])
+	}
+}
+
+func TestFallbackProvider_SkipsOpenCircuit(t *testing.T) {
+	breakers := NewCircuitBreakers(BreakerConfig{FailureThreshold: 1})
+	breakers.Record("ollama", 0, errors.New("down"))
+
+	local := &scriptedProvider{content: "local"}
+	cloud := &scriptedProvider{content: "cloud"}
+	fp := NewFallbackProvider("CHAT", []FallbackCandidate{
+		{Name: "ollama", Model: "chat-v1", Provider: local},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: cloud},
+	}, breakers)
+
+	resp, err := fp.Chat(context.Background(), nil, nil, "", nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Content != "cloud" || local.calls != 0 {
+		t.Errorf("open circuit should be skipped: content=%q local calls=%d", resp.Content, local.calls)
+	}
+}
+
+func TestFallbackProvider_AllFailReturnsLastError(t *testing.T) {
+	fp := NewFallbackProvider("CODE2", []FallbackCandidate{
+		{Name: "openai", Model: "gpt-4", Provider: &scriptedProvider{err: errors.New("429")}},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: &scriptedProvider{err: errors.New("503")}},
+	}, nil)
+
+	if _, err := fp.Chat(context.Background(), nil, nil, "", nil); err == nil {
+		t.Fatal("expected error when every provider fails")
+	}
+}
+
+func TestFallbackProvider_RestartsStreamOnHop(t *testing.T) {
+	fp := NewFallbackProvider("CHAT", []FallbackCandidate{
+		{Name: "ollama", Model: "chat-v1", Provider: &scriptedProvider{deltas: []string{"half"}, err: errors.New("reset")}},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: &scriptedProvider{deltas: []string{"full"}, content: "full"}},
+	}, nil)
+
+	var got []StreamDelta
+	if _, err := fp.ChatStream(context.Background(), nil, nil, "", nil, func(d StreamDelta) { got = append(got, d) }); err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if len(got) != 3 || got[0].Content != "half" || !got[1].Restart || got[2].Content != "full" {
+		t.Fatalf("unexpected deltas: %+v", got)
+	}
+}
+
+func TestFallbackProvider_DoesNotFallBackWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cloud := &scriptedProvider{content: "cloud"}
+	breakers := NewCircuitBreakers(BreakerConfig{FailureThreshold: 1})
+	fp := NewFallbackProvider("CHAT", []FallbackCandidate{
+		{Name: "ollama", Model: "chat-v1", Provider: &scriptedProvider{err: context.Canceled}},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: cloud},
+	}, breakers)
+
+	if _, err := fp.Chat(ctx, nil, nil, "", nil); err == nil {
+		t.Fatal("expected cancellation error")
+	}
+	if cloud.calls != 0 {
+		t.Error("cancelled turn must not fall back")
+	}
+	if ok, _ := breakers.Allow("ollama"); !ok {
+		t.Error("cancellation must not count against the provider")
+	}
+}
+
+func TestFallbackProvider_AllOpenProbesPrimaryOnce(t *testing.T) {
+	breakers := NewCircuitBreakers(BreakerConfig{FailureThreshold: 1})
+	breakers.Record("ollama", 0, errors.New("down"))
+	breakers.Record("deepseek", 0, errors.New("down"))
+
+	local := &scriptedProvider{content: "local"}
+	fp := NewFallbackProvider("CHAT", []FallbackCandidate{
+		{Name: "ollama", Model: "chat-v1", Provider: local},
+		{Name: "deepseek", Model: "deepseek-chat", Provider: &scriptedProvider{content: "cloud"}},
+	}, breakers)
+
+	// Another caller is already probing the primary.
+	if ok, _ := breakers.Probe("ollama"); !ok {
+		t.Fatal("Probe should admit the first trial")
+	}
+	if _, err := fp.Chat(context.Background(), nil, nil, "", nil); err == nil || local.calls != 0 {
+		t.Fatalf("concurrent callers must fail fast while the primary is probed: err=%v calls=%d", err, local.calls)
+	}
+
+	breakers.Release("ollama")
+	resp, err := fp.Chat(context.Background(), nil, nil, "", nil)
+	if err != nil || resp.Content != "local" {
+		t.Fatalf("primary should be probed once free: resp=%+v err=%v", resp, err)
+	}
+	if ok, _ := breakers.Allow("ollama"); !ok {
+		t.Error("a successful probe should close the circuit")
+	}
+}
@@ -7,6 +7,7 @@
 package providers
 
 import (
+	"bufio"
 	"encoding/base64"
 	"bytes"
 	"context"
@@ -75,61 +76,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		return nil, fmt.Errorf("API base not configured")
 	}
 
-	// Strip provider prefix from model name (e.g., moonshot/kimi-k2.5 -> kimi-k2.5, groq/openai/gpt-oss-120b -> openai/gpt-oss-120b, ollama/qwen2.5:14b -> qwen2.5:14b)
-	if idx := strings.Index(model, "/"); idx != -1 {
-		prefix := model[:idx]
-		if prefix == "moonshot" || prefix == "nvidia" || prefix == "groq" || prefix == "ollama" {
-			model = model[idx+1:]
-		}
-	}
-
-	requestBody := map[string]interface{}{
-		"model":    model,
-		"messages": nil,
-	}
-	httpMessages, imageAudits := buildHTTPMessagesWithAudit(messages)
-	requestBody["messages"] = httpMessages
-	if len(imageAudits) > 0 {
-		logger.InfoCF("provider.http", "LLM image audit before request", map[string]interface{}{
-			"model":  model,
-			"images": imageAuditLogEntries(imageAudits),
-		})
-	}
-
-	// Ollama's OpenAI-compatible endpoint can default to very large context windows
-	// (e.g., 131072), which may crash/timeout under multimodal load.
-	// Set a bounded context to keep vision requests stable.
-	// keep_alive: -1 keeps Chat/Worker models loaded (永続).
-	if isOllamaEndpoint(p.apiBase) {
-		requestBody["keep_alive"] = -1
-		requestBody["options"] = map[string]interface{}{
-			"num_ctx": 8192,
-		}
-	}
-
-	if len(tools) > 0 {
-		requestBody["tools"] = tools
-		requestBody["tool_choice"] = "auto"
-	}
-
-	if maxTokens, ok := options["max_tokens"].(int); ok {
-		lowerModel := strings.ToLower(model)
-		if strings.Contains(lowerModel, "glm") || strings.Contains(lowerModel, "o1") {
-			requestBody["max_completion_tokens"] = maxTokens
-		} else {
-			requestBody["max_tokens"] = maxTokens
-		}
-	}
-
-	if temperature, ok := options["temperature"].(float64); ok {
-		lowerModel := strings.ToLower(model)
-		// Kimi k2 models only support temperature=1
-		if strings.Contains(lowerModel, "kimi") && strings.Contains(lowerModel, "k2") {
-			requestBody["temperature"] = 1.0
-		} else {
-			requestBody["temperature"] = temperature
-		}
-	}
+	requestBody, model, imageAudits := p.buildRequestBody(messages, tools, model, options)
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
@@ -227,6 +174,278 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	return llmResp, nil
 }
 
+// ChatStream is the streaming variant of Chat. It accepts both OpenAI-style
+// SSE ("data: {...}" lines terminated by [DONE]) and Ollama's native NDJSON
+// chunks ({"message":{...},"done":false}).
+func (p *HTTPProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	requestBody, model, _ := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/chat/completions", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	logger.InfoCF("provider.http", "LLM stream request sent",
+		map[string]interface{}{
+			"endpoint":          p.apiBase + "/chat/completions",
+			"model":             model,
+			"messages_count":    len(messages),
+			"last_user_preview": lastUserContentPreview(messages, 200),
+		})
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		logger.InfoCF("provider.http", "LLM stream request failed (no response received)",
+			map[string]interface{}{
+				"model":      model,
+				"error":      err.Error(),
+				"is_timeout": isTimeoutError(err),
+			})
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		logger.InfoCF("provider.http", "LLM response non-OK",
+			map[string]interface{}{
+				"model":        model,
+				"status_code":  resp.StatusCode,
+				"body_preview": truncateForLog(string(body), 200),
+			})
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+	}
+
+	llmResp, err := readChatStream(resp.Body, onDelta)
+	if err != nil {
+		logger.InfoCF("provider.http", "LLM stream read failed",
+			map[string]interface{}{"model": model, "error": err.Error()})
+		return nil, err
+	}
+
+	logger.InfoCF("provider.http", "LLM stream completed",
+		map[string]interface{}{
+			"model":         model,
+			"content_len":   len(llmResp.Content),
+			"tool_calls":    len(llmResp.ToolCalls),
+			"finish_reason": llmResp.FinishReason,
+		})
+
+	return llmResp, nil
+}
+
+// chatStreamChunk covers both OpenAI chat.completion.chunk and Ollama /api/chat chunks.
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *UsageInfo `json:"usage"`
+
+	Message *struct {
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			Function struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func readChatStream(r io.Reader, onDelta StreamHandler) (*LLMResponse, error) {
+	emit := func(d StreamDelta) {
+		if onDelta != nil {
+			onDelta(d)
+		}
+	}
+
+	var content strings.Builder
+	calls := newToolCallAccumulator()
+	ollamaCalls := 0
+	result := &LLMResponse{FinishReason: "stop"}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		} else if !strings.HasPrefix(line, "{") {
+			// event:, id:, retry: fields carry nothing we need.
+			continue
+		}
+		if line == "[DONE]" {
+			break
+		}
+
+		var chunk chatStreamChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				emit(StreamDelta{Content: choice.Delta.Content})
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				d := ToolCallDelta{
+					Index:          tc.Index,
+					ID:             tc.ID,
+					Name:           tc.Function.Name,
+					ArgumentsDelta: tc.Function.Arguments,
+				}
+				calls.add(d)
+				emit(StreamDelta{ToolCall: &d})
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				result.FinishReason = *choice.FinishReason
+			}
+		}
+
+		if chunk.Message != nil {
+			if chunk.Message.Content != "" {
+				content.WriteString(chunk.Message.Content)
+				emit(StreamDelta{Content: chunk.Message.Content})
+			}
+			// Ollama sends each tool call whole, with arguments as an object.
+			for _, tc := range chunk.Message.ToolCalls {
+				d := ToolCallDelta{
+					Index:          ollamaCalls,
+					ID:             fmt.Sprintf("call_%d", ollamaCalls),
+					Name:           tc.Function.Name,
+					ArgumentsDelta: string(tc.Function.Arguments),
+				}
+				ollamaCalls++
+				calls.add(d)
+				emit(StreamDelta{ToolCall: &d})
+			}
+		}
+		if chunk.Done {
+			if chunk.DoneReason != "" {
+				result.FinishReason = chunk.DoneReason
+			}
+			if chunk.PromptEvalCount > 0 || chunk.EvalCount > 0 {
+				result.Usage = &UsageInfo{
+					PromptTokens:     chunk.PromptEvalCount,
+					CompletionTokens: chunk.EvalCount,
+					TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+				}
+			}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	result.Content = content.String()
+	result.ToolCalls = calls.toolCalls()
+	if len(result.ToolCalls) > 0 && result.FinishReason == "stop" {
+		result.FinishReason = "tool_calls"
+	}
+	return result, nil
+}
+
+// buildRequestBody assembles the chat/completions payload shared by Chat and ChatStream.
+// It returns the body, the model name with any provider prefix stripped, and image audits.
+func (p *HTTPProvider) buildRequestBody(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (map[string]interface{}, string, []imagePayloadAudit) {
+	// Strip provider prefix from model name (e.g., moonshot/kimi-k2.5 -> kimi-k2.5, groq/openai/gpt-oss-120b -> openai/gpt-oss-120b, ollama/qwen2.5:14b -> qwen2.5:14b)
+	if idx := strings.Index(model, "/"); idx != -1 {
+		prefix := model[:idx]
+		if prefix == "moonshot" || prefix == "nvidia" || prefix == "groq" || prefix == "ollama" {
+			model = model[idx+1:]
+		}
+	}
+
+	requestBody := map[string]interface{}{
+		"model":    model,
+		"messages": nil,
+	}
+	httpMessages, imageAudits := buildHTTPMessagesWithAudit(messages)
+	requestBody["messages"] = httpMessages
+	if len(imageAudits) > 0 {
+		logger.InfoCF("provider.http", "LLM image audit before request", map[string]interface{}{
+			"model":  model,
+			"images": imageAuditLogEntries(imageAudits),
+		})
+	}
+
+	// Ollama's OpenAI-compatible endpoint can default to very large context windows
+	// (e.g., 131072), which may crash/timeout under multimodal load.
+	// Set a bounded context to keep vision requests stable.
+	// keep_alive: -1 keeps Chat/Worker models loaded (永続).
+	if isOllamaEndpoint(p.apiBase) {
+		requestBody["keep_alive"] = -1
+		requestBody["options"] = map[string]interface{}{
+			"num_ctx": 8192,
+		}
+	}
+
+	if len(tools) > 0 {
+		requestBody["tools"] = tools
+		requestBody["tool_choice"] = "auto"
+	}
+
+	if maxTokens, ok := options["max_tokens"].(int); ok {
+		lowerModel := strings.ToLower(model)
+		if strings.Contains(lowerModel, "glm") || strings.Contains(lowerModel, "o1") {
+			requestBody["max_completion_tokens"] = maxTokens
+		} else {
+			requestBody["max_tokens"] = maxTokens
+		}
+	}
+
+	if temperature, ok := options["temperature"].(float64); ok {
+		lowerModel := strings.ToLower(model)
+		// Kimi k2 models only support temperature=1
+		if strings.Contains(lowerModel, "kimi") && strings.Contains(lowerModel, "k2") {
+			requestBody["temperature"] = 1.0
+		} else {
+			requestBody["temperature"] = temperature
+		}
+	}
+
+	return requestBody, model, imageAudits
+}
+
 // truncateForLog returns s truncated to maxLen with "..." suffix for safe logging.
 func truncateForLog(s string, maxLen int) string {
 	s = strings.TrimSpace(s)
@@ -2,6 +2,10 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -123,3 +127,91 @@ func TestIsTimeoutError(t *testing.T) {
 		t.Fatalf("expected non-timeout error for os.ErrNotExist")
 	}
 }
+
+func TestHTTPProvider_ChatStream_OpenAISSE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] != true {
+			t.Errorf("expected stream=true in request, got %v", reqBody["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read_file","arguments":"{\"pa"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.txt\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+		}
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("k", server.URL, "")
+	var text strings.Builder
+	var toolDeltas int
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, func(d StreamDelta) {
+		text.WriteString(d.Content)
+		if d.ToolCall != nil {
+			toolDeltas++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if text.String() != "Hello" || resp.Content != "Hello" {
+		t.Errorf("streamed %q, final %q, want Hello", text.String(), resp.Content)
+	}
+	if toolDeltas != 2 {
+		t.Errorf("expected 2 tool call deltas, got %d", toolDeltas)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "read_file" || resp.ToolCalls[0].Arguments["path"] != "a.txt" {
+		t.Fatalf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 10 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestHTTPProvider_ChatStream_OllamaNDJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"こん"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"にちは"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("", server.URL, "")
+	var deltas []string
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "ollama/chat-v1", nil, func(d StreamDelta) {
+		deltas = append(deltas, d.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if len(deltas) != 2 || resp.Content != "こんにちは" {
+		t.Errorf("deltas %v, final %q", deltas, resp.Content)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 5 || resp.Usage.CompletionTokens != 2 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestHTTPProvider_ChatStream_NonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("k", server.URL, "")
+	if _, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil, nil); err == nil {
+		t.Fatal("expected error for non-OK status")
+	}
+}
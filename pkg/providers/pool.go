@@ -0,0 +1,124 @@
+package providers
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+type poolKey struct {
+	provider string
+	model    string
+}
+
+// ProviderPool caches one LLMProvider per (provider, model) pair so routed
+// turns reuse their clients instead of rebuilding them on every message.
+// It is safe for concurrent use.
+type ProviderPool struct {
+	cfg       *config.Config
+	create    func(cfg *config.Config) (LLMProvider, error)
+	wrap      func(providerName string, provider LLMProvider) LLMProvider
+	mu        sync.Mutex
+	providers map[poolKey]LLMProvider
+	pending   map[poolKey]*poolCall
+}
+
+// poolCall is a provider being constructed; callers for the same key wait
+// on done instead of building a second one.
+type poolCall struct {
+	done     chan struct{}
+	provider LLMProvider
+	err      error
+}
+
+// NewProviderPool creates a pool that builds providers from cfg's provider settings.
+func NewProviderPool(cfg *config.Config) *ProviderPool {
+	return &ProviderPool{
+		cfg:       cfg,
+		create:    CreateProvider,
+		providers: make(map[poolKey]LLMProvider),
+		pending:   make(map[poolKey]*poolCall),
+	}
+}
+
+// SetWrapper installs fn to decorate every provider the pool creates from now
+// on (e.g. usage metering). Providers registered with Put are stored as given.
+func (p *ProviderPool) SetWrapper(fn func(providerName string, provider LLMProvider) LLMProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wrap = fn
+}
+
+// Put registers an already constructed provider for (providerName, model).
+// It is used to seed the pool with the agent's default provider.
+func (p *ProviderPool) Put(providerName, model string, provider LLMProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers[newPoolKey(providerName, model)] = provider
+}
+
+// Get returns the cached provider for (providerName, model), creating it on first use.
+// Construction may do network or auth work, so it runs outside the pool lock:
+// a slow provider only holds up the callers that asked for the same key.
+func (p *ProviderPool) Get(providerName, model string) (LLMProvider, error) {
+	key := newPoolKey(providerName, model)
+
+	p.mu.Lock()
+	if provider, ok := p.providers[key]; ok {
+		p.mu.Unlock()
+		return provider, nil
+	}
+	if call, ok := p.pending[key]; ok {
+		p.mu.Unlock()
+		<-call.done
+		return call.provider, call.err
+	}
+	call := &poolCall{done: make(chan struct{})}
+	p.pending[key] = call
+	wrap := p.wrap
+	p.mu.Unlock()
+
+	call.provider, call.err = p.build(key, wrap)
+
+	p.mu.Lock()
+	delete(p.pending, key)
+	if call.err == nil {
+		p.providers[key] = call.provider
+	}
+	p.mu.Unlock()
+	close(call.done)
+	return call.provider, call.err
+}
+
+func (p *ProviderPool) build(key poolKey, wrap func(string, LLMProvider) LLMProvider) (LLMProvider, error) {
+	cfg := config.DefaultConfig()
+	cfg.Providers = p.cfg.Providers
+	cfg.Agents.Defaults.Workspace = p.cfg.Agents.Defaults.Workspace
+	cfg.Agents.Defaults.RestrictToWorkspace = p.cfg.Agents.Defaults.RestrictToWorkspace
+	cfg.Agents.Defaults.Provider = key.provider
+	cfg.Agents.Defaults.Model = key.model
+
+	provider, err := p.create(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if wrap != nil {
+		provider = wrap(key.provider, provider)
+	}
+	return provider, nil
+}
+
+// Len returns the number of cached providers.
+func (p *ProviderPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.providers)
+}
+
+func newPoolKey(providerName, model string) poolKey {
+	return poolKey{
+		provider: strings.ToLower(strings.TrimSpace(providerName)),
+		model:    strings.TrimSpace(model),
+	}
+}
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+func TestProviderPool_CachesPerProviderAndModel(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Providers.VLLM.APIBase = "http://127.0.0.1:8000/v1"
+	cfg.Providers.VLLM.APIKey = "test"
+
+	pool := NewProviderPool(cfg)
+
+	first, err := pool.Get("vllm", "model-a")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	second, err := pool.Get(" VLLM ", "model-a")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if first != second {
+		t.Error("expected the same provider instance for the same (provider, model)")
+	}
+
+	other, err := pool.Get("vllm", "model-b")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if other == first {
+		t.Error("expected a distinct provider for a different model")
+	}
+	if pool.Len() != 2 {
+		t.Errorf("expected 2 cached providers, got %d", pool.Len())
+	}
+}
+
+func TestProviderPool_PutSeedsProvider(t *testing.T) {
+	pool := NewProviderPool(config.DefaultConfig())
+	seed := NewHTTPProvider("", "http://127.0.0.1:11434/v1", "")
+	pool.Put("ollama", "chat-v1", seed)
+
+	got, err := pool.Get("ollama", "chat-v1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != seed {
+		t.Error("expected seeded provider to be returned")
+	}
+}
+
+func TestProviderPool_PropagatesCreateError(t *testing.T) {
+	pool := NewProviderPool(config.DefaultConfig())
+	if _, err := pool.Get("groq", "llama"); err == nil {
+		t.Fatal("expected error for unconfigured provider")
+	}
+	if pool.Len() != 0 {
+		t.Errorf("failed creation must not be cached, got %d entries", pool.Len())
+	}
+}
+
+func TestProviderPool_WrapsCreatedProviders(t *testing.T) {
+	pool := NewProviderPool(config.DefaultConfig())
+	pool.create = func(cfg *config.Config) (LLMProvider, error) {
+		return NewHTTPProvider("", "http://127.0.0.1:8000/v1", ""), nil
+	}
+	var wrapped []string
+	pool.SetWrapper(func(name string, p LLMProvider) LLMProvider {
+		wrapped = append(wrapped, name)
+		return p
+	})
+
+	if _, err := pool.Get(" VLLM ", "model-a"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, err := pool.Get("vllm", "model-a"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(wrapped) != 1 || wrapped[0] != "vllm" {
+		t.Errorf("expected one wrap call for vllm, got %v", wrapped)
+	}
+}
+
+func TestProviderPool_SlowCreateDoesNotBlockOtherKeys(t *testing.T) {
+	pool := NewProviderPool(config.DefaultConfig())
+	release := make(chan struct{})
+	var calls atomic.Int32
+	pool.create = func(cfg *config.Config) (LLMProvider, error) {
+		calls.Add(1)
+		if cfg.Agents.Defaults.Model == "slow" {
+			<-release
+		}
+		return NewHTTPProvider("", "http://127.0.0.1:8000/v1", ""), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]LLMProvider, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = pool.Get("vllm", "slow")
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pool.Get("vllm", "fast")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow provider blocked Get for another key")
+	}
+
+	close(release)
+	wg.Wait()
+	if results[0] == nil || results[0] != results[1] || results[1] != results[2] {
+		t.Error("concurrent Gets for one key should share a single provider")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("create called %d times, want 2 (one per key)", n)
+	}
+}
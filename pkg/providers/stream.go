@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// StreamDelta is one incremental piece of a streamed LLM response.
+// Exactly one of Content, ToolCall or Restart is set.
+type StreamDelta struct {
+	Content  string
+	ToolCall *ToolCallDelta
+	// Restart tells the handler to discard everything received so far,
+	// e.g. because a fallback provider took over after a failed stream.
+	Restart bool
+}
+
+// ToolCallDelta is a fragment of a tool call. Fragments with the same Index
+// belong to the same call; ID and Name usually arrive only in the first one.
+type ToolCallDelta struct {
+	Index          int
+	ID             string
+	Name           string
+	ArgumentsDelta string
+}
+
+// StreamHandler receives deltas as they arrive. It is called from the
+// provider's goroutine and must not block for long.
+type StreamHandler func(StreamDelta)
+
+// StreamingProvider is implemented by providers that can emit partial output.
+// ChatStream calls onDelta for each delta and returns the fully assembled
+// response, identical in shape to what Chat would have returned.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error)
+}
+
+// toolCallAccumulator assembles tool calls from streamed fragments.
+type toolCallAccumulator struct {
+	calls map[int]*pendingToolCall
+}
+
+type pendingToolCall struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+func newToolCallAccumulator() *toolCallAccumulator {
+	return &toolCallAccumulator{calls: make(map[int]*pendingToolCall)}
+}
+
+func (a *toolCallAccumulator) add(d ToolCallDelta) {
+	tc, ok := a.calls[d.Index]
+	if !ok {
+		tc = &pendingToolCall{}
+		a.calls[d.Index] = tc
+	}
+	if d.ID != "" {
+		tc.id = d.ID
+	}
+	if d.Name != "" {
+		tc.name = d.Name
+	}
+	tc.args.WriteString(d.ArgumentsDelta)
+}
+
+// toolCalls returns the assembled calls ordered by index. Arguments that are
+// not valid JSON are kept under "raw", matching parseResponse.
+func (a *toolCallAccumulator) toolCalls() []ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(a.calls))
+	for i := range a.calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	out := make([]ToolCall, 0, len(indexes))
+	for _, i := range indexes {
+		tc := a.calls[i]
+		arguments := make(map[string]interface{})
+		if raw := tc.args.String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				arguments["raw"] = raw
+			}
+		}
+		out = append(out, ToolCall{
+			ID:        tc.id,
+			Name:      tc.name,
+			Arguments: arguments,
+		})
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+// Package redact masks secrets (API keys, bearer tokens, private keys,
+// credentials) and, when asked for, personal data (emails, phone numbers) in
+// text before it is logged, saved or
+// sent to an LLM, and keeps an audit count of what was masked per session.
+package redact
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// placeholderPrefix starts every replacement; matches that already are a
+// placeholder are left alone so redacting twice changes nothing.
+const placeholderPrefix = "[REDACTED"
+
+// Bounds of the audit record: the sessions used least recently are
+// forgotten beyond maxSessions, and a session stops recording new values
+// beyond maxValuesPerSession (its counts then are a lower bound).
+const (
+	maxSessions         = 1024
+	maxValuesPerSession = 4096
+)
+
+// Rule is a named pattern. If the pattern has a capture group, only the first
+// group is masked (e.g. the value of "password=..."); otherwise the whole
+// match is.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// builtinRules are the detectors available by name, in the order they run.
+// Those in optInRules only run when named explicitly.
+var builtinRules = []Rule{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_\-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abposr]-[A-Za-z0-9\-]{10,}|AIza[0-9A-Za-z_\-]{35}|pplx-[A-Za-z0-9]{20,}|gsk_[A-Za-z0-9]{20,}|glpat-[A-Za-z0-9_\-]{20,}|eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,})`)},
+	{"credential", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|password|passwd|pwd)["']?\s*[:=]\s*["']?([^\s"',;]{6,})`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)},
+	{"phone", regexp.MustCompile(`(?:\+\d{1,3}[\s\-]?)?(?:\(\d{1,4}\)\s?|\b\d{1,4}[\s\-])\d{2,4}[\s\-]\d{3,4}\b`)},
+}
+
+// optInRules match much ordinary text (addresses, dates, order numbers), so
+// masking them by default would garble saved history for little gain.
+var optInRules = map[string]bool{"email": true, "phone": true}
+
+// BuiltinNames returns the names of the built-in detectors.
+func BuiltinNames() []string {
+	names := make([]string, len(builtinRules))
+	for i, r := range builtinRules {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// Builtin returns the built-in detectors called names; no names means the
+// default ones, i.e. all but email and phone.
+func Builtin(names ...string) ([]Rule, error) {
+	if len(names) == 0 {
+		return defaultRules(), nil
+	}
+	var rules []Rule
+	for _, name := range names {
+		found := false
+		for _, r := range builtinRules {
+			if r.Name == name {
+				rules = append(rules, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown redaction detector %q (available: %s)", name, strings.Join(BuiltinNames(), ", "))
+		}
+	}
+	return rules, nil
+}
+
+func defaultRules() []Rule {
+	var rules []Rule
+	for _, r := range builtinRules {
+		if !optInRules[r.Name] {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// Redactor masks the matches of its rules. It records, per session, each
+// distinct value it masked, so counts do not grow when the same text is
+// logged or saved again.
+type Redactor struct {
+	rules []Rule
+
+	mu    sync.Mutex
+	seen  map[string]*sessionValues
+	clock uint64
+}
+
+// sessionValues are the values masked for one session.
+type sessionValues struct {
+	values map[[16]byte]string // value hash → rule name
+	used   uint64              // Redactor.clock when last recorded
+}
+
+// New returns a redactor using rules.
+func New(rules []Rule) *Redactor {
+	return &Redactor{rules: rules, seen: make(map[string]*sessionValues)}
+}
+
+// Redact returns s with every match replaced by "[REDACTED:<rule>]" and
+// counts the masked values under session ("" when there is none). A nil
+// Redactor returns s unchanged.
+func (r *Redactor) Redact(session, s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = r.apply(session, rule, s)
+	}
+	return s
+}
+
+func (r *Redactor) apply(session string, rule Rule, s string) string {
+	matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		value := s[start:end]
+		if strings.HasPrefix(value, placeholderPrefix) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(placeholderPrefix + ":" + rule.Name + "]")
+		last = end
+		r.record(session, rule.Name, value)
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func (r *Redactor) record(session, rule, value string) {
+	sum := sha256.Sum256([]byte(value))
+	var key [16]byte
+	copy(key[:], sum[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock++
+	sv, ok := r.seen[session]
+	if !ok {
+		if len(r.seen) >= maxSessions {
+			r.evictLocked()
+		}
+		sv = &sessionValues{values: make(map[[16]byte]string)}
+		r.seen[session] = sv
+	}
+	sv.used = r.clock
+	if _, ok := sv.values[key]; ok || len(sv.values) < maxValuesPerSession {
+		sv.values[key] = rule
+	}
+}
+
+// evictLocked forgets the session recorded least recently.
+func (r *Redactor) evictLocked() {
+	var oldest string
+	var used uint64
+	for session, sv := range r.seen {
+		if used == 0 || sv.used < used {
+			oldest, used = session, sv.used
+		}
+	}
+	delete(r.seen, oldest)
+}
+
+// Counts returns how many distinct values of each rule were masked for
+// session.
+func (r *Redactor) Counts(session string) map[string]int {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sv := r.seen[session]
+	if sv == nil || len(sv.values) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, rule := range sv.values {
+		counts[rule]++
+	}
+	return counts
+}
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	defaultRedactor.Store(New(defaultRules()))
+}
+
+// Default returns the redactor used by the logger, session files, the job
+// journal and pending proposals: the default built-in detectors unless
+// replaced with SetDefault. It is nil when
+// redaction is turned off.
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// SetDefault replaces the default redactor; nil turns redaction off.
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
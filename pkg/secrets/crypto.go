@@ -0,0 +1,257 @@
+// Package secrets encrypts credentials at rest and keeps named secrets that
+// config values can reference as "secret:<name>".
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Environment variables that select the encryption key. The first one set
+// wins; without any, a random key is kept in the key file.
+const (
+	KeyEnv        = "PICOCLAW_SECRETS_KEY"        // base64-encoded 32-byte key
+	PassphraseEnv = "PICOCLAW_SECRETS_PASSPHRASE" // passphrase, stretched with argon2id
+	KeyFileEnv    = "PICOCLAW_SECRETS_KEY_FILE"   // key file path (default ~/.picoclaw/secrets.key)
+)
+
+const (
+	envelopeVersion = 1
+	kdfKey          = "key"      // the key is used as is
+	kdfArgon2id     = "argon2id" // the key is derived from a passphrase and Salt
+
+	// argon2id parameters (RFC 9106 second recommendation).
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+var (
+	// ErrWrongKey is returned when data cannot be decrypted with the key.
+	ErrWrongKey = errors.New("secrets: wrong key or corrupted data")
+	// ErrPassphraseRequired is returned when data was encrypted with a
+	// passphrase but none is set.
+	ErrPassphraseRequired = errors.New("secrets: encrypted with a passphrase; set " + PassphraseEnv)
+)
+
+// Key is the encryption key of a store: a raw key, a passphrase or a key file.
+type Key struct {
+	raw        []byte
+	passphrase string
+	file       string
+}
+
+// DefaultKey returns the key selected by the environment. Without any, the
+// key file ~/.picoclaw/secrets.key is used: it lives next to the files it
+// encrypts, so it protects them when copied or backed up on their own but not
+// from someone who can read ~/.picoclaw. A passphrase or a key file kept
+// elsewhere covers that case.
+func DefaultKey() (*Key, error) {
+	if v := os.Getenv(KeyEnv); v != "" {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil || len(raw) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("secrets: %s must be a base64-encoded %d-byte key", KeyEnv, chacha20poly1305.KeySize)
+		}
+		return &Key{raw: raw}, nil
+	}
+	if v := os.Getenv(PassphraseEnv); v != "" {
+		return KeyFromPassphrase(v), nil
+	}
+	if v := os.Getenv(KeyFileEnv); v != "" {
+		return KeyFromFile(v), nil
+	}
+	return KeyFromFile(filepath.Join(Dir(), "secrets.key")), nil
+}
+
+// KeyFromPassphrase returns a key derived from passphrase.
+func KeyFromPassphrase(passphrase string) *Key {
+	return &Key{passphrase: passphrase}
+}
+
+// KeyFromFile returns a key read from path. The file is created with a random
+// key the first time something is encrypted.
+func KeyFromFile(path string) *Key {
+	return &Key{file: path}
+}
+
+// Dir is the directory of the picoclaw credential files (~/.picoclaw).
+func Dir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".picoclaw")
+}
+
+// envelope is the on-disk form of encrypted data.
+type envelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       string `json:"salt,omitempty"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// IsSealed reports whether data was produced by Seal. Anything else is
+// treated as a legacy plaintext file.
+func IsSealed(data []byte) bool {
+	var env envelope
+	return json.Unmarshal(data, &env) == nil && env.Version > 0 && env.Ciphertext != ""
+}
+
+// Seal encrypts plaintext with XChaCha20-Poly1305 under key.
+func Seal(plaintext []byte, key *Key) ([]byte, error) {
+	env := envelope{Version: envelopeVersion, KDF: kdfKey}
+	var k []byte
+	if key.passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		env.KDF = kdfArgon2id
+		env.Salt = base64.StdEncoding.EncodeToString(salt)
+		k = deriveKey(key.passphrase, salt)
+	} else {
+		var err error
+		if k, err = key.rawKey(true); err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	env.Ciphertext = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, additionalData(env)))
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Open decrypts data produced by Seal.
+func Open(data []byte, key *Key) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("secrets: invalid envelope: %w", err)
+	}
+	if env.Version != envelopeVersion {
+		return nil, fmt.Errorf("secrets: unsupported envelope version %d", env.Version)
+	}
+
+	var k []byte
+	switch env.KDF {
+	case kdfArgon2id:
+		if key.passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		salt, err := base64.StdEncoding.DecodeString(env.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: invalid salt: %w", err)
+		}
+		k = deriveKey(key.passphrase, salt)
+	case kdfKey:
+		if key.passphrase != "" {
+			return nil, fmt.Errorf("secrets: encrypted with a key, not a passphrase; unset %s", PassphraseEnv)
+		}
+		var err error
+		if k, err = key.rawKey(false); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("secrets: unsupported kdf %q", env.KDF)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: invalid ciphertext: %w", err)
+	}
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(env))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// additionalData binds the header fields to the ciphertext.
+func additionalData(env envelope) []byte {
+	return []byte(fmt.Sprintf("picoclaw-secrets/v%d/%s/%s", env.Version, env.KDF, env.Salt))
+}
+
+// rawKey returns the raw key, reading the key file and creating it when
+// create is set and it does not exist yet.
+func (k *Key) rawKey(create bool) ([]byte, error) {
+	if k.raw != nil {
+		return k.raw, nil
+	}
+	data, err := os.ReadFile(k.file)
+	if os.IsNotExist(err) && create {
+		return createKeyFile(k.file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets: failed to read key file: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("secrets: key file %s must hold a base64-encoded %d-byte key", k.file, chacha20poly1305.KeySize)
+	}
+	return raw, nil
+}
+
+func createKeyFile(path string) ([]byte, error) {
+	raw := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("secrets: failed to create key dir: %w", err)
+	}
+	// O_EXCL: if another process created the key meanwhile, use theirs.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return KeyFromFile(path).rawKey(false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets: failed to create key file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n"); err != nil {
+		return nil, fmt.Errorf("secrets: failed to write key file: %w", err)
+	}
+	return raw, nil
+}
+
+// derivedKeys caches argon2id results: stores are re-read on every token
+// lookup and each derivation costs 64 MiB.
+var derivedKeys sync.Map // sha256(passphrase, salt) → []byte
+
+func deriveKey(passphrase string, salt []byte) []byte {
+	id := sha256.Sum256(append([]byte(passphrase+"\x00"), salt...))
+	if k, ok := derivedKeys.Load(id); ok {
+		return k.([]byte)
+	}
+	k := argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, chacha20poly1305.KeySize)
+	derivedKeys.Store(id, k)
+	return k
+}
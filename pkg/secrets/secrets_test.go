@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealOpen_KeyFile(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "keys", "secrets.key")
+	key := KeyFromFile(keyPath)
+
+	sealed, err := Seal([]byte("refresh-token"), key)
+	if err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("refresh-token")) || !IsSealed(sealed) {
+		t.Fatalf("sealed data leaks the plaintext or is not recognised:\n%s", sealed)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file should be created with mode 0600: %v %v", info, err)
+	}
+
+	plaintext, err := Open(sealed, KeyFromFile(keyPath))
+	if err != nil || string(plaintext) != "refresh-token" {
+		t.Fatalf("Open() = %q, %v", plaintext, err)
+	}
+
+	// Another key, a tampered header or a passphrase must not open it.
+	other := KeyFromFile(filepath.Join(t.TempDir(), "other.key"))
+	if _, err := Seal(nil, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(sealed, other); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open() with another key = %v, want ErrWrongKey", err)
+	}
+	var env envelope
+	json.Unmarshal(sealed, &env)
+	env.Salt = "AAAA"
+	tampered, _ := json.Marshal(env)
+	if _, err := Open(tampered, key); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open() with a tampered header = %v, want ErrWrongKey", err)
+	}
+	if _, err := Open(sealed, KeyFromPassphrase("pw")); err == nil {
+		t.Error("a passphrase should not open key-encrypted data")
+	}
+}
+
+func TestSealOpen_Passphrase(t *testing.T) {
+	sealed, err := Seal([]byte("api-key"), KeyFromPassphrase("correct horse"))
+	if err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if plaintext, err := Open(sealed, KeyFromPassphrase("correct horse")); err != nil || string(plaintext) != "api-key" {
+		t.Fatalf("Open() = %q, %v", plaintext, err)
+	}
+	if _, err := Open(sealed, KeyFromPassphrase("wrong")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong passphrase = %v, want ErrWrongKey", err)
+	}
+	if _, err := Open(sealed, KeyFromFile(filepath.Join(t.TempDir(), "k"))); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("no passphrase = %v, want ErrPassphraseRequired", err)
+	}
+}
+
+func TestDefaultKey_Env(t *testing.T) {
+	t.Setenv(KeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	key, err := DefaultKey()
+	if err != nil {
+		t.Fatalf("DefaultKey() error: %v", err)
+	}
+	sealed, _ := Seal([]byte("x"), key)
+	if _, err := Open(sealed, &Key{raw: bytes.Repeat([]byte{7}, 32)}); err != nil {
+		t.Errorf("env key was not used: %v", err)
+	}
+
+	t.Setenv(KeyEnv, "too-short")
+	if _, err := DefaultKey(); err == nil {
+		t.Error("an invalid env key should be rejected")
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.json")
+	key := KeyFromFile(filepath.Join(dir, "secrets.key"))
+
+	store, err := Load(path, key)
+	if err != nil {
+		t.Fatalf("Load() of a missing store error: %v", err)
+	}
+	if err := store.Set("anthropic", "sk-ant-1"); err != nil {
+		t.Fatal(err)
+	}
+	store.Set("openai", "sk-oa-1")
+	if err := store.Set("bad name", "x"); err == nil {
+		t.Error("names with spaces should be rejected")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("sk-ant-1")) {
+		t.Fatal("store written in plaintext")
+	}
+
+	store, err = Load(path, key)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if v, ok := store.Get("anthropic"); !ok || v != "sk-ant-1" {
+		t.Errorf("Get(anthropic) = %q, %v", v, ok)
+	}
+	if !store.Delete("openai") || store.Delete("openai") {
+		t.Error("Delete should report whether the secret existed")
+	}
+	if names := store.Names(); len(names) != 1 || names[0] != "anthropic" {
+		t.Errorf("Names() = %v", names)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	if name, ok := ParseRef("secret:anthropic"); !ok || name != "anthropic" {
+		t.Errorf("ParseRef = %q, %v", name, ok)
+	}
+	if _, ok := ParseRef("sk-plain"); ok {
+		t.Error("plain values are not references")
+	}
+}
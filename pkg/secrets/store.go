@@ -0,0 +1,155 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RefPrefix marks a config value that names a secret, e.g. "secret:anthropic".
+const RefPrefix = "secret:"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ParseRef returns the secret name referenced by value.
+func ParseRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, RefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(value, RefPrefix), true
+}
+
+// ValidateName reports whether name can be used for a secret.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// DefaultPath is the file of the named secrets (~/.picoclaw/secrets.json).
+func DefaultPath() string {
+	return filepath.Join(Dir(), "secrets.json")
+}
+
+// Store is a set of named secrets kept encrypted in one file.
+type Store struct {
+	path    string
+	key     *Key
+	secrets map[string]string
+}
+
+type storeData struct {
+	Secrets map[string]string `json:"secrets"`
+}
+
+// Load reads the store at path. A missing file is an empty store.
+func Load(path string, key *Key) (*Store, error) {
+	s := &Store{path: path, key: key, secrets: make(map[string]string)}
+	data, err := ReadFile(path, key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var sd storeData
+	if err := json.Unmarshal(data, &sd); err != nil {
+		return nil, fmt.Errorf("secrets: failed to parse %s: %w", path, err)
+	}
+	for name, value := range sd.Secrets {
+		s.secrets[name] = value
+	}
+	return s, nil
+}
+
+// LoadDefault reads the default store with the default key.
+func LoadDefault() (*Store, error) {
+	key, err := DefaultKey()
+	if err != nil {
+		return nil, err
+	}
+	return Load(DefaultPath(), key)
+}
+
+// Get returns the secret called name.
+func (s *Store) Get(name string) (string, bool) {
+	v, ok := s.secrets[name]
+	return v, ok
+}
+
+// Set stores value as name. Call Save to persist it.
+func (s *Store) Set(name, value string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	s.secrets[name] = value
+	return nil
+}
+
+// Delete removes name and reports whether it existed.
+func (s *Store) Delete(name string) bool {
+	_, ok := s.secrets[name]
+	delete(s.secrets, name)
+	return ok
+}
+
+// Names returns the secret names, sorted.
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts and writes the store.
+func (s *Store) Save() error {
+	data, err := json.Marshal(storeData{Secrets: s.secrets})
+	if err != nil {
+		return err
+	}
+	return WriteFile(s.path, data, s.key)
+}
+
+// ReadFile reads and decrypts a file written by WriteFile. A file that is not
+// encrypted is returned as is, so callers can migrate plaintext files.
+func ReadFile(path string, key *Key) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsSealed(data) {
+		return data, nil
+	}
+	plaintext, err := Open(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// WriteFile encrypts data and replaces path with it atomically (mode 0600).
+func WriteFile(path string, data []byte, key *Key) error {
+	sealed, err := Seal(data, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
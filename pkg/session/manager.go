@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/redact"
 )
 
 type Session struct {
@@ -18,8 +20,39 @@ type Session struct {
 	Flags    SessionFlags        `json:"flags,omitempty"`
 	Created  time.Time           `json:"created"`
 	Updated  time.Time           `json:"updated"`
+	// Redactions counts the distinct values masked per detector in this
+	// session's file, logs and LLM payloads (audit only).
+	Redactions map[string]int `json:"redactions,omitempty"`
+	// Routes holds the routing decisions of the most recent turns.
+	Routes []RouteRecord `json:"routes,omitempty"`
 }
 
+// RouteRecord is how one turn was routed. Text is the start of the user
+// text the decision was made for.
+type RouteRecord struct {
+	Time        time.Time `json:"time"`
+	Text        string    `json:"text"`
+	Route       string    `json:"route"`
+	Source      string    `json:"source,omitempty"`
+	Confidence  float64   `json:"confidence,omitempty"`
+	Declaration string    `json:"declaration,omitempty"`
+	LocalOnly   bool      `json:"local_only,omitempty"`
+}
+
+// SessionInfo summarizes a session for listings.
+type SessionInfo struct {
+	Key      string       `json:"key"`
+	Messages int          `json:"messages"`
+	Flags    SessionFlags `json:"flags"`
+	Created  time.Time    `json:"created"`
+	Updated  time.Time    `json:"updated"`
+}
+
+const (
+	maxRouteRecords = 100
+	routeTextLimit  = 200 // runes
+)
+
 type SessionFlags struct {
 	LocalOnly            bool   `json:"local_only,omitempty"`
 	PrevPrimaryRoute     string `json:"prev_primary_route,omitempty"`
@@ -194,6 +227,7 @@ func (sm *SessionManager) Save(key string) error {
 		Flags:   stored.Flags,
 		Created: stored.Created,
 		Updated: stored.Updated,
+		Routes:  append([]RouteRecord(nil), stored.Routes...),
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
@@ -201,8 +235,25 @@ func (sm *SessionManager) Save(key string) error {
 	} else {
 		snapshot.Messages = []providers.Message{}
 	}
+	if len(stored.Redactions) > 0 {
+		snapshot.Redactions = make(map[string]int, len(stored.Redactions))
+		for rule, n := range stored.Redactions {
+			snapshot.Redactions[rule] = n
+		}
+	}
 	sm.mu.RUnlock()
 
+	// Tool outputs and messages may contain secrets: the file only gets
+	// redacted copies, the in-memory history stays intact.
+	if r := redact.Default(); r != nil {
+		snapshot.Messages = RedactMessages(r, key, snapshot.Messages)
+		snapshot.Summary = r.Redact(key, snapshot.Summary)
+		for i := range snapshot.Routes {
+			snapshot.Routes[i].Text = r.Redact(key, snapshot.Routes[i].Text)
+		}
+		snapshot.Redactions = sm.updateRedactions(key, r.Counts(key))
+	}
+
 	data, err := json.MarshalIndent(snapshot, "", "  ")
 	if err != nil {
 		return err
@@ -245,6 +296,71 @@ func (sm *SessionManager) Save(key string) error {
 	return nil
 }
 
+// RedactMessages returns copies of messages with their content and tool call
+// arguments redacted, counting the masked values under key.
+func RedactMessages(r *redact.Redactor, key string, messages []providers.Message) []providers.Message {
+	out := make([]providers.Message, len(messages))
+	for i, m := range messages {
+		out[i] = redactMessage(r, key, m)
+	}
+	return out
+}
+
+func redactMessage(r *redact.Redactor, key string, m providers.Message) providers.Message {
+	m.Content = r.Redact(key, m.Content)
+	if len(m.ToolCalls) == 0 {
+		return m
+	}
+	calls := make([]providers.ToolCall, len(m.ToolCalls))
+	for i, tc := range m.ToolCalls {
+		if tc.Function != nil {
+			fn := *tc.Function
+			fn.Arguments = r.Redact(key, fn.Arguments)
+			tc.Function = &fn
+		}
+		if len(tc.Arguments) > 0 {
+			args := make(map[string]interface{}, len(tc.Arguments))
+			for k, v := range tc.Arguments {
+				if s, ok := v.(string); ok {
+					v = r.Redact(key, s)
+				}
+				args[k] = v
+			}
+			tc.Arguments = args
+		}
+		calls[i] = tc
+	}
+	m.ToolCalls = calls
+	return m
+}
+
+// updateRedactions merges counts into the session's audit counts. The
+// redactor only knows values seen since startup, so the larger count wins.
+func (sm *SessionManager) updateRedactions(key string, counts map[string]int) map[string]int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session, ok := sm.sessions[key]
+	if !ok {
+		return counts
+	}
+	for rule, n := range counts {
+		if session.Redactions == nil {
+			session.Redactions = make(map[string]int)
+		}
+		if n > session.Redactions[rule] {
+			session.Redactions[rule] = n
+		}
+	}
+	if len(session.Redactions) == 0 {
+		return nil
+	}
+	merged := make(map[string]int, len(session.Redactions))
+	for rule, n := range session.Redactions {
+		merged[rule] = n
+	}
+	return merged
+}
+
 func (sm *SessionManager) loadSessions() error {
 	files, err := os.ReadDir(sm.storage)
 	if err != nil {
@@ -306,7 +422,7 @@ func (sm *SessionManager) GetUpdatedTime(key string) time.Time {
 	return session.Updated
 }
 
-// ResetSession clears the messages and summary of a session, keeping
+// ResetSession clears the messages, summary and routes of a session, keeping
 // the key, flags, and timestamps. Created is preserved; Updated is set to now.
 func (sm *SessionManager) ResetSession(key string) {
 	sm.mu.Lock()
@@ -318,6 +434,7 @@ func (sm *SessionManager) ResetSession(key string) {
 	}
 	session.Messages = []providers.Message{}
 	session.Summary = ""
+	session.Routes = nil
 	session.Updated = time.Now()
 }
 
@@ -348,3 +465,67 @@ func (sm *SessionManager) SetFlags(key string, flags SessionFlags) {
 	session.Flags = flags
 	session.Updated = time.Now()
 }
+
+// AddRoute records the routing decision of a turn, keeping the last
+// maxRouteRecords.
+func (sm *SessionManager) AddRoute(key string, rec RouteRecord) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
+		}
+		sm.sessions[key] = session
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if runes := []rune(rec.Text); len(runes) > routeTextLimit {
+		rec.Text = string(runes[:routeTextLimit])
+	}
+	session.Routes = append(session.Routes, rec)
+	if len(session.Routes) > maxRouteRecords {
+		session.Routes = append([]RouteRecord(nil), session.Routes[len(session.Routes)-maxRouteRecords:]...)
+	}
+	session.Updated = time.Now()
+}
+
+// GetRoutes returns the recorded routing decisions of a session, oldest first.
+func (sm *SessionManager) GetRoutes(key string) []RouteRecord {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return nil
+	}
+	return append([]RouteRecord(nil), session.Routes...)
+}
+
+// ListSessions returns every session, most recently updated first.
+func (sm *SessionManager) ListSessions() []SessionInfo {
+	sm.mu.RLock()
+	infos := make([]SessionInfo, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		infos = append(infos, SessionInfo{
+			Key:      session.Key,
+			Messages: len(session.Messages),
+			Flags:    session.Flags,
+			Created:  session.Created,
+			Updated:  session.Updated,
+		})
+	}
+	sm.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].Updated.Equal(infos[j].Updated) {
+			return infos[i].Updated.After(infos[j].Updated)
+		}
+		return infos[i].Key < infos[j].Key
+	})
+	return infos
+}
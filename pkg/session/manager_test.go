@@ -3,8 +3,11 @@ package session
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
 )
 
 func TestSanitizeFilename(t *testing.T) {
@@ -213,3 +216,95 @@ func TestResetSession_NonExistent(t *testing.T) {
 	// Should not panic
 	sm.ResetSession("nonexistent:key")
 }
+
+func TestSave_RedactsFileOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "telegram:42"
+	secret := "sk-abcdefghijklmnopqrstuvwx"
+
+	sm.AddMessage(key, "user", "my key is "+secret+", mail me at bob@example.com")
+	sm.AddFullMessage(key, providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{{
+			ID:       "1",
+			Name:     "exec",
+			Function: &providers.FunctionCall{Name: "exec", Arguments: `{"command":"curl -H 'Authorization: Bearer abcdefgh12345678'"}`},
+		}},
+	})
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "telegram_42.json"))
+	if err != nil {
+		t.Fatalf("reading session file: %v", err)
+	}
+	for _, s := range []string{secret, "abcdefgh12345678"} {
+		if strings.Contains(string(data), s) {
+			t.Errorf("session file contains %q", s)
+		}
+	}
+
+	// The in-memory history keeps the original text.
+	history := sm.GetHistory(key)
+	if !strings.Contains(history[0].Content, secret) {
+		t.Errorf("in-memory message was redacted: %q", history[0].Content)
+	}
+	if !strings.Contains(history[1].ToolCalls[0].Function.Arguments, "abcdefgh12345678") {
+		t.Error("in-memory tool call arguments were redacted")
+	}
+
+	// The audit counts survive a reload and do not grow on re-save.
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("second Save failed: %v", err)
+	}
+	loaded := NewSessionManager(tmpDir).GetOrCreate(key)
+	want := map[string]int{"api_key": 1, "email": 0, "bearer_token": 1}
+	for rule, n := range want {
+		if loaded.Redactions[rule] != n {
+			t.Errorf("Redactions[%s] = %d, want %d (all: %v)", rule, loaded.Redactions[rule], n, loaded.Redactions)
+		}
+	}
+}
+
+func TestRoutesAndListSessions(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	sm.AddMessage("api:old", "user", "hi")
+	sm.AddRoute("api:new", RouteRecord{Text: "first", Route: "CHAT", Source: "rules", Confidence: 0.9})
+	for i := 0; i < maxRouteRecords+5; i++ {
+		sm.AddRoute("api:new", RouteRecord{Text: "again", Route: "CODE"})
+	}
+
+	routes := sm.GetRoutes("api:new")
+	if len(routes) != maxRouteRecords {
+		t.Fatalf("kept %d routes, want %d", len(routes), maxRouteRecords)
+	}
+	if routes[0].Route != "CODE" || routes[0].Time.IsZero() {
+		t.Errorf("oldest kept route = %+v", routes[0])
+	}
+
+	sm.AddRoute("api:long", RouteRecord{Text: strings.Repeat("あ", 300), Route: "CHAT"})
+	if got := []rune(sm.GetRoutes("api:long")[0].Text); len(got) != routeTextLimit {
+		t.Errorf("route text kept %d runes, want %d", len(got), routeTextLimit)
+	}
+
+	list := sm.ListSessions()
+	if len(list) != 3 || list[0].Key != "api:long" || list[2].Key != "api:old" || list[2].Messages != 1 {
+		t.Errorf("ListSessions = %+v", list)
+	}
+
+	// Routes are saved with the session and cleared with its history.
+	if err := sm.Save("api:long"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if got := NewSessionManager(tmpDir).GetRoutes("api:long"); len(got) != 1 || got[0].Route != "CHAT" {
+		t.Errorf("reloaded routes = %+v", got)
+	}
+	sm.ResetSession("api:long")
+	if got := sm.GetRoutes("api:long"); len(got) != 0 {
+		t.Errorf("routes after reset = %+v", got)
+	}
+}
@@ -21,6 +21,62 @@ type State struct {
 
 	// Timestamp is the last time this state was updated
 	Timestamp time.Time `json:"timestamp"`
+
+	// Budget holds today's counters for budget enforcement.
+	Budget BudgetUsage `json:"budget"`
+}
+
+// BudgetUsage is the per-day usage that budgets are checked against.
+// Counters are reset when Day changes.
+type BudgetUsage struct {
+	// Day is the local date (YYYY-MM-DD) the counters belong to.
+	Day string `json:"day,omitempty"`
+	// SenderTokens is total LLM tokens per SenderID.
+	SenderTokens map[string]int `json:"sender_tokens,omitempty"`
+	// ChannelCloudUSD is cloud (non-local provider) spend per channel.
+	ChannelCloudUSD map[string]float64 `json:"channel_cloud_usd,omitempty"`
+	// SessionCode3Calls is the number of CODE3 turns per session key.
+	SessionCode3Calls map[string]int `json:"session_code3_calls,omitempty"`
+	// Code3Jobs holds the jobs already counted in SessionCode3Calls, so a turn
+	// that makes several CODE3 calls is counted once.
+	Code3Jobs map[string]bool `json:"code3_jobs,omitempty"`
+	// Notified records soft-limit notices already sent today.
+	Notified map[string]bool `json:"notified,omitempty"`
+}
+
+func (b BudgetUsage) clone() BudgetUsage {
+	out := BudgetUsage{Day: b.Day}
+	if b.SenderTokens != nil {
+		out.SenderTokens = make(map[string]int, len(b.SenderTokens))
+		for k, v := range b.SenderTokens {
+			out.SenderTokens[k] = v
+		}
+	}
+	if b.ChannelCloudUSD != nil {
+		out.ChannelCloudUSD = make(map[string]float64, len(b.ChannelCloudUSD))
+		for k, v := range b.ChannelCloudUSD {
+			out.ChannelCloudUSD[k] = v
+		}
+	}
+	if b.SessionCode3Calls != nil {
+		out.SessionCode3Calls = make(map[string]int, len(b.SessionCode3Calls))
+		for k, v := range b.SessionCode3Calls {
+			out.SessionCode3Calls[k] = v
+		}
+	}
+	if b.Code3Jobs != nil {
+		out.Code3Jobs = make(map[string]bool, len(b.Code3Jobs))
+		for k, v := range b.Code3Jobs {
+			out.Code3Jobs[k] = v
+		}
+	}
+	if b.Notified != nil {
+		out.Notified = make(map[string]bool, len(b.Notified))
+		for k, v := range b.Notified {
+			out.Notified[k] = v
+		}
+	}
+	return out
 }
 
 // Manager manages persistent state with atomic saves.
@@ -121,6 +177,27 @@ func (sm *Manager) GetTimestamp() time.Time {
 	return sm.state.Timestamp
 }
 
+// GetBudgetUsage returns a copy of the budget counters.
+func (sm *Manager) GetBudgetUsage() BudgetUsage {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.state.Budget.clone()
+}
+
+// UpdateBudgetUsage applies fn to the budget counters and saves the state atomically.
+func (sm *Manager) UpdateBudgetUsage(fn func(*BudgetUsage)) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	fn(&sm.state.Budget)
+	sm.state.Timestamp = time.Now()
+
+	if err := sm.saveAtomic(); err != nil {
+		return fmt.Errorf("failed to save state atomically: %w", err)
+	}
+	return nil
+}
+
 // saveAtomic performs an atomic save using temp file + rename.
 // This ensures that the state file is never corrupted:
 // 1. Write to a temp file
@@ -214,3 +214,31 @@ func TestNewManager_EmptyWorkspace(t *testing.T) {
 		t.Error("Expected zero timestamp for new state")
 	}
 }
+
+func TestBudgetUsage_Persists(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewManager(tmpDir)
+
+	err := sm.UpdateBudgetUsage(func(b *BudgetUsage) {
+		b.Day = "2026-10-16"
+		if b.SenderTokens == nil {
+			b.SenderTokens = map[string]int{}
+		}
+		b.SenderTokens["u1"] += 1200
+	})
+	if err != nil {
+		t.Fatalf("UpdateBudgetUsage failed: %v", err)
+	}
+
+	got := sm.GetBudgetUsage()
+	got.SenderTokens["u1"] = 0 // copies must not alias the manager's maps
+	if sm.GetBudgetUsage().SenderTokens["u1"] != 1200 {
+		t.Error("GetBudgetUsage should return a copy")
+	}
+
+	sm2 := NewManager(tmpDir)
+	b := sm2.GetBudgetUsage()
+	if b.Day != "2026-10-16" || b.SenderTokens["u1"] != 1200 {
+		t.Errorf("budget usage not persisted: %+v", b)
+	}
+}
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AskAgentTool lets an external caller (e.g. an MCP client) send a message
+// to the routed agent and get its reply.
+type AskAgentTool struct {
+	executor JobExecutor
+	channel  string
+}
+
+// NewAskAgentTool creates an ask_agent tool. Messages are processed as if
+// they came from channel; the session defaults to "<channel>:default".
+func NewAskAgentTool(executor JobExecutor, channel string) *AskAgentTool {
+	return &AskAgentTool{executor: executor, channel: channel}
+}
+
+func (t *AskAgentTool) Name() string {
+	return "ask_agent"
+}
+
+func (t *AskAgentTool) Description() string {
+	return "Ask the picoclaw agent a question or give it a task. The message is routed (CHAT/PLAN/CODE/...) like a chat message and the agent's reply is returned."
+}
+
+func (t *AskAgentTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "The message to send to the agent",
+			},
+			"session": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: conversation name; messages with the same session share history",
+			},
+		},
+		"required": []string{"message"},
+	}
+}
+
+func (t *AskAgentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	message, _ := args["message"].(string)
+	if strings.TrimSpace(message) == "" {
+		return ErrorResult("message is required")
+	}
+	session, _ := args["session"].(string)
+	session = strings.TrimSpace(session)
+	if session == "" {
+		session = "default"
+	}
+
+	response, err := t.executor.ProcessDirectWithChannel(ctx, message, t.channel+":"+session, t.channel, session)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("agent error: %v", err)).WithError(err)
+	}
+	return NewToolResult(response)
+}
@@ -17,6 +17,39 @@ type ContextualTool interface {
 	SetContext(channel, chatID string)
 }
 
+type toolContextKey struct{}
+
+type toolContext struct {
+	channel string
+	chatID  string
+}
+
+// WithToolContext returns a copy of ctx carrying the channel/chatID of the
+// message being processed. Tools must read their origin from here rather
+// than from a value stored by SetContext, since the agent may process
+// several sessions concurrently.
+func WithToolContext(ctx context.Context, channel, chatID string) context.Context {
+	return context.WithValue(ctx, toolContextKey{}, toolContext{channel: channel, chatID: chatID})
+}
+
+// ToolContextFrom returns the channel/chatID stored by WithToolContext.
+func ToolContextFrom(ctx context.Context) (channel, chatID string, ok bool) {
+	tc, ok := ctx.Value(toolContextKey{}).(toolContext)
+	if !ok {
+		return "", "", false
+	}
+	return tc.channel, tc.chatID, true
+}
+
+// toolOrigin is the channel/chatID of ctx, or the CLI's when the tool is
+// run outside a conversation.
+func toolOrigin(ctx context.Context) (channel, chatID string) {
+	if channel, chatID, ok := ToolContextFrom(ctx); ok {
+		return channel, chatID
+	}
+	return "cli", "direct"
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -0,0 +1,290 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/utils"
+)
+
+// maxRedirects is the number of redirects an egress client follows.
+const maxRedirects = 5
+
+// blockedRanges are refused unless allowed explicitly. The first match names
+// the reason, so the metadata addresses come before the ranges holding them.
+var blockedRanges = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	{netip.MustParsePrefix("169.254.169.254/32"), "cloud metadata"},
+	{netip.MustParsePrefix("100.100.100.200/32"), "cloud metadata"},
+	{netip.MustParsePrefix("fd00:ec2::254/128"), "cloud metadata"},
+	{netip.MustParsePrefix("0.0.0.0/8"), "unspecified"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "private"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "private"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "private"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "carrier-grade NAT"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link-local"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "reserved"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "reserved"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "multicast"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved"},
+	{netip.MustParsePrefix("::/128"), "unspecified"},
+	{netip.MustParsePrefix("::1/128"), "loopback"},
+	{netip.MustParsePrefix("fc00::/7"), "private"},
+	{netip.MustParsePrefix("fe80::/10"), "link-local"},
+	{netip.MustParsePrefix("ff00::/8"), "multicast"},
+	// Translation prefixes embed an IPv4 address that may be internal.
+	{netip.MustParsePrefix("64:ff9b::/96"), "NAT64"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "NAT64"},
+	{netip.MustParsePrefix("2002::/16"), "6to4"},
+}
+
+// EgressError is returned when the egress policy refuses a connection.
+type EgressError struct {
+	Host   string
+	Addr   netip.Addr // invalid when the host name itself is denied
+	Reason string
+}
+
+func (e *EgressError) Error() string {
+	if !e.Addr.IsValid() || e.Host == e.Addr.String() {
+		return fmt.Sprintf("blocked by egress policy: %s is %s", e.Host, e.Reason)
+	}
+	return fmt.Sprintf("blocked by egress policy: %s resolves to %s (%s)", e.Host, e.Addr, e.Reason)
+}
+
+// EgressPolicy decides which hosts outbound HTTP requests may reach. By
+// default it refuses loopback, private, link-local, metadata and other
+// internal addresses. Hosts and networks on the allow list are exempt from
+// that; the deny list refuses hosts and networks on top of it and wins over
+// the allow list.
+//
+// Addresses are checked when connecting, after name resolution, and the
+// connection goes to the address that was checked: redirects and DNS answers
+// that change between lookups (rebinding) cannot reach a blocked address.
+//
+// The proxy from HTTP_PROXY/HTTPS_PROXY/NO_PROXY is honoured. The connection
+// check then applies to the proxy, which must be allowed if it is internal,
+// while the destination is only checked by name before each request: the
+// proxy resolves it again, so rebinding protection is up to the proxy.
+type EgressPolicy struct {
+	allowHosts []string
+	allowNets  []netip.Prefix
+	denyHosts  []string
+	denyNets   []netip.Prefix
+
+	lookup    func(ctx context.Context, host string) ([]netip.Addr, error)
+	proxy     func(*http.Request) (*url.URL, error)
+	dialer    *net.Dialer
+	transport *http.Transport
+}
+
+// NewEgressPolicy returns a policy with the given allow and deny lists. An
+// entry is an IP address, a CIDR, a host name, or "*.example.com" for the
+// subdomains of example.com.
+func NewEgressPolicy(allow, deny []string) (*EgressPolicy, error) {
+	p := &EgressPolicy{
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		proxy:  http.ProxyFromEnvironment,
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	var err error
+	if p.allowHosts, p.allowNets, err = parseEgressEntries(allow); err != nil {
+		return nil, fmt.Errorf("egress allow list: %w", err)
+	}
+	if p.denyHosts, p.denyNets, err = parseEgressEntries(deny); err != nil {
+		return nil, fmt.Errorf("egress deny list: %w", err)
+	}
+	p.transport = &http.Transport{
+		Proxy:               p.proxyFor,
+		DialContext:         p.dialContext,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     30 * time.Second,
+		TLSHandshakeTimeout: 15 * time.Second,
+	}
+	return p, nil
+}
+
+func parseEgressEntries(entries []string) ([]string, []netip.Prefix, error) {
+	var hosts []string
+	var nets []netip.Prefix
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch {
+		case e == "":
+			continue
+		case strings.Contains(e, "/"):
+			prefix, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid CIDR %q", e)
+			}
+			nets = append(nets, prefix.Masked())
+		default:
+			if addr, err := netip.ParseAddr(e); err == nil {
+				addr = addr.Unmap()
+				nets = append(nets, netip.PrefixFrom(addr, addr.BitLen()))
+			} else {
+				hosts = append(hosts, strings.TrimSuffix(e, "."))
+			}
+		}
+	}
+	return hosts, nets, nil
+}
+
+var defaultEgress atomic.Pointer[EgressPolicy]
+
+func init() {
+	p, _ := NewEgressPolicy(nil, nil)
+	SetDefaultEgressPolicy(p)
+}
+
+// DefaultEgressPolicy returns the policy used by tools that were not given
+// one.
+func DefaultEgressPolicy() *EgressPolicy {
+	return defaultEgress.Load()
+}
+
+// SetDefaultEgressPolicy replaces the default policy. It also applies to
+// media downloads (utils.DownloadFile).
+func SetDefaultEgressPolicy(p *EgressPolicy) {
+	defaultEgress.Store(p)
+	utils.SetDownloadTransport(p.Transport())
+}
+
+// Transport returns an HTTP transport that only connects where the policy
+// allows.
+func (p *EgressPolicy) Transport() *http.Transport {
+	return p.transport
+}
+
+// Client returns an HTTP client using the policy's transport. It follows up
+// to 5 redirects, to http and https URLs only.
+func (p *EgressPolicy) Client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: p.transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// Resolve returns the addresses of host that the policy allows connecting
+// to, or an *EgressError if any of them is blocked.
+func (p *EgressPolicy) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if matchEgressHost(p.denyHosts, host) {
+		return nil, &EgressError{Host: host, Reason: "on the deny list"}
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		if addrs, err = p.lookup(ctx, host); err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses for %s", host)
+		}
+	}
+
+	hostAllowed := matchEgressHost(p.allowHosts, host)
+	for i, addr := range addrs {
+		addr = addr.Unmap()
+		addrs[i] = addr
+		if reason := p.blockReason(addr, hostAllowed); reason != "" {
+			return nil, &EgressError{Host: host, Addr: addr, Reason: reason}
+		}
+	}
+	return addrs, nil
+}
+
+// blockReason says why addr is refused, or "" if it is allowed.
+func (p *EgressPolicy) blockReason(addr netip.Addr, hostAllowed bool) string {
+	for _, n := range p.denyNets {
+		if n.Contains(addr) {
+			return "on the deny list"
+		}
+	}
+	if hostAllowed {
+		return ""
+	}
+	for _, n := range p.allowNets {
+		if n.Contains(addr) {
+			return ""
+		}
+	}
+	for _, r := range blockedRanges {
+		if r.prefix.Contains(addr) {
+			return "a " + r.reason + " address"
+		}
+	}
+	return ""
+}
+
+// proxyFor returns the proxy for req. When there is one, the dial check only
+// sees the proxy, so the destination is checked here first.
+func (p *EgressPolicy) proxyFor(req *http.Request) (*url.URL, error) {
+	proxyURL, err := p.proxy(req)
+	if err != nil || proxyURL == nil {
+		return proxyURL, err
+	}
+	if _, err := p.Resolve(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return proxyURL, nil
+}
+
+// dialContext resolves and checks the host, then connects to the checked
+// addresses themselves so a second lookup cannot swap them.
+func (p *EgressPolicy) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := p.Resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := p.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// matchEgressHost reports whether host is in list. "*.example.com" matches
+// the subdomains of example.com.
+func matchEgressHost(list []string, host string) bool {
+	for _, entry := range list {
+		if entry == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
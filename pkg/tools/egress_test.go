@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// loopbackEgress allows the loopback addresses httptest servers listen on.
+func loopbackEgress(t *testing.T) *EgressPolicy {
+	t.Helper()
+	p, err := NewEgressPolicy([]string{"127.0.0.0/8", "::1"}, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+	return p
+}
+
+// fakeDNS makes p resolve names from hosts only.
+func fakeDNS(p *EgressPolicy, hosts map[string]string) {
+	p.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		if ip, ok := hosts[host]; ok {
+			return []netip.Addr{netip.MustParseAddr(ip)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestEgressPolicy_BlocksInternalAddresses(t *testing.T) {
+	p, err := NewEgressPolicy(nil, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+
+	tests := []struct {
+		host   string
+		reason string // "" means allowed
+	}{
+		{"169.254.169.254", "cloud metadata"},
+		{"fd00:ec2::254", "cloud metadata"},
+		{"127.0.0.1", "loopback"},
+		{"::ffff:127.0.0.1", "loopback"},
+		{"[::1]", "loopback"},
+		{"10.1.2.3", "private"},
+		{"192.168.0.10", "private"},
+		{"172.20.0.1", "private"},
+		{"169.254.1.1", "link-local"},
+		{"fe80::1", "link-local"},
+		{"100.64.0.1", "carrier-grade NAT"},
+		{"0.0.0.0", "unspecified"},
+		{"64:ff9b::a00:1", "NAT64"},
+		{"2002:a00:1::1", "6to4"},
+		{"8.8.8.8", ""},
+		{"2606:4700::1111", ""},
+	}
+	for _, tt := range tests {
+		_, err := p.Resolve(context.Background(), tt.host)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.host, err)
+			}
+			continue
+		}
+		var blocked *EgressError
+		if !errors.As(err, &blocked) {
+			t.Errorf("%s: expected EgressError, got %v", tt.host, err)
+			continue
+		}
+		if !strings.Contains(blocked.Reason, tt.reason) {
+			t.Errorf("%s: reason = %q, want %q", tt.host, blocked.Reason, tt.reason)
+		}
+	}
+}
+
+func TestEgressPolicy_ChecksResolvedAddresses(t *testing.T) {
+	p, err := NewEgressPolicy([]string{"*.lan.example", "10.0.0.5"}, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+	fakeDNS(p, map[string]string{
+		"rebind.example":  "127.0.0.1",
+		"nas.lan.example": "192.168.1.5",
+		"printer.example": "10.0.0.5",
+		"public.example":  "93.184.216.34",
+	})
+
+	_, err = p.Resolve(context.Background(), "rebind.example")
+	if err == nil || !strings.Contains(err.Error(), "rebind.example resolves to 127.0.0.1 (a loopback address)") {
+		t.Errorf("rebind.example: expected loopback block, got %v", err)
+	}
+	for _, host := range []string{"nas.lan.example", "printer.example", "public.example"} {
+		if _, err := p.Resolve(context.Background(), host); err != nil {
+			t.Errorf("%s: expected allowed, got %v", host, err)
+		}
+	}
+}
+
+func TestEgressPolicy_DenyListWins(t *testing.T) {
+	p, err := NewEgressPolicy([]string{"93.184.216.0/24"}, []string{"blocked.example", "93.184.216.34"})
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+	fakeDNS(p, map[string]string{"other.example": "93.184.216.34"})
+
+	for _, host := range []string{"blocked.example", "other.example", "93.184.216.34"} {
+		_, err := p.Resolve(context.Background(), host)
+		var blocked *EgressError
+		if !errors.As(err, &blocked) || blocked.Reason != "on the deny list" {
+			t.Errorf("%s: expected deny list block, got %v", host, err)
+		}
+	}
+
+	if _, err := NewEgressPolicy(nil, []string{"10.0.0.0/99"}); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestWebFetch_BlockedByEgressPolicy(t *testing.T) {
+	tool := NewWebFetchTool(50000)
+	p, err := NewEgressPolicy(nil, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+	tool.SetEgressPolicy(p)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"url": "http://169.254.169.254/latest/meta-data/",
+	})
+	if !result.IsError {
+		t.Fatalf("expected error, got: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "blocked by egress policy") || !strings.Contains(result.ForLLM, "cloud metadata") {
+		t.Errorf("expected egress block message, got: %s", result.ForLLM)
+	}
+}
+
+func TestWebFetch_BlocksRedirectToInternalAddress(t *testing.T) {
+	var secretHits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/secret" {
+			secretHits.Add(1)
+			w.Write([]byte("secret"))
+			return
+		}
+		// Redirect to the same server by its loopback address.
+		http.Redirect(w, r, server.URL+"/secret", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// public.example is trusted and happens to resolve to the test server.
+	p, err := NewEgressPolicy([]string{"public.example"}, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy: %v", err)
+	}
+	fakeDNS(p, map[string]string{"public.example": "127.0.0.1"})
+	tool := NewWebFetchTool(50000)
+	tool.SetEgressPolicy(p)
+
+	u, _ := url.Parse(server.URL)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"url": "http://public.example:" + u.Port() + "/",
+	})
+	if !result.IsError {
+		t.Fatalf("expected redirect to be blocked, got: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "127.0.0.1 is a loopback address") {
+		t.Errorf("expected loopback block message, got: %s", result.ForLLM)
+	}
+	if secretHits.Load() != 0 {
+		t.Error("internal address was reached through the redirect")
+	}
+}
+
+func TestEgressPolicy_ChecksDestinationBehindProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	// The proxy itself is on loopback and has to be allowed.
+	p := loopbackEgress(t)
+	fakeDNS(p, map[string]string{"public.example": "93.184.216.34", "internal.example": "10.0.0.8"})
+	p.proxy = http.ProxyURL(proxyURL)
+	client := p.Client(0)
+
+	resp, err := client.Get("http://public.example/")
+	if err != nil {
+		t.Fatalf("GET through proxy: %v", err)
+	}
+	resp.Body.Close()
+	if proxied.Load() != 1 {
+		t.Fatalf("request should go through the proxy")
+	}
+
+	_, err = client.Get("http://internal.example/")
+	var blocked *EgressError
+	if !errors.As(err, &blocked) || !strings.Contains(blocked.Reason, "private") {
+		t.Errorf("internal destination behind the proxy should be blocked, got %v", err)
+	}
+	if proxied.Load() != 1 {
+		t.Error("a blocked request must not reach the proxy")
+	}
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+)
+
+// Command is a process for an Executor to run.
+type Command struct {
+	Args   []string // program and arguments, e.g. {"sh", "-c", "ls"}
+	Dir    string
+	Env    []string // KEY=VALUE pairs added to the executor's environment
+	Stdout io.Writer
+	Stderr io.Writer // may be the same writer as Stdout
+}
+
+// Executor runs the shell commands of the exec tool and the Worker.
+type Executor interface {
+	// Run runs cmd and waits for it. Cancelling ctx kills the command and
+	// every process it started. A non-zero exit is an *exec.ExitError.
+	Run(ctx context.Context, cmd Command) error
+}
+
+// DirectExecutor runs commands as ordinary child processes.
+type DirectExecutor struct{}
+
+func (DirectExecutor) Run(ctx context.Context, c Command) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	// Cancelling the job kills the whole command tree, not just the shell.
+	ConfigureProcessGroup(cmd)
+	return cmd.Run()
+}
+
+var defaultExecutor atomic.Pointer[Executor]
+
+// DefaultExecutor returns the executor used by exec tools that were not given
+// one. It is a DirectExecutor unless replaced with SetDefaultExecutor.
+func DefaultExecutor() Executor {
+	if e := defaultExecutor.Load(); e != nil {
+		return *e
+	}
+	return DirectExecutor{}
+}
+
+// SetDefaultExecutor replaces the default executor.
+func SetDefaultExecutor(e Executor) {
+	defaultExecutor.Store(&e)
+}
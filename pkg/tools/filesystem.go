@@ -44,6 +44,10 @@ func validatePath(path, workspace string, restrict bool) (string, error) {
 				return "", fmt.Errorf("access denied: symlink resolves outside workspace")
 			}
 		} else if os.IsNotExist(err) {
+			// A dangling symlink would be followed on write, wherever it points.
+			if info, lerr := os.Lstat(absPath); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+				return "", fmt.Errorf("access denied: dangling symlink")
+			}
 			if parentResolved, err := resolveExistingAncestor(filepath.Dir(absPath)); err == nil {
 				if !isWithinWorkspace(parentResolved, workspaceReal) {
 					return "", fmt.Errorf("access denied: symlink resolves outside workspace")
@@ -59,6 +63,13 @@ func validatePath(path, workspace string, restrict bool) (string, error) {
 	return absPath, nil
 }
 
+// ResolvePath resolves path against workspace with the same checks the
+// filesystem tools use: with restrict set, paths and symlinks that leave the
+// workspace are rejected.
+func ResolvePath(path, workspace string, restrict bool) (string, error) {
+	return validatePath(path, workspace, restrict)
+}
+
 func resolveExistingAncestor(path string) (string, error) {
 	for current := filepath.Clean(path); ; current = filepath.Dir(current) {
 		if resolved, err := filepath.EvalSymlinks(current); err == nil {
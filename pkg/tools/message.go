@@ -3,19 +3,25 @@ package tools
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
 )
 
-type SendCallback func(channel, chatID, content string) error
+type SendCallback func(channel, chatID, content string, attachments []bus.Attachment) error
 
 type MessageTool struct {
 	sendCallback   SendCallback
+	workspace      string // attachments must be files inside it
 	defaultChannel string
 	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sentInRound    map[string]bool // Tracks, per origin chat, whether a message was sent in the current processing round
+	mu             sync.Mutex
 }
 
 func NewMessageTool() *MessageTool {
-	return &MessageTool{}
+	return &MessageTool{sentInRound: make(map[string]bool)}
 }
 
 func (t *MessageTool) Name() string {
@@ -23,7 +29,7 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	return "Send a message to user on a chat channel. Use this when you want to communicate something. Files from the workspace (images, documents, patches) can be sent as attachments."
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
@@ -42,26 +48,119 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"attachments": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional: workspace files to send with the message",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{
+							"type":        "string",
+							"description": "File path, relative to the workspace",
+						},
+						"caption": map[string]interface{}{
+							"type":        "string",
+							"description": "Optional: caption shown with the file",
+						},
+						"filename": map[string]interface{}{
+							"type":        "string",
+							"description": "Optional: file name shown to the user",
+						},
+					},
+					"required": []string{"path"},
+				},
+			},
 		},
 		"required": []string{"content"},
 	}
 }
 
 func (t *MessageTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
+	// Reset send tracking for new processing round
+	delete(t.sentInRound, roundKey(channel, chatID))
 }
 
-// HasSentInRound returns true if the message tool sent a message during the current round.
+// HasSentInRound returns true if the message tool sent a message during the current round
+// of the most recently set context.
 func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sentInRound[roundKey(t.defaultChannel, t.defaultChatID)]
+}
+
+// HasSentTo returns true if a message was sent during the current round that
+// originated from the given channel/chat.
+func (t *MessageTool) HasSentTo(channel, chatID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sentInRound[roundKey(channel, chatID)]
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetWorkspace sets the directory attachments are resolved against and
+// confined to.
+func (t *MessageTool) SetWorkspace(workspace string) {
+	t.workspace = workspace
+}
+
+// parseAttachments turns the "attachments" argument into bus attachments,
+// checking that each one is a readable workspace file.
+func (t *MessageTool) parseAttachments(raw interface{}) ([]bus.Attachment, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("attachments must be an array")
+	}
+	if len(items) > 0 && t.workspace == "" {
+		return nil, fmt.Errorf("attachments are not available: no workspace configured")
+	}
+	attachments := make([]bus.Attachment, 0, len(items))
+	for i, item := range items {
+		var a bus.Attachment
+		switch v := item.(type) {
+		case string:
+			a.Path = v
+		case map[string]interface{}:
+			a.Path, _ = v["path"].(string)
+			a.Caption, _ = v["caption"].(string)
+			a.Filename, _ = v["filename"].(string)
+		}
+		if a.Path == "" {
+			return nil, fmt.Errorf("attachments[%d]: path is required", i)
+		}
+		path, err := validatePath(a.Path, t.workspace, true)
+		if err != nil {
+			return nil, fmt.Errorf("attachments[%d]: %w", i, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("attachments[%d]: %w", i, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("attachments[%d]: %s is not a regular file", i, a.Path)
+		}
+		if info.Size() > bus.MaxAttachmentBytes {
+			return nil, fmt.Errorf("attachments[%d]: %s is larger than %d MB", i, a.Path, bus.MaxAttachmentBytes>>20)
+		}
+		a.Path = path
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+func roundKey(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	content, ok := args["content"].(string)
 	if !ok {
@@ -71,11 +170,23 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	attachments, err := t.parseAttachments(args["attachments"])
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true}
+	}
+
+	originChannel, originChatID, ok := ToolContextFrom(ctx)
+	if !ok {
+		t.mu.Lock()
+		originChannel, originChatID = t.defaultChannel, t.defaultChatID
+		t.mu.Unlock()
+	}
+
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = originChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = originChatID
 	}
 
 	if channel == "" || chatID == "" {
@@ -86,7 +197,7 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	if err := t.sendCallback(channel, chatID, content, attachments); err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -94,10 +205,16 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
-	t.sentInRound = true
+	t.mu.Lock()
+	t.sentInRound[roundKey(originChannel, originChatID)] = true
+	t.mu.Unlock()
 	// Silent: user already received the message directly
+	forLLM := fmt.Sprintf("Message sent to %s:%s", channel, chatID)
+	if len(attachments) > 0 {
+		forLLM += fmt.Sprintf(" with %d attachment(s)", len(attachments))
+	}
 	return &ToolResult{
-		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
+		ForLLM: forLLM,
 		Silent: true,
 	}
 }
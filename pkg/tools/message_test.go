@@ -3,7 +3,12 @@ package tools
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -11,7 +16,7 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -63,7 +68,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -99,7 +104,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		return sendErr
 	})
 
@@ -153,7 +158,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
 	// No SetContext called, so defaultChannel and defaultChatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		return nil
 	})
 
@@ -257,3 +262,66 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_HasSentTo_TracksOriginFromContext(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error { return nil })
+	tool.SetContext("telegram", "a")
+	tool.SetContext("slack", "b")
+
+	ctx := WithToolContext(context.Background(), "telegram", "a")
+	result := tool.Execute(ctx, map[string]interface{}{"content": "hi"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+
+	if !tool.HasSentTo("telegram", "a") {
+		t.Error("expected send to be recorded for telegram:a")
+	}
+	if tool.HasSentTo("slack", "b") {
+		t.Error("send must not be attributed to slack:b")
+	}
+}
+
+func TestMessageTool_Execute_Attachments(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "chart.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := NewMessageTool()
+	tool.SetWorkspace(workspace)
+	tool.SetContext("telegram", "1")
+
+	var sent []bus.Attachment
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		sent = attachments
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"content": "here it is",
+		"attachments": []interface{}{
+			map[string]interface{}{"path": "chart.png", "caption": "Q3"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if len(sent) != 1 || sent[0].Path != filepath.Join(workspace, "chart.png") || sent[0].Caption != "Q3" {
+		t.Errorf("unexpected attachments: %+v", sent)
+	}
+	if !strings.Contains(result.ForLLM, "1 attachment") {
+		t.Errorf("ForLLM should mention the attachment, got %q", result.ForLLM)
+	}
+
+	for _, path := range []string{"missing.png", "../outside.txt", "/etc/passwd", "."} {
+		sent = nil
+		result := tool.Execute(context.Background(), map[string]interface{}{
+			"content":     "x",
+			"attachments": []interface{}{map[string]interface{}{"path": path}},
+		})
+		if !result.IsError || sent != nil {
+			t.Errorf("attachment %q: expected an error and nothing sent, got %+v", path, result)
+		}
+	}
+}
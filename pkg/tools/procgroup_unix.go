@@ -0,0 +1,26 @@
+//go:build !windows
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ConfigureProcessGroup starts cmd in its own process group and, when the
+// command's context is cancelled, kills the whole group so that grandchildren
+// (pipelines, background jobs) do not outlive a cancelled job.
+// Call it before cmd.Start.
+func ConfigureProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = processWaitDelay
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// ConfigureProcessGroup makes cmd.Wait return soon after cancellation even if
+// a grandchild still holds the output pipes. Windows has no process groups
+// to kill, so only the direct child is terminated.
+func ConfigureProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = processWaitDelay
+}
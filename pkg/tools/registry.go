@@ -27,6 +27,13 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes the tool with the given name, if any.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -61,6 +68,9 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
 		contextualTool.SetContext(channel, chatID)
 	}
+	if channel != "" && chatID != "" {
+		ctx = WithToolContext(ctx, channel, chatID)
+	}
 
 	// If tool implements AsyncTool and callback is provided, set callback
 	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"io"
+	"time"
+)
+
+// SandboxOptions configures a SandboxExecutor.
+type SandboxOptions struct {
+	// Workspace is the only writable directory besides a private /tmp.
+	Workspace string
+	// Network keeps the host network; by default the command only has an
+	// isolated loopback interface.
+	Network bool
+	// Limits; 0 means no limit.
+	CPUTime        time.Duration // CPU time (RLIMIT_CPU)
+	MemoryBytes    uint64        // address space (RLIMIT_AS)
+	MaxOutputBytes int64         // size of written files (RLIMIT_FSIZE) and of captured stdout/stderr each
+}
+
+// SandboxExecutor runs commands isolated in Linux namespaces: a read-only
+// view of the root filesystem with the workspace bound writable, a private
+// /tmp, ~/.picoclaw hidden, its own PID, IPC and UTS namespaces, no network
+// unless allowed, resource limits, and only PATH, HOME, LANG and TERM of
+// picoclaw's environment. It needs unprivileged user namespaces and is not
+// available on other systems. It is opt-in (tools.exec.backend "sandbox");
+// the default DirectExecutor isolates nothing.
+type SandboxExecutor struct {
+	opts SandboxOptions
+}
+
+// NewSandboxExecutor returns a sandbox executor with opts.
+func NewSandboxExecutor(opts SandboxOptions) *SandboxExecutor {
+	return &SandboxExecutor{opts: opts}
+}
+
+// limitWriter passes through the first n bytes written to it and drops the
+// rest, noting the truncation once.
+type limitWriter struct {
+	w         io.Writer
+	n         int64
+	truncated bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	size := len(p)
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	if len(p) > 0 {
+		n, err := l.w.Write(p)
+		l.n -= int64(n)
+		if err != nil {
+			return n, err
+		}
+	}
+	if len(p) < size && !l.truncated {
+		l.truncated = true
+		io.WriteString(l.w, "\n... (output truncated by sandbox limit)\n")
+	}
+	return size, nil
+}
+
+// limitOutput wraps the command's writers in limitWriters, sharing one when
+// stdout and stderr are the same writer.
+func limitOutput(stdout, stderr io.Writer, n int64) (io.Writer, io.Writer) {
+	if n <= 0 {
+		return stdout, stderr
+	}
+	var out, errOut io.Writer
+	if stdout != nil {
+		out = &limitWriter{w: stdout, n: n}
+	}
+	if stderr != nil {
+		if sameWriter(stdout, stderr) {
+			errOut = out
+		} else {
+			errOut = &limitWriter{w: stderr, n: n}
+		}
+	}
+	return out, errOut
+}
+
+// sameWriter compares writers like os/exec does, without panicking on
+// uncomparable types.
+func sameWriter(a, b io.Writer) (same bool) {
+	defer func() { recover() }()
+	return a == b
+}
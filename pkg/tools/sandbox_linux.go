@@ -0,0 +1,334 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/secrets"
+)
+
+// The sandbox re-executes the running binary under this name inside the new
+// namespaces; the init below then sets up the mounts and limits and execs
+// the command.
+const (
+	sandboxInitArg0 = "picoclaw-sandbox-init"
+	sandboxSpecEnv  = "PICOCLAW_SANDBOX_SPEC"
+	// sandboxSetupFailed is the exit code when the sandbox cannot be set up.
+	sandboxSetupFailed = 125
+)
+
+// sandboxDevices are the device nodes visible in the sandbox's /dev.
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// sandboxEnvKeys are the only variables of picoclaw's own environment passed
+// to the command; API keys and other secrets in it stay outside.
+var sandboxEnvKeys = []string{"PATH", "HOME", "LANG", "TERM"}
+
+// sandboxSpec tells the init what to set up.
+type sandboxSpec struct {
+	Workspace  string `json:"workspace"`
+	Dir        string `json:"dir"`
+	CPUSeconds uint64 `json:"cpu_seconds,omitempty"`
+	Memory     uint64 `json:"memory,omitempty"`
+	FileSize   uint64 `json:"file_size,omitempty"`
+	// Hide are directories covered with an empty tmpfs.
+	Hide []string `json:"hide,omitempty"`
+}
+
+func init() {
+	if len(os.Args) > 1 && os.Args[0] == sandboxInitArg0 && os.Getenv(sandboxSpecEnv) != "" {
+		runSandboxInit()
+	}
+}
+
+// Run runs cmd in the sandbox.
+func (s *SandboxExecutor) Run(ctx context.Context, c Command) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	if s.opts.Workspace == "" {
+		return fmt.Errorf("sandbox: no workspace configured")
+	}
+	workspace, err := filepath.Abs(s.opts.Workspace)
+	if err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+	dir := workspace
+	if c.Dir != "" {
+		if dir, err = filepath.Abs(c.Dir); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+	spec := sandboxSpec{Workspace: workspace, Dir: dir}
+	// picoclaw's config, credentials and secret store are not the command's
+	// business, even when the workspace lives below them.
+	if info, err := os.Stat(secrets.Dir()); err == nil && info.IsDir() {
+		spec.Hide = append(spec.Hide, secrets.Dir())
+	}
+	if s.opts.CPUTime > 0 {
+		spec.CPUSeconds = uint64((s.opts.CPUTime + time.Second - 1) / time.Second)
+	}
+	spec.Memory = s.opts.MemoryBytes
+	if s.opts.MaxOutputBytes > 0 {
+		spec.FileSize = uint64(s.opts.MaxOutputBytes)
+	}
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = append([]string{sandboxInitArg0}, c.Args...)
+	cmd.Env = append(append(sandboxEnv(), c.Env...), sandboxSpecEnv+"="+string(specJSON))
+	cmd.Stdout, cmd.Stderr = limitOutput(c.Stdout, c.Stderr, s.opts.MaxOutputBytes)
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if !s.opts.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 flags,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	// The command is PID 1 of its namespace: killing the group (or just it)
+	// takes down everything it started.
+	ConfigureProcessGroup(cmd)
+	return cmd.Run()
+}
+
+// sandboxEnv returns the sandboxEnvKeys set in picoclaw's environment.
+func sandboxEnv() []string {
+	var env []string
+	for _, key := range sandboxEnvKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
+
+// Check runs a trivial command to verify that the sandbox works here.
+func (s *SandboxExecutor) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	if err := s.Run(ctx, Command{Args: []string{"true"}, Stdout: &out, Stderr: &out}); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runSandboxInit runs in the re-executed binary, inside the new namespaces.
+// It never returns.
+func runSandboxInit() {
+	runtime.LockOSThread()
+	var spec sandboxSpec
+	err := json.Unmarshal([]byte(os.Getenv(sandboxSpecEnv)), &spec)
+	if err == nil {
+		err = setupSandbox(spec)
+	}
+	if err == nil {
+		err = execSandboxed(os.Args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(sandboxSetupFailed)
+}
+
+func setupSandbox(spec sandboxSpec) error {
+	// Keep every mount change inside this namespace.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	// Hold the workspace and devices open: /tmp and /dev get covered below.
+	wsFD, err := unix.Open(spec.Workspace, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening workspace: %w", err)
+	}
+	devFDs := make(map[string]int)
+	for _, name := range sandboxDevices {
+		if fd, err := unix.Open("/dev/"+name, unix.O_PATH|unix.O_CLOEXEC, 0); err == nil {
+			devFDs[name] = fd
+		}
+	}
+
+	if err := makeReadOnly("/", true); err != nil {
+		return fmt.Errorf("making root read-only: %w", err)
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting /tmp: %w", err)
+	}
+	if err := setupDev(devFDs); err != nil {
+		return fmt.Errorf("setting up /dev: %w", err)
+	}
+	// A /proc matching the new PID namespace; the inherited one still works
+	// if this is refused.
+	unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC|unix.MS_RDONLY, "")
+
+	// Before the workspace is bound, so a workspace below a hidden directory
+	// stays reachable.
+	for _, dir := range spec.Hide {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue // already covered, e.g. by the private /tmp
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=700"); err != nil {
+			return fmt.Errorf("hiding %s: %w", dir, err)
+		}
+	}
+
+	if err := os.MkdirAll(spec.Workspace, 0755); err != nil {
+		return fmt.Errorf("creating workspace mount point: %w", err)
+	}
+	if err := unix.Mount(fdPath(wsFD), spec.Workspace, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("binding workspace: %w", err)
+	}
+	if err := makeWritable(spec.Workspace); err != nil {
+		return fmt.Errorf("making workspace writable: %w", err)
+	}
+	unix.Close(wsFD)
+
+	unix.Sethostname([]byte("sandbox"))
+	if err := unix.Chdir(spec.Dir); err != nil {
+		return fmt.Errorf("changing to %s: %w", spec.Dir, err)
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, spec.CPUSeconds},
+		{unix.RLIMIT_AS, spec.Memory},
+		{unix.RLIMIT_FSIZE, spec.FileSize},
+	}
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("setting rlimit %d: %w", l.resource, err)
+		}
+	}
+	return dropCapabilities()
+}
+
+// makeReadOnly marks path's mount (and those below it when recursive)
+// read-only. Kernels without mount_setattr only get the top mount changed.
+func makeReadOnly(path string, recursive bool) error {
+	var flags uint
+	if recursive {
+		flags = unix.AT_RECURSIVE
+	}
+	err := unix.MountSetattr(-1, path, flags, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+	if err == unix.ENOSYS {
+		err = unix.Mount("", path, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, "")
+	}
+	return err
+}
+
+// makeWritable clears the read-only flag of the mounts at and below path.
+func makeWritable(path string) error {
+	err := unix.MountSetattr(-1, path, unix.AT_RECURSIVE, &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY})
+	if err == unix.ENOSYS {
+		err = unix.Mount("", path, "", unix.MS_REMOUNT|unix.MS_BIND, "")
+	}
+	return err
+}
+
+// setupDev replaces /dev with a tmpfs holding only the harmless devices.
+func setupDev(devFDs map[string]int) error {
+	if err := unix.Mount("tmpfs", "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return err
+	}
+	for name, fd := range devFDs {
+		target := "/dev/" + name
+		if err := os.WriteFile(target, nil, 0666); err != nil {
+			return err
+		}
+		if err := unix.Mount(fdPath(fd), target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("binding %s: %w", target, err)
+		}
+		unix.Close(fd)
+	}
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, "/dev/"+name); err != nil {
+			return err
+		}
+	}
+	return os.Mkdir("/dev/shm", 01777)
+}
+
+func fdPath(fd int) string {
+	return "/proc/self/fd/" + strconv.Itoa(fd)
+}
+
+// dropCapabilities makes sure the command cannot undo the mounts: even when
+// it runs as root inside the namespace it gets no capabilities, and setuid
+// binaries cannot give it any.
+func dropCapabilities() error {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return fmt.Errorf("reading cap_last_cap: %w", err)
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("parsing cap_last_cap: %w", err)
+	}
+	for c := 0; c <= last; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			return fmt.Errorf("dropping capability %d: %w", c, err)
+		}
+	}
+	unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var caps [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &caps[0]); err != nil {
+		return fmt.Errorf("reading capabilities: %w", err)
+	}
+	caps[0].Inheritable, caps[1].Inheritable = 0, 0
+	if err := unix.Capset(&hdr, &caps[0]); err != nil {
+		return fmt.Errorf("clearing inheritable capabilities: %w", err)
+	}
+	return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+}
+
+// execSandboxed replaces the init with the command. The environment is the
+// one Run built, minus the spec.
+func execSandboxed(args []string) error {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, sandboxSpecEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	return unix.Exec(path, args, env)
+}
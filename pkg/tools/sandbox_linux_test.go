@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSandbox returns a sandbox for workspace, skipping the test where
+// user namespaces are not available.
+func newTestSandbox(t *testing.T, opts SandboxOptions) *SandboxExecutor {
+	t.Helper()
+	s := NewSandboxExecutor(opts)
+	if err := s.Check(); err != nil {
+		t.Skipf("sandbox not available: %v", err)
+	}
+	return s
+}
+
+func runSandboxed(t *testing.T, s *SandboxExecutor, dir, script string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := s.Run(ctx, Command{Args: []string{"sh", "-c", script}, Dir: dir, Stdout: &out, Stderr: &out})
+	return out.String(), err
+}
+
+func TestSandboxExecutor_Filesystem(t *testing.T) {
+	ws := t.TempDir()
+	s := newTestSandbox(t, SandboxOptions{Workspace: ws})
+
+	out, err := runSandboxed(t, s, ws, "echo hello > out.txt && touch /tmp/scratch && echo tmp-ok")
+	if err != nil {
+		t.Fatalf("workspace write failed: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "out.txt")); string(data) != "hello\n" {
+		t.Errorf("out.txt = %q, want %q", data, "hello\n")
+	}
+	if !strings.Contains(out, "tmp-ok") {
+		t.Errorf("private /tmp not writable: %s", out)
+	}
+
+	// Outside the workspace the filesystem is read-only, and /tmp is private:
+	// a file next to the workspace never reaches the host.
+	out, err = runSandboxed(t, s, ws, "echo x > /etc/picoclaw-escape")
+	if err == nil || !strings.Contains(out, "Read-only file system") {
+		t.Errorf("expected /etc to be read-only, got err=%v\n%s", err, out)
+	}
+	if _, err := os.Stat("/etc/picoclaw-escape"); err == nil {
+		os.Remove("/etc/picoclaw-escape")
+		t.Error("/etc was writable from the sandbox")
+	}
+	sibling := filepath.Join(filepath.Dir(ws), "escape.txt")
+	runSandboxed(t, s, ws, "echo x > "+sibling)
+	if _, err := os.Stat(sibling); err == nil {
+		t.Errorf("%s was created outside the workspace", sibling)
+	}
+}
+
+func TestSandboxExecutor_HidesSecrets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PICOCLAW_TEST_API_KEY", "sk-leak")
+	if err := os.MkdirAll(filepath.Join(home, ".picoclaw"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(home, ".picoclaw", "auth.json"), []byte("credential"), 0600)
+	// The default workspace lives below the hidden directory.
+	ws := filepath.Join(home, ".picoclaw", "workspace")
+	os.MkdirAll(ws, 0755)
+	s := newTestSandbox(t, SandboxOptions{Workspace: ws})
+
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := s.Run(ctx, Command{
+		Args:   []string{"sh", "-c", `cat "$HOME/.picoclaw/auth.json"; echo "key=$PICOCLAW_TEST_API_KEY extra=$EXTRA"; echo ok > out.txt`},
+		Dir:    ws,
+		Env:    []string{"EXTRA=passed"},
+		Stdout: &out,
+		Stderr: &out,
+	})
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out.String())
+	}
+	if strings.Contains(out.String(), "credential") {
+		t.Errorf("~/.picoclaw was readable from the sandbox: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "key= extra=passed") {
+		t.Errorf("environment not limited to the allowlist and Command.Env: %s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(ws, "out.txt")); err != nil {
+		t.Errorf("workspace below ~/.picoclaw not writable: %v", err)
+	}
+}
+
+func TestSandboxExecutor_NoNetworkByDefault(t *testing.T) {
+	ws := t.TempDir()
+	s := newTestSandbox(t, SandboxOptions{Workspace: ws})
+
+	out, err := runSandboxed(t, s, ws, "cat /proc/net/dev")
+	if err != nil {
+		t.Fatalf("reading /proc/net/dev: %v\n%s", err, out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		name, _, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && name != "lo" {
+			t.Errorf("unexpected network interface %q in sandbox", name)
+		}
+	}
+}
+
+func TestSandboxExecutor_Limits(t *testing.T) {
+	ws := t.TempDir()
+	s := newTestSandbox(t, SandboxOptions{Workspace: ws, CPUTime: time.Second, MaxOutputBytes: 1000})
+
+	out, err := runSandboxed(t, s, ws, "head -c 5000 /dev/zero | tr '\\0' a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "output truncated by sandbox limit") || strings.Contains(out, strings.Repeat("a", 1001)) {
+		t.Errorf("expected output capped at 1000 bytes, got %d bytes", len(out))
+	}
+
+	start := time.Now()
+	if _, err := runSandboxed(t, s, ws, "while :; do :; done"); err == nil {
+		t.Error("expected the CPU limit to kill a busy loop")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("busy loop ran for %v despite a 1s CPU limit", elapsed)
+	}
+}
+
+func TestSandboxExecutor_TimeoutKillsProcessTree(t *testing.T) {
+	ws := t.TempDir()
+	s := newTestSandbox(t, SandboxOptions{Workspace: ws})
+	tool := NewExecTool(ws, false)
+	tool.SetExecutor(s)
+	tool.SetTimeout(500 * time.Millisecond)
+
+	start := time.Now()
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": "sleep 30 & sleep 30 & wait",
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "timed out") {
+		t.Errorf("expected a timeout, got: %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Execute returned after %v, expected prompt return on timeout", elapsed)
+	}
+}
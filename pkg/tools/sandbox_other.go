@@ -0,0 +1,20 @@
+//go:build !linux
+
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+var errSandboxUnsupported = fmt.Errorf("sandbox executor is only available on Linux")
+
+// Run fails: the sandbox needs Linux namespaces.
+func (s *SandboxExecutor) Run(ctx context.Context, c Command) error {
+	return errSandboxUnsupported
+}
+
+// Check reports that the sandbox is not available here.
+func (s *SandboxExecutor) Check() error {
+	return errSandboxUnsupported
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -13,12 +12,17 @@ import (
 	"time"
 )
 
+// processWaitDelay bounds how long a killed command may keep its output
+// pipes open before Wait gives up on them.
+const processWaitDelay = 2 * time.Second
+
 type ExecTool struct {
 	workingDir          string
 	timeout             time.Duration
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	executor            Executor // nil: DefaultExecutor
 }
 
 func NewExecTool(workingDir string, restrict bool) *ExecTool {
@@ -99,21 +103,17 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 	defer cancel()
 
-	var cmd *exec.Cmd
+	argv := []string{"sh", "-c", command}
 	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
+		argv = []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", command}
 	}
-	if cwd != "" {
-		cmd.Dir = cwd
+	executor := t.executor
+	if executor == nil {
+		executor = DefaultExecutor()
 	}
 
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+	err := executor.Run(cmdCtx, Command{Args: argv, Dir: cwd, Stdout: &stdout, Stderr: &stderr})
 	output := stdout.String()
 	if stderr.Len() > 0 {
 		output += "\nSTDERR:\n" + stderr.String()
@@ -128,6 +128,9 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 				IsError: true,
 			}
 		}
+		if ctx.Err() != nil {
+			return ErrorResult("Command cancelled").WithError(ctx.Err())
+		}
 		output += fmt.Sprintf("\nExit code: %v", err)
 	}
 
@@ -215,6 +218,11 @@ func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
 
+// SetExecutor sets how commands are run, e.g. in a SandboxExecutor.
+func (t *ExecTool) SetExecutor(e Executor) {
+	t.executor = e
+}
+
 func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestShellTool_CancelKillsProcessTree verifies that cancelling the context
+// kills background children of the shell, not only the shell itself
+func TestShellTool_CancelKillsProcessTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	pidFile := filepath.Join(tmpDir, "child.pid")
+	tool := NewExecTool(tmpDir, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(pidFile); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	start := time.Now()
+	result := tool.Execute(ctx, map[string]interface{}{
+		"command": "sleep 30 & echo $! > child.pid; wait",
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "cancelled") {
+		t.Errorf("Expected a cancelled error, got: %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Execute returned after %v, expected prompt return on cancel", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("child pid not written: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	time.Sleep(100 * time.Millisecond)
+	if processAlive(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("background child %d survived cancellation", pid)
+	}
+}
+
+// processAlive reports whether pid exists and is not a zombie waiting to be reaped.
+func processAlive(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name: "pid (comm) S ..."
+	stat := string(data)
+	if i := strings.LastIndex(stat, ")"); i >= 0 && i+2 < len(stat) {
+		return stat[i+2] != 'Z'
+	}
+	return true
+}
@@ -3,25 +3,27 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
+// SpawnTool reports results to the chat it was called from, which it reads
+// from the tool context of each call.
 type SpawnTool struct {
-	manager       *SubagentManager
-	originChannel string
-	originChatID  string
-	callback      AsyncCallback // For async completion notification
+	manager  *SubagentManager
+	mu       sync.Mutex
+	callback AsyncCallback // For async completion notification
 }
 
 func NewSpawnTool(manager *SubagentManager) *SpawnTool {
 	return &SpawnTool{
-		manager:       manager,
-		originChannel: "cli",
-		originChatID:  "direct",
+		manager: manager,
 	}
 }
 
 // SetCallback implements AsyncTool interface for async completion notification
 func (t *SpawnTool) SetCallback(cb AsyncCallback) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.callback = cb
 }
 
@@ -50,11 +52,6 @@ func (t *SpawnTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *SpawnTool) SetContext(channel, chatID string) {
-	t.originChannel = channel
-	t.originChatID = chatID
-}
-
 func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	task, ok := args["task"].(string)
 	if !ok {
@@ -68,7 +65,11 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) *T
 	}
 
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, t.originChannel, t.originChatID, t.callback)
+	t.mu.Lock()
+	callback := t.callback
+	t.mu.Unlock()
+	channel, chatID := toolOrigin(ctx)
+	result, err := t.manager.Spawn(ctx, task, label, channel, chatID, callback)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
@@ -209,16 +209,12 @@ func (sm *SubagentManager) ListTasks() []*SubagentTask {
 // Unlike SpawnTool which runs tasks asynchronously, SubagentTool waits for completion
 // and returns the result directly in the ToolResult.
 type SubagentTool struct {
-	manager       *SubagentManager
-	originChannel string
-	originChatID  string
+	manager *SubagentManager
 }
 
 func NewSubagentTool(manager *SubagentManager) *SubagentTool {
 	return &SubagentTool{
-		manager:       manager,
-		originChannel: "cli",
-		originChatID:  "direct",
+		manager: manager,
 	}
 }
 
@@ -247,11 +243,6 @@ func (t *SubagentTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *SubagentTool) SetContext(channel, chatID string) {
-	t.originChannel = channel
-	t.originChatID = chatID
-}
-
 func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	task, ok := args["task"].(string)
 	if !ok {
@@ -277,6 +268,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 	}
 
 	// Use RunToolLoop to execute with tools (same as async SpawnTool)
+	channel, chatID := toolOrigin(ctx)
 	sm := t.manager
 	sm.mu.RLock()
 	tools := sm.tools
@@ -292,7 +284,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 			"max_tokens":  4096,
 			"temperature": 0.7,
 		},
-	}, messages, t.originChannel, t.originChatID)
+	}, messages, channel, chatID)
 
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
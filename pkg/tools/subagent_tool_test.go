@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/Nyukimin/picoclaw_multiLLM/pkg/bus"
@@ -112,17 +113,34 @@ func TestSubagentTool_Parameters(t *testing.T) {
 	}
 }
 
-// TestSubagentTool_SetContext verifies context setting
-func TestSubagentTool_SetContext(t *testing.T) {
+// TestSpawnTool_OriginFromContext verifies concurrent calls keep their own origin chat
+func TestSpawnTool_OriginFromContext(t *testing.T) {
 	provider := &MockLLMProvider{}
 	manager := NewSubagentManager(provider, "test-model", "/tmp/test", nil)
-	tool := NewSubagentTool(manager)
-
-	tool.SetContext("test-channel", "test-chat")
-
-	// Verify context is set (we can't directly access private fields,
-	// but we can verify it doesn't crash)
-	// The actual context usage is tested in Execute tests
+	tool := NewSpawnTool(manager)
+
+	var wg sync.WaitGroup
+	for _, chatID := range []string{"chat-a", "chat-b"} {
+		wg.Add(1)
+		go func(chatID string) {
+			defer wg.Done()
+			ctx := WithToolContext(context.Background(), "telegram", chatID)
+			if result := tool.Execute(ctx, map[string]interface{}{"task": "task for " + chatID}); result.IsError {
+				t.Errorf("spawn failed: %s", result.ForLLM)
+			}
+		}(chatID)
+	}
+	wg.Wait()
+
+	origins := map[string]string{}
+	for _, task := range manager.ListTasks() {
+		origins[task.Task] = task.OriginChannel + ":" + task.OriginChatID
+	}
+	for _, chatID := range []string{"chat-a", "chat-b"} {
+		if got := origins["task for "+chatID]; got != "telegram:"+chatID {
+			t.Errorf("origin of %s = %q", chatID, got)
+		}
+	}
 }
 
 // TestSubagentTool_Execute_Success tests successful execution
@@ -131,9 +149,8 @@ func TestSubagentTool_Execute_Success(t *testing.T) {
 	msgBus := bus.NewMessageBus()
 	manager := NewSubagentManager(provider, "test-model", "/tmp/test", msgBus)
 	tool := NewSubagentTool(manager)
-	tool.SetContext("telegram", "chat-123")
 
-	ctx := context.Background()
+	ctx := WithToolContext(context.Background(), "telegram", "chat-123")
 	args := map[string]interface{}{
 		"task":  "Write a haiku about coding",
 		"label": "haiku-task",
@@ -265,9 +282,7 @@ func TestSubagentTool_Execute_ContextPassing(t *testing.T) {
 	// Set context
 	channel := "test-channel"
 	chatID := "test-chat"
-	tool.SetContext(channel, chatID)
-
-	ctx := context.Background()
+	ctx := WithToolContext(context.Background(), channel, chatID)
 	args := map[string]interface{}{
 		"task": "Test context passing",
 	}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -340,6 +341,7 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 
 type WebFetchTool struct {
 	maxChars int
+	egress   *EgressPolicy // nil: DefaultEgressPolicy
 }
 
 func NewWebFetchTool(maxChars int) *WebFetchTool {
@@ -351,6 +353,11 @@ func NewWebFetchTool(maxChars int) *WebFetchTool {
 	}
 }
 
+// SetEgressPolicy sets the policy deciding which hosts can be fetched.
+func (t *WebFetchTool) SetEgressPolicy(p *EgressPolicy) {
+	t.egress = p
+}
+
 func (t *WebFetchTool) Name() string {
 	return "web_fetch"
 }
@@ -410,24 +417,19 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableCompression:  false,
-			TLSHandshakeTimeout: 15 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return fmt.Errorf("stopped after 5 redirects")
-			}
-			return nil
-		},
+	egress := t.egress
+	if egress == nil {
+		egress = DefaultEgressPolicy()
 	}
+	client := egress.Client(60 * time.Second)
 
 	resp, err := client.Do(req)
 	if err != nil {
+		var blocked *EgressError
+		if errors.As(err, &blocked) {
+			return ErrorResult(fmt.Sprintf("cannot fetch %s: %v. Internal and private addresses are not reachable from web_fetch; "+
+				"if the user trusts this host, it must be added to tools.egress.allow_hosts", urlStr, blocked))
+		}
 		return ErrorResult(fmt.Sprintf("request failed: %v", err))
 	}
 	defer resp.Body.Close()
@@ -19,6 +19,7 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 	defer server.Close()
 
 	tool := NewWebFetchTool(50000)
+	tool.SetEgressPolicy(loopbackEgress(t))
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -55,6 +56,7 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 	defer server.Close()
 
 	tool := NewWebFetchTool(50000)
+	tool.SetEgressPolicy(loopbackEgress(t))
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -146,6 +148,7 @@ func TestWebTool_WebFetch_Truncation(t *testing.T) {
 	defer server.Close()
 
 	tool := NewWebFetchTool(1000) // Limit to 1000 chars
+	tool.SetEgressPolicy(loopbackEgress(t))
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -211,6 +214,7 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 	defer server.Close()
 
 	tool := NewWebFetchTool(50000)
+	tool.SetEgressPolicy(loopbackEgress(t))
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
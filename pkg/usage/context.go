@@ -0,0 +1,44 @@
+package usage
+
+import "context"
+
+// CallInfo describes who an LLM call was made for. It travels on the context
+// so that metered providers can attribute calls without changing the
+// LLMProvider interface.
+type CallInfo struct {
+	SessionKey string
+	Channel    string
+	ChatID     string
+	SenderID   string
+	Route      string
+	JobID      string
+}
+
+type callInfoKey struct{}
+
+// WithCallInfo returns a context carrying info.
+func WithCallInfo(ctx context.Context, info CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext returns the CallInfo stored on ctx, or a zero value.
+func CallInfoFromContext(ctx context.Context) CallInfo {
+	if info, ok := ctx.Value(callInfoKey{}).(CallInfo); ok {
+		return info
+	}
+	return CallInfo{}
+}
+
+// WithRoute returns a context whose CallInfo has Route replaced.
+func WithRoute(ctx context.Context, route string) context.Context {
+	info := CallInfoFromContext(ctx)
+	info.Route = route
+	return WithCallInfo(ctx, info)
+}
+
+// WithJobID returns a context whose CallInfo has JobID replaced.
+func WithJobID(ctx context.Context, jobID string) context.Context {
+	info := CallInfoFromContext(ctx)
+	info.JobID = jobID
+	return WithCallInfo(ctx, info)
+}
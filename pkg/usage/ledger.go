@@ -0,0 +1,174 @@
+// Package usage records token usage, latency and cost of every LLM call in an
+// append-only JSONL ledger under the workspace, and summarizes it per route,
+// channel and provider.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+// Record is one LLM call as written to the ledger.
+type Record struct {
+	Time             time.Time `json:"ts"`
+	SessionKey       string    `json:"session_key,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	ChatID           string    `json:"chat_id,omitempty"`
+	SenderID         string    `json:"sender_id,omitempty"`
+	Route            string    `json:"route,omitempty"`
+	JobID            string    `json:"job_id,omitempty"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	LatencyMS        int64     `json:"latency_ms"`
+	CostUSD          float64   `json:"cost_usd"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// Ledger appends Records to monthly files (usage/YYYY-MM.jsonl).
+// It is safe for concurrent use.
+type Ledger struct {
+	dir    string
+	prices PriceTable
+	mu     sync.Mutex
+	hooks  []func(Record)
+}
+
+// NewLedger creates a ledger writing into dir. Costs are computed from prices
+// when a record is appended.
+func NewLedger(dir string, prices PriceTable) *Ledger {
+	return &Ledger{dir: dir, prices: prices}
+}
+
+// Dir returns the directory holding the ledger files.
+func (l *Ledger) Dir() string {
+	return l.dir
+}
+
+// OnRecord registers fn to be called after every appended record. fn runs on
+// the caller's goroutine and must not call Append.
+func (l *Ledger) OnRecord(fn func(Record)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, fn)
+}
+
+// Append prices rec (unless CostUSD is already set) and writes it to the
+// month's file.
+func (l *Ledger) Append(rec Record) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if rec.TotalTokens == 0 {
+		rec.TotalTokens = rec.PromptTokens + rec.CompletionTokens
+	}
+	if rec.CostUSD == 0 {
+		rec.CostUSD = l.prices.Cost(rec.Provider, rec.Model, rec.PromptTokens, rec.CompletionTokens)
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	l.mu.Lock()
+	err = l.write(rec.Time, data)
+	hooks := l.hooks
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range hooks {
+		fn(rec)
+	}
+	return nil
+}
+
+func (l *Ledger) write(t time.Time, data []byte) error {
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create usage dir: %w", err)
+	}
+	f, err := os.OpenFile(l.monthFile(t), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// Load returns the records with from <= Time < to, in file order.
+// Lines that cannot be parsed are skipped.
+func (l *Ledger) Load(from, to time.Time) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []Record
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for month.Before(to) {
+		recs, err := readFile(l.monthFile(month))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			if !r.Time.Before(from) && r.Time.Before(to) {
+				out = append(out, r)
+			}
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return out, nil
+}
+
+func (l *Ledger) monthFile(t time.Time) string {
+	return filepath.Join(l.dir, t.Format("2006-01")+".jsonl")
+}
+
+func readFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+
+	var out []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+	return out, nil
+}
+
+// DirName is the workspace subdirectory holding the ledger.
+const DirName = "usage"
+
+// Open returns the workspace ledger for cfg, or nil when usage tracking is disabled.
+func Open(workspace string, cfg config.UsageConfig) *Ledger {
+	if !cfg.Enabled {
+		return nil
+	}
+	return NewLedger(filepath.Join(workspace, DirName), NewPriceTable(cfg.Prices))
+}
@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+func TestLedger_AppendAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLedger(dir, NewPriceTable(map[string]config.ModelPrice{
+		"anthropic/claude-x": {InputPerMTok: 3, OutputPerMTok: 15},
+	}))
+
+	at := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+	if err := l.Append(Record{Time: at, Provider: "anthropic", Model: "claude-x", Route: "CODE3", PromptTokens: 1000, CompletionTokens: 500}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := l.Append(Record{Time: at.AddDate(0, 1, 0), Provider: "ollama", Model: "chat-v1", PromptTokens: 10}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "2026-10.jsonl")); err != nil {
+		t.Fatalf("expected monthly file: %v", err)
+	}
+
+	recs, err := l.Load(at.Add(-time.Hour), at.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record in range, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.TotalTokens != 1500 {
+		t.Errorf("TotalTokens = %d, want 1500", r.TotalTokens)
+	}
+	if want := 0.0105; r.CostUSD < want-1e-9 || r.CostUSD > want+1e-9 {
+		t.Errorf("CostUSD = %f, want %f", r.CostUSD, want)
+	}
+
+	all, err := l.Load(at.AddDate(0, 0, -1), at.AddDate(0, 2, 0))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected records from both months, got %d", len(all))
+	}
+}
+
+func TestLedger_OnRecord(t *testing.T) {
+	l := NewLedger(t.TempDir(), nil)
+	var got []Record
+	l.OnRecord(func(r Record) { got = append(got, r) })
+
+	if err := l.Append(Record{Provider: "ollama", Model: "m", PromptTokens: 1}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Time.IsZero() {
+		t.Fatalf("expected hook with a timestamped record, got %+v", got)
+	}
+}
+
+func TestPriceTable_Lookup(t *testing.T) {
+	prices := NewPriceTable(map[string]config.ModelPrice{
+		"Ollama":                   {},
+		"deepseek-chat":            {InputPerMTok: 0.27, OutputPerMTok: 1.1},
+		"openrouter/deepseek-chat": {InputPerMTok: 0.5, OutputPerMTok: 2},
+	})
+
+	if p, ok := prices.Lookup("openrouter", "deepseek-chat"); !ok || p.InputPerMTok != 0.5 {
+		t.Errorf("provider/model key should win, got %+v %v", p, ok)
+	}
+	if p, ok := prices.Lookup("deepseek", "DeepSeek-Chat"); !ok || p.InputPerMTok != 0.27 {
+		t.Errorf("model key should match case-insensitively, got %+v %v", p, ok)
+	}
+	if _, ok := prices.Lookup("ollama", "anything"); !ok {
+		t.Error("provider key should price every model of that provider")
+	}
+	if _, ok := prices.Lookup("openai", "gpt-4"); ok {
+		t.Error("unpriced model should not match")
+	}
+}
+
+func TestLedger_Report(t *testing.T) {
+	l := NewLedger(t.TempDir(), nil)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	recs := []Record{
+		{Time: now, Route: "CHAT", Channel: "telegram", Provider: "ollama", Model: "chat", PromptTokens: 100, CompletionTokens: 20, CostUSD: 0.01},
+		{Time: now, Route: "CODE3", Channel: "slack", Provider: "anthropic", Model: "claude", PromptTokens: 1000, CompletionTokens: 200, CostUSD: 0.5},
+		{Time: now.AddDate(0, 0, -3), Route: "CHAT", Channel: "telegram", Provider: "ollama", Model: "chat", PromptTokens: 50, CostUSD: 0.02},
+	}
+	for _, r := range recs {
+		if err := l.Append(r); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	day, err := l.DaySummary(now)
+	if err != nil {
+		t.Fatalf("DaySummary failed: %v", err)
+	}
+	if day.Total.Calls != 2 || day.ByRoute[0].Key != "CODE3" {
+		t.Errorf("unexpected day summary: %+v", day)
+	}
+	month, err := l.MonthSummary(now)
+	if err != nil {
+		t.Fatalf("MonthSummary failed: %v", err)
+	}
+	if month.Total.Calls != 3 {
+		t.Errorf("month calls = %d, want 3", month.Total.Calls)
+	}
+	for _, g := range month.ByChannel {
+		if g.Key == "telegram" && g.Calls != 2 {
+			t.Errorf("telegram calls = %d, want 2", g.Calls)
+		}
+	}
+
+	report, err := l.Report(now)
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	for _, want := range []string{"Usage 2026-10-16", "Usage 2026-10:", "by route", "by channel", "telegram"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report missing %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/logger"
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+// Meter wraps provider so that every Chat/ChatStream call is appended to
+// ledger. Streaming providers stay streaming. A nil ledger returns provider
+// unchanged.
+func Meter(ledger *Ledger, providerName string, provider providers.LLMProvider) providers.LLMProvider {
+	if ledger == nil || provider == nil {
+		return provider
+	}
+	if _, already := provider.(meteredMarker); already {
+		return provider
+	}
+	m := &meteredProvider{ledger: ledger, name: normalizeKey(providerName), inner: provider}
+	if sp, ok := provider.(providers.StreamingProvider); ok {
+		return &meteredStreamingProvider{meteredProvider: m, stream: sp}
+	}
+	return m
+}
+
+type meteredMarker interface {
+	metered()
+}
+
+type meteredProvider struct {
+	ledger *Ledger
+	name   string
+	inner  providers.LLMProvider
+}
+
+func (m *meteredProvider) metered() {}
+
+func (m *meteredProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	start := time.Now()
+	resp, err := m.inner.Chat(ctx, messages, tools, model, options)
+	m.record(ctx, model, start, resp, err)
+	return resp, err
+}
+
+func (m *meteredProvider) GetDefaultModel() string {
+	return m.inner.GetDefaultModel()
+}
+
+func (m *meteredProvider) record(ctx context.Context, model string, start time.Time, resp *providers.LLMResponse, callErr error) {
+	if model == "" {
+		model = m.inner.GetDefaultModel()
+	}
+	info := CallInfoFromContext(ctx)
+	rec := Record{
+		Time:       start,
+		SessionKey: info.SessionKey,
+		Channel:    info.Channel,
+		ChatID:     info.ChatID,
+		SenderID:   info.SenderID,
+		Route:      info.Route,
+		JobID:      info.JobID,
+		Provider:   m.name,
+		Model:      model,
+		LatencyMS:  time.Since(start).Milliseconds(),
+	}
+	if resp != nil && resp.Usage != nil {
+		rec.PromptTokens = resp.Usage.PromptTokens
+		rec.CompletionTokens = resp.Usage.CompletionTokens
+		rec.TotalTokens = resp.Usage.TotalTokens
+	}
+	if callErr != nil {
+		rec.Error = callErr.Error()
+	}
+	if err := m.ledger.Append(rec); err != nil {
+		logger.WarnCF("usage", "usage.record_failed", map[string]interface{}{
+			"provider": m.name,
+			"model":    model,
+			"error":    err.Error(),
+		})
+	}
+}
+
+type meteredStreamingProvider struct {
+	*meteredProvider
+	stream providers.StreamingProvider
+}
+
+func (m *meteredStreamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}, onDelta providers.StreamHandler) (*providers.LLMResponse, error) {
+	start := time.Now()
+	resp, err := m.stream.ChatStream(ctx, messages, tools, model, options, onDelta)
+	m.record(ctx, model, start, resp, err)
+	return resp, err
+}
@@ -0,0 +1,111 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/providers"
+)
+
+type fakeProvider struct {
+	err error
+}
+
+func (f *fakeProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage:   &providers.UsageInfo{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+	}, nil
+}
+
+func (f *fakeProvider) GetDefaultModel() string { return "default-model" }
+
+type fakeStreamingProvider struct {
+	fakeProvider
+}
+
+func (f *fakeStreamingProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}, onDelta providers.StreamHandler) (*providers.LLMResponse, error) {
+	onDelta(providers.StreamDelta{Content: "ok"})
+	return f.Chat(ctx, messages, tools, model, opts)
+}
+
+func loadAll(t *testing.T, l *Ledger) []Record {
+	t.Helper()
+	now := time.Now()
+	recs, err := l.Load(now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return recs
+}
+
+func TestMeter_RecordsCallWithContext(t *testing.T) {
+	l := NewLedger(t.TempDir(), nil)
+	p := Meter(l, "DeepSeek", &fakeProvider{})
+
+	ctx := WithCallInfo(context.Background(), CallInfo{SessionKey: "telegram:1", Channel: "telegram", ChatID: "1", SenderID: "u1", Route: "CODE"})
+	ctx = WithJobID(ctx, "job_20261016_001")
+	if _, err := p.Chat(ctx, nil, nil, "", nil); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	recs := loadAll(t, l)
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	r := recs[0]
+	if r.Provider != "deepseek" || r.Model != "default-model" {
+		t.Errorf("provider/model = %s/%s", r.Provider, r.Model)
+	}
+	if r.Route != "CODE" || r.JobID != "job_20261016_001" || r.SenderID != "u1" || r.Channel != "telegram" {
+		t.Errorf("call info not recorded: %+v", r)
+	}
+	if r.PromptTokens != 12 || r.CompletionTokens != 3 || r.TotalTokens != 15 {
+		t.Errorf("tokens not recorded: %+v", r)
+	}
+}
+
+func TestMeter_RecordsErrors(t *testing.T) {
+	l := NewLedger(t.TempDir(), nil)
+	p := Meter(l, "ollama", &fakeProvider{err: errors.New("boom")})
+
+	if _, err := p.Chat(context.Background(), nil, nil, "m", nil); err == nil {
+		t.Fatal("expected error to pass through")
+	}
+	recs := loadAll(t, l)
+	if len(recs) != 1 || recs[0].Error != "boom" {
+		t.Fatalf("expected failed call to be recorded, got %+v", recs)
+	}
+}
+
+func TestMeter_KeepsStreaming(t *testing.T) {
+	l := NewLedger(t.TempDir(), nil)
+	p := Meter(l, "anthropic", &fakeStreamingProvider{})
+
+	sp, ok := p.(providers.StreamingProvider)
+	if !ok {
+		t.Fatal("metered streaming provider must still stream")
+	}
+	var got string
+	if _, err := sp.ChatStream(context.Background(), nil, nil, "m", nil, func(d providers.StreamDelta) { got += d.Content }); err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if got != "ok" || len(loadAll(t, l)) != 1 {
+		t.Errorf("expected delta and one record, got %q", got)
+	}
+
+	if _, ok := Meter(l, "ollama", &fakeProvider{}).(providers.StreamingProvider); ok {
+		t.Error("non-streaming provider must not become streaming")
+	}
+	if Meter(l, "anthropic", p) != p {
+		t.Error("metering twice should be a no-op")
+	}
+	if Meter(nil, "x", p) != p {
+		t.Error("nil ledger should return the provider unchanged")
+	}
+}
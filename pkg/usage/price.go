@@ -0,0 +1,49 @@
+package usage
+
+import (
+	"strings"
+
+	"github.com/Nyukimin/picoclaw_multiLLM/pkg/config"
+)
+
+// PriceTable maps "provider/model", "model" or "provider" to a USD price per
+// million tokens. Lookups are case-insensitive and try those keys in order,
+// so a bare provider key (e.g. "ollama") prices every model of that provider.
+type PriceTable map[string]config.ModelPrice
+
+// NewPriceTable normalizes the keys of a configured price map.
+func NewPriceTable(prices map[string]config.ModelPrice) PriceTable {
+	t := make(PriceTable, len(prices))
+	for k, v := range prices {
+		t[normalizeKey(k)] = v
+	}
+	return t
+}
+
+// Lookup returns the price for provider/model and whether one is configured.
+func (t PriceTable) Lookup(provider, model string) (config.ModelPrice, bool) {
+	provider = normalizeKey(provider)
+	model = normalizeKey(model)
+	for _, key := range []string{provider + "/" + model, model, provider} {
+		if key == "" || key == "/" {
+			continue
+		}
+		if p, ok := t[key]; ok {
+			return p, true
+		}
+	}
+	return config.ModelPrice{}, false
+}
+
+// Cost returns the USD cost of a call. Unpriced models cost 0.
+func (t PriceTable) Cost(provider, model string, promptTokens, completionTokens int) float64 {
+	p, ok := t.Lookup(provider, model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*p.InputPerMTok + float64(completionTokens)*p.OutputPerMTok) / 1e6
+}
+
+func normalizeKey(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
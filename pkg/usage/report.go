@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Totals aggregates a set of records.
+type Totals struct {
+	Calls            int     `json:"calls"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *Totals) add(r Record) {
+	t.Calls++
+	if r.Error != "" {
+		t.Errors++
+	}
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.TotalTokens += r.TotalTokens
+	t.CostUSD += r.CostUSD
+}
+
+// Group is the totals for one key (a route, channel, ...).
+type Group struct {
+	Key string `json:"key"`
+	Totals
+}
+
+// Summary is the usage for one period broken down by route, channel and provider.
+type Summary struct {
+	Label      string  `json:"label"`
+	Total      Totals  `json:"total"`
+	ByRoute    []Group `json:"by_route"`
+	ByChannel  []Group `json:"by_channel"`
+	ByProvider []Group `json:"by_provider"`
+}
+
+// Summarize aggregates records under label.
+func Summarize(label string, records []Record) Summary {
+	s := Summary{Label: label}
+	routes := map[string]*Totals{}
+	channels := map[string]*Totals{}
+	provs := map[string]*Totals{}
+	for _, r := range records {
+		s.Total.add(r)
+		addTo(routes, orDash(r.Route), r)
+		addTo(channels, orDash(r.Channel), r)
+		addTo(provs, orDash(r.Provider+"/"+r.Model), r)
+	}
+	s.ByRoute = sortedGroups(routes)
+	s.ByChannel = sortedGroups(channels)
+	s.ByProvider = sortedGroups(provs)
+	return s
+}
+
+// DaySummary summarizes the calendar day containing t.
+func (l *Ledger) DaySummary(t time.Time) (Summary, error) {
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	records, err := l.Load(from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return Summary{}, err
+	}
+	return Summarize(from.Format("2006-01-02"), records), nil
+}
+
+// MonthSummary summarizes the calendar month containing t.
+func (l *Ledger) MonthSummary(t time.Time) (Summary, error) {
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	records, err := l.Load(from, from.AddDate(0, 1, 0))
+	if err != nil {
+		return Summary{}, err
+	}
+	return Summarize(from.Format("2006-01"), records), nil
+}
+
+// Report returns the daily and monthly summaries for t as plain text.
+func (l *Ledger) Report(t time.Time) (string, error) {
+	day, err := l.DaySummary(t)
+	if err != nil {
+		return "", err
+	}
+	month, err := l.MonthSummary(t)
+	if err != nil {
+		return "", err
+	}
+	return FormatSummary(day) + "\n" + FormatSummary(month), nil
+}
+
+// FormatSummary renders s for chat and CLI output.
+func FormatSummary(s Summary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage %s: %s\n", s.Label, formatTotals(s.Total))
+	if s.Total.Calls == 0 {
+		return b.String()
+	}
+	writeGroups(&b, "route", s.ByRoute)
+	writeGroups(&b, "channel", s.ByChannel)
+	writeGroups(&b, "provider", s.ByProvider)
+	return b.String()
+}
+
+func writeGroups(b *strings.Builder, title string, groups []Group) {
+	fmt.Fprintf(b, "  by %s:\n", title)
+	for _, g := range groups {
+		fmt.Fprintf(b, "    %-20s %s\n", g.Key, formatTotals(g.Totals))
+	}
+}
+
+func formatTotals(t Totals) string {
+	line := fmt.Sprintf("%d calls, %d tokens (in %d / out %d), $%.4f",
+		t.Calls, t.TotalTokens, t.PromptTokens, t.CompletionTokens, t.CostUSD)
+	if t.Errors > 0 {
+		line += fmt.Sprintf(", %d errors", t.Errors)
+	}
+	return line
+}
+
+func addTo(m map[string]*Totals, key string, r Record) {
+	t, ok := m[key]
+	if !ok {
+		t = &Totals{}
+		m[key] = t
+	}
+	t.add(r)
+}
+
+// sortedGroups orders groups by cost, then tokens, then key.
+func sortedGroups(m map[string]*Totals) []Group {
+	out := make([]Group, 0, len(m))
+	for k, t := range m {
+		out = append(out, Group{Key: k, Totals: *t})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CostUSD != out[j].CostUSD {
+			return out[i].CostUSD > out[j].CostUSD
+		}
+		if out[i].TotalTokens != out[j].TotalTokens {
+			return out[i].TotalTokens > out[j].TotalTokens
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func orDash(s string) string {
+	if strings.Trim(s, "/") == "" {
+		return "-"
+	}
+	return s
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,6 +47,14 @@ func SanitizeFilename(filename string) string {
 	return base
 }
 
+var downloadTransport atomic.Value // *http.RoundTripper
+
+// SetDownloadTransport sets the transport DownloadFile uses, e.g. one that
+// enforces the tools egress policy.
+func SetDownloadTransport(rt http.RoundTripper) {
+	downloadTransport.Store(&rt)
+}
+
 // DownloadOptions holds optional parameters for downloading files
 type DownloadOptions struct {
 	Timeout      time.Duration
@@ -91,6 +100,9 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 	}
 
 	client := &http.Client{Timeout: opts.Timeout}
+	if rt, ok := downloadTransport.Load().(*http.RoundTripper); ok {
+		client.Transport = *rt
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to download file", map[string]interface{}{